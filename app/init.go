@@ -5,6 +5,7 @@ import (
 
 	"github.com/benjamw/gogame/config"
 	gttp "github.com/benjamw/gogame/http"
+	"github.com/benjamw/gogame/ratelimit"
 
 	// instead of adding all the endpoints here
 	// add them to the initializer so `app` can be imported
@@ -16,5 +17,13 @@ import (
 func init() {
 	config.SetRoot(".")
 
+	// fail fast instead of on the first request that needs a missing setting
+	if err := config.Get().Validate(); err != nil {
+		panic(err)
+	}
+
+	// every instance shares the chat rate limits
+	ratelimit.Default = ratelimit.Memcache{}
+
 	http.Handle("/", gttp.R)
 }
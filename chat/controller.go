@@ -2,41 +2,48 @@ package chat
 
 import (
 	"context"
+	"net/http"
 	"strconv"
 	"time"
 
-	"github.com/benjamw/gogame/config"
 	"github.com/benjamw/golibs/db"
 	"google.golang.org/appengine/datastore"
 
+	"github.com/benjamw/gogame/config"
+	"github.com/benjamw/gogame/game"
 	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
 )
 
 // AddChat adds the given message from the given player to the given room
 func AddChat(ctx context.Context, roomID, playerID, message string) (chat model.Chat, myerr error) {
-	rID, myerr := strconv.ParseInt(roomID, 10, 64)
+	room, myerr := findRoom(ctx, roomID)
 	if myerr != nil {
-		return
-	}
-
-	var room model.Room
-	if _, myerr = db.LoadInt(ctx, rID, &room); myerr != nil {
-		if rID != 0 {
+		if _, ok := myerr.(*db.UnfoundObjectError); !ok || roomID != "0" {
 			return
 		}
 
 		// lobby wasn't found. make the lobby
 		room = model.Room{
 			ID:   0,
-			Name: config.SiteName + " Lobby",
+			Name: config.FromContext(ctx).SiteName + " Lobby",
+			Type: model.RoomLobby,
 		}
-		if myerr = db.Save(ctx, &room); myerr != nil {
+		if myerr = store.Save(ctx, &room); myerr != nil {
 			return
 		}
 	}
 
 	var player model.Player
-	if _, myerr = db.LoadS(ctx, playerID, &player); myerr != nil {
+	if myerr = store.LoadS(ctx, playerID, &player); myerr != nil {
+		return
+	}
+
+	if myerr = checkMember(ctx, player.GetKey(), room); myerr != nil {
+		return
+	}
+
+	if myerr = checkSanctions(ctx, player.GetKey(), room, model.SanctionSilence, model.SanctionBan); myerr != nil {
 		return
 	}
 
@@ -46,56 +53,236 @@ func AddChat(ctx context.Context, roomID, playerID, message string) (chat model.
 		Message:   message,
 	}
 
-	if myerr = db.Save(ctx, &c); myerr != nil {
+	if myerr = validate(ctx, room, &c); myerr != nil {
+		return
+	}
+
+	// only chats that will be posted use up the rate limits
+	if myerr = checkRate(ctx, player.GetKey(), room); myerr != nil {
+		return
+	}
+
+	if myerr = store.Save(ctx, &c); myerr != nil {
 		return
 	}
 
+	// the chat is saved, so a failed push only delays it until the streams reconnect
+	if err := publishChat(ctx, c); err != nil {
+		game.Errorf(ctx, "Could not publish the chat: %v", err)
+	}
+
+	queueMentions(ctx, c, "")
+
 	chat = c
 
 	return
 }
 
-// GetChats gets all the chats for the given room
-func GetChats(ctx context.Context, roomID string) (room model.Room, chats model.ChatList, myerr error) {
-	rID, myerr := strconv.ParseInt(roomID, 10, 64)
-	if myerr != nil {
+// DefaultLimit is the number of chats in a page when no limit is given
+const DefaultLimit = 50
+
+// MaxLimit is the most chats returned in one page
+const MaxLimit = 200
+
+// Page selects a page of the chats in a room
+// Before and After are chat cursors, and only one of them may be given
+type Page struct {
+	Limit        int    // the most chats returned, DefaultLimit if not set
+	Before       string // return the chats older than this cursor, reading back through the room
+	After        string // return the chats newer than this cursor, reading forward through the room
+	IncludeMuted bool   // return the chats from muted players, marked as Muted, instead of leaving them out
+}
+
+// GetChats gets a page of the chats for the given room, newest first, as seen by the given player,
+// and the cursor to pass in the same direction for the next page, which is empty if there are no more chats
+func GetChats(ctx context.Context, roomID, playerID string, page Page) (room model.Room, chats model.ChatList, next string, myerr error) {
+	return getChatPage(ctx, roomID, playerID, time.Time{}, page)
+}
+
+// GetChatsAfter gets a page of the chats for the given room that came in at or after the given time, newest first,
+// as seen by the given player, and the cursor to pass as After for the next page
+func GetChatsAfter(ctx context.Context, roomID, playerID string, after time.Time, page Page) (room model.Room, chats model.ChatList, next string, myerr error) {
+	return getChatPage(ctx, roomID, playerID, after, page)
+}
+
+// getChatPage gets a page of the chats for the given room, reading forward from since if it is set
+func getChatPage(ctx context.Context, roomID, playerID string, since time.Time, page Page) (room model.Room, chats model.ChatList, next string, myerr error) {
+	if page.Limit < 0 || MaxLimit < page.Limit {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Invalid limit: %d (at most %d)", page.Limit, MaxLimit)
 		return
 	}
 
-	if _, myerr = db.LoadInt(ctx, rID, &room); myerr != nil {
+	if page.Limit == 0 {
+		page.Limit = DefaultLimit
+	}
+
+	if page.Before != "" && page.After != "" {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Only one of before and after may be given")
 		return
 	}
 
-	if myerr = chats.ByRoomID(ctx, room.GetKey().IntID()); myerr != nil {
-		chats = model.ChatList{}
+	var before, after model.ChatPosition
+	if page.Before != "" {
+		if before.Created, before.Key, myerr = model.ParseChatCursor(page.Before); myerr != nil {
+			myerr = game.NewUserError(myerr, http.StatusBadRequest, "Invalid cursor: %s", page.Before)
+			return
+		}
+	} else if page.After != "" {
+		if after.Created, after.Key, myerr = model.ParseChatCursor(page.After); myerr != nil {
+			myerr = game.NewUserError(myerr, http.StatusBadRequest, "Invalid cursor: %s", page.After)
+			return
+		}
+	} else if !since.IsZero() {
+		// the time is inclusive, and pages are read past the time
+		after.Created = since.Truncate(time.Microsecond).Add(-time.Microsecond)
+	}
 
+	if room, myerr = findRoom(ctx, roomID); myerr != nil {
 		return
 	}
 
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	if myerr = checkMember(ctx, playerKey, room); myerr != nil {
+		return
+	}
+
+	if myerr = checkSanctions(ctx, playerKey, room, model.SanctionBan); myerr != nil {
+		return
+	}
+
+	// chats past the room's retention policy are no longer shown, even before they are purged
+	cutoff := room.Cutoff(ctx)
+
+	if !cutoff.IsZero() && !after.Created.IsZero() && after.Created.Before(cutoff) {
+		after = model.ChatPosition{Created: cutoff.Add(-time.Microsecond)}
+	}
+
+	var more bool
+	if more, myerr = chats.ByRoomPage(ctx, room.GetKey(), before, after, page.Limit); myerr != nil {
+		return
+	}
+
+	var expired bool
+	if chats, expired = retained(chats, cutoff); expired {
+		more = false
+	}
+
+	// reading the room moves the player's read marker up to the newest chat read
+	if len(chats) != 0 {
+		if err := markSeen(ctx, playerKey, room, chats[0].Created); err != nil {
+			game.Errorf(ctx, "Could not mark the chats as seen: %v", err)
+		}
+	}
+
+	// the cursor comes from the whole page, so the chats left out don't end the paging early
+	if more && len(chats) != 0 {
+		// the chats are newest first
+		if after.Created.IsZero() {
+			next = chats[len(chats)-1].Cursor()
+		} else {
+			next = chats[0].Cursor()
+		}
+	}
+
+	if chats, myerr = applyMutes(ctx, playerID, room, chats, page.IncludeMuted); myerr != nil {
+		return
+	}
+
+	myerr = chats.LoadReactions(ctx)
+
 	return
 }
 
-// GetChatsAfter gets all the chats for the given room after the given time
-func GetChatsAfter(ctx context.Context, roomID string, after time.Time) (room model.Room, chats model.ChatList, myerr error) {
-	rID, myerr := strconv.ParseInt(roomID, 10, 64)
+// retained returns the chats that are not older than the cutoff, and true if any were left out
+func retained(chats model.ChatList, cutoff time.Time) (kept model.ChatList, expired bool) {
+	if cutoff.IsZero() {
+		return chats, false
+	}
+
+	kept = make(model.ChatList, 0, len(chats))
+	for _, v := range chats {
+		if v.Created.Before(cutoff) {
+			expired = true
+			continue
+		}
+
+		kept = append(kept, v)
+	}
+
+	return
+}
+
+// applyMutes marks the chats from players the given player has muted in the room,
+// and leaves them out unless includeMuted is set
+func applyMutes(ctx context.Context, playerID string, room model.Room, chats model.ChatList, includeMuted bool) (shown model.ChatList, myerr error) {
+	muted, myerr := mutedKeys(ctx, playerID, room)
 	if myerr != nil {
 		return
 	}
 
-	if _, myerr = db.LoadInt(ctx, rID, &room); myerr != nil {
-		return
+	shown = hideMuted(chats, muted, includeMuted)
+
+	return
+}
+
+// hideMuted marks the chats from the muted players, leaving them out unless includeMuted is set
+func hideMuted(chats model.ChatList, muted map[string]bool, includeMuted bool) (shown model.ChatList) {
+	shown = make(model.ChatList, 0, len(chats))
+	for _, v := range chats {
+		v.Muted = muted[v.AuthorID()]
+		if v.Muted && !includeMuted {
+			continue
+		}
+
+		shown = append(shown, v)
 	}
 
-	if myerr = chats.ByRoomIDAfter(ctx, room.GetKey().IntID(), after); myerr != nil {
-		chats = model.ChatList{}
+	return
+}
+
+// Scope is where a mute applies: a room, a game, or the whole site if both IDs are empty
+type Scope struct {
+	RoomID string
+	GameID string
+}
 
+// key returns the key of the room or game in the scope, or nil for the whole site
+func (s Scope) key(ctx context.Context) (key *datastore.Key, myerr error) {
+	if s.RoomID != "" && s.GameID != "" {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Only one of room_id and game_id may be given")
 		return
 	}
 
+	switch {
+	case s.RoomID != "":
+		var room model.Room
+		if room, myerr = findRoom(ctx, s.RoomID); myerr != nil {
+			return
+		}
+
+		key = room.GetKey()
+	case s.GameID != "":
+		var id int64
+		if id, myerr = strconv.ParseInt(s.GameID, 10, 64); myerr != nil {
+			return
+		}
+
+		var g model.Game
+		if myerr = g.ByID(ctx, id); myerr != nil {
+			return
+		}
+
+		key = g.GetKey()
+	}
+
 	return
 }
 
-// GetMuted returns a list of all the players the given player has muted
+// GetMuted returns a list of all the active mutes the given player has set
 func GetMuted(ctx context.Context, playerID string) (mutes model.MuteList, myerr error) {
 	var playerKey *datastore.Key
 	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
@@ -107,52 +294,170 @@ func GetMuted(ctx context.Context, playerID string) (mutes model.MuteList, myerr
 		return
 	}
 
-	mutes = ml
+	now := game.Now(ctx)
+
+	mutes = make(model.MuteList, 0, len(ml))
+	for _, v := range ml {
+		if v.Active(now) {
+			mutes = append(mutes, v)
+		}
+	}
 
 	return
 }
 
-// Mute the given player
-func Mute(ctx context.Context, playerID, mutedID string) (mute model.Mute, myerr error) {
-	var playerKey, mutedKey *datastore.Key
+// Mute the given player in the given scope, for the given duration if it is not zero
+// A mute replaces any mute or exemption the player already has for the muted player in the scope
+func Mute(ctx context.Context, playerID, mutedID string, scope Scope, duration time.Duration) (mute model.Mute, myerr error) {
+	var playerKey, mutedKey, scopeKey *datastore.Key
 	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
 		return
 	}
 	if mutedKey, myerr = datastore.DecodeKey(mutedID); myerr != nil {
 		return
 	}
+	if scopeKey, myerr = scope.key(ctx); myerr != nil {
+		return
+	}
+
+	if duration < 0 {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Invalid duration: %v", duration)
+		return
+	}
+
+	var ml model.MuteList
+	if _, myerr = ml.ByPlayer(ctx, playerKey); myerr != nil {
+		return
+	}
 
 	m := model.Mute{
 		PlayerKey: playerKey,
 		MutedKey:  mutedKey,
+		ScopeKey:  scopeKey,
 	}
-	if myerr = db.Save(ctx, &m); myerr != nil {
+	if found, ok := ml.Find(mutedKey, scopeKey); ok {
+		m = *found
+	}
+
+	m.Exempt = false
+	m.Expires = time.Time{}
+	if duration > 0 {
+		m.Expires = game.Now(ctx).Add(duration)
+	}
+
+	if myerr = store.Save(ctx, &m); myerr != nil {
 		return
 	}
 
+	publishMutes(ctx, playerKey)
+
 	mute = m
 
 	return
 }
 
-// Unmute the given player
-func Unmute(ctx context.Context, playerID, mutedID string) (myerr error) {
-	var playerKey, mutedKey *datastore.Key
+// Unmute the given player in the given scope
+// Unmuting for the whole site removes every mute of the player
+// Unmuting in a room or game that a broader mute still covers adds an exemption,
+// lasting for the given duration if it is not zero
+func Unmute(ctx context.Context, playerID, mutedID string, scope Scope, duration time.Duration) (myerr error) {
+	var playerKey, mutedKey, scopeKey *datastore.Key
 	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
 		return
 	}
 	if mutedKey, myerr = datastore.DecodeKey(mutedID); myerr != nil {
 		return
 	}
+	if scopeKey, myerr = scope.key(ctx); myerr != nil {
+		return
+	}
+
+	if duration < 0 {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Invalid duration: %v", duration)
+		return
+	}
 
 	var ml model.MuteList
+	if _, myerr = ml.ByPlayer(ctx, playerKey); myerr != nil {
+		return
+	}
 
-	ml.ByPlayer(ctx, playerKey)
+	remaining := make(model.MuteList, 0, len(ml))
+	for k := range ml {
+		if !ml[k].MutedKey.Equal(mutedKey) {
+			continue
+		}
 
-	for _, v := range ml {
-		if v.MutedKey == mutedKey {
-			myerr = db.Delete(ctx, &v)
-			break
+		if scopeKey == nil || ml[k].ScopeKey.Equal(scopeKey) {
+			if myerr = store.Delete(ctx, &ml[k]); myerr != nil {
+				return
+			}
+
+			continue
+		}
+
+		remaining = append(remaining, ml[k])
+	}
+
+	if scopeKey != nil && broaderMute(ctx, remaining, mutedKey, scopeKey) {
+		exempt := model.Mute{
+			PlayerKey: playerKey,
+			MutedKey:  mutedKey,
+			ScopeKey:  scopeKey,
+			Exempt:    true,
+		}
+		if duration > 0 {
+			exempt.Expires = game.Now(ctx).Add(duration)
+		}
+
+		if myerr = store.Save(ctx, &exempt); myerr != nil {
+			return
+		}
+	}
+
+	publishMutes(ctx, playerKey)
+
+	return
+}
+
+// broaderMute returns true if a mute of the muted player covers the scope from a broader scope
+func broaderMute(ctx context.Context, ml model.MuteList, mutedKey, scopeKey *datastore.Key) bool {
+	now := game.Now(ctx)
+
+	var m *model.Mute
+	var ok bool
+	if scopeKey.Kind() == new(model.Room).EntityType() {
+		// the room's own scope has no entries left, so the most specific mute is a broader one
+		room := model.Room{ID: scopeKey.IntID()}
+		room.SetKey(scopeKey)
+		m, ok = ml.Applies(ctx, mutedKey, room, now)
+	} else if m, ok = ml.Find(mutedKey, nil); ok {
+		ok = m.Active(now)
+	}
+
+	return ok && !m.Exempt
+}
+
+// mutedKeys returns the set of the encoded keys of the players the player has muted in the room
+func mutedKeys(ctx context.Context, playerID string, room model.Room) (muted map[string]bool, myerr error) {
+	mutes, myerr := GetMuted(ctx, playerID)
+	if myerr != nil {
+		return
+	}
+
+	muted = mutedIn(ctx, mutes, room)
+
+	return
+}
+
+// mutedIn returns the set of the encoded keys of the players muted in the room by the given mutes
+func mutedIn(ctx context.Context, mutes model.MuteList, room model.Room) (muted map[string]bool) {
+	now := game.Now(ctx)
+
+	muted = make(map[string]bool, len(mutes))
+	for _, v := range mutes {
+		if m, ok := mutes.Applies(ctx, v.MutedKey, room, now); ok && !m.Exempt {
+			muted[v.MutedKey.Encode()] = true
 		}
 	}
 
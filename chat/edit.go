@@ -0,0 +1,240 @@
+package chat
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+)
+
+// EditWindow is how long after posting a chat its author can edit it
+const EditWindow = 15 * time.Minute
+
+// maxEmojiLength is the most runes in a reaction, enough for emoji built from several code points
+const maxEmojiLength = 8
+
+// EditChat replaces the message of the given chat, keeping the old message in the chat's edit history
+// Only the author can edit a chat, and only within EditWindow of posting it
+func EditChat(ctx context.Context, playerID, chatID, message string) (chat model.Chat, myerr error) {
+	chat, playerKey, room, myerr := loadChat(ctx, playerID, chatID)
+	if myerr != nil {
+		return
+	}
+
+	if myerr = checkSanctions(ctx, playerKey, room, model.SanctionSilence, model.SanctionBan); myerr != nil {
+		return
+	}
+
+	if !chat.PlayerKey.Equal(playerKey) {
+		myerr = game.NewUserError(nil, http.StatusForbidden, "You can only edit your own chats")
+		return
+	}
+
+	if chat.IsDeleted() {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "That chat was deleted")
+		return
+	}
+
+	now := game.Now(ctx)
+	if now.Sub(chat.Created) > EditWindow {
+		myerr = game.NewUserError(nil, http.StatusForbidden, "Chats can only be edited for %s after posting", EditWindow)
+		return
+	}
+
+	edited := chat
+	edited.Message = message
+	if myerr = validate(ctx, room, &edited); myerr != nil {
+		return
+	}
+
+	if edited.Message == chat.Message {
+		return
+	}
+
+	edit := model.ChatEdit{
+		ChatKey: chat.GetKey(),
+		Message: chat.Message,
+		Edited:  now,
+	}
+	if myerr = store.Save(ctx, &edit); myerr != nil {
+		return
+	}
+
+	edited.Edited = now
+	if myerr = store.Save(ctx, &edited); myerr != nil {
+		return
+	}
+
+	publishUpdate(ctx, edited)
+
+	// players mentioned before the edit were already told
+	queueMentions(ctx, edited, chat.Message)
+
+	chat = edited
+
+	return
+}
+
+// DeleteChat deletes the given chat, keeping it so the room shows where it was
+// Authors can delete their own chats, and admins can delete any chat
+func DeleteChat(ctx context.Context, playerID, chatID string) (chat model.Chat, myerr error) {
+	chat, playerKey, _, myerr := loadChat(ctx, playerID, chatID)
+	if myerr != nil {
+		return
+	}
+
+	if chat.IsDeleted() {
+		return
+	}
+
+	if !chat.PlayerKey.Equal(playerKey) {
+		if _, myerr = loadAdmin(ctx, playerID); myerr != nil {
+			myerr = game.NewUserError(myerr, http.StatusForbidden, "You can only delete your own chats")
+			return
+		}
+	}
+
+	chat.Deleted = game.Now(ctx)
+	chat.DeleterKey = playerKey
+	if myerr = store.Save(ctx, &chat); myerr != nil {
+		return
+	}
+
+	publishUpdate(ctx, chat)
+
+	return
+}
+
+// GetEdits returns the edit history of the given chat, oldest first
+// The history of a deleted chat is only shown to admins
+func GetEdits(ctx context.Context, playerID, chatID string) (chat model.Chat, edits model.ChatEditList, myerr error) {
+	chat, _, _, myerr = loadChat(ctx, playerID, chatID)
+	if myerr != nil {
+		return
+	}
+
+	if chat.IsDeleted() {
+		if _, myerr = loadAdmin(ctx, playerID); myerr != nil {
+			myerr = game.NewUserError(myerr, http.StatusNotFound, "That chat was deleted")
+			return
+		}
+	}
+
+	myerr = edits.ByChat(ctx, chat.GetKey())
+
+	return
+}
+
+// React adds the player's reaction to the given chat with the given emoji
+func React(ctx context.Context, playerID, chatID, emoji string) (reaction model.Reaction, myerr error) {
+	chat, playerKey, room, myerr := loadChat(ctx, playerID, chatID)
+	if myerr != nil {
+		return
+	}
+
+	if myerr = checkSanctions(ctx, playerKey, room, model.SanctionSilence, model.SanctionBan); myerr != nil {
+		return
+	}
+
+	if chat.IsDeleted() {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "That chat was deleted")
+		return
+	}
+
+	if !validEmoji(emoji) {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Invalid emoji: %s", emoji)
+		return
+	}
+
+	var r model.Reaction
+	if myerr = r.ByChat(ctx, chat.GetKey(), playerKey, emoji); myerr == nil {
+		reaction = r
+		return
+	} else if _, ok := myerr.(*db.UnfoundObjectError); !ok {
+		return
+	}
+
+	r = model.Reaction{
+		ChatKey:   chat.GetKey(),
+		PlayerKey: playerKey,
+		Emoji:     emoji,
+	}
+	if myerr = store.Save(ctx, &r); myerr != nil {
+		return
+	}
+
+	publishUpdate(ctx, chat)
+
+	reaction = r
+
+	return
+}
+
+// Unreact removes the player's reaction to the given chat with the given emoji
+func Unreact(ctx context.Context, playerID, chatID, emoji string) (myerr error) {
+	chat, playerKey, _, myerr := loadChat(ctx, playerID, chatID)
+	if myerr != nil {
+		return
+	}
+
+	var r model.Reaction
+	if myerr = r.ByChat(ctx, chat.GetKey(), playerKey, emoji); myerr != nil {
+		if _, ok := myerr.(*db.UnfoundObjectError); ok {
+			myerr = nil
+		}
+
+		return
+	}
+
+	if myerr = store.Delete(ctx, &r); myerr != nil {
+		return
+	}
+
+	publishUpdate(ctx, chat)
+
+	return
+}
+
+// loadChat loads the chat with the given ID and its room,
+// and returns an error if the player can't read the room
+func loadChat(ctx context.Context, playerID, chatID string) (chat model.Chat, playerKey *datastore.Key, room model.Room, myerr error) {
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	if myerr = store.LoadS(ctx, chatID, &chat); myerr != nil {
+		return
+	}
+
+	if myerr = store.Load(ctx, chat.RoomKey, &room); myerr != nil {
+		return
+	}
+
+	if myerr = checkMember(ctx, playerKey, room); myerr != nil {
+		return
+	}
+
+	myerr = checkSanctions(ctx, playerKey, room, model.SanctionBan)
+
+	return
+}
+
+// validEmoji returns true if the reaction is a short run of symbols, without ASCII, letters or spaces
+func validEmoji(emoji string) bool {
+	if emoji == "" || utf8.RuneCountInString(emoji) > maxEmojiLength {
+		return false
+	}
+
+	return strings.IndexFunc(emoji, func(r rune) bool {
+		return r < utf8.RuneSelf || unicode.IsSpace(r) || unicode.IsLetter(r)
+	}) == -1
+}
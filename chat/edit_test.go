@@ -0,0 +1,120 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+	"github.com/benjamw/gogame/store/storetest"
+)
+
+func TestEditChat(t *testing.T) {
+	ctx := storetest.NewContext()
+	now := time.Now()
+
+	author, other := storetest.SavePlayer(ctx, t), storetest.SavePlayer(ctx, t)
+	authorID, otherID := author.GetKey().Encode(), other.GetKey().Encode()
+	room := storetest.SaveRoom(ctx, t, author, other)
+
+	chat := postChat(game.SetNow(ctx, now), t, room, author, "frist")
+	chatID := chat.GetKey().Encode()
+
+	if _, err := EditChat(ctx, otherID, chatID, "mine now"); err == nil {
+		t.Fatal("EditChat did not throw an error for a player who is not the author.")
+	}
+
+	edited, err := EditChat(game.SetNow(ctx, now.Add(time.Minute)), authorID, chatID, "first")
+	if err != nil {
+		t.Fatalf("EditChat threw an error: %v", err)
+	}
+	if edited.Message != "first" || edited.Edited.IsZero() {
+		t.Fatalf("EditChat did not edit the chat. Got: %+v", edited)
+	}
+
+	if _, err = EditChat(game.SetNow(ctx, now.Add(EditWindow+time.Second)), authorID, chatID, "late"); err == nil {
+		t.Fatal("EditChat did not throw an error past the edit window.")
+	}
+
+	_, edits, err := GetEdits(ctx, otherID, chatID)
+	if err != nil {
+		t.Fatalf("GetEdits threw an error: %v", err)
+	}
+	if len(edits) != 1 || edits[0].Message != "frist" {
+		t.Fatalf("GetEdits returned the wrong history. Got: %+v", edits)
+	}
+
+	if _, err = React(ctx, otherID, chatID, "a"); err == nil {
+		t.Fatal("React did not throw an error for an invalid emoji.")
+	}
+	for _, v := range []string{authorID, otherID, otherID} {
+		if _, err = React(ctx, v, chatID, "👍"); err != nil {
+			t.Fatalf("React threw an error: %v", err)
+		}
+	}
+	if _, err = React(ctx, otherID, chatID, "🎉"); err != nil {
+		t.Fatalf("React threw an error: %v", err)
+	}
+	if err = Unreact(ctx, otherID, chatID, "🎉"); err != nil {
+		t.Fatalf("Unreact threw an error: %v", err)
+	}
+
+	roomID := room.GetKey().Encode()
+	_, chats, _, err := GetChats(ctx, roomID, otherID, Page{})
+	if err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	var reply Reply
+	reply.Set(chats[0])
+	if !reply.Edited || reply.Message != "first" || len(reply.Reactions) != 1 || reply.Reactions["👍"] != 2 {
+		t.Fatalf("GetChats returned the wrong chat state. Got: %+v", reply)
+	}
+
+	if _, err = DeleteChat(ctx, otherID, chatID); err == nil {
+		t.Fatal("DeleteChat did not throw an error for a player who is not the author.")
+	}
+	if _, err = DeleteChat(ctx, authorID, chatID); err != nil {
+		t.Fatalf("DeleteChat threw an error: %v", err)
+	}
+
+	if _, chats, _, err = GetChats(ctx, roomID, otherID, Page{}); err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	reply.Set(chats[0])
+	if !reply.Deleted || reply.Message != "" || reply.Reactions != nil {
+		t.Fatalf("GetChats returned the wrong deleted chat state. Got: %+v", reply)
+	}
+
+	if _, _, err = GetEdits(ctx, otherID, chatID); err == nil {
+		t.Fatal("GetEdits did not throw an error for a deleted chat.")
+	}
+
+	admin := storetest.SavePlayer(ctx, t)
+	admin.IsAdmin = true
+	if err = store.Save(ctx, &admin); err != nil {
+		t.Fatalf("Could not save the test admin: %v", err)
+	}
+
+	spam := postChat(ctx, t, room, other, "spam")
+	deleted, err := DeleteChat(ctx, admin.GetKey().Encode(), spam.GetKey().Encode())
+	if err != nil {
+		t.Fatalf("DeleteChat threw an error: %v", err)
+	}
+	if !deleted.IsDeleted() || !deleted.DeleterKey.Equal(admin.GetKey()) {
+		t.Fatalf("DeleteChat did not delete the chat. Got: %+v", deleted)
+	}
+
+	// hard deleting a chat takes its history and reactions with it
+	if err = store.Delete(ctx, &chats[0]); err != nil {
+		t.Fatalf("store.Delete threw an error: %v", err)
+	}
+
+	var left model.ReactionList
+	if err = left.ByChat(ctx, chat.GetKey()); err != nil {
+		t.Fatalf("ReactionList.ByChat threw an error: %v", err)
+	}
+	if len(left) != 0 {
+		t.Fatalf("Deleting the chat left its reactions. Got: %d", len(left))
+	}
+}
@@ -2,27 +2,93 @@ package chat
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/benjamw/gogame/game"
 	gttp "github.com/benjamw/gogame/http"
 	"github.com/benjamw/gogame/model"
 	"github.com/benjamw/gogame/session"
 )
 
 func init() {
-	gttp.R.Path("/room/{id:[0-9]+}").
+	gttp.R.Path("/room/{id}").
 		Methods("POST").
 		Handler(&gttp.PlayerJSONHandler{handleAdd})
 
-	gttp.R.Path("/room/{id:[0-9]+}").
+	gttp.R.Path("/room/{id}").
 		Methods("GET").
 		Handler(&gttp.PlayerJSONHandler{handleRead})
 
-	gttp.R.Path("/room/{id:[0-9]+}/after/{time:[0-9]+}").
+	gttp.R.Path("/room/{id}/after/{time:[0-9]+}").
 		Methods("GET").
 		Handler(&gttp.PlayerJSONHandler{handleLatest})
 
+	gttp.R.Path("/room/{id}/stream").
+		Methods("GET").
+		Handler(&gttp.PlayerBlankHandler{handleStream})
+
+	gttp.R.Path("/room/{id}/seen").
+		Methods("GET").
+		Handler(&gttp.PlayerJSONHandler{handleSeen})
+
+	gttp.R.Path("/room/{id}/retention").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleRetention})
+
+	gttp.R.Path("/room/{id}/members").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleAddMember})
+
+	gttp.R.Path("/room/{id}/members").
+		Methods("GET").
+		Handler(&gttp.PlayerJSONHandler{handleMembers})
+
+	gttp.R.Path("/room/{id}/export").
+		Methods("GET").
+		Handler(&gttp.PlayerBlankHandler{handleExport})
+
+	gttp.R.Path("/room/{id}/search").
+		Methods("GET").
+		Handler(&gttp.PlayerJSONHandler{handleSearch})
+
+	gttp.R.Path("/rooms").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleCreateGroup})
+
+	gttp.R.Path("/rooms").
+		Methods("GET").
+		Handler(&gttp.PlayerJSONHandler{handleRooms})
+
+	gttp.R.Path("/direct").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleDirect})
+
+	gttp.R.Path("/notifications").
+		Methods("GET").
+		Handler(&gttp.PlayerJSONHandler{handleNotifications})
+
+	gttp.R.Path("/notifications/read").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleMarkRead})
+
+	gttp.R.Path("/notifications/settings").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleNotify})
+
+	gttp.R.Path("/tasks/purge").
+		Methods("GET").
+		Handler(&gttp.JSONHandler{handlePurge})
+
+	gttp.R.Path("/unread").
+		Methods("GET").
+		Handler(&gttp.PlayerJSONHandler{handleUnread})
+
 	gttp.R.Path("/muted").
 		Methods("GET").
 		Handler(&gttp.PlayerJSONHandler{handleMuted})
@@ -34,23 +100,77 @@ func init() {
 	gttp.R.Path("/unmute").
 		Methods("POST").
 		Handler(&gttp.PlayerJSONHandler{handleUnmute})
+
+	gttp.R.Path("/sanction").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleSanction})
+
+	gttp.R.Path("/sanctions").
+		Methods("GET").
+		Handler(&gttp.PlayerJSONHandler{handleSanctions})
+
+	gttp.R.Path("/sanction/{id}/lift").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleLift})
+
+	gttp.R.Path("/chat/{id}/edit").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleEdit})
+
+	gttp.R.Path("/chat/{id}/edits").
+		Methods("GET").
+		Handler(&gttp.PlayerJSONHandler{handleEdits})
+
+	gttp.R.Path("/chat/{id}/delete").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleDelete})
+
+	gttp.R.Path("/chat/{id}/react").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleReact})
+
+	gttp.R.Path("/chat/{id}/unreact").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleUnreact})
 }
 
 type Reply struct {
 	gttp.Response
-	ChatID   string    `json:"chat_id"`
-	RoomID   string    `json:"room_id"`
-	PlayerID string    `json:"player_id"`
-	Message  string    `json:"message"`
-	Created  time.Time `json:"created"`
+	ChatID    string          `json:"chat_id"`
+	RoomID    string          `json:"room_id"`
+	PlayerID  string          `json:"player_id"`
+	Type      string          `json:"type"`
+	Event     string          `json:"event,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Message   string          `json:"message"`
+	Created   time.Time       `json:"created"`
+	Cursor    string          `json:"cursor"`
+	Muted     bool            `json:"muted,omitempty"`
+	Edited    bool            `json:"edited,omitempty"`
+	Deleted   bool            `json:"deleted,omitempty"`
+	Reactions map[string]int  `json:"reactions,omitempty"`
 }
 
 func (r *Reply) Set(m model.Chat) {
 	r.ChatID = m.GetKey().Encode()
 	r.RoomID = m.RoomKey.Encode()
-	r.PlayerID = m.PlayerKey.Encode()
+	r.PlayerID = m.AuthorID()
+	r.Type = m.ChatType()
+	r.Event = m.Event
+	r.Data = json.RawMessage(m.Data)
 	r.Message = m.Message
 	r.Created = m.Created
+	r.Cursor = m.Cursor()
+	r.Muted = m.Muted
+	r.Edited = !m.Edited.IsZero()
+	r.Deleted = m.IsDeleted()
+	r.Reactions = m.Reactions
+
+	// deleted chats only show where they were
+	if r.Deleted {
+		r.Message = ""
+		r.Reactions = nil
+	}
 }
 
 func handleAdd(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
@@ -82,14 +202,21 @@ func handleAdd(ctx context.Context, s session.Data, w http.ResponseWriter, r *ht
 
 type RoomReply struct {
 	gttp.Response
-	RoomID string  `json:"room_id"`
-	Name   string  `json:"name"`
-	Chats  []Reply `json:"chats"`
+	RoomID     string  `json:"room_id"`
+	Name       string  `json:"name"`
+	Type       string  `json:"type"`
+	KeepLast   int64   `json:"keep_last,omitempty"`
+	MaxAge     int64   `json:"max_age,omitempty"`
+	Chats      []Reply `json:"chats"`
+	NextCursor string  `json:"next_cursor"`
 }
 
 func (r *RoomReply) Set(m model.Room) {
 	r.RoomID = m.GetKey().Encode()
 	r.Name = m.Name
+	r.Type = m.RoomType()
+	r.KeepLast = m.KeepLast
+	r.MaxAge = m.MaxAge
 }
 
 func (r *RoomReply) SetChats(l model.ChatList) {
@@ -106,9 +233,16 @@ func (r *RoomReply) SetChats(l model.ChatList) {
 func handleRead(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
 	roomID := gttp.GetURLValue(r, "id")
 
+	var page Page
+	page, errReply = formPage(r)
+	if errReply != nil {
+		return
+	}
+
 	var room model.Room
 	var chats model.ChatList
-	room, chats, errReply = GetChats(ctx, roomID)
+	var next string
+	room, chats, next, errReply = GetChats(ctx, roomID, s.PlayerID, page)
 	if errReply != nil {
 		return
 	}
@@ -120,6 +254,7 @@ func handleRead(ctx context.Context, s session.Data, w http.ResponseWriter, r *h
 	}
 	reply.Set(room)
 	reply.SetChats(chats)
+	reply.NextCursor = next
 
 	replyRaw = reply
 
@@ -136,9 +271,16 @@ func handleLatest(ctx context.Context, s session.Data, w http.ResponseWriter, r
 		return
 	}
 
+	var page Page
+	page, errReply = formPage(r)
+	if errReply != nil {
+		return
+	}
+
 	var room model.Room
 	var chats model.ChatList
-	room, chats, errReply = GetChatsAfter(ctx, roomID, after)
+	var next string
+	room, chats, next, errReply = GetChatsAfter(ctx, roomID, s.PlayerID, after, page)
 	if errReply != nil {
 		return
 	}
@@ -150,89 +292,1330 @@ func handleLatest(ctx context.Context, s session.Data, w http.ResponseWriter, r
 	}
 	reply.Set(room)
 	reply.SetChats(chats)
+	reply.NextCursor = next
 
 	replyRaw = reply
 
 	return
 }
 
-type MuteReply struct {
-	gttp.Response
-	MutedID string `json:"muted_id"`
+// formPage reads the limit, before, after, and include_muted form values
+func formPage(r *http.Request) (page Page, myerr error) {
+	if value := r.FormValue("limit"); value != "" {
+		if page.Limit, myerr = strconv.Atoi(value); myerr != nil {
+			myerr = game.NewUserError(myerr, http.StatusBadRequest, "Invalid limit: %s", value)
+			return
+		}
+	}
+
+	page.Before = r.FormValue("before")
+	page.After = r.FormValue("after")
+	page.IncludeMuted = r.FormValue("include_muted") == "true"
+
+	return
 }
 
-func (r *MuteReply) Set(mute model.Mute) {
-	r.MutedID = mute.MutedKey.Encode()
+// sseStreamer writes the streamed chats as server-sent events
+type sseStreamer struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	started bool
 }
 
-type MutedReply struct {
-	Muted []MuteReply `json:"muted"`
+// start writes the event stream headers before the first event
+func (s *sseStreamer) start() {
+	if s.started {
+		return
+	}
+
+	h := s.w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	s.w.WriteHeader(http.StatusOK)
+
+	s.started = true
 }
 
-func (r *MutedReply) Set(muted model.MuteList) {
-	r.Muted = make([]MuteReply, len(muted))
+func (s *sseStreamer) Send(chat model.Chat) error {
+	s.start()
 
-	for k, v := range muted {
-		r.Muted[k].Set(v)
+	var reply Reply
+	reply.Set(chat)
+
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+
+	// the cursor is the event ID, so a reconnecting client resumes from the last chat it got
+	if _, err = fmt.Fprintf(s.w, "id: %s\nevent: chat\ndata: %s\n\n", reply.Cursor, data); err != nil {
+		return err
 	}
+
+	s.flusher.Flush()
+
+	return nil
 }
 
-func handleMuted(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
-	var mutes model.MuteList
-	mutes, errReply = GetMuted(ctx, s.PlayerID)
+func (s *sseStreamer) Update(chat model.Chat) error {
+	s.start()
+
+	var reply Reply
+	reply.Set(chat)
+
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+
+	// updates have no event ID, so a reconnecting client still resumes from the last new chat
+	event := "update"
+	if reply.Deleted {
+		event = "delete"
+	}
+
+	if _, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+
+	s.flusher.Flush()
+
+	return nil
+}
+
+func (s *sseStreamer) Ping() error {
+	s.start()
+
+	if _, err := fmt.Fprint(s.w, ": ping\n\n"); err != nil {
+		return err
+	}
+
+	s.flusher.Flush()
+
+	return nil
+}
+
+func (s *sseStreamer) Notify(note model.Notification) error {
+	s.start()
+
+	var reply NotificationReply
+	reply.Set(note)
+
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+
+	if _, err = fmt.Fprintf(s.w, "event: notification\ndata: %s\n\n", data); err != nil {
+		return err
+	}
+
+	s.flusher.Flush()
+
+	return nil
+}
+
+func handleStream(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) error {
+	roomID := gttp.GetURLValue(r, "id")
+
+	cursor := r.FormValue("cursor")
+	if cursor == "" {
+		cursor = r.Header.Get("Last-Event-ID")
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return game.NewUserError(nil, http.StatusNotImplemented, "Streaming is not supported")
+	}
+
+	streamer := &sseStreamer{
+		w:       w,
+		flusher: flusher,
+	}
+
+	includeMuted := r.FormValue("include_muted") == "true"
+
+	err := StreamChats(ctx, roomID, s.PlayerID, cursor, includeMuted, streamer)
+	if err != nil && streamer.started {
+		// the stream has begun, so the error can't be sent as a reply
+		game.Errorf(ctx, "Chat stream closed: %v", err)
+		return nil
+	}
+
+	return err
+}
+
+// transcriptTime is the format of the times in the plain text transcripts
+const transcriptTime = "2006-01-02 15:04:05"
+
+// exportWriter writes a transcript to the response once the export begins
+type exportWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	ext         string
+	started     bool
+	count       int
+}
+
+// start writes the response headers before the transcript
+func (e *exportWriter) start(room model.Room) {
+	h := e.w.Header()
+	h.Set("Content-Type", e.contentType)
+	// direct message rooms are named for their players, so they have no number
+	name := "room-" + strconv.FormatInt(room.ID, 10)
+	if room.RoomType() == model.RoomDirect {
+		name = "direct-message"
+	}
+
+	h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, e.ext))
+	e.w.WriteHeader(http.StatusOK)
+
+	e.started = true
+}
+
+// written counts a written chat, and sends the transcript so far to the client after each batch
+func (e *exportWriter) written() {
+	e.count++
+	if e.count%ExportBatch != 0 {
+		return
+	}
+
+	if flusher, ok := e.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// jsonExporter writes the transcript as a JSON object, with the chats in an array
+type jsonExporter struct {
+	*exportWriter
+}
+
+func (e jsonExporter) Begin(room model.Room) error {
+	e.start(room)
+
+	var reply RoomReply
+	reply.Set(room)
+
+	fields := make([]interface{}, 0, 3)
+	for _, v := range []string{reply.RoomID, reply.Name, reply.Type} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		fields = append(fields, data)
+	}
+
+	// the chats are streamed into the array as they are written
+	_, err := fmt.Fprintf(e.w, `{"room_id":%s,"name":%s,"type":%s,"chats":[`, fields...)
+
+	return err
+}
+
+func (e jsonExporter) Write(chat model.Chat, username string) error {
+	reply := ExportReply{
+		Username: username,
+	}
+	reply.Set(chat)
+
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+
+	if e.count > 0 {
+		if _, err = fmt.Fprint(e.w, ","); err != nil {
+			return err
+		}
+	}
+
+	if _, err = e.w.Write(data); err != nil {
+		return err
+	}
+
+	e.written()
+
+	return nil
+}
+
+func (e jsonExporter) End() error {
+	_, err := fmt.Fprint(e.w, "]}")
+
+	return err
+}
+
+// csvExporter writes the transcript as CSV, with a header row
+type csvExporter struct {
+	*exportWriter
+	csv *csv.Writer
+}
+
+func (e csvExporter) Begin(room model.Room) error {
+	e.start(room)
+
+	return e.csv.Write([]string{"chat_id", "created", "player_id", "username", "type", "event", "message", "edited", "deleted"})
+}
+
+func (e csvExporter) Write(chat model.Chat, username string) error {
+	var reply Reply
+	reply.Set(chat)
+
+	err := e.csv.Write([]string{
+		reply.ChatID,
+		reply.Created.UTC().Format(time.RFC3339Nano),
+		reply.PlayerID,
+		username,
+		reply.Type,
+		reply.Event,
+		reply.Message,
+		strconv.FormatBool(reply.Edited),
+		strconv.FormatBool(reply.Deleted),
+	})
+	if err != nil {
+		return err
+	}
+
+	// the response buffers the rows itself, until the batch is sent
+	e.csv.Flush()
+	e.written()
+
+	return e.csv.Error()
+}
+
+func (e csvExporter) End() error {
+	e.csv.Flush()
+
+	return e.csv.Error()
+}
+
+// txtExporter writes the transcript as plain text, one chat per line
+type txtExporter struct {
+	*exportWriter
+}
+
+func (e txtExporter) Begin(room model.Room) error {
+	e.start(room)
+
+	_, err := fmt.Fprintf(e.w, "Transcript of %s\n\n", room.Name)
+
+	return err
+}
+
+func (e txtExporter) Write(chat model.Chat, username string) error {
+	if username == "" {
+		username = chat.AuthorID()
+	}
+
+	// lines of a longer message are indented under the first
+	message := strings.Replace(chat.Message, "\n", "\n\t", -1)
+	switch {
+	case chat.IsDeleted():
+		message = "(deleted)"
+	case !chat.Edited.IsZero():
+		message += " (edited)"
+	}
+
+	// system chats are written as events, without a player
+	line := username + ": " + message
+	if chat.IsSystem() {
+		line = "* " + message
+	}
+
+	_, err := fmt.Fprintf(e.w, "[%s] %s\n", chat.Created.UTC().Format(transcriptTime), line)
+	if err != nil {
+		return err
+	}
+
+	e.written()
+
+	return nil
+}
+
+func (e txtExporter) End() error {
+	return nil
+}
+
+type ExportReply struct {
+	Reply
+	Username string `json:"username"`
+}
+
+func handleExport(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) error {
+	roomID := gttp.GetURLValue(r, "id")
+
+	ew := &exportWriter{
+		w: w,
+	}
+
+	var exporter Exporter
+	switch format := r.FormValue("format"); format {
+	case "", "json":
+		ew.contentType, ew.ext = "application/json", "json"
+		exporter = jsonExporter{ew}
+	case "csv":
+		ew.contentType, ew.ext = "text/csv; charset=utf-8", "csv"
+		exporter = csvExporter{ew, csv.NewWriter(w)}
+	case "txt":
+		ew.contentType, ew.ext = "text/plain; charset=utf-8", "txt"
+		exporter = txtExporter{ew}
+	default:
+		return game.NewUserError(nil, http.StatusBadRequest, "Invalid format: %s (json, csv or txt)", format)
+	}
+
+	err := ExportChats(ctx, roomID, s.PlayerID, exporter)
+	if err != nil && ew.started {
+		// the transcript has begun, so the error can't be sent as a reply
+		game.Errorf(ctx, "Chat export stopped: %v", err)
+		return nil
+	}
+
+	return err
+}
+
+func handleRetention(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	roomID := gttp.GetURLValue(r, "id")
+
+	var keepLast, maxAge int64
+	if value := r.FormValue("keep_last"); value != "" {
+		if keepLast, errReply = strconv.ParseInt(value, 10, 64); errReply != nil {
+			errReply = game.NewUserError(errReply, http.StatusBadRequest, "Invalid keep_last: %s", value)
+			return
+		}
+	}
+
+	if value := r.FormValue("max_age"); value != "" {
+		if maxAge, errReply = strconv.ParseInt(value, 10, 64); errReply != nil {
+			errReply = game.NewUserError(errReply, http.StatusBadRequest, "Invalid max_age: %s", value)
+			return
+		}
+	}
+
+	var room model.Room
+	room, errReply = SetRetention(ctx, s.PlayerID, roomID, keepLast, maxAge)
 	if errReply != nil {
 		return
 	}
 
-	reply := MutedReply{}
-	reply.Set(mutes)
+	reply := RoomReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(room)
 
 	replyRaw = reply
 
 	return
 }
 
-func handleMute(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
-	mutedID := r.FormValue("muted_id")
-	if mutedID == "" {
-		errReply = &gttp.MissingRequiredError{FormElement: "muted_id"}
+type MemberReply struct {
+	PlayerID string    `json:"player_id"`
+	Joined   time.Time `json:"joined"`
+}
+
+type MembersReply struct {
+	gttp.Response
+	RoomID  string        `json:"room_id"`
+	ID      int64         `json:"id"`
+	Name    string        `json:"name"`
+	Type    string        `json:"type"`
+	Members []MemberReply `json:"members"`
+}
+
+func (r *MembersReply) Set(m model.Room, l model.MemberList) {
+	r.RoomID = m.GetKey().Encode()
+	r.ID = m.ID
+	r.Name = m.Name
+	r.Type = m.RoomType()
+	r.Members = make([]MemberReply, len(l))
+
+	for k, v := range l {
+		r.Members[k] = MemberReply{
+			PlayerID: v.PlayerKey.Encode(),
+			Joined:   v.Joined,
+		}
+	}
+}
+
+func handleCreateGroup(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	name := r.FormValue("name")
+	if name == "" {
+		errReply = &gttp.MissingRequiredError{FormElement: "name"}
 		return
 	}
 
-	var mute model.Mute
-	mute, errReply = Mute(ctx, s.PlayerID, mutedID)
+	var room model.Room
+	var members model.MemberList
+	room, members, errReply = CreateGroup(ctx, s.PlayerID, name, gttp.FormMultiValue(r, "member_ids", ""))
 	if errReply != nil {
 		return
 	}
 
-	reply := MuteReply{
+	reply := MembersReply{
 		Response: gttp.Response{
 			Success: true,
 		},
 	}
-	reply.Set(mute)
+	reply.Set(room, members)
 
 	replyRaw = reply
 
 	return
 }
 
-func handleUnmute(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
-	mutedID := r.FormValue("muted_id")
-	if mutedID == "" {
-		errReply = &gttp.MissingRequiredError{FormElement: "muted_id"}
+func handleDirect(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	otherID := r.FormValue("player_id")
+	if otherID == "" {
+		errReply = &gttp.MissingRequiredError{FormElement: "player_id"}
 		return
 	}
 
-	errReply = Unmute(ctx, s.PlayerID, mutedID)
+	var room model.Room
+	var members model.MemberList
+	room, members, errReply = CreateDirect(ctx, s.PlayerID, otherID)
 	if errReply != nil {
 		return
 	}
 
-	reply := MuteReply{
+	reply := MembersReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(room, members)
+
+	replyRaw = reply
+
+	return
+}
+
+func handleAddMember(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	roomID := gttp.GetURLValue(r, "id")
+
+	memberID := r.FormValue("member_id")
+	if memberID == "" {
+		errReply = &gttp.MissingRequiredError{FormElement: "member_id"}
+		return
+	}
+
+	if _, errReply = AddMember(ctx, s.PlayerID, roomID, memberID); errReply != nil {
+		return
+	}
+
+	var room model.Room
+	var members model.MemberList
+	room, members, errReply = GetMembers(ctx, s.PlayerID, roomID)
+	if errReply != nil {
+		return
+	}
+
+	reply := MembersReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(room, members)
+
+	replyRaw = reply
+
+	return
+}
+
+func handleMembers(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	roomID := gttp.GetURLValue(r, "id")
+
+	var room model.Room
+	var members model.MemberList
+	room, members, errReply = GetMembers(ctx, s.PlayerID, roomID)
+	if errReply != nil {
+		return
+	}
+
+	reply := MembersReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(room, members)
+
+	replyRaw = reply
+
+	return
+}
+
+type RoomsRoomReply struct {
+	RoomID string `json:"room_id"`
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+}
+
+type RoomsReply struct {
+	gttp.Response
+	Rooms []RoomsRoomReply `json:"rooms"`
+}
+
+func (r *RoomsReply) Set(l model.RoomList) {
+	r.Rooms = make([]RoomsRoomReply, len(l))
+
+	for k, v := range l {
+		r.Rooms[k] = RoomsRoomReply{
+			RoomID: v.GetKey().Encode(),
+			ID:     v.ID,
+			Name:   v.Name,
+			Type:   v.RoomType(),
+		}
+	}
+}
+
+func handleRooms(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	var rooms model.RoomList
+	rooms, errReply = GetRooms(ctx, s.PlayerID)
+	if errReply != nil {
+		return
+	}
+
+	reply := RoomsReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(rooms)
+
+	replyRaw = reply
+
+	return
+}
+
+type PurgeReply struct {
+	gttp.Response
+	Chats int `json:"chats"`
+}
+
+func handlePurge(ctx context.Context, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	// App Engine strips these headers from outside requests,
+	// and the standalone server purges on its own
+	if !game.AppEngine || (r.Header.Get("X-Appengine-Cron") == "" && r.Header.Get("X-AppEngine-QueueName") == "") {
+		errReply = game.NewUserError(nil, http.StatusForbidden, "The purge can only be run by cron or the task queue")
+		return
+	}
+
+	num, errReply := Purge(ctx)
+	if errReply != nil {
+		return
+	}
+
+	replyRaw = PurgeReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+		Chats: num,
+	}
+
+	return
+}
+
+type SeenReply struct {
+	gttp.Response
+	RoomID              string    `json:"room_id"`
+	LastMessageSeenDate time.Time `json:"last_message_seen_date"`
+	DateSeen            time.Time `json:"date_seen"`
+}
+
+func (r *SeenReply) Set(m model.ChatSeen) {
+	r.RoomID = m.RoomKey.Encode()
+	r.LastMessageSeenDate = m.LastMessageSeenDate
+	r.DateSeen = m.DateSeen
+}
+
+func handleSeen(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	roomID := gttp.GetURLValue(r, "id")
+
+	var seen model.ChatSeen
+	seen, errReply = GetLastSeen(ctx, roomID, s.PlayerID)
+	if errReply != nil {
+		return
+	}
+
+	reply := SeenReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(seen)
+
+	replyRaw = reply
+
+	return
+}
+
+type UnreadRoomReply struct {
+	RoomID string `json:"room_id"`
+	Name   string `json:"name"`
+	Unread int    `json:"unread"`
+	More   bool   `json:"more,omitempty"`
+}
+
+type UnreadReply struct {
+	gttp.Response
+	Rooms []UnreadRoomReply `json:"rooms"`
+	Total int               `json:"total"`
+}
+
+func (r *UnreadReply) Set(l []Unread) {
+	r.Rooms = make([]UnreadRoomReply, len(l))
+	r.Total = 0
+
+	for k, v := range l {
+		r.Rooms[k] = UnreadRoomReply{
+			RoomID: v.Room.GetKey().Encode(),
+			Name:   v.Room.Name,
+			Unread: v.Count,
+			More:   v.More,
+		}
+		r.Total += v.Count
+	}
+}
+
+func handleUnread(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	var unread []Unread
+	unread, errReply = GetUnread(ctx, s.PlayerID)
+	if errReply != nil {
+		return
+	}
+
+	reply := UnreadReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(unread)
+
+	replyRaw = reply
+
+	return
+}
+
+type MuteReply struct {
+	gttp.Response
+	MutedID string    `json:"muted_id"`
+	Scope   string    `json:"scope,omitempty"`
+	ScopeID string    `json:"scope_id,omitempty"`
+	Expires time.Time `json:"expires,omitempty"`
+	Exempt  bool      `json:"exempt,omitempty"`
+}
+
+func (r *MuteReply) Set(mute model.Mute) {
+	r.MutedID = mute.MutedKey.Encode()
+	r.Scope = mute.Scope()
+	// the same IDs the scope is given with: the room's key, or the game's ID
+	switch mute.Scope() {
+	case model.MuteRoom:
+		r.ScopeID = mute.ScopeKey.Encode()
+	case model.MuteGame:
+		r.ScopeID = strconv.FormatInt(mute.ScopeKey.IntID(), 10)
+	}
+	r.Expires = mute.Expires
+	r.Exempt = mute.Exempt
+}
+
+// formMute reads the room_id, game_id, and duration (in seconds) form values
+func formMute(r *http.Request) (scope Scope, duration time.Duration, myerr error) {
+	scope.RoomID = r.FormValue("room_id")
+	scope.GameID = r.FormValue("game_id")
+
+	if value := r.FormValue("duration"); value != "" {
+		var seconds int64
+		if seconds, myerr = strconv.ParseInt(value, 10, 64); myerr != nil {
+			myerr = game.NewUserError(myerr, http.StatusBadRequest, "Invalid duration: %s", value)
+			return
+		}
+
+		duration = time.Duration(seconds) * time.Second
+	}
+
+	return
+}
+
+type MutedReply struct {
+	Muted []MuteReply `json:"muted"`
+}
+
+func (r *MutedReply) Set(muted model.MuteList) {
+	r.Muted = make([]MuteReply, len(muted))
+
+	for k, v := range muted {
+		r.Muted[k].Set(v)
+	}
+}
+
+func handleMuted(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	var mutes model.MuteList
+	mutes, errReply = GetMuted(ctx, s.PlayerID)
+	if errReply != nil {
+		return
+	}
+
+	reply := MutedReply{}
+	reply.Set(mutes)
+
+	replyRaw = reply
+
+	return
+}
+
+func handleMute(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	mutedID := r.FormValue("muted_id")
+	if mutedID == "" {
+		errReply = &gttp.MissingRequiredError{FormElement: "muted_id"}
+		return
+	}
+
+	var scope Scope
+	var duration time.Duration
+	scope, duration, errReply = formMute(r)
+	if errReply != nil {
+		return
+	}
+
+	var mute model.Mute
+	mute, errReply = Mute(ctx, s.PlayerID, mutedID, scope, duration)
+	if errReply != nil {
+		return
+	}
+
+	reply := MuteReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(mute)
+
+	replyRaw = reply
+
+	return
+}
+
+func handleUnmute(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	mutedID := r.FormValue("muted_id")
+	if mutedID == "" {
+		errReply = &gttp.MissingRequiredError{FormElement: "muted_id"}
+		return
+	}
+
+	var scope Scope
+	var duration time.Duration
+	scope, duration, errReply = formMute(r)
+	if errReply != nil {
+		return
+	}
+
+	errReply = Unmute(ctx, s.PlayerID, mutedID, scope, duration)
+	if errReply != nil {
+		return
+	}
+
+	reply := MuteReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+
+	replyRaw = reply
+
+	return
+}
+
+type SanctionReply struct {
+	gttp.Response
+	SanctionID string    `json:"sanction_id"`
+	PlayerID   string    `json:"player_id"`
+	Kind       string    `json:"kind"`
+	RoomID     string    `json:"room_id,omitempty"`
+	AdminID    string    `json:"admin_id"`
+	Reason     string    `json:"reason"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires,omitempty"`
+	Lifted     time.Time `json:"lifted,omitempty"`
+	LifterID   string    `json:"lifter_id,omitempty"`
+	Active     bool      `json:"active"`
+}
+
+func (r *SanctionReply) Set(m model.Sanction, now time.Time) {
+	r.SanctionID = m.GetKey().Encode()
+	r.PlayerID = m.PlayerKey.Encode()
+	r.Kind = m.Kind
+	if m.RoomKey != nil {
+		r.RoomID = m.RoomKey.Encode()
+	}
+	r.AdminID = m.AdminKey.Encode()
+	r.Reason = m.Reason
+	r.Created = m.Created
+	r.Expires = m.Expires
+	r.Lifted = m.Lifted
+	if m.LifterKey != nil {
+		r.LifterID = m.LifterKey.Encode()
+	}
+	r.Active = m.Active(now)
+}
+
+type SanctionsReply struct {
+	gttp.Response
+	Sanctions []SanctionReply `json:"sanctions"`
+}
+
+func (r *SanctionsReply) Set(l model.SanctionList, now time.Time) {
+	r.Sanctions = make([]SanctionReply, len(l))
+
+	for k := range l {
+		r.Sanctions[k].Set(l[k], now)
+	}
+}
+
+func handleSanction(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	playerID := r.FormValue("player_id")
+	if playerID == "" {
+		errReply = &gttp.MissingRequiredError{FormElement: "player_id"}
+		return
+	}
+
+	kind := r.FormValue("kind")
+	if kind == "" {
+		errReply = &gttp.MissingRequiredError{FormElement: "kind"}
+		return
+	}
+
+	reason := r.FormValue("reason")
+	if reason == "" {
+		errReply = &gttp.MissingRequiredError{FormElement: "reason"}
+		return
+	}
+
+	var scope Scope
+	var duration time.Duration
+	scope, duration, errReply = formMute(r)
+	if errReply != nil {
+		return
+	}
+
+	if scope.GameID != "" {
+		errReply = game.NewUserError(nil, http.StatusBadRequest, "Sanctions apply to a room or the whole site")
+		return
+	}
+
+	var sanction model.Sanction
+	sanction, errReply = AddSanction(ctx, s.PlayerID, playerID, kind, scope.RoomID, duration, reason)
+	if errReply != nil {
+		return
+	}
+
+	reply := SanctionReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(sanction, game.Now(ctx))
+
+	replyRaw = reply
+
+	return
+}
+
+func handleSanctions(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	var page Page
+	page, errReply = formPage(r)
+	if errReply != nil {
+		return
+	}
+
+	var offset int
+	if value := r.FormValue("offset"); value != "" {
+		if offset, errReply = strconv.Atoi(value); errReply != nil {
+			errReply = game.NewUserError(errReply, http.StatusBadRequest, "Invalid offset: %s", value)
+			return
+		}
+	}
+
+	var sanctions model.SanctionList
+	sanctions, errReply = GetSanctions(ctx, s.PlayerID, r.FormValue("player_id"), page.Limit, offset)
+	if errReply != nil {
+		return
+	}
+
+	reply := SanctionsReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(sanctions, game.Now(ctx))
+
+	replyRaw = reply
+
+	return
+}
+
+func handleLift(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	sanctionID := gttp.GetURLValue(r, "id")
+
+	var sanction model.Sanction
+	sanction, errReply = LiftSanction(ctx, s.PlayerID, sanctionID)
+	if errReply != nil {
+		return
+	}
+
+	reply := SanctionReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(sanction, game.Now(ctx))
+
+	replyRaw = reply
+
+	return
+}
+
+func handleEdit(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	chatID := gttp.GetURLValue(r, "id")
+
+	message := r.FormValue("message")
+	if message == "" {
+		errReply = &gttp.MissingRequiredError{FormElement: "message"}
+		return
+	}
+
+	var chat model.Chat
+	chat, errReply = EditChat(ctx, s.PlayerID, chatID, message)
+	if errReply != nil {
+		return
+	}
+
+	reply := Reply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(chat)
+
+	replyRaw = reply
+
+	return
+}
+
+func handleDelete(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	chatID := gttp.GetURLValue(r, "id")
+
+	var chat model.Chat
+	chat, errReply = DeleteChat(ctx, s.PlayerID, chatID)
+	if errReply != nil {
+		return
+	}
+
+	reply := Reply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(chat)
+
+	replyRaw = reply
+
+	return
+}
+
+type EditReply struct {
+	Message string    `json:"message"`
+	Edited  time.Time `json:"edited"`
+}
+
+type EditsReply struct {
+	gttp.Response
+	ChatID string      `json:"chat_id"`
+	Edits  []EditReply `json:"edits"`
+}
+
+func (r *EditsReply) Set(m model.Chat, l model.ChatEditList) {
+	r.ChatID = m.GetKey().Encode()
+	r.Edits = make([]EditReply, len(l))
+
+	for k, v := range l {
+		r.Edits[k] = EditReply{
+			Message: v.Message,
+			Edited:  v.Edited,
+		}
+	}
+}
+
+func handleEdits(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	chatID := gttp.GetURLValue(r, "id")
+
+	var chat model.Chat
+	var edits model.ChatEditList
+	chat, edits, errReply = GetEdits(ctx, s.PlayerID, chatID)
+	if errReply != nil {
+		return
+	}
+
+	reply := EditsReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(chat, edits)
+
+	replyRaw = reply
+
+	return
+}
+
+type ReactionReply struct {
+	gttp.Response
+	ChatID string `json:"chat_id"`
+	Emoji  string `json:"emoji"`
+}
+
+func handleReact(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	chatID := gttp.GetURLValue(r, "id")
+
+	emoji := r.FormValue("emoji")
+	if emoji == "" {
+		errReply = &gttp.MissingRequiredError{FormElement: "emoji"}
+		return
+	}
+
+	if _, errReply = React(ctx, s.PlayerID, chatID, emoji); errReply != nil {
+		return
+	}
+
+	replyRaw = ReactionReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+		ChatID: chatID,
+		Emoji:  emoji,
+	}
+
+	return
+}
+
+func handleUnreact(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	chatID := gttp.GetURLValue(r, "id")
+
+	emoji := r.FormValue("emoji")
+	if emoji == "" {
+		errReply = &gttp.MissingRequiredError{FormElement: "emoji"}
+		return
+	}
+
+	if errReply = Unreact(ctx, s.PlayerID, chatID, emoji); errReply != nil {
+		return
+	}
+
+	replyRaw = ReactionReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+		ChatID: chatID,
+		Emoji:  emoji,
+	}
+
+	return
+}
+
+type SearchReply struct {
+	gttp.Response
+	Results    []SearchResultReply `json:"results"`
+	NextCursor string              `json:"next_cursor"`
+}
+
+func (r *SearchReply) Set(l []Result, next string) {
+	r.Results = make([]SearchResultReply, len(l))
+	r.NextCursor = next
+
+	for k := range l {
+		r.Results[k].Set(l[k])
+	}
+}
+
+type SearchResultReply struct {
+	Reply
+	Highlight string `json:"highlight"`
+}
+
+func (r *SearchResultReply) Set(m Result) {
+	r.Reply.Set(m.Chat)
+	r.Highlight = m.Highlight
+}
+
+func handleSearch(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	roomID := gttp.GetURLValue(r, "id")
+
+	search := Search{
+		Query:    r.FormValue("q"),
+		AuthorID: r.FormValue("author_id"),
+	}
+
+	times := []struct {
+		name  string
+		value *time.Time
+	}{
+		{"from", &search.From},
+		{"to", &search.To},
+	}
+	for _, v := range times {
+		if value := r.FormValue(v.name); value != "" {
+			if *v.value, errReply = time.Parse("20060102150405", value); errReply != nil {
+				errReply = game.NewUserError(errReply, http.StatusBadRequest, "Invalid %s: %s", v.name, value)
+				return
+			}
+		}
+	}
+
+	var page Page
+	page, errReply = formPage(r)
+	if errReply != nil {
+		return
+	}
+	search.Limit = page.Limit
+	search.Before = page.Before
+
+	var results []Result
+	var next string
+	results, next, errReply = SearchChats(ctx, roomID, s.PlayerID, search)
+	if errReply != nil {
+		return
+	}
+
+	reply := SearchReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(results, next)
+
+	replyRaw = reply
+
+	return
+}
+
+type NotificationReply struct {
+	gttp.Response
+	NotificationID string    `json:"notification_id"`
+	Kind           string    `json:"kind"`
+	FromID         string    `json:"from_id"`
+	RoomID         string    `json:"room_id"`
+	ChatID         string    `json:"chat_id"`
+	Message        string    `json:"message"`
+	Created        time.Time `json:"created"`
+	Unread         bool      `json:"unread"`
+}
+
+func (r *NotificationReply) Set(m model.Notification) {
+	r.NotificationID = m.GetKey().Encode()
+	r.Kind = m.Kind
+	r.FromID = m.FromKey.Encode()
+	r.RoomID = m.RoomKey.Encode()
+	r.ChatID = m.ChatKey.Encode()
+	r.Message = m.Message
+	r.Created = m.Created
+	r.Unread = m.Unread
+}
+
+type NotificationsReply struct {
+	gttp.Response
+	Notifications []NotificationReply `json:"notifications"`
+}
+
+func (r *NotificationsReply) Set(l model.NotificationList) {
+	r.Notifications = make([]NotificationReply, len(l))
+
+	for k := range l {
+		r.Notifications[k].Set(l[k])
+	}
+}
+
+type MarkReadReply struct {
+	gttp.Response
+	Read int `json:"read"`
+}
+
+type NotifyReply struct {
+	gttp.Response
+	Notify string `json:"notify"`
+}
+
+func handleNotifications(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	var page Page
+	page, errReply = formPage(r)
+	if errReply != nil {
+		return
+	}
+
+	var notes model.NotificationList
+	notes, errReply = GetNotifications(ctx, s.PlayerID, page.Limit)
+	if errReply != nil {
+		return
+	}
+
+	reply := NotificationsReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(notes)
+
+	replyRaw = reply
+
+	return
+}
+
+func handleMarkRead(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	notificationIDs := gttp.FormMultiValue(r, "notification_ids", "")
+
+	// marking every notification read has to be asked for, so a missing ID doesn't clear the list
+	if len(notificationIDs) == 0 && r.FormValue("all") != "true" {
+		errReply = &gttp.MissingRequiredError{FormElement: "notification_ids"}
+		return
+	}
+
+	var num int
+	num, errReply = MarkRead(ctx, s.PlayerID, notificationIDs)
+	if errReply != nil {
+		return
+	}
+
+	reply := MarkReadReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+		Read: num,
+	}
+
+	replyRaw = reply
+
+	return
+}
+
+func handleNotify(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	notify := r.FormValue("notify")
+	if notify == "" {
+		errReply = &gttp.MissingRequiredError{FormElement: "notify"}
+		return
+	}
+
+	var player model.Player
+	player, errReply = SetNotify(ctx, s.PlayerID, notify)
+	if errReply != nil {
+		return
+	}
+
+	reply := NotifyReply{
 		Response: gttp.Response{
 			Success: true,
 		},
+		Notify: player.Notify,
 	}
 
 	replyRaw = reply
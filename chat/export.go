@@ -0,0 +1,119 @@
+package chat
+
+import (
+	"context"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+)
+
+// ExportBatch is the number of chats loaded at a time while a room is exported
+var ExportBatch = 200
+
+// Exporter receives the transcript of a room as it is exported
+type Exporter interface {
+	// Begin starts the transcript of the room
+	Begin(room model.Room) error
+
+	// Write adds the chat, posted by the player with the given username, to the transcript
+	// The chats are written oldest first
+	Write(chat model.Chat, username string) error
+
+	// End finishes the transcript
+	End() error
+}
+
+// ExportChats writes the whole transcript of the room to the exporter, as seen by the given player
+// The chats are loaded in batches of ExportBatch, so a large room is never held in memory at once
+// Deleted chats are written without their message, and chats past the room's retention policy are left out
+func ExportChats(ctx context.Context, roomID, playerID string, exporter Exporter) (myerr error) {
+	room, myerr := loadRoom(ctx, roomID, playerID)
+	if myerr != nil {
+		return
+	}
+
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	if myerr = checkSanctions(ctx, playerKey, room, model.SanctionBan); myerr != nil {
+		return
+	}
+
+	cutoff := room.Cutoff(ctx)
+
+	// pages are read past the time, so start just before the oldest chat that can be shown
+	after := model.ChatPosition{Created: time.Unix(0, 0)}
+	if !cutoff.IsZero() {
+		after.Created = cutoff.Add(-time.Microsecond)
+	}
+
+	if myerr = exporter.Begin(room); myerr != nil {
+		return
+	}
+
+	usernames := make(map[string]string)
+	for {
+		var chats model.ChatList
+		var more bool
+		if more, myerr = chats.ByRoomPage(ctx, room.GetKey(), model.ChatPosition{}, after, ExportBatch); myerr != nil {
+			return
+		}
+
+		// the page is newest first
+		for i := len(chats) - 1; i >= 0; i-- {
+			var username string
+			if username, myerr = lookupUsername(ctx, chats[i].PlayerKey, usernames); myerr != nil {
+				return
+			}
+
+			if myerr = exporter.Write(chats[i], username); myerr != nil {
+				return
+			}
+		}
+
+		if !more || len(chats) == 0 {
+			break
+		}
+
+		after = model.ChatPosition{
+			Created: chats[0].Created,
+			Key:     chats[0].GetKey(),
+		}
+	}
+
+	myerr = exporter.End()
+
+	return
+}
+
+// lookupUsername returns the username of the player, keeping the usernames already looked up in the cache
+// System chats, and players who can no longer be found, have an empty username
+func lookupUsername(ctx context.Context, playerKey *datastore.Key, cache map[string]string) (username string, myerr error) {
+	if playerKey == nil {
+		return
+	}
+
+	id := playerKey.Encode()
+	if username, ok := cache[id]; ok {
+		return username, nil
+	}
+
+	var player model.Player
+	if myerr = store.Load(ctx, playerKey, &player); myerr != nil {
+		if _, ok := myerr.(*db.UnfoundObjectError); !ok {
+			return
+		}
+		myerr = nil
+	}
+
+	username = player.Username
+	cache[id] = username
+
+	return
+}
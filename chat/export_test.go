@@ -0,0 +1,87 @@
+package chat
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store/storetest"
+)
+
+// recordExporter keeps the transcript it is given
+type recordExporter struct {
+	room      model.Room
+	chats     model.ChatList
+	usernames []string
+	ended     bool
+}
+
+func (e *recordExporter) Begin(room model.Room) error {
+	e.room = room
+	return nil
+}
+
+func (e *recordExporter) Write(chat model.Chat, username string) error {
+	e.chats = append(e.chats, chat)
+	e.usernames = append(e.usernames, username)
+	return nil
+}
+
+func (e *recordExporter) End() error {
+	e.ended = true
+	return nil
+}
+
+func TestExportChats(t *testing.T) {
+	ctx := storetest.NewContext()
+	now := time.Now()
+
+	defer func(batch int) { ExportBatch = batch }(ExportBatch)
+	ExportBatch = 2
+
+	reader, talker, outsider := storetest.SavePlayer(ctx, t), storetest.SavePlayer(ctx, t), storetest.SavePlayer(ctx, t)
+	room := storetest.SaveRoom(ctx, t, reader, talker)
+	roomID := room.GetKey().Encode()
+
+	var deleted model.Chat
+	for i := 0; i < 5; i++ {
+		chat := postChat(game.SetNow(ctx, now.Add(time.Duration(i)*time.Minute)), t, room, talker, "chat "+strconv.Itoa(i))
+		if i == 3 {
+			deleted = chat
+		}
+	}
+	if _, err := DeleteChat(ctx, talker.GetKey().Encode(), deleted.GetKey().Encode()); err != nil {
+		t.Fatalf("DeleteChat threw an error: %v", err)
+	}
+
+	if err := ExportChats(ctx, roomID, outsider.GetKey().Encode(), &recordExporter{}); err == nil {
+		t.Fatal("ExportChats did not throw an error for a player who is not a member.")
+	}
+
+	var e recordExporter
+	if err := ExportChats(ctx, roomID, reader.GetKey().Encode(), &e); err != nil {
+		t.Fatalf("ExportChats threw an error: %v", err)
+	}
+	if !e.ended || e.room.ID != room.ID || len(e.chats) != 5 {
+		t.Fatalf("ExportChats did not export the whole room. Got: %+v", e)
+	}
+	for k, v := range e.chats {
+		if v.Message != "chat "+strconv.Itoa(k) || e.usernames[k] != talker.Username {
+			t.Fatalf("ExportChats exported chat %d wrong. Got: %q by %q", k, v.Message, e.usernames[k])
+		}
+	}
+
+	w := httptest.NewRecorder()
+	ew := &exportWriter{w: w, contentType: "text/plain", ext: "txt"}
+	if err := ExportChats(ctx, roomID, reader.GetKey().Encode(), txtExporter{ew}); err != nil {
+		t.Fatalf("ExportChats threw an error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 7 || !strings.HasSuffix(lines[2], talker.Username+": chat 0") || !strings.HasSuffix(lines[5], ": (deleted)") {
+		t.Fatalf("txtExporter wrote the wrong transcript. Got: %q", lines)
+	}
+}
@@ -0,0 +1,47 @@
+package chat
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/config"
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/ratelimit"
+)
+
+// checkRate takes a token from the player's and the room's chat rate limits,
+// and returns a TooManyRequestsError if either has run out
+func checkRate(ctx context.Context, playerKey *datastore.Key, room model.Room) (myerr error) {
+	cfg := config.FromContext(ctx)
+	now := game.Now(ctx)
+
+	limits := []struct {
+		key     string
+		rate    ratelimit.Rate
+		message string
+	}{
+		{"chat/player/" + playerKey.Encode(), ratelimit.PerMinute(cfg.ChatPlayerBurst, cfg.ChatPlayerPerMinute), "You are chatting too fast"},
+		{"chat/room/" + room.GetKey().Encode(), ratelimit.PerMinute(cfg.ChatRoomBurst, cfg.ChatRoomPerMinute), "This room is too busy"},
+	}
+
+	for _, v := range limits {
+		var ok bool
+		var retryAfter time.Duration
+		if ok, retryAfter, myerr = ratelimit.Take(ctx, v.key, v.rate, now); myerr != nil {
+			return
+		}
+
+		if !ok {
+			myerr = &game.TooManyRequestsError{
+				Message:    v.message + ", try again in " + retryAfter.Round(time.Second).String(),
+				RetryAfter: retryAfter,
+			}
+			return
+		}
+	}
+
+	return
+}
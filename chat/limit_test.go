@@ -0,0 +1,50 @@
+package chat
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/benjamw/gogame/config"
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/ratelimit"
+	"github.com/benjamw/gogame/store/storetest"
+)
+
+func TestRateLimit(t *testing.T) {
+
+	cfg := *config.Get()
+	cfg.ChatPlayerBurst = 2
+	cfg.ChatPlayerPerMinute = 1
+	cfg.ChatRoomBurst = 3
+	cfg.ChatRoomPerMinute = 1
+	ctx := ratelimit.NewContext(config.NewContext(storetest.NewContext(), &cfg), ratelimit.NewMemory())
+
+	fast, slow := storetest.SavePlayer(ctx, t), storetest.SavePlayer(ctx, t)
+	fastID, slowID := fast.GetKey().Encode(), slow.GetKey().Encode()
+	room := storetest.SaveRoom(ctx, t, fast, slow)
+	roomID := room.GetKey().Encode()
+
+	// a chat that fails validation does not use up the limit
+	if _, err := AddChat(ctx, roomID, fastID, " "); err == nil {
+		t.Fatal("AddChat did not throw an error for an empty message.")
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := AddChat(ctx, roomID, fastID, strconv.Itoa(i)); err != nil {
+			t.Fatalf("AddChat threw an error: %v", err)
+		}
+	}
+
+	_, err := AddChat(ctx, roomID, fastID, "too fast")
+	if e, ok := err.(*game.TooManyRequestsError); !ok || e.RetryAfter <= 0 {
+		t.Fatalf("AddChat did not limit the player. Got: %v", err)
+	}
+
+	// the room's burst is shared by every player in it
+	if _, err = AddChat(ctx, roomID, slowID, "busy"); err != nil {
+		t.Fatalf("AddChat threw an error: %v", err)
+	}
+	if _, err = AddChat(ctx, roomID, slowID, "too busy"); err == nil {
+		t.Fatal("AddChat did not limit the room.")
+	}
+}
@@ -0,0 +1,61 @@
+package chat
+
+import (
+	"context"
+
+	"github.com/benjamw/golibs/hooks"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/games"
+	"github.com/benjamw/gogame/model"
+)
+
+func init() {
+	hooks.Listen("GameJoin", &games.SeatListener{listenJoin}, 1000)
+	hooks.Listen("GameLeave", &games.SeatListener{listenLeave}, 1000)
+	hooks.Listen("GameStart", &games.GameListener{listenStart}, 1000)
+	hooks.Listen("GameMove", &games.MoveListener{listenMove}, 1000)
+	hooks.Listen("GameFinish", &games.GameListener{listenFinish}, 1000)
+}
+
+func listenJoin(ctx context.Context, g model.Game, seats model.SeatList, seat model.Seat) (bool, error) {
+	// the player has joined either way, so a missing chat is only logged
+	if err := postSeat(ctx, g, seat, EventPlayerJoined, "joined"); err != nil {
+		game.Errorf(ctx, "Could not post the player joining the game: %v", err)
+	}
+
+	return true, nil
+}
+
+func listenLeave(ctx context.Context, g model.Game, seats model.SeatList, seat model.Seat) (bool, error) {
+	if err := postSeat(ctx, g, seat, EventPlayerLeft, "left"); err != nil {
+		game.Errorf(ctx, "Could not post the player leaving the game: %v", err)
+	}
+
+	return true, nil
+}
+
+func listenStart(ctx context.Context, g model.Game, seats model.SeatList) (bool, error) {
+	// the game has started either way, so a missing chat is only logged
+	if err := postGameStart(ctx, g, seats); err != nil {
+		game.Errorf(ctx, "Could not post the start of the game: %v", err)
+	}
+
+	return true, nil
+}
+
+func listenMove(ctx context.Context, g model.Game, seats model.SeatList, move model.Move) (bool, error) {
+	if err := postTurn(ctx, g, seats, move); err != nil {
+		game.Errorf(ctx, "Could not post the turn: %v", err)
+	}
+
+	return true, nil
+}
+
+func listenFinish(ctx context.Context, g model.Game, seats model.SeatList) (bool, error) {
+	if err := postGameOver(ctx, g, seats); err != nil {
+		game.Errorf(ctx, "Could not post the end of the game: %v", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,190 @@
+package chat
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+)
+
+// AddSanction silences or bans the given player in the given room, or site-wide if roomID is empty,
+// for the given duration if it is not zero
+// Only admins can add sanctions
+func AddSanction(ctx context.Context, adminID, playerID, kind, roomID string, duration time.Duration, reason string) (sanction model.Sanction, myerr error) {
+	var admin model.Player
+	if admin, myerr = loadAdmin(ctx, adminID); myerr != nil {
+		return
+	}
+
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	switch kind {
+	case model.SanctionSilence, model.SanctionBan:
+	default:
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Invalid sanction: %s", kind)
+		return
+	}
+
+	if reason == "" {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "A reason is required")
+		return
+	}
+
+	if duration < 0 {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Invalid duration: %v", duration)
+		return
+	}
+
+	var player model.Player
+	if myerr = store.Load(ctx, playerKey, &player); myerr != nil {
+		return
+	}
+
+	s := model.Sanction{
+		PlayerKey: player.GetKey(),
+		Kind:      kind,
+		AdminKey:  admin.GetKey(),
+		Reason:    reason,
+		Created:   game.Now(ctx),
+	}
+
+	if roomID != "" {
+		var room model.Room
+		if room, myerr = findRoom(ctx, roomID); myerr != nil {
+			return
+		}
+
+		s.RoomKey = room.GetKey()
+	}
+
+	if duration > 0 {
+		s.Expires = s.Created.Add(duration)
+	}
+
+	if myerr = store.Save(ctx, &s); myerr != nil {
+		return
+	}
+
+	sanction = s
+
+	return
+}
+
+// LiftSanction ends the given sanction before it expires
+// Only admins can lift sanctions
+func LiftSanction(ctx context.Context, adminID, sanctionID string) (sanction model.Sanction, myerr error) {
+	var admin model.Player
+	if admin, myerr = loadAdmin(ctx, adminID); myerr != nil {
+		return
+	}
+
+	var s model.Sanction
+	if myerr = store.LoadS(ctx, sanctionID, &s); myerr != nil {
+		return
+	}
+
+	if !s.Active(game.Now(ctx)) {
+		myerr = game.NewUserError(nil, http.StatusConflict, "The sanction has already ended")
+		return
+	}
+
+	s.Lifted = game.Now(ctx)
+	s.LifterKey = admin.GetKey()
+	if myerr = store.Save(ctx, &s); myerr != nil {
+		return
+	}
+
+	sanction = s
+
+	return
+}
+
+// GetSanctions returns the sanctions put on the given player, or a page of all sanctions
+// if playerID is empty, active and past, newest first
+// Only admins can read the sanctions
+func GetSanctions(ctx context.Context, adminID, playerID string, limit, offset int) (sanctions model.SanctionList, myerr error) {
+	if _, myerr = loadAdmin(ctx, adminID); myerr != nil {
+		return
+	}
+
+	if playerID != "" {
+		var playerKey *datastore.Key
+		if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+			return
+		}
+
+		myerr = sanctions.ByPlayer(ctx, playerKey)
+
+		return
+	}
+
+	if limit < 0 || MaxLimit < limit || offset < 0 {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Invalid page: limit %d (at most %d), offset %d", limit, MaxLimit, offset)
+		return
+	}
+
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+
+	myerr = sanctions.Page(ctx, limit, offset)
+
+	return
+}
+
+// checkSanctions returns an error if the player has an active sanction of one of the given kinds in the room
+func checkSanctions(ctx context.Context, playerKey *datastore.Key, room model.Room, kinds ...string) (myerr error) {
+	var sanctions model.SanctionList
+	if myerr = sanctions.ByPlayer(ctx, playerKey); myerr != nil {
+		return
+	}
+
+	now := game.Now(ctx)
+	for _, v := range sanctions {
+		if !v.Active(now) || !v.Covers(room.GetKey()) {
+			continue
+		}
+
+		for _, kind := range kinds {
+			if v.Kind != kind {
+				continue
+			}
+
+			until := "further notice"
+			if !v.Expires.IsZero() {
+				until = v.Expires.Format(time.RFC3339)
+			}
+
+			verb := "silenced"
+			if kind == model.SanctionBan {
+				verb = "banned"
+			}
+
+			return game.NewUserError(nil, http.StatusForbidden, "You have been %s until %s: %s", verb, until, v.Reason)
+		}
+	}
+
+	return
+}
+
+// loadAdmin loads the given player, and returns an error if they are not an admin
+func loadAdmin(ctx context.Context, adminID string) (admin model.Player, myerr error) {
+	if myerr = store.LoadS(ctx, adminID, &admin); myerr != nil {
+		return
+	}
+
+	if !admin.IsAdmin {
+		myerr = game.NewUserError(nil, http.StatusForbidden, "Only admins can moderate chat")
+		return
+	}
+
+	return
+}
@@ -0,0 +1,99 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+	"github.com/benjamw/gogame/store/storetest"
+)
+
+func TestSanctions(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	admin := storetest.SavePlayer(ctx, t)
+	admin.IsAdmin = true
+	if err := store.Save(ctx, &admin); err != nil {
+		t.Fatalf("Could not save the test admin: %v", err)
+	}
+
+	player := storetest.SavePlayer(ctx, t)
+	adminID, playerID := admin.GetKey().Encode(), player.GetKey().Encode()
+
+	room := storetest.SaveRoom(ctx, t, player)
+	other := storetest.SaveRoom(ctx, t, player)
+	roomID, otherID := room.GetKey().Encode(), other.GetKey().Encode()
+
+	if _, err := AddSanction(ctx, playerID, adminID, model.SanctionSilence, "", 0, "turnabout"); err == nil {
+		t.Fatal("AddSanction did not throw an error for a player who is not an admin.")
+	}
+
+	if _, err := AddSanction(ctx, adminID, playerID, model.SanctionSilence, "", 0, ""); err == nil {
+		t.Fatal("AddSanction did not throw an error for a missing reason.")
+	}
+
+	silence, err := AddSanction(ctx, adminID, playerID, model.SanctionSilence, roomID, time.Hour, "spam")
+	if err != nil {
+		t.Fatalf("AddSanction threw an error: %v", err)
+	}
+
+	_, err = AddChat(ctx, roomID, playerID, "more spam")
+	if e, ok := err.(game.Error); !ok || e.Code() != 403 {
+		t.Fatalf("AddChat did not reject the silenced player. Got: %v", err)
+	}
+
+	if _, err = AddChat(ctx, otherID, playerID, "elsewhere"); err != nil {
+		t.Fatalf("The room silence applied to another room: %v", err)
+	}
+
+	if _, err = AddChat(game.SetNow(ctx, time.Now().Add(2*time.Hour)), roomID, playerID, "later"); err != nil {
+		t.Fatalf("The silence did not expire: %v", err)
+	}
+
+	// silenced players can still read
+	if _, _, _, err = GetChats(ctx, roomID, playerID, Page{}); err != nil {
+		t.Fatalf("GetChats threw an error for the silenced player: %v", err)
+	}
+
+	if _, err = AddSanction(ctx, adminID, playerID, model.SanctionBan, "", 0, "abuse"); err != nil {
+		t.Fatalf("AddSanction threw an error: %v", err)
+	}
+
+	if _, _, _, err = GetChats(ctx, otherID, playerID, Page{}); err == nil {
+		t.Fatal("GetChats did not reject the banned player.")
+	}
+
+	sanctions, err := GetSanctions(ctx, adminID, playerID, 0, 0)
+	if err != nil {
+		t.Fatalf("GetSanctions threw an error: %v", err)
+	}
+	if len(sanctions) != 2 || sanctions[0].Kind != model.SanctionBan {
+		t.Fatalf("GetSanctions did not return the sanctions, newest first. Got: %+v", sanctions)
+	}
+
+	lifted, err := LiftSanction(ctx, adminID, sanctions[0].GetKey().Encode())
+	if err != nil {
+		t.Fatalf("LiftSanction threw an error: %v", err)
+	}
+	if lifted.Lifted.IsZero() || !lifted.LifterKey.Equal(admin.GetKey()) {
+		t.Fatalf("LiftSanction did not record the lift. Got: %+v", lifted)
+	}
+
+	if _, err = AddChat(ctx, otherID, playerID, "back"); err != nil {
+		t.Fatalf("The lifted ban still applied: %v", err)
+	}
+
+	if _, err = LiftSanction(ctx, adminID, lifted.GetKey().Encode()); err == nil {
+		t.Fatal("LiftSanction did not throw an error for a sanction that has ended.")
+	}
+
+	// the audit list keeps the past sanctions
+	if sanctions, err = GetSanctions(ctx, adminID, "", 0, 0); err != nil {
+		t.Fatalf("GetSanctions threw an error: %v", err)
+	}
+	if len(sanctions) != 2 || !sanctions[1].GetKey().Equal(silence.GetKey()) {
+		t.Fatalf("GetSanctions did not return every sanction. Got: %+v", sanctions)
+	}
+}
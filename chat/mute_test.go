@@ -2,12 +2,17 @@ package chat
 
 import (
 	"context"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"google.golang.org/appengine/datastore"
 
+	"github.com/benjamw/gogame/game"
 	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+	"github.com/benjamw/gogame/store/storetest"
 	"github.com/benjamw/golibs/db"
 	"github.com/benjamw/golibs/test"
 )
@@ -65,7 +70,153 @@ func TestMute(t *testing.T) {
 }
 
 func TestUnmute(t *testing.T) {
+	ctx := storetest.NewContext()
 
+	player := storetest.SavePlayer(ctx, t)
+	muted := storetest.SavePlayer(ctx, t)
+	other := storetest.SavePlayer(ctx, t)
+
+	for _, v := range []model.Player{muted, muted, other} {
+		if _, err := Mute(ctx, player.GetKey().Encode(), v.GetKey().Encode(), Scope{}, 0); err != nil {
+			t.Fatalf("Mute threw an error: %v", err)
+		}
+	}
+
+	if err := Unmute(ctx, player.GetKey().Encode(), muted.GetKey().Encode(), Scope{}, 0); err != nil {
+		t.Fatalf("Unmute threw an error: %v", err)
+	}
+
+	mutes, err := GetMuted(ctx, player.GetKey().Encode())
+	if err != nil {
+		t.Fatalf("GetMuted threw an error: %v", err)
+	}
+	if len(mutes) != 1 || !mutes[0].MutedKey.Equal(other.GetKey()) {
+		t.Fatalf("Unmute did not remove the mutes of the player. Got: %+v", mutes)
+	}
+}
+
+func TestScopedMutes(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	viewer := storetest.SavePlayer(ctx, t)
+	muted := storetest.SavePlayer(ctx, t)
+	viewerID, mutedID := viewer.GetKey().Encode(), muted.GetKey().Encode()
+
+	g := model.Game{
+		Type:       "scoped",
+		CreatorKey: muted.GetKey(),
+	}
+	if err := store.Save(ctx, &g); err != nil {
+		t.Fatalf("Could not save the test Game: %v", err)
+	}
+	gameRoom := model.Room{ID: g.ID}
+	if err := store.Save(ctx, &gameRoom); err != nil {
+		t.Fatalf("Could not save the test Room: %v", err)
+	}
+
+	room := storetest.SaveRoom(ctx, t)
+	roomScope := Scope{RoomID: room.GetKey().Encode()}
+	gameScope := Scope{GameID: strconv.FormatInt(g.ID, 10)}
+
+	isMuted := func(ctx context.Context, room model.Room) bool {
+		muted, err := mutedKeys(ctx, viewerID, room)
+		if err != nil {
+			t.Fatalf("mutedKeys threw an error: %v", err)
+		}
+
+		return muted[mutedID]
+	}
+
+	if _, err := Mute(ctx, viewerID, mutedID, gameScope, 0); err != nil {
+		t.Fatalf("Mute threw an error: %v", err)
+	}
+	if !isMuted(ctx, gameRoom) || isMuted(ctx, room) {
+		t.Fatal("The game mute did not apply to the game's room only.")
+	}
+
+	if _, err := Mute(ctx, viewerID, mutedID, Scope{}, time.Hour); err != nil {
+		t.Fatalf("Mute threw an error: %v", err)
+	}
+	if !isMuted(ctx, room) || isMuted(game.SetNow(ctx, time.Now().Add(2*time.Hour)), room) {
+		t.Fatal("The site-wide mute did not apply until it expired.")
+	}
+
+	// unmuting in a room the site-wide mute covers exempts the room
+	if err := Unmute(ctx, viewerID, mutedID, roomScope, 0); err != nil {
+		t.Fatalf("Unmute threw an error: %v", err)
+	}
+	if isMuted(ctx, room) || !isMuted(ctx, gameRoom) {
+		t.Fatal("The room exemption did not override the site-wide mute in the room only.")
+	}
+
+	if _, err := Mute(ctx, viewerID, mutedID, roomScope, 0); err != nil {
+		t.Fatalf("Mute threw an error: %v", err)
+	}
+	if !isMuted(ctx, room) {
+		t.Fatal("The room mute did not replace the room exemption.")
+	}
+
+	mutes, err := GetMuted(ctx, viewerID)
+	if err != nil {
+		t.Fatalf("GetMuted threw an error: %v", err)
+	}
+	if len(mutes) != 3 {
+		t.Fatalf("GetMuted returned the wrong mutes. Got: %+v", mutes)
+	}
+
+	if err = Unmute(ctx, viewerID, mutedID, Scope{}, 0); err != nil {
+		t.Fatalf("Unmute threw an error: %v", err)
+	}
+	if isMuted(ctx, room) || isMuted(ctx, gameRoom) {
+		t.Fatal("The site-wide unmute did not remove every mute.")
+	}
+
+	if _, err = Mute(ctx, viewerID, mutedID, Scope{RoomID: "1", GameID: "1"}, 0); err == nil {
+		t.Fatal("Mute did not throw an error for two scopes.")
+	}
+}
+
+func TestGetChatsMuted(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	viewer := storetest.SavePlayer(ctx, t)
+	talker := storetest.SavePlayer(ctx, t)
+	muted := storetest.SavePlayer(ctx, t)
+	room := storetest.SaveRoom(ctx, t, viewer, talker, muted)
+	roomID := room.GetKey().Encode()
+
+	if _, err := Mute(ctx, viewer.GetKey().Encode(), muted.GetKey().Encode(), Scope{}, 0); err != nil {
+		t.Fatalf("Mute threw an error: %v", err)
+	}
+
+	now := time.Now()
+	postChat(game.SetNow(ctx, now), t, room, talker, "shown")
+	postChat(game.SetNow(ctx, now.Add(time.Second)), t, room, muted, "hidden")
+
+	_, chats, _, err := GetChats(ctx, roomID, viewer.GetKey().Encode(), Page{})
+	if err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	if len(chats) != 1 || chats[0].Message != "shown" {
+		t.Fatalf("GetChats did not leave out the muted chat. Got: %+v", chats)
+	}
+
+	_, chats, _, err = GetChats(ctx, roomID, viewer.GetKey().Encode(), Page{IncludeMuted: true})
+	if err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	if len(chats) != 2 || !chats[0].Muted || chats[1].Muted {
+		t.Fatalf("GetChats did not mark the muted chat. Got: %+v", chats)
+	}
+
+	// mutes only apply to the player who set them
+	_, chats, _, err = GetChats(ctx, roomID, talker.GetKey().Encode(), Page{})
+	if err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	if len(chats) != 2 || chats[0].Muted {
+		t.Fatalf("GetChats applied another player's mutes. Got: %+v", chats)
+	}
 }
 
 // HELPER FUNCTIONS
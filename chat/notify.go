@@ -0,0 +1,427 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	netcontext "golang.org/x/net/context"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/delay"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/mail"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/pubsub"
+	"github.com/benjamw/gogame/store"
+)
+
+// MaxMentions is the most players notified of one chat
+const MaxMentions = 10
+
+// mentionPattern matches an @username that does not follow a word, such as in an email address
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.-]+)`)
+
+// Notifier is a Streamer that is also sent the player's notifications
+type Notifier interface {
+	Streamer
+
+	// Notify sends the notification to the client
+	Notify(note model.Notification) error
+}
+
+// notificationEvent is a notification as it is passed through the pub/sub broker
+type notificationEvent struct {
+	NotificationID string    `json:"notification_id"`
+	Kind           string    `json:"kind"`
+	FromID         string    `json:"from_id"`
+	RoomID         string    `json:"room_id"`
+	ChatID         string    `json:"chat_id"`
+	Message        string    `json:"message"`
+	Created        time.Time `json:"created"`
+}
+
+// playerTopic returns the pub/sub topic for the notifications of the player
+func playerTopic(playerKey *datastore.Key) string {
+	return "player/" + playerKey.Encode()
+}
+
+// publishNotification sends a saved notification to the streams of its player
+func publishNotification(ctx context.Context, note model.Notification) error {
+	data, err := json.Marshal(notificationEvent{
+		NotificationID: note.GetKey().Encode(),
+		Kind:           note.Kind,
+		FromID:         note.FromKey.Encode(),
+		RoomID:         note.RoomKey.Encode(),
+		ChatID:         note.ChatKey.Encode(),
+		Message:        note.Message,
+		Created:        note.Created,
+	})
+	if err != nil {
+		return err
+	}
+
+	return pubsub.Publish(ctx, playerTopic(note.PlayerKey), data)
+}
+
+// decodeNotification rebuilds the notification from a pub/sub message
+func decodeNotification(data []byte) (note model.Notification, myerr error) {
+	var e notificationEvent
+	if myerr = json.Unmarshal(data, &e); myerr != nil {
+		return
+	}
+
+	keys := []struct {
+		id  string
+		key **datastore.Key
+	}{
+		{e.FromID, &note.FromKey},
+		{e.RoomID, &note.RoomKey},
+		{e.ChatID, &note.ChatKey},
+	}
+	for _, v := range keys {
+		if *v.key, myerr = datastore.DecodeKey(v.id); myerr != nil {
+			return
+		}
+	}
+
+	var key *datastore.Key
+	if key, myerr = datastore.DecodeKey(e.NotificationID); myerr != nil {
+		return
+	}
+
+	note.SetKey(key)
+	note.PlayerKey = key.Parent()
+	note.Kind = e.Kind
+	note.Message = e.Message
+	note.Created = e.Created
+	note.Unread = true
+
+	return
+}
+
+// mentions returns the distinct usernames mentioned in the message, in the order they are mentioned
+func mentions(message string) (usernames []string) {
+	found := make(map[string]bool)
+	for _, v := range mentionPattern.FindAllStringSubmatch(message, -1) {
+		// a mention can end a sentence
+		username := strings.TrimRight(v[1], ".-")
+		if username == "" || found[username] {
+			continue
+		}
+		found[username] = true
+
+		usernames = append(usernames, username)
+	}
+
+	return
+}
+
+// newMentions returns the usernames mentioned in the message that were not mentioned in the previous one
+func newMentions(message, previous string) (usernames []string) {
+	mentioned := make(map[string]bool)
+	for _, v := range mentions(previous) {
+		mentioned[v] = true
+	}
+
+	for _, v := range mentions(message) {
+		if !mentioned[v] {
+			usernames = append(usernames, v)
+		}
+	}
+
+	if len(usernames) > MaxMentions {
+		usernames = usernames[:MaxMentions]
+	}
+
+	return
+}
+
+// queueMentions notifies the players the chat mentions that the previous message (if edited) did not,
+// once the request is done
+// The chat is saved, so a failed notification is only logged
+func queueMentions(ctx context.Context, chat model.Chat, previous string) {
+	if len(newMentions(chat.Message, previous)) == 0 {
+		return
+	}
+
+	if err := notifyLater(ctx, chat.GetKey().Encode(), chat.Message, previous); err != nil {
+		game.Errorf(ctx, "Could not notify the mentioned players: %v", err)
+	}
+}
+
+// notifyLater runs notifyChat in a task on App Engine, and in the background outside of it
+// It is a variable so the tests can notify the players right away
+var notifyLater = func(ctx context.Context, chatID, message, previous string) error {
+	if game.AppEngine {
+		return NotifyMentionsDelay.Call(ctx, chatID, message, previous)
+	}
+
+	// no task queue outside of App Engine, so notify them once the request is done with the context
+	ctx = context.WithoutCancel(ctx)
+	notifying.Add(1)
+	go func() {
+		defer notifying.Done()
+
+		if err := notifyChat(ctx, chatID, message, previous); err != nil {
+			game.Errorf(ctx, "Could not notify the mentioned players: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// notifying counts the mentions being notified in the background
+var notifying sync.WaitGroup
+
+// WaitForNotifications waits until the mentions being notified in the background are done,
+// so a server that is shutting down doesn't drop them
+func WaitForNotifications() {
+	notifying.Wait()
+}
+
+// NotifyMentionsDelay runs notifyChat in a task, so the mentioned players are notified after the request
+var NotifyMentionsDelay = delay.Func("notify_mentions", notifyChat)
+
+// notifyChat notifies the players mentioned in the message of the chat that the previous message did not mention
+// The message is the one the chat was saved with, as the chat may have been edited again since
+func notifyChat(ctx netcontext.Context, chatID, message, previous string) (myerr error) {
+	c := game.ConvertOldContext(ctx)
+
+	var chat model.Chat
+	if myerr = store.LoadS(c, chatID, &chat); myerr != nil {
+		return
+	}
+
+	if chat.IsDeleted() {
+		return
+	}
+	chat.Message = message
+
+	var room model.Room
+	if myerr = store.Load(c, chat.RoomKey, &room); myerr != nil {
+		return
+	}
+
+	var author model.Player
+	if myerr = store.Load(c, chat.PlayerKey, &author); myerr != nil {
+		return
+	}
+
+	_, myerr = notifyMentions(c, room, author, chat, previous)
+
+	return
+}
+
+// notifyMentions notifies the players mentioned in the chat that the previous message did not mention,
+// and returns the notifications
+// Players who can't read the room, or who have muted the author there, are not notified
+func notifyMentions(ctx context.Context, room model.Room, author model.Player, chat model.Chat, previous string) (notes model.NotificationList, myerr error) {
+	usernames := newMentions(chat.Message, previous)
+
+	for _, username := range usernames {
+		var player model.Player
+		if myerr = player.ByUsername(ctx, username); myerr != nil {
+			if _, ok := myerr.(*db.UnfoundObjectError); ok {
+				myerr = nil
+				continue
+			}
+			return
+		}
+
+		if player.GetKey().Equal(author.GetKey()) {
+			continue
+		}
+
+		var ok bool
+		if ok, myerr = canNotify(ctx, player, room, author); myerr != nil {
+			return
+		} else if !ok {
+			continue
+		}
+
+		// a task that is run again finds the players it already notified
+		var sent model.Notification
+		if err := sent.ByChat(ctx, player.GetKey(), chat.GetKey()); err == nil {
+			continue
+		} else if _, ok := err.(*db.UnfoundObjectError); !ok {
+			myerr = err
+			return
+		}
+
+		note := model.Notification{
+			PlayerKey: player.GetKey(),
+			Kind:      model.NotificationMention,
+			FromKey:   author.GetKey(),
+			RoomKey:   room.GetKey(),
+			ChatKey:   chat.GetKey(),
+			Message:   chat.Message,
+		}
+		if myerr = store.Save(ctx, &note); myerr != nil {
+			return
+		}
+
+		deliver(ctx, player, author, room, note)
+
+		notes = append(notes, note)
+	}
+
+	return
+}
+
+// canNotify returns true if the player can read the room and has not muted the author in it
+func canNotify(ctx context.Context, player model.Player, room model.Room, author model.Player) (ok bool, myerr error) {
+	myerr = checkMember(ctx, player.GetKey(), room)
+	if myerr == nil {
+		myerr = checkSanctions(ctx, player.GetKey(), room, model.SanctionBan)
+	}
+	if myerr != nil {
+		// players kept out of the room are not told about it
+		if _, denied := myerr.(*game.UserError); denied {
+			myerr = nil
+		}
+		return
+	}
+
+	muted, myerr := mutedKeys(ctx, player.GetKey().Encode(), room)
+	if myerr != nil {
+		return
+	}
+
+	ok = !muted[author.GetKey().Encode()]
+
+	return
+}
+
+// deliver pushes the notification to the player's open streams and emails it, as the player prefers
+// The notification is already saved, so a failed delivery is only logged
+func deliver(ctx context.Context, player, author model.Player, room model.Room, note model.Notification) {
+	push, email := player.NotifyBy()
+
+	if push {
+		if err := publishNotification(ctx, note); err != nil {
+			game.Errorf(ctx, "Could not publish the notification: %v", err)
+		}
+	}
+
+	if email && player.Email != "" {
+		roomID := room.GetKey().Encode()
+
+		var err error
+		if game.AppEngine {
+			err = SendMentionEmailDelay.Call(ctx, player.Email, author.Username, room.Name, roomID, note.Message)
+		} else {
+			// no task queue outside of App Engine, so send it now
+			err = sendMentionEmail(ctx, player.Email, author.Username, room.Name, roomID, note.Message)
+		}
+		if err != nil {
+			game.Errorf(ctx, "Could not email the notification: %v", err)
+		}
+	}
+}
+
+// SendMentionEmailDelay runs sendMentionEmail in a task, so the request does not wait on the mail service
+var SendMentionEmailDelay = delay.Func("mention_email", sendMentionEmail)
+
+// sendMentionEmail emails a player that they were mentioned in a room
+func sendMentionEmail(ctx netcontext.Context, email, from, room, roomID, message string) error {
+	ctx = game.ConvertOldContext(ctx)
+
+	params := map[string]interface{}{
+		"from":    from,
+		"room":    room,
+		"room_id": roomID,
+		"message": message,
+	}
+
+	return mail.FromTemplate(ctx, "mention", []string{email}, params, nil)
+}
+
+// GetNotifications gets up to limit of the player's unread notifications, newest first
+func GetNotifications(ctx context.Context, playerID string, limit int) (notes model.NotificationList, myerr error) {
+	if limit < 0 || MaxLimit < limit {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Invalid limit: %d (at most %d)", limit, MaxLimit)
+		return
+	}
+
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	myerr = notes.Unread(ctx, playerKey, limit)
+
+	return
+}
+
+// MarkRead marks the player's notifications with the given IDs read, or every unread one if no IDs are given,
+// and returns the number marked
+func MarkRead(ctx context.Context, playerID string, notificationIDs []string) (num int, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	var notes model.NotificationList
+	if len(notificationIDs) == 0 {
+		if myerr = notes.Unread(ctx, playerKey, 0); myerr != nil {
+			return
+		}
+	} else {
+		notes = make(model.NotificationList, len(notificationIDs))
+		for k, id := range notificationIDs {
+			if myerr = store.LoadS(ctx, id, &notes[k]); myerr != nil {
+				return
+			}
+
+			if !notes[k].PlayerKey.Equal(playerKey) {
+				myerr = game.NewUserError(nil, http.StatusForbidden, "That is not your notification")
+				return
+			}
+		}
+	}
+
+	now := game.Now(ctx)
+	for k := range notes {
+		if !notes[k].Unread {
+			continue
+		}
+
+		notes[k].Unread = false
+		notes[k].Read = now
+		if myerr = store.Save(ctx, &notes[k]); myerr != nil {
+			return
+		}
+
+		num++
+	}
+
+	return
+}
+
+// SetNotify sets how the player is told about notifications, besides the list of notifications
+func SetNotify(ctx context.Context, playerID, notify string) (player model.Player, myerr error) {
+	if !model.ValidNotify(notify) {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Invalid notify: %s (%s, %s, %s or %s)", notify,
+			model.NotifyPush, model.NotifyEmail, model.NotifyAll, model.NotifyNone)
+		return
+	}
+
+	if myerr = store.LoadS(ctx, playerID, &player); myerr != nil {
+		return
+	}
+
+	player.Notify = notify
+	myerr = store.Save(ctx, &player)
+
+	return
+}
@@ -0,0 +1,149 @@
+package chat
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store/storetest"
+)
+
+// testNotifier collects the streamed chats and notifications
+type testNotifier struct {
+	testStreamer
+	notes chan model.Notification
+}
+
+func (s *testNotifier) Notify(note model.Notification) error {
+	s.notes <- note
+	return nil
+}
+
+func TestMentions(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	// notify the players right away instead of once the request is done
+	defer func(f func(context.Context, string, string, string) error) { notifyLater = f }(notifyLater)
+	notifyLater = func(ctx context.Context, chatID, message, previous string) error {
+		return notifyChat(ctx, chatID, message, previous)
+	}
+
+	got := mentions("@ann, mail bob@example.com or @carl. @ann again, @d-e-")
+	if want := []string{"ann", "carl", "d-e"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("mentions returned the wrong usernames. Wanted: %v; Got: %v", want, got)
+	}
+
+	author, reader, muter, outsider := storetest.SavePlayer(ctx, t), storetest.SavePlayer(ctx, t), storetest.SavePlayer(ctx, t), storetest.SavePlayer(ctx, t)
+	readerID := reader.GetKey().Encode()
+	room := storetest.SaveRoom(ctx, t, author, reader, muter)
+	roomID := room.GetKey().Encode()
+
+	if _, err := Mute(ctx, muter.GetKey().Encode(), author.GetKey().Encode(), Scope{}, 0); err != nil {
+		t.Fatalf("Mute threw an error: %v", err)
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	s := &testNotifier{
+		testStreamer: testStreamer{
+			chats: make(chan model.Chat, 10),
+			ready: make(chan bool, 1),
+		},
+		notes: make(chan model.Notification, 10),
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- StreamChats(streamCtx, roomID, readerID, "", false, s)
+	}()
+
+	select {
+	case <-s.ready:
+	case err := <-done:
+		t.Fatalf("StreamChats threw an error: %v", err)
+	}
+
+	message := "@" + reader.Username + " @" + muter.Username + " @" + outsider.Username + " @" + author.Username + " @nobody"
+	chat, err := AddChat(ctx, roomID, author.GetKey().Encode(), message)
+	if err != nil {
+		t.Fatalf("AddChat threw an error: %v", err)
+	}
+
+	select {
+	case note := <-s.notes:
+		if note.Kind != model.NotificationMention || !note.ChatKey.Equal(chat.GetKey()) || !note.FromKey.Equal(author.GetKey()) {
+			t.Fatalf("StreamChats sent the wrong notification. Got: %+v", note)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("StreamChats did not send the notification.")
+	}
+
+	cancel()
+	if err = <-done; err != nil {
+		t.Fatalf("StreamChats threw an error when closed: %v", err)
+	}
+
+	for _, v := range []model.Player{muter, outsider, author} {
+		if notes, err := GetNotifications(ctx, v.GetKey().Encode(), 0); err != nil || len(notes) != 0 {
+			t.Fatalf("AddChat notified a player who should not be. Got: %+v, %v", notes, err)
+		}
+	}
+
+	notes, err := GetNotifications(ctx, readerID, 0)
+	if err != nil {
+		t.Fatalf("GetNotifications threw an error: %v", err)
+	}
+	if len(notes) != 1 || notes[0].Message != message {
+		t.Fatalf("GetNotifications returned the wrong notifications. Got: %+v", notes)
+	}
+	noteID := notes[0].GetKey().Encode()
+
+	if _, err = MarkRead(ctx, author.GetKey().Encode(), []string{noteID}); err == nil {
+		t.Fatal("MarkRead did not throw an error for another player's notification.")
+	}
+
+	if num, err := MarkRead(ctx, readerID, []string{noteID}); err != nil || num != 1 {
+		t.Fatalf("MarkRead did not mark the notification read. Got: %d, %v", num, err)
+	}
+
+	if notes, err = GetNotifications(ctx, readerID, 0); err != nil || len(notes) != 0 {
+		t.Fatalf("GetNotifications returned a read notification. Got: %+v, %v", notes, err)
+	}
+
+	// a notifying task that is run again does not notify the players twice
+	if err = notifyChat(ctx, chat.GetKey().Encode(), message, ""); err != nil {
+		t.Fatalf("notifyChat threw an error: %v", err)
+	}
+	if notes, err = GetNotifications(ctx, readerID, 0); err != nil || len(notes) != 0 {
+		t.Fatalf("notifyChat notified a player again. Got: %+v, %v", notes, err)
+	}
+
+	if _, err = SetNotify(ctx, readerID, "pigeon"); err == nil {
+		t.Fatal("SetNotify did not throw an error for an invalid setting.")
+	}
+	if _, err = SetNotify(ctx, readerID, model.NotifyNone); err != nil {
+		t.Fatalf("SetNotify threw an error: %v", err)
+	}
+
+	if _, err = AddChat(ctx, roomID, author.GetKey().Encode(), "again @"+reader.Username); err != nil {
+		t.Fatalf("AddChat threw an error: %v", err)
+	}
+	if num, err := MarkRead(ctx, readerID, nil); err != nil || num != 1 {
+		t.Fatalf("MarkRead did not mark every notification read. Got: %d, %v", num, err)
+	}
+
+	hello, err := AddChat(ctx, roomID, author.GetKey().Encode(), "hello")
+	if err != nil {
+		t.Fatalf("AddChat threw an error: %v", err)
+	}
+	for _, v := range []string{"hello @" + reader.Username, "hello again @" + reader.Username} {
+		if _, err = EditChat(ctx, author.GetKey().Encode(), hello.GetKey().Encode(), v); err != nil {
+			t.Fatalf("EditChat threw an error: %v", err)
+		}
+	}
+
+	if notes, err = GetNotifications(ctx, readerID, 0); err != nil || len(notes) != 1 || notes[0].Message != "hello @"+reader.Username {
+		t.Fatalf("EditChat did not notify only the newly mentioned players. Got: %+v, %v", notes, err)
+	}
+}
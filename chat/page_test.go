@@ -0,0 +1,114 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benjamw/golibs/test"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store/storetest"
+)
+
+func TestGetChatsPage(t *testing.T) {
+	ctx := storetest.NewContext()
+	now := time.Now()
+
+	player := storetest.SavePlayer(ctx, t)
+	room := storetest.SaveRoom(ctx, t, player)
+	roomID := room.GetKey().Encode()
+
+	// the third and fourth chats are posted at the same time
+	offsets := []time.Duration{0, 1, 2, 2, 3, 4}
+	chats := make(model.ChatList, len(offsets))
+	for k, v := range offsets {
+		chats[k] = postChat(game.SetNow(ctx, now.Add(v*time.Second)), t, room, player, string(rune('a'+k)))
+	}
+
+	_, got, next, err := GetChats(ctx, roomID, player.GetKey().Encode(), Page{Limit: 2})
+	if err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	checkPage(t, got, chats[5], chats[4])
+	if next != chats[4].Cursor() {
+		t.Fatalf("GetChats returned the wrong next cursor. Wanted: %s; Got: %s", chats[4].Cursor(), next)
+	}
+
+	// the chats posted at the same time are paged through by key, one at a time
+	_, got, next, err = GetChats(ctx, roomID, player.GetKey().Encode(), Page{Limit: 1, Before: next})
+	if err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	checkPage(t, got, chats[3])
+
+	_, got, next, err = GetChats(ctx, roomID, player.GetKey().Encode(), Page{Limit: 1, Before: next})
+	if err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	checkPage(t, got, chats[2])
+
+	_, got, next, err = GetChats(ctx, roomID, player.GetKey().Encode(), Page{Limit: 2, Before: next})
+	if err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	checkPage(t, got, chats[1], chats[0])
+	if next != "" {
+		t.Fatalf("GetChats returned a next cursor on the last page. Got: %s", next)
+	}
+
+	_, got, next, err = GetChats(ctx, roomID, player.GetKey().Encode(), Page{Limit: 2, After: chats[0].Cursor()})
+	if err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	checkPage(t, got, chats[2], chats[1])
+	if next != chats[2].Cursor() {
+		t.Fatalf("GetChats returned the wrong next cursor. Wanted: %s; Got: %s", chats[2].Cursor(), next)
+	}
+
+	_, got, next, err = GetChats(ctx, roomID, player.GetKey().Encode(), Page{Limit: 2, After: next})
+	if err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	checkPage(t, got, chats[4], chats[3])
+	if next != chats[4].Cursor() {
+		t.Fatalf("GetChats returned the wrong next cursor. Wanted: %s; Got: %s", chats[4].Cursor(), next)
+	}
+
+	_, got, _, err = GetChatsAfter(ctx, roomID, player.GetKey().Encode(), chats[4].Created, Page{})
+	if err != nil {
+		t.Fatalf("GetChatsAfter threw an error: %v", err)
+	}
+	checkPage(t, got, chats[5], chats[4])
+
+	for _, page := range []Page{{Limit: MaxLimit + 1}, {Before: "bad"}, {Before: next, After: next}} {
+		if _, _, _, err = GetChats(ctx, roomID, player.GetKey().Encode(), page); err == nil {
+			t.Fatalf("GetChats did not throw an error for the invalid page: %+v", page)
+		}
+	}
+}
+
+// checkPage fails the test if the chats are not the wanted chats in order
+func checkPage(t *testing.T, chats model.ChatList, want ...model.Chat) {
+	file, line, funct := test.GetCaller()
+
+	got := make([]string, len(chats))
+	for k := range chats {
+		got[k] = chats[k].Message
+	}
+
+	wanted := make([]string, len(want))
+	for k := range want {
+		wanted[k] = want[k].Message
+	}
+
+	if len(got) != len(wanted) {
+		t.Fatalf("Wrong page. Func: %s; File: %s; Line: %d; Wanted: %v; Got: %v", funct, file, line, wanted, got)
+	}
+
+	for k := range got {
+		if got[k] != wanted[k] {
+			t.Fatalf("Wrong page. Func: %s; File: %s; Line: %d; Wanted: %v; Got: %v", funct, file, line, wanted, got)
+		}
+	}
+}
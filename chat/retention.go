@@ -0,0 +1,68 @@
+package chat
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+)
+
+// purgeBatch is the most expired chats deleted from a room by a single Purge
+const purgeBatch = 100
+
+// SetRetention sets the retention policy of the given room,
+// keeping the newest keepLast chats and the chats younger than maxAge seconds (0 for no limit)
+// Only admins can set the retention policy
+func SetRetention(ctx context.Context, adminID, roomID string, keepLast, maxAge int64) (room model.Room, myerr error) {
+	if _, myerr = loadAdmin(ctx, adminID); myerr != nil {
+		return
+	}
+
+	if keepLast < 0 || maxAge < 0 {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Invalid retention: keep_last %d, max_age %d", keepLast, maxAge)
+		return
+	}
+
+	r, myerr := findRoom(ctx, roomID)
+	if myerr != nil {
+		return
+	}
+
+	r.KeepLast = keepLast
+	r.MaxAge = maxAge
+	if myerr = store.Save(ctx, &r); myerr != nil {
+		return
+	}
+
+	// the chats past the new limit are hidden right away, not at the next purge
+	if myerr = r.UpdateKeptFrom(ctx); myerr != nil {
+		return
+	}
+
+	room = r
+
+	return
+}
+
+// Purge deletes the expired chats from the rooms with a retention policy,
+// up to purgeBatch chats per room, and returns the number of chats deleted
+func Purge(ctx context.Context) (num int, myerr error) {
+	var rooms model.RoomList
+	if myerr = rooms.WithRetention(ctx); myerr != nil {
+		return
+	}
+
+	for k := range rooms {
+		// one broken room should not hold up the rest of the purge
+		n, err := rooms[k].ClearExpired(ctx, purgeBatch)
+		if err != nil {
+			game.Errorf(ctx, "Could not purge the chats in room %s: %v", rooms[k].GetKey().Encode(), err)
+		}
+
+		num += n
+	}
+
+	return
+}
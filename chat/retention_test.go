@@ -0,0 +1,100 @@
+package chat
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+	"github.com/benjamw/gogame/store/storetest"
+)
+
+func TestRetention(t *testing.T) {
+	ctx := storetest.NewContext()
+	now := time.Now()
+
+	admin := storetest.SavePlayer(ctx, t)
+	admin.IsAdmin = true
+	if err := store.Save(ctx, &admin); err != nil {
+		t.Fatalf("Could not save the test admin: %v", err)
+	}
+	adminID := admin.GetKey().Encode()
+
+	player := storetest.SavePlayer(ctx, t)
+	playerID := player.GetKey().Encode()
+
+	room := storetest.SaveRoom(ctx, t, player)
+	roomID := room.GetKey().Encode()
+
+	chats := make(model.ChatList, 5)
+	for k := range chats {
+		chats[k] = postChat(game.SetNow(ctx, now.Add(time.Duration(k)*time.Second)), t, room, player, strconv.Itoa(k))
+	}
+
+	if _, err := SetRetention(ctx, playerID, roomID, 3, 0); err == nil {
+		t.Fatal("SetRetention did not throw an error for a player who is not an admin.")
+	}
+
+	if _, err := SetRetention(ctx, adminID, roomID, 3, 0); err != nil {
+		t.Fatalf("SetRetention threw an error: %v", err)
+	}
+
+	_, got, next, err := GetChats(ctx, roomID, playerID, Page{Limit: 2})
+	if err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	checkPage(t, got, chats[4], chats[3])
+
+	_, got, next, err = GetChats(ctx, roomID, playerID, Page{Limit: 2, Before: next})
+	if err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	checkPage(t, got, chats[2])
+	if next != "" {
+		t.Fatalf("GetChats returned a next cursor past the kept chats. Got: %s", next)
+	}
+
+	_, got, _, err = GetChats(ctx, roomID, playerID, Page{After: chats[0].Cursor()})
+	if err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	checkPage(t, got, chats[4], chats[3], chats[2])
+
+	// a new chat pushes the oldest kept chat out at the next purge
+	newest := postChat(game.SetNow(ctx, now.Add(5*time.Second)), t, room, player, "5")
+	if _, got, _, err = GetChats(ctx, roomID, playerID, Page{}); err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	checkPage(t, got, newest, chats[4], chats[3], chats[2])
+
+	if _, err = Purge(ctx); err != nil {
+		t.Fatalf("Purge threw an error: %v", err)
+	}
+
+	if _, got, _, err = GetChats(ctx, roomID, playerID, Page{}); err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	checkPage(t, got, newest, chats[4], chats[3])
+
+	if _, err = SetRetention(ctx, adminID, roomID, 0, 10); err != nil {
+		t.Fatalf("SetRetention threw an error: %v", err)
+	}
+
+	later := game.SetNow(ctx, now.Add(12500*time.Millisecond))
+	if _, got, _, err = GetChats(later, roomID, playerID, Page{}); err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	checkPage(t, got, newest, chats[4], chats[3])
+
+	if _, err = Purge(later); err != nil {
+		t.Fatalf("Purge threw an error: %v", err)
+	}
+
+	var left model.ChatList
+	if err = left.ByRoom(ctx, room.GetKey()); err != nil {
+		t.Fatalf("ChatList.ByRoom threw an error: %v", err)
+	}
+	checkPage(t, left, newest, chats[4], chats[3])
+}
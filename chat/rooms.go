@@ -0,0 +1,341 @@
+package chat
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+)
+
+// CreateGroup creates a private group room with the given player and the players with the given IDs as members
+func CreateGroup(ctx context.Context, playerID, name string, memberIDs []string) (room model.Room, members model.MemberList, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	if name == "" {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "A name is required")
+		return
+	}
+
+	keys := []*datastore.Key{playerKey}
+	listed := map[string]bool{playerID: true}
+	for _, v := range memberIDs {
+		if v == "" || listed[v] {
+			continue
+		}
+		listed[v] = true
+
+		var key *datastore.Key
+		if key, myerr = datastore.DecodeKey(v); myerr != nil {
+			return
+		}
+
+		keys = append(keys, key)
+	}
+
+	var players model.PlayerList
+	if myerr = players.ByKeys(ctx, keys); myerr != nil {
+		return
+	}
+
+	r := model.Room{
+		Name: name,
+		Type: model.RoomGroup,
+	}
+	if myerr = store.Save(ctx, &r); myerr != nil {
+		return
+	}
+
+	for k := range players {
+		if myerr = addMember(ctx, &r, &members, players[k].GetKey()); myerr != nil {
+			return
+		}
+	}
+
+	room = r
+
+	return
+}
+
+// CreateDirect returns the direct message room between the given players, creating it if needed
+func CreateDirect(ctx context.Context, playerID, otherID string) (room model.Room, members model.MemberList, myerr error) {
+	var playerKey, otherKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+	if otherKey, myerr = datastore.DecodeKey(otherID); myerr != nil {
+		return
+	}
+
+	if playerKey.Equal(otherKey) {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "You can't message yourself")
+		return
+	}
+
+	var players model.PlayerList
+	if myerr = players.ByKeys(ctx, []*datastore.Key{playerKey, otherKey}); myerr != nil {
+		return
+	}
+
+	// the room's key is named for the two players, so both of them always find the same room
+	key := model.DirectRoomKey(ctx, playerKey, otherKey)
+	myerr = store.RunInTransaction(ctx, func(ctx context.Context) (err error) {
+		var r model.Room
+		if err = store.Load(ctx, key, &r); err == nil {
+			room = r
+			return members.ByRoom(ctx, key)
+		} else if _, ok := err.(*db.UnfoundObjectError); !ok {
+			return
+		}
+
+		r = model.Room{
+			Name: players[0].Username + ", " + players[1].Username,
+			Type: model.RoomDirect,
+		}
+		r.SetKey(key)
+		if err = store.Save(ctx, &r); err != nil {
+			return
+		}
+
+		members = nil
+		for k := range players {
+			if err = addMember(ctx, &r, &members, players[k].GetKey()); err != nil {
+				return
+			}
+		}
+
+		room = r
+
+		return
+	})
+
+	return
+}
+
+// AddMember adds the player with the given memberID to the given private group
+// Only members of the group can add players to it
+func AddMember(ctx context.Context, playerID, roomID, memberID string) (member model.Member, myerr error) {
+	room, myerr := loadRoom(ctx, roomID, playerID)
+	if myerr != nil {
+		return
+	}
+
+	if room.RoomType() != model.RoomGroup {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Players can only be added to private groups")
+		return
+	}
+
+	var player model.Player
+	if myerr = store.LoadS(ctx, memberID, &player); myerr != nil {
+		return
+	}
+
+	var members model.MemberList
+	if myerr = members.ByRoom(ctx, room.GetKey()); myerr != nil {
+		return
+	}
+
+	if found, ok := members.Find(player.GetKey()); ok {
+		member = *found
+		return
+	}
+
+	if myerr = addMember(ctx, &room, &members, player.GetKey()); myerr != nil {
+		return
+	}
+
+	member = members[len(members)-1]
+
+	return
+}
+
+// GetMembers returns the members of the given private room
+func GetMembers(ctx context.Context, playerID, roomID string) (room model.Room, members model.MemberList, myerr error) {
+	if room, myerr = loadRoom(ctx, roomID, playerID); myerr != nil {
+		return
+	}
+
+	if !room.Private() {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Only private rooms have members")
+		return
+	}
+
+	myerr = members.ByRoom(ctx, room.GetKey())
+
+	return
+}
+
+// GetRooms returns the rooms the player belongs to:
+// the lobby, the rooms of the games the player is seated in that are not over,
+// and the private groups and direct messages the player is a member of
+func GetRooms(ctx context.Context, playerID string) (rooms model.RoomList, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	return playerRooms(ctx, playerKey)
+}
+
+// playerRooms returns the rooms the player belongs to
+func playerRooms(ctx context.Context, playerKey *datastore.Key) (rooms model.RoomList, myerr error) {
+	var lobby model.Room
+	if myerr = lobby.ByID(ctx, 0); myerr == nil {
+		rooms = append(rooms, lobby)
+	} else if _, ok := myerr.(*db.UnfoundObjectError); !ok {
+		return
+	}
+	myerr = nil
+
+	var seats model.SeatList
+	if myerr = seats.ByPlayer(ctx, playerKey); myerr != nil {
+		return
+	}
+
+	for _, v := range seats {
+		var g model.Game
+		if myerr = g.ByID(ctx, v.GameKey.IntID()); myerr != nil {
+			return
+		}
+
+		if g.IsOver() {
+			continue
+		}
+
+		var room model.Room
+		if myerr = room.ByID(ctx, g.ID); myerr != nil {
+			if _, ok := myerr.(*db.UnfoundObjectError); !ok {
+				return
+			}
+
+			myerr = nil
+			continue
+		}
+
+		rooms = append(rooms, room)
+	}
+
+	var members model.MemberList
+	if myerr = members.ByPlayer(ctx, playerKey); myerr != nil {
+		return
+	}
+
+	for _, v := range members {
+		var room model.Room
+		if myerr = store.Load(ctx, v.RoomKey, &room); myerr != nil {
+			return
+		}
+
+		rooms = append(rooms, room)
+	}
+
+	return
+}
+
+// findRoom loads the room with the given ID: 0 for the lobby, a game's ID for the game's room,
+// or the encoded key of any room, which is the only way to name a private room
+func findRoom(ctx context.Context, roomID string) (room model.Room, myerr error) {
+	if id, err := strconv.ParseInt(roomID, 10, 64); err == nil {
+		myerr = room.ByID(ctx, id)
+		return
+	}
+
+	var key *datastore.Key
+	if key, myerr = datastore.DecodeKey(roomID); myerr != nil {
+		myerr = game.NewUserError(myerr, http.StatusBadRequest, "Invalid room ID: %s", roomID)
+		return
+	}
+
+	if key.Kind() != room.EntityType() {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Invalid room ID: %s", roomID)
+		return
+	}
+
+	myerr = store.Load(ctx, key, &room)
+
+	return
+}
+
+// loadRoom loads the room with the given ID, and returns an error if the player can't use it
+func loadRoom(ctx context.Context, roomID, playerID string) (room model.Room, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	if room, myerr = findRoom(ctx, roomID); myerr != nil {
+		return
+	}
+
+	myerr = checkMember(ctx, playerKey, room)
+
+	return
+}
+
+// checkMember returns an error if the player can't read or post in the room
+// The lobby is open to everybody, game rooms to the players seated in the game,
+// and private rooms to their members; admins can use every room
+func checkMember(ctx context.Context, playerKey *datastore.Key, room model.Room) (myerr error) {
+	switch room.RoomType() {
+	case model.RoomLobby:
+		return
+	case model.RoomGame:
+		var g model.Game
+		if myerr = g.ByID(ctx, room.ID); myerr != nil {
+			return
+		}
+
+		var seats model.SeatList
+		if myerr = seats.ByGame(ctx, g.GetKey()); myerr != nil {
+			return
+		}
+
+		if _, ok := seats.Find(playerKey); ok {
+			return
+		}
+	default:
+		var member model.Member
+		if myerr = member.ByRoom(ctx, room.GetKey(), playerKey); myerr == nil {
+			return
+		} else if _, ok := myerr.(*db.UnfoundObjectError); !ok {
+			return
+		}
+	}
+
+	var player model.Player
+	if myerr = store.Load(ctx, playerKey, &player); myerr != nil {
+		return
+	}
+
+	if !player.IsAdmin {
+		myerr = game.NewUserError(nil, http.StatusForbidden, "You are not a member of this room")
+		return
+	}
+
+	myerr = nil
+
+	return
+}
+
+// addMember saves the player as a member of the room and adds them to the list
+func addMember(ctx context.Context, room *model.Room, members *model.MemberList, playerKey *datastore.Key) (myerr error) {
+	m := model.Member{
+		RoomKey:   room.GetKey(),
+		PlayerKey: playerKey,
+	}
+	if myerr = store.Save(ctx, &m); myerr != nil {
+		return
+	}
+
+	*members = append(*members, m)
+
+	return
+}
@@ -0,0 +1,150 @@
+package chat
+
+import (
+	"strconv"
+	"testing"
+
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+	"github.com/benjamw/gogame/store/storetest"
+)
+
+func TestPrivateRooms(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	a, b, c := storetest.SavePlayer(ctx, t), storetest.SavePlayer(ctx, t), storetest.SavePlayer(ctx, t)
+	aID, bID, cID := a.GetKey().Encode(), b.GetKey().Encode(), c.GetKey().Encode()
+
+	direct, members, err := CreateDirect(ctx, aID, bID)
+	if err != nil {
+		t.Fatalf("CreateDirect threw an error: %v", err)
+	}
+	if direct.RoomType() != model.RoomDirect || len(members) != 2 {
+		t.Fatalf("CreateDirect returned the wrong room. Got: %+v; Members: %d", direct, len(members))
+	}
+	directID := direct.GetKey().Encode()
+
+	again, _, err := CreateDirect(ctx, bID, aID)
+	if err != nil {
+		t.Fatalf("CreateDirect threw an error: %v", err)
+	}
+	if !again.GetKey().Equal(direct.GetKey()) {
+		t.Fatalf("CreateDirect did not return the existing room. Wanted: %v; Got: %v", direct.GetKey(), again.GetKey())
+	}
+
+	if _, _, err = CreateDirect(ctx, aID, aID); err == nil {
+		t.Fatal("CreateDirect did not throw an error for a direct message to yourself.")
+	}
+
+	if _, err = AddChat(ctx, directID, aID, "hi"); err != nil {
+		t.Fatalf("AddChat threw an error: %v", err)
+	}
+	if _, err = AddChat(ctx, directID, cID, "hi"); err == nil {
+		t.Fatal("AddChat did not throw an error for a player who is not a member.")
+	}
+	if _, _, _, err = GetChats(ctx, directID, cID, Page{}); err == nil {
+		t.Fatal("GetChats did not throw an error for a player who is not a member.")
+	}
+	if _, err = AddMember(ctx, aID, directID, cID); err == nil {
+		t.Fatal("AddMember did not throw an error for a direct message.")
+	}
+
+	group, members, err := CreateGroup(ctx, aID, "group", []string{bID, aID, ""})
+	if err != nil {
+		t.Fatalf("CreateGroup threw an error: %v", err)
+	}
+	if group.RoomType() != model.RoomGroup || len(members) != 2 {
+		t.Fatalf("CreateGroup returned the wrong room. Got: %+v; Members: %d", group, len(members))
+	}
+	groupID := group.GetKey().Encode()
+
+	if _, err = AddMember(ctx, cID, groupID, cID); err == nil {
+		t.Fatal("AddMember did not throw an error for a player who is not a member.")
+	}
+	if _, err = AddMember(ctx, bID, groupID, cID); err != nil {
+		t.Fatalf("AddMember threw an error: %v", err)
+	}
+
+	if _, members, err = GetMembers(ctx, cID, groupID); err != nil {
+		t.Fatalf("GetMembers threw an error: %v", err)
+	}
+	if len(members) != 3 {
+		t.Fatalf("GetMembers returned the wrong members. Wanted: 3; Got: %d", len(members))
+	}
+
+	rooms, err := GetRooms(ctx, cID)
+	if err != nil {
+		t.Fatalf("GetRooms threw an error: %v", err)
+	}
+
+	var found bool
+	for _, v := range rooms {
+		if v.GetKey().Equal(direct.GetKey()) {
+			t.Fatal("GetRooms returned a direct message the player is not in.")
+		}
+
+		if v.GetKey().Equal(group.GetKey()) {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("GetRooms did not return the player's group.")
+	}
+
+	// a game with the same ID as the group gets a room of its own
+	g := model.Game{
+		ID:         group.ID,
+		Type:       "rooms",
+		CreatorKey: a.GetKey(),
+	}
+	if err = store.Save(ctx, &g); err != nil {
+		t.Fatalf("Could not save the test Game: %v", err)
+	}
+	gameRoom := model.Room{ID: g.ID, Type: model.RoomGame}
+	if err = store.Save(ctx, &gameRoom); err != nil {
+		t.Fatalf("Could not save the test Room: %v", err)
+	}
+
+	for id, want := range map[string]model.Room{strconv.FormatInt(g.ID, 10): gameRoom, groupID: group} {
+		room, err := findRoom(ctx, id)
+		if err != nil {
+			t.Fatalf("findRoom threw an error: %v", err)
+		}
+		if !room.GetKey().Equal(want.GetKey()) || room.RoomType() != want.RoomType() {
+			t.Fatalf("findRoom returned the wrong room for %s. Wanted: %v; Got: %v", id, want.GetKey(), room.GetKey())
+		}
+	}
+}
+
+func TestLegacyGameRoom(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	player := storetest.SavePlayer(ctx, t)
+	g := model.Game{
+		Type:       "rooms",
+		CreatorKey: player.GetKey(),
+	}
+	if err := store.Save(ctx, &g); err != nil {
+		t.Fatalf("Could not save the test Game: %v", err)
+	}
+
+	// game rooms used to be kept at the root, under the game's ID
+	legacy := model.Room{ID: g.ID}
+	legacy.SetKey(datastore.NewKey(ctx, legacy.EntityType(), "", g.ID, nil))
+	if err := store.Save(ctx, &legacy); err != nil {
+		t.Fatalf("Could not save the test Room: %v", err)
+	}
+
+	room, err := findRoom(ctx, strconv.FormatInt(g.ID, 10))
+	if err != nil {
+		t.Fatalf("findRoom threw an error: %v", err)
+	}
+	if !room.GetKey().Equal(legacy.GetKey()) || room.RoomType() != model.RoomGame {
+		t.Fatalf("findRoom returned the wrong room. Wanted: %v; Got: %v", legacy.GetKey(), room.GetKey())
+	}
+	if !room.GameKey(ctx).Equal(g.GetKey()) {
+		t.Fatalf("Room.GameKey returned the wrong game. Wanted: %v; Got: %v", g.GetKey(), room.GameKey(ctx))
+	}
+}
@@ -0,0 +1,279 @@
+package chat
+
+import (
+	"context"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+)
+
+// MaxSearchTerms is the most words a search may look for
+const MaxSearchTerms = 8
+
+// Search selects the chats to find in a room
+// Every word in the query has to be in a chat for it to be found
+type Search struct {
+	Query    string    // the words to look for
+	AuthorID string    // only find the chats of this player, if set
+	From     time.Time // only find the chats posted at or after this time, if set
+	To       time.Time // only find the chats posted before this time, if set
+	Limit    int       // the most chats returned, DefaultLimit if not set
+	Before   string    // only find the chats older than this cursor, to read on from an earlier page
+}
+
+// searchBatch is the number of chats or index entries read at a time while searching
+var searchBatch = 100
+
+// Result is a chat found by a search
+type Result struct {
+	Chat      model.Chat
+	Highlight string // the HTML escaped message, with the words searched for in <mark> tags
+}
+
+// SearchChats finds a page of the chats in the room matching the search, newest first, as seen by the given player,
+// and the cursor to pass as Before for the next page, which is empty if there are no more chats found
+// The chats of muted players, and the chats past the room's retention policy, are not found
+func SearchChats(ctx context.Context, roomID, playerID string, search Search) (results []Result, next string, myerr error) {
+	if search.Limit < 0 || MaxLimit < search.Limit {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Invalid limit: %d (at most %d)", search.Limit, MaxLimit)
+		return
+	}
+
+	if search.Limit == 0 {
+		search.Limit = DefaultLimit
+	}
+
+	terms := model.Terms(search.Query)
+	if len(terms) > MaxSearchTerms {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Too many words to search for: %d (at most %d)", len(terms), MaxSearchTerms)
+		return
+	}
+
+	var authorKey *datastore.Key
+	if search.AuthorID != "" {
+		if authorKey, myerr = datastore.DecodeKey(search.AuthorID); myerr != nil {
+			myerr = game.NewUserError(myerr, http.StatusBadRequest, "Invalid author_id: %s", search.AuthorID)
+			return
+		}
+	}
+
+	if len(terms) == 0 && authorKey == nil {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Search for a word or an author")
+		return
+	}
+
+	var before model.ChatPosition
+	if search.Before != "" {
+		if before.Created, before.Key, myerr = model.ParseChatCursor(search.Before); myerr != nil {
+			myerr = game.NewUserError(myerr, http.StatusBadRequest, "Invalid before cursor: %s", search.Before)
+			return
+		}
+	}
+
+	room, myerr := loadRoom(ctx, roomID, playerID)
+	if myerr != nil {
+		return
+	}
+
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	if myerr = checkSanctions(ctx, playerKey, room, model.SanctionBan); myerr != nil {
+		return
+	}
+
+	// chats past the room's retention policy are no longer shown, even before they are purged
+	cutoff := room.Cutoff(ctx)
+
+	if !cutoff.IsZero() && search.From.Before(cutoff) {
+		search.From = cutoff
+	}
+
+	muted, myerr := mutedKeys(ctx, playerID, room)
+	if myerr != nil {
+		return
+	}
+
+	keep := func(chat model.Chat) bool {
+		return !chat.IsDeleted() && (chat.PlayerKey == nil || !muted[chat.PlayerKey.Encode()])
+	}
+
+	var chats model.ChatList
+	var more bool
+	if len(terms) == 0 {
+		chats, more, myerr = authorHits(ctx, room.GetKey(), authorKey, search.From, search.To, before, search.Limit, keep)
+	} else {
+		chats, more, myerr = termHits(ctx, room.GetKey(), terms, authorKey, search.From, search.To, before, search.Limit, keep)
+	}
+	if myerr != nil {
+		return
+	}
+
+	if myerr = chats.LoadReactions(ctx); myerr != nil {
+		return
+	}
+
+	if more {
+		next = chats[len(chats)-1].Cursor()
+	}
+
+	matched := make(map[string]bool, len(terms))
+	for _, v := range terms {
+		matched[v] = true
+	}
+
+	results = make([]Result, 0, len(chats))
+	for _, v := range chats {
+		results = append(results, Result{
+			Chat:      v,
+			Highlight: highlight(v.Message, matched),
+		})
+	}
+
+	return
+}
+
+// termHits finds at most limit chats in the room with every one of the terms in the search index that pass keep,
+// newest first, starting from the chats older than before (if set)
+// more is true if there are more chats found past the page
+func termHits(ctx context.Context, roomKey *datastore.Key, terms []string, authorKey *datastore.Key, from, to time.Time, before model.ChatPosition, limit int, keep func(model.Chat) bool) (hits model.ChatList, more bool, myerr error) {
+	// the rarest term has the fewest entries to read through, and the chats they point to
+	// are checked for the other terms, so every batch costs the same whatever the other terms are
+	rarest := 0
+	var batch model.ChatTermList
+	for i, term := range terms {
+		var entries model.ChatTermList
+		if myerr = entries.Search(ctx, roomKey, term, authorKey, from, to, before, searchBatch); myerr != nil {
+			return
+		}
+
+		if i == 0 || rarer(entries, batch) {
+			rarest, batch = i, entries
+		}
+	}
+
+	for len(batch) > 0 {
+		keys := make([]*datastore.Key, len(batch))
+		for k, v := range batch {
+			keys[k] = v.ChatKey
+		}
+
+		var chats model.ChatList
+		if myerr = chats.ByKeys(ctx, keys); myerr != nil {
+			return
+		}
+
+		for _, v := range chats {
+			if !hasTerms(v.Message, terms) || !keep(v) {
+				continue
+			}
+
+			if len(hits) == limit {
+				more = true
+				return
+			}
+
+			hits = append(hits, v)
+		}
+
+		if len(batch) < searchBatch {
+			return
+		}
+
+		last := batch[len(batch)-1]
+		before = model.ChatPosition{Created: last.Created, Key: last.ChatKey}
+		if myerr = batch.Search(ctx, roomKey, terms[rarest], authorKey, from, to, before, searchBatch); myerr != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// rarer returns true if the first batch of index entries is for a rarer term than the second
+// A batch that is not full holds every entry for its term; when both are full,
+// the one reaching further back has its term spread over more time
+func rarer(a, b model.ChatTermList) bool {
+	if len(a) != len(b) || len(a) == 0 {
+		return len(a) < len(b)
+	}
+
+	return a[len(a)-1].Created.Before(b[len(b)-1].Created)
+}
+
+// hasTerms returns true if the message has every one of the terms
+func hasTerms(message string, terms []string) bool {
+	found := make(map[string]bool)
+	for _, v := range model.Terms(message) {
+		found[v] = true
+	}
+
+	for _, v := range terms {
+		if !found[v] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// authorHits finds at most limit chats the author posted in the room that pass keep,
+// newest first, starting from the chats older than before (if set)
+// more is true if there are more chats found past the page
+func authorHits(ctx context.Context, roomKey *datastore.Key, authorKey *datastore.Key, from, to time.Time, before model.ChatPosition, limit int, keep func(model.Chat) bool) (hits model.ChatList, more bool, myerr error) {
+	for {
+		var chats model.ChatList
+		if myerr = chats.ByRoomAndPlayerPage(ctx, roomKey, authorKey, from, to, before, searchBatch); myerr != nil {
+			return
+		}
+
+		for _, v := range chats {
+			if !keep(v) {
+				continue
+			}
+
+			if len(hits) == limit {
+				more = true
+				return
+			}
+
+			hits = append(hits, v)
+		}
+
+		if len(chats) < searchBatch {
+			return
+		}
+
+		last := chats[len(chats)-1]
+		before = model.ChatPosition{Created: last.Created, Key: last.GetKey()}
+	}
+}
+
+// highlight returns the HTML escaped message with the words matching the terms wrapped in <mark> tags
+func highlight(message string, terms map[string]bool) string {
+	var b strings.Builder
+
+	last := 0
+	for _, v := range model.TermSpans(message) {
+		if !terms[v.Term] {
+			continue
+		}
+
+		b.WriteString(html.EscapeString(message[last:v.Start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(message[v.Start:v.End]))
+		b.WriteString("</mark>")
+		last = v.End
+	}
+	b.WriteString(html.EscapeString(message[last:]))
+
+	return b.String()
+}
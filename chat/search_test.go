@@ -0,0 +1,95 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/store/storetest"
+)
+
+func TestSearch(t *testing.T) {
+	ctx := storetest.NewContext()
+	now := time.Now()
+
+	reader, talker, noisy, outsider := storetest.SavePlayer(ctx, t), storetest.SavePlayer(ctx, t), storetest.SavePlayer(ctx, t), storetest.SavePlayer(ctx, t)
+	readerID, talkerID := reader.GetKey().Encode(), talker.GetKey().Encode()
+	room := storetest.SaveRoom(ctx, t, reader, talker, noisy)
+	roomID := room.GetKey().Encode()
+
+	postChat(game.SetNow(ctx, now), t, room, talker, "Who wants a <rematch>?")
+	postChat(game.SetNow(ctx, now.Add(time.Minute)), t, room, reader, "no rematch today")
+	edited := postChat(game.SetNow(ctx, now.Add(2*time.Minute)), t, room, talker, "good game")
+	deleted := postChat(game.SetNow(ctx, now.Add(3*time.Minute)), t, room, talker, "rematch tomorrow")
+	postChat(game.SetNow(ctx, now.Add(4*time.Minute)), t, room, noisy, "REMATCH REMATCH")
+
+	if _, _, err := SearchChats(ctx, roomID, outsider.GetKey().Encode(), Search{Query: "rematch"}); err == nil {
+		t.Fatal("SearchChats did not throw an error for a player who is not a member.")
+	}
+
+	if _, _, err := SearchChats(ctx, roomID, readerID, Search{Query: "a"}); err == nil {
+		t.Fatal("SearchChats did not throw an error for a search with nothing to look for.")
+	}
+
+	if _, err := EditChat(game.SetNow(ctx, now.Add(5*time.Minute)), talkerID, edited.GetKey().Encode(), "good rematch"); err != nil {
+		t.Fatalf("EditChat threw an error: %v", err)
+	}
+	if _, err := DeleteChat(ctx, talkerID, deleted.GetKey().Encode()); err != nil {
+		t.Fatalf("DeleteChat threw an error: %v", err)
+	}
+	if _, err := Mute(ctx, readerID, noisy.GetKey().Encode(), Scope{}, 0); err != nil {
+		t.Fatalf("Mute threw an error: %v", err)
+	}
+
+	results, next, err := SearchChats(ctx, roomID, readerID, Search{Query: "Rematch", Limit: 2})
+	if err != nil {
+		t.Fatalf("SearchChats threw an error: %v", err)
+	}
+	if next == "" || len(results) != 2 || results[0].Chat.Message != "good rematch" || results[1].Chat.Message != "no rematch today" {
+		t.Fatalf("SearchChats returned the wrong chats. Got: %q, %+v", next, results)
+	}
+
+	results, next, err = SearchChats(ctx, roomID, readerID, Search{Query: "rematch", Before: next})
+	if err != nil {
+		t.Fatalf("SearchChats threw an error: %v", err)
+	}
+	if next != "" || len(results) != 1 || results[0].Highlight != "Who wants a &lt;<mark>rematch</mark>&gt;?" {
+		t.Fatalf("SearchChats returned the wrong page. Got: %q, %+v", next, results)
+	}
+
+	results, _, err = SearchChats(ctx, roomID, readerID, Search{Query: "good rematch", AuthorID: talkerID})
+	if err != nil {
+		t.Fatalf("SearchChats threw an error: %v", err)
+	}
+	if len(results) != 1 || results[0].Highlight != "<mark>good</mark> <mark>rematch</mark>" {
+		t.Fatalf("SearchChats did not match every word. Got: %+v", results)
+	}
+
+	if results, _, err = SearchChats(ctx, roomID, readerID, Search{Query: "game"}); err != nil || len(results) != 0 {
+		t.Fatalf("SearchChats found an edited out word. Got: %+v, %v", results, err)
+	}
+
+	results, _, err = SearchChats(ctx, roomID, readerID, Search{AuthorID: talkerID, From: now.Add(time.Minute)})
+	if err != nil || len(results) != 1 {
+		t.Fatalf("SearchChats did not filter by author and time. Got: %+v, %v", results, err)
+	}
+
+	// reading the index one entry at a time finds the same chats
+	defer func(n int) { searchBatch = n }(searchBatch)
+	searchBatch = 1
+
+	results, next, err = SearchChats(ctx, roomID, readerID, Search{Query: "rematch good", Limit: 1})
+	if err != nil || next != "" || len(results) != 1 || results[0].Chat.Message != "good rematch" {
+		t.Fatalf("SearchChats did not read the rarest word in batches. Got: %q, %+v, %v", next, results, err)
+	}
+
+	results, next, err = SearchChats(ctx, roomID, readerID, Search{AuthorID: talkerID, Limit: 1})
+	if err != nil || next == "" || len(results) != 1 || results[0].Chat.Message != "good rematch" {
+		t.Fatalf("SearchChats did not read the author's chats in batches. Got: %q, %+v, %v", next, results, err)
+	}
+
+	results, next, err = SearchChats(ctx, roomID, readerID, Search{AuthorID: talkerID, Limit: 1, Before: next})
+	if err != nil || next != "" || len(results) != 1 || results[0].Chat.Message != "Who wants a <rematch>?" {
+		t.Fatalf("SearchChats did not skip the deleted chat reading on. Got: %q, %+v, %v", next, results, err)
+	}
+}
@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+)
+
+// MaxUnread is the most unread chats counted in a room
+const MaxUnread = 100
+
+// Unread is the number of chats in a room the player has not seen
+type Unread struct {
+	Room  model.Room
+	Count int
+	More  bool // set if there are more than Count unread chats
+}
+
+// GetLastSeen returns the player's read marker for the given room
+func GetLastSeen(ctx context.Context, roomID, playerID string) (seen model.ChatSeen, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	room, myerr := findRoom(ctx, roomID)
+	if myerr != nil {
+		return
+	}
+
+	if myerr = checkMember(ctx, playerKey, room); myerr != nil {
+		return
+	}
+
+	myerr = seen.ByRoom(ctx, playerKey, room.GetKey())
+
+	return
+}
+
+// GetUnread returns the number of unread chats in each room the player belongs to,
+// leaving out the player's own chats and the chats from players they have muted
+func GetUnread(ctx context.Context, playerID string) (unread []Unread, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	rooms, myerr := playerRooms(ctx, playerKey)
+	if myerr != nil {
+		return
+	}
+
+	// the markers are all under the player, so they load together instead of one per room
+	var markers model.ChatSeenList
+	if myerr = markers.ByPlayer(ctx, playerKey); myerr != nil {
+		return
+	}
+
+	// the mutes are the player's in every room, so they are loaded once for all of them
+	mutes, myerr := GetMuted(ctx, playerID)
+	if myerr != nil {
+		return
+	}
+
+	unread = make([]Unread, 0, len(rooms))
+	for _, room := range rooms {
+		// a room the player has not read has no marker, so all of its chats are unread
+		var after time.Time
+		if seen, ok := markers.Find(room.GetKey()); ok {
+			after = seen.LastMessageSeenDate
+		}
+
+		// expired chats can't be read, so they are not unread
+		cutoff := room.Cutoff(ctx)
+		if after.Before(cutoff) {
+			after = cutoff.Add(-time.Microsecond)
+		}
+
+		var chats model.ChatList
+		var more bool
+		if more, myerr = chats.ByRoomPage(ctx, room.GetKey(), model.ChatPosition{}, model.ChatPosition{Created: after}, MaxUnread); myerr != nil {
+			return
+		}
+
+		chats = hideMuted(chats, mutedIn(ctx, mutes, room), false)
+
+		u := Unread{
+			Room: room,
+			More: more,
+		}
+		for _, v := range chats {
+			if !v.PlayerKey.Equal(playerKey) && !v.IsDeleted() {
+				u.Count++
+			}
+		}
+
+		unread = append(unread, u)
+	}
+
+	return
+}
+
+// markSeen moves the player's read marker for the room up to the given chat time
+// The marker never moves back, so reading older chats leaves it where it is
+func markSeen(ctx context.Context, playerKey *datastore.Key, room model.Room, newest time.Time) (myerr error) {
+	var seen model.ChatSeen
+	if myerr = seen.ByRoom(ctx, playerKey, room.GetKey()); myerr != nil {
+		return
+	}
+
+	if !newest.After(seen.LastMessageSeenDate) {
+		return
+	}
+
+	seen.LastMessageSeenDate = newest
+	seen.DateSeen = game.Now(ctx)
+	myerr = store.Save(ctx, &seen)
+
+	return
+}
@@ -0,0 +1,102 @@
+package chat
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/benjamw/golibs/test"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+	"github.com/benjamw/gogame/store/storetest"
+)
+
+func TestUnread(t *testing.T) {
+	ctx := storetest.NewContext()
+	now := time.Now()
+
+	reader := storetest.SavePlayer(ctx, t)
+	talker := storetest.SavePlayer(ctx, t)
+	readerID := reader.GetKey().Encode()
+
+	g := model.Game{
+		Type:       "unread",
+		CreatorKey: reader.GetKey(),
+	}
+	if err := store.Save(ctx, &g); err != nil {
+		t.Fatalf("Could not save the test Game: %v", err)
+	}
+	for _, v := range []model.Player{reader, talker} {
+		seat := model.Seat{
+			GameKey:   g.GetKey(),
+			PlayerKey: v.GetKey(),
+		}
+		if err := store.Save(ctx, &seat); err != nil {
+			t.Fatalf("Could not save the test Seat: %v", err)
+		}
+	}
+	room := model.Room{ID: g.ID}
+	if err := store.Save(ctx, &room); err != nil {
+		t.Fatalf("Could not save the test Room: %v", err)
+	}
+	roomID := strconv.FormatInt(room.ID, 10)
+
+	chats := make(model.ChatList, 3)
+	for k := range chats {
+		chats[k] = postChat(game.SetNow(ctx, now.Add(time.Duration(k)*time.Second)), t, room, talker, "unread")
+	}
+	postChat(game.SetNow(ctx, now.Add(5*time.Second)), t, room, reader, "mine")
+
+	checkUnread(ctx, t, readerID, room, 3)
+
+	// read the oldest chat past the first
+	if _, _, _, err := GetChats(ctx, roomID, readerID, Page{Limit: 1, After: chats[0].Cursor()}); err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	checkUnread(ctx, t, readerID, room, 1)
+
+	if _, _, _, err := GetChats(ctx, roomID, readerID, Page{}); err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+	checkUnread(ctx, t, readerID, room, 0)
+
+	// reading older chats does not move the marker back
+	if _, _, _, err := GetChats(ctx, roomID, readerID, Page{Before: chats[1].Cursor()}); err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+
+	seen, err := GetLastSeen(ctx, roomID, readerID)
+	if err != nil {
+		t.Fatalf("GetLastSeen threw an error: %v", err)
+	}
+	if !seen.LastMessageSeenDate.Equal(now.Add(5 * time.Second).Truncate(time.Microsecond)) {
+		t.Fatalf("GetLastSeen returned the wrong marker. Got: %v", seen.LastMessageSeenDate)
+	}
+}
+
+// checkUnread fails the test if the player does not have the wanted number of unread chats in the room
+func checkUnread(ctx context.Context, t *testing.T, playerID string, room model.Room, want int) {
+	file, line, funct := test.GetCaller()
+
+	unread, err := GetUnread(ctx, playerID)
+	if err != nil {
+		t.Fatalf("GetUnread threw an error. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+	}
+
+	for _, v := range unread {
+		if v.Room.ID != room.ID {
+			continue
+		}
+
+		if v.Count != want {
+			t.Fatalf("GetUnread returned the wrong count. Func: %s; File: %s; Line: %d; Wanted: %d; Got: %d", funct, file, line, want, v.Count)
+		}
+
+		return
+	}
+
+	t.Fatalf("GetUnread did not return the room. Func: %s; File: %s; Line: %d; Got: %+v", funct, file, line, unread)
+}
@@ -0,0 +1,345 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/pubsub"
+)
+
+// PingInterval is how often an idle stream is pinged to keep the connection open
+var PingInterval = 30 * time.Second
+
+// StreamBatch is the number of missed chats loaded at a time when a stream catches up from a cursor
+var StreamBatch = 100
+
+// Streamer receives the chats of a room as they are streamed
+type Streamer interface {
+	// Send sends the chat to the client
+	Send(chat model.Chat) error
+
+	// Ping keeps the connection open while there are no chats to send
+	// It is also called once the stream is ready
+	Ping() error
+}
+
+// Updater is a Streamer that is also sent the changes to chats it was already sent,
+// when they are edited, deleted, or reacted to
+type Updater interface {
+	Streamer
+
+	// Update sends the changed chat to the client
+	Update(chat model.Chat) error
+}
+
+// chatEvent is a chat as it is passed through the pub/sub broker
+type chatEvent struct {
+	ChatID    string         `json:"chat_id"`
+	PlayerID  string         `json:"player_id"`
+	Type      string         `json:"type"`
+	Event     string         `json:"event"`
+	Data      string         `json:"data"`
+	Message   string         `json:"message"`
+	Created   time.Time      `json:"created"`
+	Edited    time.Time      `json:"edited"`
+	Deleted   time.Time      `json:"deleted"`
+	Reactions map[string]int `json:"reactions,omitempty"`
+	Update    bool           `json:"update,omitempty"` // set for a change to a chat that was already posted
+}
+
+// roomTopic returns the pub/sub topic for the chats in the room
+func roomTopic(roomKey *datastore.Key) string {
+	return "room/" + roomKey.Encode()
+}
+
+// publishChat sends a saved chat to the streams of its room
+func publishChat(ctx context.Context, chat model.Chat) error {
+	return publish(ctx, chat, false)
+}
+
+// publishUpdate sends a changed chat, with its reactions, to the streams of its room
+func publishUpdate(ctx context.Context, chat model.Chat) {
+	// the update replaces the reactions the clients have
+	chats := model.ChatList{chat}
+	if err := chats.LoadReactions(ctx); err != nil {
+		game.Errorf(ctx, "Could not load the reactions of the chat update: %v", err)
+		return
+	}
+
+	// the change is saved, so a failed push only delays it until the streams reconnect
+	if err := publish(ctx, chats[0], true); err != nil {
+		game.Errorf(ctx, "Could not publish the chat update: %v", err)
+	}
+}
+
+func publish(ctx context.Context, chat model.Chat, update bool) error {
+	data, err := json.Marshal(chatEvent{
+		ChatID:    chat.GetKey().Encode(),
+		PlayerID:  chat.AuthorID(),
+		Type:      chat.Type,
+		Event:     chat.Event,
+		Data:      chat.Data,
+		Message:   chat.Message,
+		Created:   chat.Created,
+		Edited:    chat.Edited,
+		Deleted:   chat.Deleted,
+		Reactions: chat.Reactions,
+		Update:    update,
+	})
+	if err != nil {
+		return err
+	}
+
+	return pubsub.Publish(ctx, roomTopic(chat.RoomKey), data)
+}
+
+// muteTopic returns the pub/sub topic for the changes to the player's mutes
+func muteTopic(playerKey *datastore.Key) string {
+	return "mutes/" + playerKey.Encode()
+}
+
+// publishMutes tells the player's streams that their mutes changed
+func publishMutes(ctx context.Context, playerKey *datastore.Key) {
+	// the mutes are saved, so a failed push only delays them until the streams reconnect
+	if err := pubsub.Publish(ctx, muteTopic(playerKey), []byte(playerKey.Encode())); err != nil {
+		game.Errorf(ctx, "Could not publish the mutes: %v", err)
+	}
+}
+
+// decodeChat rebuilds the chat from a pub/sub message, and whether it is a change to a chat already posted
+func decodeChat(data []byte) (chat model.Chat, update bool, myerr error) {
+	var e chatEvent
+	if myerr = json.Unmarshal(data, &e); myerr != nil {
+		return
+	}
+
+	var key *datastore.Key
+	if key, myerr = datastore.DecodeKey(e.ChatID); myerr != nil {
+		return
+	}
+
+	// system chats have no player
+	if e.PlayerID != "" {
+		if chat.PlayerKey, myerr = datastore.DecodeKey(e.PlayerID); myerr != nil {
+			return
+		}
+	}
+
+	chat.SetKey(key)
+	chat.RoomKey = key.Parent()
+	chat.Type = e.Type
+	chat.Event = e.Event
+	chat.Data = e.Data
+	chat.Message = e.Message
+	chat.Created = e.Created
+	chat.Edited = e.Edited
+	chat.Deleted = e.Deleted
+	chat.Reactions = e.Reactions
+	update = e.Update
+
+	return
+}
+
+// StreamChats sends the chats posted to the room to the Streamer until ctx is done,
+// leaving out the chats from players the viewing player has muted unless includeMuted is set
+// If a cursor is given, the chats posted after the chat it points to are sent first
+// If the Streamer is an Updater, it is also sent the changes to the room's chats
+// If the Streamer is a Notifier, it is also sent the viewing player's new notifications
+func StreamChats(ctx context.Context, roomID, playerID, cursor string, includeMuted bool, s Streamer) (myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	room, myerr := findRoom(ctx, roomID)
+	if myerr != nil {
+		return
+	}
+
+	if myerr = checkMember(ctx, playerKey, room); myerr != nil {
+		return
+	}
+
+	if myerr = checkSanctions(ctx, playerKey, room, model.SanctionBan); myerr != nil {
+		return
+	}
+
+	var after model.ChatPosition
+	if cursor != "" {
+		if after.Created, after.Key, myerr = model.ParseChatCursor(cursor); myerr != nil {
+			myerr = game.NewUserError(myerr, http.StatusBadRequest, "Invalid cursor: %s", cursor)
+			return
+		}
+	}
+
+	muted, myerr := mutedKeys(ctx, playerID, room)
+	if myerr != nil {
+		return
+	}
+
+	// subscribe before reading the missed chats so nothing posted in between is lost
+	subscribed := game.Now(ctx)
+	messages, cancel, myerr := pubsub.Subscribe(ctx, roomTopic(room.GetKey()))
+	if myerr != nil {
+		return
+	}
+	defer cancel()
+
+	// the mutes are read again when the player changes them
+	mutes, cancelMutes, myerr := pubsub.Subscribe(ctx, muteTopic(playerKey))
+	if myerr != nil {
+		return
+	}
+	defer cancelMutes()
+
+	// streams that take notifications get the player's as well
+	var notes <-chan []byte
+	notifier, notify := s.(Notifier)
+	if notify {
+		var cancelNotes func()
+		if notes, cancelNotes, myerr = pubsub.Subscribe(ctx, playerTopic(playerKey)); myerr != nil {
+			return
+		}
+		defer cancelNotes()
+	}
+
+	if myerr = s.Ping(); myerr != nil {
+		return
+	}
+
+	// the missed chats posted since subscribing also come in live, so they are kept to not be sent twice
+	var dupes map[string]bool
+	if !after.Created.IsZero() {
+		if dupes, myerr = catchUp(ctx, s, room, after, subscribed, muted, includeMuted); myerr != nil {
+			return
+		}
+	}
+
+	ping := time.NewTicker(PingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ping.C:
+			// the live chats posted during the catch up have come in by now
+			dupes = nil
+
+			// and timed mutes may have run out
+			if muted, myerr = mutedKeys(ctx, playerID, room); myerr != nil {
+				return
+			}
+
+			if myerr = s.Ping(); myerr != nil {
+				return
+			}
+		case _, ok := <-mutes:
+			if !ok {
+				return
+			}
+
+			if muted, myerr = mutedKeys(ctx, playerID, room); myerr != nil {
+				return
+			}
+		case data, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			chat, update, err := decodeChat(data)
+			if err != nil {
+				game.Errorf(ctx, "Could not decode the streamed chat: %v", err)
+				continue
+			}
+
+			if id := chat.GetKey().Encode(); dupes[id] && !update {
+				delete(dupes, id)
+				continue
+			}
+
+			if myerr = send(s, chat, update, muted, includeMuted); myerr != nil {
+				return
+			}
+		case data, ok := <-notes:
+			if !ok {
+				return
+			}
+
+			note, err := decodeNotification(data)
+			if err != nil {
+				game.Errorf(ctx, "Could not decode the streamed notification: %v", err)
+				continue
+			}
+
+			if myerr = notifier.Notify(note); myerr != nil {
+				return
+			}
+		}
+	}
+}
+
+// catchUp sends the chats posted to the room after the position, in batches of StreamBatch,
+// and returns the IDs of those posted since the stream subscribed, which will also come in live
+func catchUp(ctx context.Context, s Streamer, room model.Room, after model.ChatPosition, subscribed time.Time, muted map[string]bool, includeMuted bool) (dupes map[string]bool, myerr error) {
+	cutoff := room.Cutoff(ctx)
+
+	// chats past the room's retention policy are no longer shown
+	if !cutoff.IsZero() && after.Created.Before(cutoff) {
+		after = model.ChatPosition{Created: cutoff.Add(-time.Microsecond)}
+	}
+
+	dupes = make(map[string]bool)
+	for {
+		var chats model.ChatList
+		var more bool
+		if more, myerr = chats.ByRoomPage(ctx, room.GetKey(), model.ChatPosition{}, after, StreamBatch); myerr != nil {
+			return
+		}
+
+		// the page is newest first
+		for k := len(chats) - 1; k >= 0; k-- {
+			if !chats[k].Created.Before(subscribed) {
+				dupes[chats[k].GetKey().Encode()] = true
+			}
+
+			if myerr = send(s, chats[k], false, muted, includeMuted); myerr != nil {
+				return
+			}
+		}
+
+		if !more || len(chats) == 0 {
+			return
+		}
+
+		after = model.ChatPosition{
+			Created: chats[0].Created,
+			Key:     chats[0].GetKey(),
+		}
+	}
+}
+
+// send sends the chat, or the change to it if it is an update,
+// unless it is muted and muted chats are not included
+func send(s Streamer, chat model.Chat, update bool, muted map[string]bool, includeMuted bool) error {
+	chat.Muted = muted[chat.AuthorID()]
+	if chat.Muted && !includeMuted {
+		return nil
+	}
+
+	if !update {
+		return s.Send(chat)
+	}
+
+	if updater, ok := s.(Updater); ok {
+		return updater.Update(chat)
+	}
+
+	return nil
+}
@@ -0,0 +1,320 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benjamw/golibs/random"
+	"github.com/benjamw/golibs/test"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store/storetest"
+)
+
+// testStreamer collects the streamed chats
+type testStreamer struct {
+	chats chan model.Chat
+	ready chan bool
+}
+
+func (s *testStreamer) Send(chat model.Chat) error {
+	s.chats <- chat
+	return nil
+}
+
+func (s *testStreamer) Ping() error {
+	select {
+	case s.ready <- true:
+	default:
+	}
+
+	return nil
+}
+
+// updateStreamer also collects the streamed changes to chats
+type updateStreamer struct {
+	testStreamer
+	updates chan model.Chat
+}
+
+func (s *updateStreamer) Update(chat model.Chat) error {
+	s.updates <- chat
+	return nil
+}
+
+func TestStreamChats(t *testing.T) {
+	ctx := storetest.NewContext()
+	now := time.Now()
+
+	viewer := storetest.SavePlayer(ctx, t)
+	talker := storetest.SavePlayer(ctx, t)
+	muted := storetest.SavePlayer(ctx, t)
+	room := storetest.SaveRoom(ctx, t, viewer, talker, muted)
+	roomID := room.GetKey().Encode()
+
+	if _, err := Mute(ctx, viewer.GetKey().Encode(), muted.GetKey().Encode(), Scope{}, 0); err != nil {
+		t.Fatalf("Mute threw an error: %v", err)
+	}
+
+	first := postChat(game.SetNow(ctx, now), t, room, talker, "first")
+	missed := postChat(game.SetNow(ctx, now.Add(time.Second)), t, room, talker, "missed")
+	postChat(game.SetNow(ctx, now.Add(2*time.Second)), t, room, muted, "hidden")
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	s := &testStreamer{
+		chats: make(chan model.Chat, 10),
+		ready: make(chan bool, 1),
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- StreamChats(streamCtx, roomID, viewer.GetKey().Encode(), first.Cursor(), false, s)
+	}()
+
+	select {
+	case <-s.ready:
+	case err := <-done:
+		t.Fatalf("StreamChats threw an error: %v", err)
+	}
+
+	live := postChat(game.SetNow(ctx, now.Add(3*time.Second)), t, room, talker, "live")
+	postChat(game.SetNow(ctx, now.Add(4*time.Second)), t, room, muted, "hidden")
+	last := postChat(game.SetNow(ctx, now.Add(5*time.Second)), t, room, talker, "last")
+
+	for _, want := range []model.Chat{missed, live, last} {
+		select {
+		case got := <-s.chats:
+			if !got.GetKey().Equal(want.GetKey()) || got.Message != want.Message {
+				t.Fatalf("StreamChats sent the wrong chat. Wanted: %s; Got: %s", want.Message, got.Message)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("StreamChats did not send the chat: %s", want.Message)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("StreamChats threw an error when closed: %v", err)
+	}
+
+	if len(s.chats) != 0 {
+		t.Fatalf("StreamChats sent a muted chat. Got: %s", (<-s.chats).Message)
+	}
+
+	if err := StreamChats(ctx, roomID, viewer.GetKey().Encode(), "bad", false, s); err == nil {
+		t.Fatal("StreamChats did not throw an error for an invalid cursor.")
+	}
+}
+
+func TestStreamCatchUp(t *testing.T) {
+	ctx := storetest.NewContext()
+	now := time.Now()
+
+	defer func(batch int) { StreamBatch = batch }(StreamBatch)
+	StreamBatch = 2
+
+	player := storetest.SavePlayer(ctx, t)
+	room := storetest.SaveRoom(ctx, t, player)
+
+	chats := make(model.ChatList, 6)
+	for k := range chats {
+		chats[k] = postChat(game.SetNow(ctx, now.Add(time.Duration(k)*time.Second)), t, room, player, string(rune('a'+k)))
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	s := &testStreamer{
+		chats: make(chan model.Chat, 10),
+		ready: make(chan bool, 1),
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- StreamChats(streamCtx, room.GetKey().Encode(), player.GetKey().Encode(), chats[0].Cursor(), false, s)
+	}()
+
+	// the missed chats are sent oldest first, over several batches
+	for _, want := range chats[1:] {
+		select {
+		case got := <-s.chats:
+			if got.Message != want.Message {
+				t.Fatalf("StreamChats sent the wrong chat. Wanted: %s; Got: %s", want.Message, got.Message)
+			}
+		case err := <-done:
+			t.Fatalf("StreamChats threw an error: %v", err)
+		case <-time.After(time.Second):
+			t.Fatalf("StreamChats did not send the chat: %s", want.Message)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("StreamChats threw an error when closed: %v", err)
+	}
+
+	if len(s.chats) != 0 {
+		t.Fatalf("StreamChats sent a chat twice. Got: %s", (<-s.chats).Message)
+	}
+}
+
+func TestStreamMutes(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	viewer := storetest.SavePlayer(ctx, t)
+	talker := storetest.SavePlayer(ctx, t)
+	room := storetest.SaveRoom(ctx, t, viewer, talker)
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	s := &testStreamer{
+		chats: make(chan model.Chat, 10),
+		ready: make(chan bool, 1),
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- StreamChats(streamCtx, room.GetKey().Encode(), viewer.GetKey().Encode(), "", false, s)
+	}()
+
+	select {
+	case <-s.ready:
+	case err := <-done:
+		t.Fatalf("StreamChats threw an error: %v", err)
+	}
+
+	// the open stream picks up the new mute, and then the unmute
+	for _, muting := range []bool{true, false} {
+		var err error
+		if muting {
+			_, err = Mute(ctx, viewer.GetKey().Encode(), talker.GetKey().Encode(), Scope{}, 0)
+		} else {
+			err = Unmute(ctx, viewer.GetKey().Encode(), talker.GetKey().Encode(), Scope{}, 0)
+		}
+		if err != nil {
+			t.Fatalf("Mute threw an error: %v", err)
+		}
+
+		// give the stream time to read the mutes again
+		time.Sleep(50 * time.Millisecond)
+
+		chat := postChat(ctx, t, room, talker, random.Stringn(10))
+
+		select {
+		case got := <-s.chats:
+			if muting {
+				t.Fatalf("StreamChats sent a chat from a player muted while streaming. Got: %s", got.Message)
+			}
+			if got.Message != chat.Message {
+				t.Fatalf("StreamChats sent the wrong chat. Wanted: %s; Got: %s", chat.Message, got.Message)
+			}
+		case <-time.After(100 * time.Millisecond):
+			if !muting {
+				t.Fatal("StreamChats did not send a chat from a player unmuted while streaming.")
+			}
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("StreamChats threw an error when closed: %v", err)
+	}
+}
+
+func TestStreamUpdates(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	viewer := storetest.SavePlayer(ctx, t)
+	talker := storetest.SavePlayer(ctx, t)
+	room := storetest.SaveRoom(ctx, t, viewer, talker)
+
+	chat := postChat(ctx, t, room, talker, "first")
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	s := &updateStreamer{
+		testStreamer: testStreamer{
+			chats: make(chan model.Chat, 10),
+			ready: make(chan bool, 1),
+		},
+		updates: make(chan model.Chat, 10),
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- StreamChats(streamCtx, room.GetKey().Encode(), viewer.GetKey().Encode(), "", false, s)
+	}()
+
+	select {
+	case <-s.ready:
+	case err := <-done:
+		t.Fatalf("StreamChats threw an error: %v", err)
+	}
+
+	if _, err := EditChat(ctx, talker.GetKey().Encode(), chat.GetKey().Encode(), "edited"); err != nil {
+		t.Fatalf("EditChat threw an error: %v", err)
+	}
+	if _, err := React(ctx, viewer.GetKey().Encode(), chat.GetKey().Encode(), "👍"); err != nil {
+		t.Fatalf("React threw an error: %v", err)
+	}
+	if _, err := DeleteChat(ctx, talker.GetKey().Encode(), chat.GetKey().Encode()); err != nil {
+		t.Fatalf("DeleteChat threw an error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		check func(model.Chat) bool
+	}{
+		{"edit", func(c model.Chat) bool { return c.Message == "edited" && !c.Edited.IsZero() }},
+		{"reaction", func(c model.Chat) bool { return c.Reactions["👍"] == 1 }},
+		{"delete", func(c model.Chat) bool { return c.IsDeleted() }},
+	}
+
+	for _, v := range tests {
+		select {
+		case got := <-s.updates:
+			if !got.GetKey().Equal(chat.GetKey()) || !v.check(got) {
+				t.Fatalf("StreamChats sent the wrong %s update. Got: %+v", v.name, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("StreamChats did not send the %s update.", v.name)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("StreamChats threw an error when closed: %v", err)
+	}
+
+	// the updates are not sent as new chats
+	if len(s.chats) != 0 {
+		t.Fatalf("StreamChats sent an update as a new chat. Got: %s", (<-s.chats).Message)
+	}
+}
+
+func TestChatCursor(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	player := storetest.SavePlayer(ctx, t)
+	chat := postChat(ctx, t, storetest.SaveRoom(ctx, t, player), player, "cursor")
+
+	created, key, err := model.ParseChatCursor(chat.Cursor())
+	if err != nil {
+		t.Fatalf("ParseChatCursor threw an error: %v", err)
+	}
+	if !key.Equal(chat.GetKey()) || !created.Equal(chat.Created.Truncate(time.Microsecond)) {
+		t.Fatalf("ParseChatCursor returned the wrong chat. Got: %v %v", created, key)
+	}
+}
+
+// HELPER FUNCTIONS
+
+// postChat posts the message to the room
+func postChat(ctx context.Context, t *testing.T, room model.Room, player model.Player, message string) model.Chat {
+	file, line, funct := test.GetCaller()
+
+	chat, err := AddChat(ctx, room.GetKey().Encode(), player.GetKey().Encode(), message)
+	if err != nil {
+		t.Fatalf("Could not add the test Chat. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+	}
+
+	return chat
+}
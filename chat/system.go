@@ -0,0 +1,212 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+)
+
+// The system events posted by the chat package for every game
+const (
+	EventPlayerJoined = "player_joined" // a player joined the game; params: player_id, position
+	EventPlayerLeft   = "player_left"   // a player left the game before it started; params: player_id, position
+	EventGameStart    = "game_start"    // the game started; params: player_ids, in seat order
+	EventTurn         = "turn"          // a move was made and the turn moved on; params: player_ids whose turn it is, move_number
+	EventGameOver     = "game_over"     // the game finished or was abandoned; params: status, results by player ID
+)
+
+// eventPattern matches the names of system events
+var eventPattern = regexp.MustCompile(`^[a-z][a-z0-9_.]*$`)
+
+// SystemEvent is something that happened in a game, posted to its room as a system chat
+// Clients render or localize the chat from its event and params, and fall back to the message
+type SystemEvent struct {
+	Event   string                 // the kind of event, such as "player_joined" or "turn"
+	Params  map[string]interface{} // the details of the event, such as the ID of the player whose turn it is
+	Message string                 // the plain text of the event, for clients that don't know it
+}
+
+// PostSystem posts the event to the room with the given ID as a system chat
+// A game's room has the game's ID; the event is posted by the game, so no player or checks are needed
+func PostSystem(ctx context.Context, roomID int64, event SystemEvent) (chat model.Chat, myerr error) {
+	if !eventPattern.MatchString(event.Event) {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Invalid event: %s", event.Event)
+		return
+	}
+
+	var room model.Room
+	if myerr = room.ByID(ctx, roomID); myerr != nil {
+		return
+	}
+
+	c := model.Chat{
+		RoomKey: room.GetKey(),
+		Type:    model.ChatSystem,
+		Event:   event.Event,
+		Message: event.Message,
+	}
+
+	if len(event.Params) != 0 {
+		var data []byte
+		if data, myerr = json.Marshal(event.Params); myerr != nil {
+			return
+		}
+
+		c.Data = string(data)
+	}
+
+	if myerr = store.Save(ctx, &c); myerr != nil {
+		return
+	}
+
+	// the chat is saved, so a failed push only delays it until the streams reconnect
+	if err := publishChat(ctx, c); err != nil {
+		game.Errorf(ctx, "Could not publish the chat: %v", err)
+	}
+
+	chat = c
+
+	return
+}
+
+// postSeat posts the player in the seat joining or leaving the game to its room
+func postSeat(ctx context.Context, g model.Game, seat model.Seat, event, verb string) (myerr error) {
+	var player model.Player
+	if myerr = store.Load(ctx, seat.PlayerKey, &player); myerr != nil {
+		return
+	}
+
+	_, myerr = PostSystem(ctx, g.ID, SystemEvent{
+		Event: event,
+		Params: map[string]interface{}{
+			"player_id": seat.PlayerKey.Encode(),
+			"position":  seat.Position,
+		},
+		Message: player.Username + " " + verb,
+	})
+
+	return
+}
+
+// postGameStart posts the start of the game to its room
+func postGameStart(ctx context.Context, g model.Game, seats model.SeatList) (myerr error) {
+	playerIDs := make([]string, len(seats))
+	for k, v := range seats {
+		playerIDs[k] = v.PlayerKey.Encode()
+	}
+
+	_, myerr = PostSystem(ctx, g.ID, SystemEvent{
+		Event: EventGameStart,
+		Params: map[string]interface{}{
+			"player_ids": playerIDs,
+		},
+		Message: "The game has started",
+	})
+
+	return
+}
+
+// postTurn posts the players whose turn it is after the move to the game's room
+// Nothing is posted once the move has ended the game, as the end is posted instead
+func postTurn(ctx context.Context, g model.Game, seats model.SeatList, move model.Move) (myerr error) {
+	rules, ok := game.GetRules(g.Type)
+	if !ok {
+		return
+	}
+
+	state := []byte(move.State)
+	over, _, myerr := rules.Over(state)
+	if myerr != nil || over {
+		return
+	}
+
+	positions, myerr := rules.Turn(state)
+	if myerr != nil || len(positions) == 0 {
+		return
+	}
+
+	keys := make([]*datastore.Key, 0, len(positions))
+	for _, v := range positions {
+		for _, seat := range seats {
+			if seat.Position == int64(v) {
+				keys = append(keys, seat.PlayerKey)
+			}
+		}
+	}
+
+	var players model.PlayerList
+	if myerr = players.ByKeys(ctx, keys); myerr != nil {
+		return
+	}
+
+	playerIDs := make([]string, len(keys))
+	names := make([]string, len(players))
+	for k := range players {
+		playerIDs[k] = keys[k].Encode()
+		names[k] = players[k].Username
+	}
+
+	_, myerr = PostSystem(ctx, g.ID, SystemEvent{
+		Event: EventTurn,
+		Params: map[string]interface{}{
+			"player_ids":  playerIDs,
+			"move_number": move.Number,
+		},
+		Message: strings.Join(names, " and ") + "'s turn",
+	})
+
+	return
+}
+
+// postGameOver posts the end of the game, and the result for each player, to its room
+func postGameOver(ctx context.Context, g model.Game, seats model.SeatList) (myerr error) {
+	keys := make([]*datastore.Key, len(seats))
+	results := make(map[string]string, len(seats))
+	for k, v := range seats {
+		keys[k] = v.PlayerKey
+		results[v.PlayerKey.Encode()] = v.Result
+	}
+
+	var players model.PlayerList
+	if myerr = players.ByKeys(ctx, keys); myerr != nil {
+		return
+	}
+
+	var winners []string
+	draw := false
+	for k, v := range seats {
+		switch v.Result {
+		case model.SeatWon:
+			winners = append(winners, players[k].Username)
+		case model.SeatDraw:
+			draw = true
+		}
+	}
+
+	message := "Game over"
+	switch {
+	case len(winners) != 0:
+		message += ": " + strings.Join(winners, " and ") + " won"
+	case draw:
+		message += ": it's a draw"
+	}
+
+	_, myerr = PostSystem(ctx, g.ID, SystemEvent{
+		Event: EventGameOver,
+		Params: map[string]interface{}{
+			"status":  g.Status,
+			"results": results,
+		},
+		Message: message,
+	})
+
+	return
+}
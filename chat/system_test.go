@@ -0,0 +1,106 @@
+package chat
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/benjamw/golibs/db"
+
+	"github.com/benjamw/gogame/games"
+	"github.com/benjamw/gogame/games/tictactoe"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store/storetest"
+)
+
+func TestSystemChats(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	room := storetest.SaveRoom(ctx, t)
+	c := model.Chat{
+		RoomKey: room.GetKey(),
+		Type:    model.ChatSystem,
+	}
+	if e, ok := c.PreSave(ctx).(*db.MissingRequiredError); !ok || e.Property != "Event" {
+		t.Fatal("Chat.PreSave did not throw an error for a system chat without an event.")
+	}
+
+	creator, other, leaver := storetest.SavePlayer(ctx, t), storetest.SavePlayer(ctx, t), storetest.SavePlayer(ctx, t)
+	creatorID := creator.GetKey().Encode()
+
+	g, _, err := games.CreateGame(ctx, creatorID, tictactoe.GameType, "", 2, 2)
+	if err != nil {
+		t.Fatalf("CreateGame threw an error: %v", err)
+	}
+	gameID := strconv.FormatInt(g.ID, 10)
+
+	if _, err = PostSystem(ctx, g.ID, SystemEvent{Event: "Bad Event"}); err == nil {
+		t.Fatal("PostSystem did not throw an error for an invalid event.")
+	}
+
+	turn, err := PostSystem(ctx, g.ID, SystemEvent{
+		Event:   "turn",
+		Params:  map[string]interface{}{"player_id": creatorID},
+		Message: creator.Username + "'s turn",
+	})
+	if err != nil {
+		t.Fatalf("PostSystem threw an error: %v", err)
+	}
+	if turn.PlayerKey != nil || !turn.IsSystem() || turn.Data != `{"player_id":"`+creatorID+`"}` {
+		t.Fatalf("PostSystem did not post a system chat. Got: %+v", turn)
+	}
+
+	if _, _, err = games.JoinGame(ctx, gameID, leaver.GetKey().Encode()); err != nil {
+		t.Fatalf("JoinGame threw an error: %v", err)
+	}
+	if _, _, err = games.LeaveGame(ctx, gameID, leaver.GetKey().Encode()); err != nil {
+		t.Fatalf("LeaveGame threw an error: %v", err)
+	}
+	if _, _, err = games.JoinGame(ctx, gameID, other.GetKey().Encode()); err != nil {
+		t.Fatalf("JoinGame threw an error: %v", err)
+	}
+	if _, _, err = games.StartGame(ctx, gameID, creatorID); err != nil {
+		t.Fatalf("StartGame threw an error: %v", err)
+	}
+	if _, _, _, err = games.MakeMove(ctx, gameID, creatorID, `{"square":0}`); err != nil {
+		t.Fatalf("MakeMove threw an error: %v", err)
+	}
+	if _, _, err = games.ForfeitGame(ctx, gameID, other.GetKey().Encode()); err != nil {
+		t.Fatalf("ForfeitGame threw an error: %v", err)
+	}
+
+	_, chats, _, err := GetChats(ctx, gameID, creatorID, Page{})
+	if err != nil {
+		t.Fatalf("GetChats threw an error: %v", err)
+	}
+
+	events := []string{EventGameOver, EventTurn, EventGameStart, EventPlayerJoined, EventPlayerLeft, EventPlayerJoined, "turn"}
+	if len(chats) != len(events) {
+		t.Fatalf("The game did not post its events. Got: %+v", chats)
+	}
+	for k, v := range chats {
+		if v.Event != events[k] {
+			t.Fatalf("The game posted the wrong event. Wanted: %s; Got: %s", events[k], v.Event)
+		}
+	}
+	messages := map[int]string{
+		0: "Game over: " + creator.Username + " won",
+		1: other.Username + "'s turn",
+		3: other.Username + " joined",
+		4: leaver.Username + " left",
+	}
+	for k, want := range messages {
+		if chats[k].Message != want {
+			t.Fatalf("The game posted the wrong message. Wanted: %s; Got: %s", want, chats[k].Message)
+		}
+	}
+	if want := `{"move_number":1,"player_ids":["` + other.GetKey().Encode() + `"]}`; chats[1].Data != want {
+		t.Fatalf("The game posted the wrong turn. Wanted: %s; Got: %s", want, chats[1].Data)
+	}
+
+	var reply Reply
+	reply.Set(chats[0])
+	if _, err = json.Marshal(reply); err != nil || reply.PlayerID != "" || reply.Type != model.ChatSystem {
+		t.Fatalf("Reply did not show the system chat. Got: %+v, %v", reply, err)
+	}
+}
@@ -0,0 +1,211 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/benjamw/gogame/config"
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+)
+
+// Validator checks a chat before it is saved
+// A Validator may change the message (e.g.- to mask a word), and should return
+// a game.UserError explaining why if the chat can not be posted
+type Validator interface {
+	Validate(ctx context.Context, room model.Room, chat *model.Chat) error
+}
+
+// ValidatorFunc lets an ordinary function be used as a Validator
+type ValidatorFunc func(ctx context.Context, room model.Room, chat *model.Chat) error
+
+// Validate calls f(ctx, room, chat)
+func (f ValidatorFunc) Validate(ctx context.Context, room model.Room, chat *model.Chat) error {
+	return f(ctx, room, chat)
+}
+
+var (
+	validators     map[string][]Validator
+	validatorsLock sync.RWMutex
+
+	// wordPatterns caches the compiled word filters by word list
+	wordPatterns sync.Map
+
+	linkPattern  = regexp.MustCompile(`(?i)\b(?:[a-z][a-z0-9+.-]*://|www\.)\S+`)
+	spacePattern = regexp.MustCompile(`[ \t]{2,}`)
+)
+
+// builtInValidators check every chat, in order, before the registered validators
+// Links are stripped and words masked first, so the length and repeats are checked on the message as posted
+var builtInValidators = []Validator{
+	ValidatorFunc(stripLinks),
+	ValidatorFunc(filterWords),
+	ValidatorFunc(checkLength),
+	ValidatorFunc(checkRepeats),
+}
+
+// RegisterValidator registers a validator for the chats in the rooms of games of the given type,
+// or for every chat if the game type is empty
+// Validators run in the order they are registered, after the built in validators
+// This is usually called in the init() of the package holding the rules
+func RegisterValidator(gameType string, v Validator) {
+	validatorsLock.Lock()
+	defer validatorsLock.Unlock()
+
+	if validators == nil {
+		validators = make(map[string][]Validator, 0)
+	}
+
+	validators[gameType] = append(validators[gameType], v)
+}
+
+// validate runs the chat through the validators for the room, stopping at the first error
+func validate(ctx context.Context, room model.Room, chat *model.Chat) (myerr error) {
+	validatorsLock.RLock()
+	chain := append(append([]Validator{}, builtInValidators...), validators[""]...)
+	byGame := false
+	for gameType := range validators {
+		if gameType != "" {
+			byGame = true
+			break
+		}
+	}
+	validatorsLock.RUnlock()
+
+	if byGame && room.RoomType() == model.RoomGame {
+		var g model.Game
+		if myerr = g.ByID(ctx, room.ID); myerr != nil {
+			return
+		}
+
+		validatorsLock.RLock()
+		chain = append(chain, validators[g.Type]...)
+		validatorsLock.RUnlock()
+	}
+
+	for _, v := range chain {
+		if myerr = v.Validate(ctx, room, chat); myerr != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// stripLinks removes the links from the message if the config says to
+func stripLinks(ctx context.Context, room model.Room, chat *model.Chat) error {
+	if !config.FromContext(ctx).ChatStripLinks {
+		return nil
+	}
+
+	message := linkPattern.ReplaceAllString(chat.Message, "")
+	chat.Message = strings.TrimSpace(spacePattern.ReplaceAllString(message, " "))
+
+	return nil
+}
+
+// filterWords masks or rejects the words in the config word list
+func filterWords(ctx context.Context, room model.Room, chat *model.Chat) error {
+	cfg := config.FromContext(ctx)
+	if len(cfg.ChatWords) == 0 {
+		return nil
+	}
+
+	pattern := wordPattern(cfg.ChatWords)
+
+	if cfg.ChatWordMode == "reject" {
+		if pattern.MatchString(chat.Message) {
+			return game.NewUserError(nil, http.StatusBadRequest, "Your message has language that is not allowed here")
+		}
+
+		return nil
+	}
+
+	chat.Message = pattern.ReplaceAllStringFunc(chat.Message, func(word string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(word))
+	})
+
+	return nil
+}
+
+// wordPattern returns the pattern matching any of the words, ignoring case
+func wordPattern(words []string) *regexp.Regexp {
+	cacheKey := strings.Join(words, "\x00")
+	if pattern, ok := wordPatterns.Load(cacheKey); ok {
+		return pattern.(*regexp.Regexp)
+	}
+
+	quoted := make([]string, len(words))
+	for k, v := range words {
+		quoted[k] = regexp.QuoteMeta(v)
+	}
+
+	pattern := regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	wordPatterns.Store(cacheKey, pattern)
+
+	return pattern
+}
+
+// checkLength rejects empty messages and messages longer than the config allows
+func checkLength(ctx context.Context, room model.Room, chat *model.Chat) error {
+	if strings.TrimSpace(chat.Message) == "" {
+		return game.NewUserError(nil, http.StatusBadRequest, "A message is required")
+	}
+
+	max := config.FromContext(ctx).ChatMaxLength
+	if max > 0 && utf8.RuneCountInString(chat.Message) > max {
+		return game.NewUserError(nil, http.StatusBadRequest, "Chats can be at most %d characters", max)
+	}
+
+	return nil
+}
+
+// checkRepeats rejects a message the player has already posted to the room
+// as many times as the config allows within the repeat window
+func checkRepeats(ctx context.Context, room model.Room, chat *model.Chat) (myerr error) {
+	cfg := config.FromContext(ctx)
+	if cfg.ChatRepeatLimit <= 0 || cfg.ChatRepeatWindow <= 0 {
+		return
+	}
+
+	window := time.Duration(cfg.ChatRepeatWindow) * time.Second
+	now := game.Now(ctx)
+
+	var chats model.ChatList
+	if myerr = chats.ByRoomAndPlayer(ctx, room.GetKey(), chat.PlayerKey, now.Add(-window), time.Time{}); myerr != nil {
+		return
+	}
+
+	message := strings.TrimSpace(chat.Message)
+
+	// the repeats are newest first
+	repeats := make(model.ChatList, 0, cfg.ChatRepeatLimit)
+	for _, v := range chats {
+		// an edit is not a repeat of the chat being edited
+		if chat.GetKey() != nil && v.GetKey().Equal(chat.GetKey()) {
+			continue
+		}
+
+		if !v.IsDeleted() && strings.EqualFold(strings.TrimSpace(v.Message), message) {
+			repeats = append(repeats, v)
+		}
+	}
+
+	if len(repeats) >= cfg.ChatRepeatLimit {
+		// the message can be posted again once the repeats in the window drop below the limit
+		retryAfter := repeats[cfg.ChatRepeatLimit-1].Created.Add(window).Sub(now)
+		myerr = &game.TooManyRequestsError{
+			Message:    fmt.Sprintf("You have already posted that message %d times in the last %s, try again in %s", len(repeats), window, retryAfter.Round(time.Second)),
+			RetryAfter: retryAfter,
+		}
+		return
+	}
+
+	return
+}
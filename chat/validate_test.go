@@ -0,0 +1,106 @@
+package chat
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjamw/gogame/config"
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+	"github.com/benjamw/gogame/store/storetest"
+)
+
+func TestValidators(t *testing.T) {
+
+	cfg := *config.Get()
+	cfg.ChatMaxLength = 10
+	cfg.ChatRepeatLimit = 2
+	cfg.ChatRepeatWindow = 60
+	cfg.ChatWords = []string{"darn"}
+	cfg.ChatWordMode = "mask"
+	cfg.ChatStripLinks = true
+	ctx := config.NewContext(storetest.NewContext(), &cfg)
+
+	player := storetest.SavePlayer(ctx, t)
+	playerID := player.GetKey().Encode()
+	room := storetest.SaveRoom(ctx, t, player)
+	roomID := room.GetKey().Encode()
+
+	chat, err := AddChat(ctx, roomID, playerID, "Darn it")
+	if err != nil {
+		t.Fatalf("AddChat threw an error: %v", err)
+	}
+	if chat.Message != "**** it" {
+		t.Fatalf("AddChat did not mask the word. Got: %q", chat.Message)
+	}
+
+	if chat, err = AddChat(ctx, roomID, playerID, "see http://x.io  ok"); err != nil {
+		t.Fatalf("AddChat threw an error: %v", err)
+	}
+	if chat.Message != "see ok" {
+		t.Fatalf("AddChat did not strip the link. Got: %q", chat.Message)
+	}
+
+	if _, err = AddChat(ctx, roomID, playerID, "www.x.io"); err == nil {
+		t.Fatal("AddChat did not throw an error for a message that was only a link.")
+	}
+
+	if _, err = AddChat(ctx, roomID, playerID, strings.Repeat("a", 11)); err == nil {
+		t.Fatal("AddChat did not throw an error for a long message.")
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err = AddChat(ctx, roomID, playerID, "gg"); err != nil {
+			t.Fatalf("AddChat threw an error: %v", err)
+		}
+	}
+	_, err = AddChat(ctx, roomID, playerID, "GG ")
+	if e, ok := err.(*game.TooManyRequestsError); !ok || e.RetryAfter <= 0 || e.RetryAfter > time.Minute {
+		t.Fatalf("AddChat did not throw a 429 error with the time left in the window for a repeated message. Got: %v", err)
+	}
+
+	cfg.ChatWordMode = "reject"
+	if _, err = AddChat(ctx, roomID, playerID, "darn"); err == nil {
+		t.Fatal("AddChat did not throw an error for a rejected word.")
+	}
+
+	// validators registered for a game type only check the chats in those games
+	RegisterValidator("validated", ValidatorFunc(func(ctx context.Context, room model.Room, chat *model.Chat) error {
+		if chat.Message == "e4" {
+			return game.NewUserError(nil, http.StatusBadRequest, "Moves go in the move box")
+		}
+
+		return nil
+	}))
+
+	g := model.Game{
+		Type:       "validated",
+		CreatorKey: player.GetKey(),
+	}
+	if err = store.Save(ctx, &g); err != nil {
+		t.Fatalf("Could not save the test Game: %v", err)
+	}
+	seat := model.Seat{
+		GameKey:   g.GetKey(),
+		PlayerKey: player.GetKey(),
+	}
+	if err = store.Save(ctx, &seat); err != nil {
+		t.Fatalf("Could not save the test Seat: %v", err)
+	}
+	gameRoom := model.Room{ID: g.ID, Type: model.RoomGame}
+	if err = store.Save(ctx, &gameRoom); err != nil {
+		t.Fatalf("Could not save the test Room: %v", err)
+	}
+
+	if _, err = AddChat(ctx, strconv.FormatInt(g.ID, 10), playerID, "e4"); err == nil {
+		t.Fatal("AddChat did not run the game's validator.")
+	}
+	if _, err = AddChat(ctx, roomID, playerID, "e4"); err != nil {
+		t.Fatalf("AddChat ran the game's validator outside of the game: %v", err)
+	}
+}
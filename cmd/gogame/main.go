@@ -0,0 +1,151 @@
+// Command gogame serves the game API without App Engine
+//
+// Usage:
+//
+//	gogame [-config file.yaml] [-addr :8080] [-store memory|sqlite|postgres] [-dsn ...]
+//	       [-tls-cert cert.pem -tls-key key.pem] [-root path/to/app]
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/benjamw/gogame/chat"
+	"github.com/benjamw/gogame/config"
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/games"
+	gttp "github.com/benjamw/gogame/http"
+	"github.com/benjamw/gogame/store"
+
+	// run init() on the endpoints
+	_ "github.com/benjamw/gogame/initializer"
+)
+
+var (
+	configFile = flag.String("config", "", "path to the JSON, YAML, or TOML config file (GOGAME_* environment variables override it)")
+	addr       = flag.String("addr", ":8080", "address to listen on")
+	tlsCert    = flag.String("tls-cert", "", "path to the TLS certificate (requires -tls-key)")
+	tlsKey     = flag.String("tls-key", "", "path to the TLS private key (requires -tls-cert)")
+	storeType  = flag.String("store", "memory", "storage backend: memory, sqlite, or postgres")
+	dsn        = flag.String("dsn", "", "data source name for the sqlite or postgres store")
+	root       = flag.String("root", "", "path to the app directory holding the email templates")
+	grace      = flag.Duration("shutdown-timeout", 10*time.Second, "time to wait for open requests when shutting down")
+)
+
+func main() {
+	flag.Parse()
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatal("both -tls-cert and -tls-key are required to serve TLS")
+	}
+
+	game.AppEngine = false
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatalf("could not load the config: %v", err)
+	}
+	config.Set(cfg)
+
+	if *root != "" {
+		config.SetRoot(*root)
+	}
+
+	s, closeStore, err := openStore(context.Background(), *storeType, *dsn)
+	if err != nil {
+		log.Fatalf("could not open the %s store: %v", *storeType, err)
+	}
+	defer closeStore()
+
+	// ending the base context on shutdown closes the open chat streams
+	base, closeStreams := context.WithCancel(context.Background())
+	defer closeStreams()
+
+	srv := &http.Server{
+		Addr:    *addr,
+		Handler: gttp.WithConfig(gttp.WithStore(gttp.R, s), cfg),
+		BaseContext: func(net.Listener) context.Context {
+			return base
+		},
+	}
+	srv.RegisterOnShutdown(closeStreams)
+
+	if cfg.SweepInterval > 0 {
+		sweepCtx, stopSweep := context.WithCancel(store.NewContext(config.NewContext(context.Background(), cfg), s))
+		defer stopSweep()
+
+		go sweep(sweepCtx, time.Duration(cfg.SweepInterval)*time.Second)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("serving on %s using the %s store", *addr, *storeType)
+
+		if *tlsCert != "" {
+			errs <- srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			errs <- srv.ListenAndServe()
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err = <-errs:
+		if err != http.ErrServerClosed {
+			log.Fatalf("server error: %v", err)
+		}
+	case sig := <-stop:
+		log.Printf("received %v, shutting down", sig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), *grace)
+		defer cancel()
+
+		if err = srv.Shutdown(ctx); err != nil {
+			log.Printf("could not shut down cleanly: %v", err)
+		}
+
+		// the mentions of the last chats are still being notified in the background
+		notified := make(chan struct{})
+		go func() {
+			chat.WaitForNotifications()
+			close(notified)
+		}()
+
+		select {
+		case <-notified:
+		case <-ctx.Done():
+			log.Printf("could not finish notifying the mentioned players")
+		}
+	}
+}
+
+// sweep times out the turns that have run out of time and purges the expired chats
+// on every tick until ctx is done
+func sweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := games.Sweep(ctx); err != nil {
+				log.Printf("could not sweep the timed out turns: %v", err)
+			}
+
+			if _, err := chat.Purge(ctx); err != nil {
+				log.Printf("could not purge the expired chats: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/benjamw/gogame/store"
+)
+
+// openStore creates the storage backend of the given type and
+// returns it along with a function to close it when done
+func openStore(ctx context.Context, kind, dsn string) (s store.Store, closer func() error, myerr error) {
+	closer = func() error { return nil }
+
+	var driver, dialect string
+	switch kind {
+	case "memory":
+		s = store.NewMemory()
+		return
+	case "sqlite":
+		driver, dialect = "sqlite3", store.SQLite
+		if dsn == "" {
+			dsn = "gogame.db"
+		}
+	case "postgres":
+		driver, dialect = "postgres", store.Postgres
+	default:
+		myerr = fmt.Errorf("unknown store type %q", kind)
+		return
+	}
+
+	if dsn == "" {
+		myerr = fmt.Errorf("the %s store requires a -dsn", kind)
+		return
+	}
+
+	if dialect == store.SQLite {
+		// transactions take the write lock when they begin, so two of them can't both read
+		// and then deadlock upgrading to write, which SQLite fails without waiting
+		dsn = withParam(dsn, "_txlock", "immediate")
+	}
+
+	conn, myerr := sql.Open(driver, dsn)
+	if myerr != nil {
+		return
+	}
+
+	if dialect == store.SQLite {
+		// SQLite only allows a single writer
+		conn.SetMaxOpenConns(1)
+	}
+
+	ss, myerr := store.NewSQL(conn, dialect)
+	if myerr != nil {
+		conn.Close()
+		return
+	}
+
+	if _, myerr = ss.Migrate(ctx); myerr != nil {
+		conn.Close()
+		return
+	}
+
+	s = ss
+	closer = conn.Close
+
+	return
+}
+
+// withParam adds the query parameter to the data source name, unless it is already set
+func withParam(dsn, name, value string) string {
+	if strings.Contains(dsn, name+"=") {
+		return dsn
+	}
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+
+	return dsn + sep + name + "=" + value
+}
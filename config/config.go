@@ -1,18 +1,26 @@
 package config
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/BurntSushi/toml"
 	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
 )
 
 var (
-	hasGameDefaults bool
-
 	/***********************************************************
-	  The Root* variables should not be set in a local.go file
+	  The Root* variables should not be set in a config file
 	  as they are set dynamically elsewhere in the code
 	 ***********************************************************/
 
@@ -24,94 +32,424 @@ var (
 
 	/* END Root* VARIABLES */
 
+	current     = Default()
+	currentLock sync.RWMutex
+
+	configContextKey = "holds the Config used for the request"
+)
+
+// envPrefix is the prefix for the environment variables that override the config values
+const envPrefix = "GOGAME_"
+
+// Config holds the settings for a game site.
+// It can be loaded from a JSON, YAML, or TOML file with Load,
+// and each value can be overridden with the GOGAME_* environment variable
+// given in its env tag (e.g.- GOGAME_SITE_NAME)
+type Config struct {
 	/*** Game Settings ***/
 
 	// SiteName is the name of this website
-	SiteName string
+	SiteName string `json:"site_name" yaml:"site_name" toml:"site_name" env:"SITE_NAME"`
 
 	// RoutePriority is the default priority value for mux routes
 	// lower ( > 0 ) is better
-	RoutePriority int
+	RoutePriority int `json:"route_priority" yaml:"route_priority" toml:"route_priority" env:"ROUTE_PRIORITY"`
+
+	/*** Turn Timer Settings ***/
+
+	// TurnTimeout is the default policy for players that run out of time on their turn
+	// one of "skip", "forfeit", or "random"
+	TurnTimeout string `json:"turn_timeout" yaml:"turn_timeout" toml:"turn_timeout" env:"TURN_TIMEOUT"`
+
+	// SweepInterval is the time in seconds between sweeps for timed out turns and expired chats in the standalone server
+	// (App Engine uses the cron job instead), 0 disables the sweeps
+	SweepInterval int `json:"sweep_interval" yaml:"sweep_interval" toml:"sweep_interval" env:"SWEEP_INTERVAL"`
+
+	/*** Chat Settings ***/
+
+	// ChatMaxLength is the most characters in a chat message, 0 for no limit
+	ChatMaxLength int `json:"chat_max_length" yaml:"chat_max_length" toml:"chat_max_length" env:"CHAT_MAX_LENGTH"`
+
+	// ChatRepeatLimit is the most times a player can post the same message to a room
+	// within ChatRepeatWindow seconds, 0 for no limit
+	ChatRepeatLimit int `json:"chat_repeat_limit" yaml:"chat_repeat_limit" toml:"chat_repeat_limit" env:"CHAT_REPEAT_LIMIT"`
+
+	// ChatRepeatWindow is the time in seconds that repeated chat messages are counted over
+	ChatRepeatWindow int `json:"chat_repeat_window" yaml:"chat_repeat_window" toml:"chat_repeat_window" env:"CHAT_REPEAT_WINDOW"`
+
+	// ChatWords is the list of words filtered out of chat messages
+	// (a comma-separated list in the environment)
+	ChatWords []string `json:"chat_words" yaml:"chat_words" toml:"chat_words" env:"CHAT_WORDS"`
+
+	// ChatWordMode is what is done with a chat message holding one of the ChatWords
+	// either "mask" to replace the word with asterisks, or "reject" to refuse the message
+	ChatWordMode string `json:"chat_word_mode" yaml:"chat_word_mode" toml:"chat_word_mode" env:"CHAT_WORD_MODE"`
+
+	// ChatStripLinks removes links from chat messages
+	ChatStripLinks bool `json:"chat_strip_links" yaml:"chat_strip_links" toml:"chat_strip_links" env:"CHAT_STRIP_LINKS"`
+
+	// ChatPlayerBurst is the most chats a player can post at once, across every room,
+	// before being limited to ChatPlayerPerMinute, 0 for no limit
+	ChatPlayerBurst int `json:"chat_player_burst" yaml:"chat_player_burst" toml:"chat_player_burst" env:"CHAT_PLAYER_BURST"`
+
+	// ChatPlayerPerMinute is the most chats a minute a player can post once their burst is used up
+	ChatPlayerPerMinute int `json:"chat_player_per_minute" yaml:"chat_player_per_minute" toml:"chat_player_per_minute" env:"CHAT_PLAYER_PER_MINUTE"`
+
+	// ChatRoomBurst is the most chats that can be posted to a room at once,
+	// before it is limited to ChatRoomPerMinute, 0 for no limit
+	ChatRoomBurst int `json:"chat_room_burst" yaml:"chat_room_burst" toml:"chat_room_burst" env:"CHAT_ROOM_BURST"`
+
+	// ChatRoomPerMinute is the most chats a minute that can be posted to a room once its burst is used up
+	ChatRoomPerMinute int `json:"chat_room_per_minute" yaml:"chat_room_per_minute" toml:"chat_room_per_minute" env:"CHAT_ROOM_PER_MINUTE"`
+
+	/*** Rating Settings ***/
+
+	// RatingSystem is the default formula used to rate players when a game finishes
+	// either "elo" or "glicko"
+	RatingSystem string `json:"rating_system" yaml:"rating_system" toml:"rating_system" env:"RATING_SYSTEM"`
 
 	/*** Email Settings ***/
 
 	// FromEmail the email address to send from
-	FromEmail string
+	FromEmail string `json:"from_email" yaml:"from_email" toml:"from_email" env:"FROM_EMAIL"`
 
 	// TestToEmail the email address to send emails to when testing
 	// This email address needs to be whitelisted in the MailGun Sandbox subdomain
-	TestToEmail string
+	TestToEmail string `json:"test_to_email" yaml:"test_to_email" toml:"test_to_email" env:"TEST_TO_EMAIL"`
 
 	/*** MailGun Settings ***/
 
 	// MailGunDomain is the domain to use for MailGun
-	MailGunDomain string
+	MailGunDomain string `json:"mailgun_domain" yaml:"mailgun_domain" toml:"mailgun_domain" env:"MAILGUN_DOMAIN"`
 
 	// MailGunAPIKey is the private API key for MailGun
-	MailGunAPIKey string
+	MailGunAPIKey string `json:"mailgun_api_key" yaml:"mailgun_api_key" toml:"mailgun_api_key" env:"MAILGUN_API_KEY"`
 
 	// MailGunPubKey is the public key for MailGun
-	MailGunPubKey string
+	MailGunPubKey string `json:"mailgun_pub_key" yaml:"mailgun_pub_key" toml:"mailgun_pub_key" env:"MAILGUN_PUB_KEY"`
 
 	/*** Cloud Storage Settings ***/
 
 	// StorageBucket stores the name of the Bucket used in CloudStorage
-	StorageBucket string
+	StorageBucket string `json:"storage_bucket" yaml:"storage_bucket" toml:"storage_bucket" env:"STORAGE_BUCKET"`
 
 	// StorageBaseURL is ???
-	StorageBaseURL string
+	StorageBaseURL string `json:"storage_base_url" yaml:"storage_base_url" toml:"storage_base_url" env:"STORAGE_BASE_URL"`
 
 	/*** Forgot Password Token Settings ***/
 
 	// FPTokenExpiry is the time in days to expire forgot password tokens
-	FPTokenExpiry int
+	FPTokenExpiry int `json:"fp_token_expiry" yaml:"fp_token_expiry" toml:"fp_token_expiry" env:"FP_TOKEN_EXPIRY"`
 
 	/*** BCrypt password settings ***/
 
 	// BcryptCost is the cost of the bcrypt hashing function
-	BcryptCost int
+	BcryptCost int `json:"bcrypt_cost" yaml:"bcrypt_cost" toml:"bcrypt_cost" env:"BCRYPT_COST"`
 
 	/*** Cookie settings ***/
 
 	// CookieCryptKey is the encryption key for the session cookie
 	// must be 32 bytes
-	CookieCryptKey []byte
+	CookieCryptKey Key `json:"cookie_crypt_key" yaml:"cookie_crypt_key" toml:"cookie_crypt_key" env:"COOKIE_CRYPT_KEY"`
 
 	// CookieSignatureKey is the encryption signature for the session cookie
-	CookieSignatureKey []byte
+	// must be 32 bytes
+	CookieSignatureKey Key `json:"cookie_signature_key" yaml:"cookie_signature_key" toml:"cookie_signature_key" env:"COOKIE_SIGNATURE_KEY"`
 
 	/*** Login Redirect Settings ***/
 
 	// FrontLogin contains the relative path to the user login page
-	FrontLogin string
+	FrontLogin string `json:"front_login" yaml:"front_login" toml:"front_login" env:"FRONT_LOGIN"`
 
 	// AdminLogin contains the relative path to the vendor admin login page
-	AdminLogin string
+	AdminLogin string `json:"admin_login" yaml:"admin_login" toml:"admin_login" env:"ADMIN_LOGIN"`
 
 	/*** Encryption settings ***/
 
 	// EncryptionKey is the encryption key for general encryption on the server
-	EncryptionKey []byte
-)
+	// must be 32 bytes if set
+	EncryptionKey Key `json:"encryption_key" yaml:"encryption_key" toml:"encryption_key" env:"ENCRYPTION_KEY"`
+}
+
+// Default returns a Config filled with the default game settings
+func Default() *Config {
+	return &Config{
+		RoutePriority:       9999,
+		TurnTimeout:         "forfeit",
+		SweepInterval:       60,
+		ChatMaxLength:       1000,
+		ChatRepeatLimit:     3,
+		ChatRepeatWindow:    60,
+		ChatWordMode:        "mask",
+		ChatPlayerBurst:     10,
+		ChatPlayerPerMinute: 30,
+		ChatRoomBurst:       60,
+		ChatRoomPerMinute:   300,
+		RatingSystem:        "glicko",
+		FPTokenExpiry:       1,
+		BcryptCost:          bcrypt.DefaultCost,
+		FrontLogin:          "/login",
+		AdminLogin:          "/admin/#/login",
+	}
+}
+
+// Load reads the config file at the given path on top of the default settings,
+// applies the GOGAME_* environment overrides, and validates the result.
+// The file format is chosen by the file extension (.json, .yaml, .yml, or .toml).
+// If path is empty, only the defaults and the environment are used
+func Load(path string) (c *Config, myerr error) {
+	cfg := Default()
+
+	if path != "" {
+		if myerr = cfg.ReadFile(path); myerr != nil {
+			return
+		}
+	}
 
-func init() {
-	SetGameConfig()
+	if myerr = cfg.ApplyEnv(); myerr != nil {
+		return
+	}
+
+	if myerr = cfg.Validate(); myerr != nil {
+		return
+	}
+
+	c = cfg
+
+	return
 }
 
-func SetGameConfig() {
-	if hasGameDefaults {
+// ReadFile reads the config file at the given path into the config
+func (c *Config) ReadFile(path string) (myerr error) {
+	contents, myerr := os.ReadFile(path)
+	if myerr != nil {
 		return
 	}
-	hasGameDefaults = true
 
-	RoutePriority = 9999
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		myerr = json.Unmarshal(contents, c)
+	case ".yaml", ".yml":
+		myerr = yaml.Unmarshal(contents, c)
+	case ".toml":
+		myerr = toml.Unmarshal(contents, c)
+	default:
+		myerr = fmt.Errorf("unknown config file format: '%s'", ext)
+	}
+
+	if myerr != nil {
+		myerr = fmt.Errorf("could not read config file '%s': %v", path, myerr)
+	}
+
+	return
+}
+
+// ApplyEnv overrides the config values with any GOGAME_* environment variables that are set
+func (c *Config) ApplyEnv() error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
 
-	FPTokenExpiry = 1
+		value, ok := os.LookupEnv(envPrefix + name)
+		if !ok {
+			continue
+		}
 
-	BcryptCost = bcrypt.DefaultCost
+		if err := setValue(v.Field(i), value); err != nil {
+			return fmt.Errorf("invalid value for %s%s: %v", envPrefix, name, err)
+		}
+	}
+
+	return nil
+}
+
+func setValue(field reflect.Value, value string) error {
+	if u, ok := field.Addr().Interface().(interface{ UnmarshalText([]byte) error }); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported config type %v", field.Type())
+		}
+
+		values := make([]string, 0)
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("unsupported config type %v", field.Type())
+	}
+
+	return nil
+}
+
+// Validate checks the config for missing or invalid settings
+func (c *Config) Validate() error {
+	e := &InvalidConfigError{}
+
+	if len(c.CookieCryptKey) != 32 {
+		e.add("cookie_crypt_key must be 32 bytes, got %d", len(c.CookieCryptKey))
+	}
+
+	if len(c.CookieSignatureKey) != 32 {
+		e.add("cookie_signature_key must be 32 bytes, got %d", len(c.CookieSignatureKey))
+	}
+
+	if len(c.EncryptionKey) != 0 && len(c.EncryptionKey) != 32 {
+		e.add("encryption_key must be 32 bytes, got %d", len(c.EncryptionKey))
+	}
+
+	if c.FromEmail == "" {
+		e.add("from_email is required")
+	}
+
+	if c.MailGunDomain == "" {
+		e.add("mailgun_domain is required")
+	}
+
+	if c.MailGunAPIKey == "" {
+		e.add("mailgun_api_key is required")
+	}
+
+	switch c.TurnTimeout {
+	case "skip", "forfeit", "random":
+	default:
+		e.add("turn_timeout must be skip, forfeit, or random, got %q", c.TurnTimeout)
+	}
+
+	if c.RatingSystem != "elo" && c.RatingSystem != "glicko" {
+		e.add("rating_system must be elo or glicko, got %q", c.RatingSystem)
+	}
+
+	if c.SweepInterval < 0 {
+		e.add("sweep_interval can not be negative, got %d", c.SweepInterval)
+	}
+
+	if c.ChatMaxLength < 0 {
+		e.add("chat_max_length can not be negative, got %d", c.ChatMaxLength)
+	}
+
+	if c.ChatRepeatLimit < 0 || c.ChatRepeatWindow < 0 {
+		e.add("chat_repeat_limit and chat_repeat_window can not be negative, got %d and %d", c.ChatRepeatLimit, c.ChatRepeatWindow)
+	}
+
+	if c.ChatPlayerBurst < 0 || c.ChatPlayerPerMinute < 0 || c.ChatRoomBurst < 0 || c.ChatRoomPerMinute < 0 {
+		e.add("the chat rate limits can not be negative")
+	}
+
+	if c.ChatWordMode != "mask" && c.ChatWordMode != "reject" {
+		e.add("chat_word_mode must be mask or reject, got %q", c.ChatWordMode)
+	}
+
+	if c.FPTokenExpiry <= 0 {
+		e.add("fp_token_expiry must be positive, got %d", c.FPTokenExpiry)
+	}
+
+	if c.BcryptCost < bcrypt.MinCost || bcrypt.MaxCost < c.BcryptCost {
+		e.add("bcrypt_cost must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, c.BcryptCost)
+	}
+
+	if len(e.Problems) != 0 {
+		return e
+	}
+
+	return nil
+}
+
+// Get returns the process wide Config used when none is attached to the context
+func Get() *Config {
+	currentLock.RLock()
+	defer currentLock.RUnlock()
+
+	return current
+}
+
+// Set replaces the process wide Config
+func Set(c *Config) {
+	currentLock.Lock()
+	defer currentLock.Unlock()
+
+	current = c
+}
+
+// NewContext returns a copy of ctx that uses the given Config
+func NewContext(ctx context.Context, c *Config) context.Context {
+	return context.WithValue(ctx, &configContextKey, c)
+}
+
+// FromContext returns the Config that is stored in context, or the process wide Config if not found
+func FromContext(ctx context.Context) *Config {
+	if c, ok := ctx.Value(&configContextKey).(*Config); ok && c != nil {
+		return c
+	}
+
+	return Get()
+}
+
+// Key is a binary key value.
+// In config files and the environment it can be given as the raw key,
+// or prefixed with "hex:" or "base64:" to be decoded first
+type Key []byte
+
+// UnmarshalText satisfies the encoding.TextUnmarshaler interface
+func (k *Key) UnmarshalText(text []byte) (myerr error) {
+	s := string(text)
+
+	var b []byte
+	switch {
+	case strings.HasPrefix(s, "hex:"):
+		b, myerr = hex.DecodeString(s[len("hex:"):])
+	case strings.HasPrefix(s, "base64:"):
+		b, myerr = base64.StdEncoding.DecodeString(s[len("base64:"):])
+	default:
+		b = []byte(s)
+	}
+
+	if myerr != nil {
+		return
+	}
+
+	*k = b
+
+	return
+}
+
+// InvalidConfigError gets thrown when the config fails validation
+type InvalidConfigError struct {
+	Problems []string
+}
+
+func (e *InvalidConfigError) add(format string, params ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, params...))
+}
 
-	FrontLogin = "/login"
-	AdminLogin = "/admin/#/login"
+// Error allows the struct to implement the error interface
+func (e *InvalidConfigError) Error() string {
+	return "invalid config: " + strings.Join(e.Problems, "; ")
 }
 
 // GenRoot generates and sets the Root path value for the config data
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	cryptKey = "fake_crypt_key_1_2_3_4_5_6_7_8_9" // 32 chars
+	sigKey   = "fake_sig_key_1_2_3_4_5_6_7_8_9_0" // 32 chars
+)
+
+var configFiles = map[string]string{
+	"gogame.json": `{
+	"site_name": "The Gamesite",
+	"from_email": "games@example.com",
+	"mailgun_domain": "mg.example.com",
+	"mailgun_api_key": "key-1234",
+	"fp_token_expiry": 2,
+	"cookie_crypt_key": "` + cryptKey + `",
+	"cookie_signature_key": "hex:66616b655f7369675f6b65795f315f325f335f345f355f365f375f385f395f30"
+}`,
+	"gogame.yaml": `site_name: The Gamesite
+from_email: games@example.com
+mailgun_domain: mg.example.com
+mailgun_api_key: key-1234
+fp_token_expiry: 2
+cookie_crypt_key: ` + cryptKey + `
+cookie_signature_key: base64:ZmFrZV9zaWdfa2V5XzFfMl8zXzRfNV82XzdfOF85XzA=
+`,
+	"gogame.toml": `site_name = "The Gamesite"
+from_email = "games@example.com"
+mailgun_domain = "mg.example.com"
+mailgun_api_key = "key-1234"
+fp_token_expiry = 2
+cookie_crypt_key = "` + cryptKey + `"
+cookie_signature_key = "` + sigKey + `"
+`,
+}
+
+func writeConfig(t *testing.T, name, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatalf("Could not write the test config file. Error: %v", err)
+	}
+
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	for name, contents := range configFiles {
+		c, err := Load(writeConfig(t, name, contents))
+		if err != nil {
+			t.Fatalf("Load threw an error for %s: %v", name, err)
+		}
+
+		if c.SiteName != "The Gamesite" || c.FromEmail != "games@example.com" || c.FPTokenExpiry != 2 {
+			t.Fatalf("Load did not read the values from %s. Got: %+v", name, c)
+		}
+
+		if string(c.CookieCryptKey) != cryptKey || string(c.CookieSignatureKey) != sigKey {
+			t.Fatalf("Load did not decode the keys from %s. Got: %q, %q", name, c.CookieCryptKey, c.CookieSignatureKey)
+		}
+
+		// values not in the file keep their defaults
+		if c.RoutePriority != 9999 || c.FrontLogin != "/login" {
+			t.Fatalf("Load did not keep the default values for %s. Got: %+v", name, c)
+		}
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	path := writeConfig(t, "gogame.json", configFiles["gogame.json"])
+
+	t.Setenv("GOGAME_SITE_NAME", "Env Games")
+	t.Setenv("GOGAME_FP_TOKEN_EXPIRY", "7")
+	t.Setenv("GOGAME_CHAT_WORDS", "heck, darn,,")
+	t.Setenv("GOGAME_COOKIE_CRYPT_KEY", "hex:"+"00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff")
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load threw an error: %v", err)
+	}
+
+	if c.SiteName != "Env Games" || c.FPTokenExpiry != 7 {
+		t.Fatalf("Load did not apply the environment overrides. Got: %+v", c)
+	}
+
+	if len(c.ChatWords) != 2 || c.ChatWords[1] != "darn" {
+		t.Fatalf("Load did not split the environment list. Got: %q", c.ChatWords)
+	}
+
+	if len(c.CookieCryptKey) != 32 || c.CookieCryptKey[1] != 0x11 {
+		t.Fatalf("Load did not decode the environment key. Got: %x", c.CookieCryptKey)
+	}
+
+	t.Setenv("GOGAME_FP_TOKEN_EXPIRY", "a week")
+	if _, err = Load(path); err == nil {
+		t.Fatal("Load did not throw an error for an invalid environment value.")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := Default()
+
+	err := c.Validate()
+	e, ok := err.(*InvalidConfigError)
+	if !ok {
+		t.Fatalf("Validate threw the wrong error for an empty config. Error: %v", err)
+	}
+
+	// both cookie keys, the from email, the domain, and the API key
+	if len(e.Problems) != 5 {
+		t.Fatalf("Validate found the wrong number of problems. Wanted: 5; Got: %d (%v)", len(e.Problems), e)
+	}
+
+	c.CookieCryptKey = Key(cryptKey)
+	c.CookieSignatureKey = Key(sigKey)
+	c.FromEmail = "games@example.com"
+	c.MailGunDomain = "mg.example.com"
+	c.MailGunAPIKey = "key-1234"
+	if err = c.Validate(); err != nil {
+		t.Fatalf("Validate threw an error for a valid config: %v", err)
+	}
+
+	c.FPTokenExpiry = 0
+	if err = c.Validate(); err == nil {
+		t.Fatal("Validate did not throw an error for a zero token expiry.")
+	}
+
+	c.FPTokenExpiry = 1
+	c.TurnTimeout = "resign"
+	if err = c.Validate(); err == nil {
+		t.Fatal("Validate did not throw an error for an unknown turn timeout.")
+	}
+
+	c.TurnTimeout = "skip"
+	c.ChatWordMode = "bleep"
+	if err = c.Validate(); err == nil {
+		t.Fatal("Validate did not throw an error for an unknown chat word mode.")
+	}
+
+	c.ChatWordMode = "reject"
+	c.CookieSignatureKey = Key("too short")
+	if err = c.Validate(); err == nil {
+		t.Fatal("Validate did not throw an error for a short cookie key.")
+	}
+
+	if _, err = Load(writeConfig(t, "gogame.ini", "")); err == nil {
+		t.Fatal("Load did not throw an error for an unknown file format.")
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if FromContext(ctx) != Get() {
+		t.Fatal("FromContext did not return the process wide config for an empty context.")
+	}
+
+	c := Default()
+	c.SiteName = "Router Games"
+
+	if got := FromContext(NewContext(ctx, c)); got != c {
+		t.Fatalf("FromContext did not return the attached config. Got: %+v", got)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/benjamw/gogame/game"
 	"github.com/benjamw/gogame/mail"
 	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
 )
 
 // CreateToken creates a forgot password token for the given email address
@@ -30,9 +31,9 @@ func CreateToken(ctx context.Context, email string) (token model.ForgotToken, my
 	ft := model.ForgotToken{
 		PlayerKey: pl.GetKey(),
 		Value:     random.Stringnt(64, random.ALPHANUMERIC),
-		Expires:   game.Now(ctx).Add(time.Hour * time.Duration(24*config.FPTokenExpiry)),
+		Expires:   game.Now(ctx).Add(time.Hour * time.Duration(24*config.FromContext(ctx).FPTokenExpiry)),
 	}
-	if myerr = db.Save(ctx, &ft); myerr != nil {
+	if myerr = store.Save(ctx, &ft); myerr != nil {
 		return
 	}
 
@@ -49,7 +50,7 @@ func TestToken(ctx context.Context, token string) (pl model.Player, myerr error)
 	}
 
 	player := model.Player{}
-	if _, err := db.Load(ctx, ft.PlayerKey, &player); err != nil {
+	if err := store.Load(ctx, ft.PlayerKey, &player); err != nil {
 		myerr = &db.UnfoundObjectError{
 			EntityType: "Entity",
 			Key:        "token",
@@ -72,7 +73,7 @@ func TokenChangePassword(ctx context.Context, token string, pass string) (myerr
 	}
 
 	pl.PasswordHash = password.Encode(pass)
-	if myerr = db.Save(ctx, &pl); myerr != nil {
+	if myerr = store.Save(ctx, &pl); myerr != nil {
 		return
 	}
 
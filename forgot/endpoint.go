@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/benjamw/gogame/game"
 	gttp "github.com/benjamw/gogame/http"
 	"github.com/benjamw/golibs/db"
 )
@@ -40,7 +41,13 @@ func handleForgotPassword(ctx context.Context, w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	if errReply = SendForgotEmailDelay.Call(ctx, email, token.Value); errReply != nil {
+	if game.AppEngine {
+		errReply = SendForgotEmailDelay.Call(ctx, email, token.Value)
+	} else {
+		// no task queue outside of App Engine, so send it now
+		errReply = sendForgotEmail(ctx, email, token.Value)
+	}
+	if errReply != nil {
 		return
 	}
 
@@ -3,6 +3,7 @@ package game
 import (
 	"fmt"
 	"net/http"
+	"time"
 )
 
 // MultipleObjectError gets thrown when multiple entities are found when only one should exist
@@ -69,6 +70,22 @@ func (e *InvalidCredentialsError) Code() int {
 	return http.StatusBadRequest
 }
 
+// TooManyRequestsError gets thrown when a player is rate limited
+type TooManyRequestsError struct {
+	Message    string        // the error message to return
+	RetryAfter time.Duration // how long until the request can be made again
+}
+
+// Error allows the struct to implement the error interface as well as the game.Error interface
+func (e *TooManyRequestsError) Error() string {
+	return e.Message
+}
+
+// Code allows the struct to implement the game.Error interface
+func (e *TooManyRequestsError) Code() int {
+	return http.StatusTooManyRequests
+}
+
 // UserError is an error type that is strictly used for error output to the end user.
 type UserError struct {
 	Status  int    // the http status code
@@ -0,0 +1,35 @@
+package game
+
+import (
+	"context"
+	"log"
+
+	aelog "google.golang.org/appengine/log"
+)
+
+// AppEngine is true when running inside of App Engine.
+// The standalone server (cmd/gogame) sets this to false so the
+// App Engine only services (logging, task queues, urlfetch) are not used
+var AppEngine = true
+
+// Errorf logs an error message to the App Engine log,
+// or the standard logger when not running on App Engine
+func Errorf(ctx context.Context, format string, args ...interface{}) {
+	if AppEngine {
+		aelog.Errorf(ctx, format, args...)
+		return
+	}
+
+	log.Printf("ERROR: "+format, args...)
+}
+
+// Infof logs an info message to the App Engine log,
+// or the standard logger when not running on App Engine
+func Infof(ctx context.Context, format string, args ...interface{}) {
+	if AppEngine {
+		aelog.Infof(ctx, format, args...)
+		return
+	}
+
+	log.Printf("INFO: "+format, args...)
+}
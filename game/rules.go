@@ -0,0 +1,73 @@
+package game
+
+import (
+	"sync"
+)
+
+var (
+	rules     map[string]Rules
+	rulesLock sync.RWMutex
+)
+
+// Rules is the rules engine for one type of turn based game
+// The core keeps the game state as an opaque serialized value (JSON works well),
+// and passes it to the Rules to validate and apply each move.
+// Players are identified by their seat position, starting at 0
+type Rules interface {
+	// Setup returns the starting state for a game with the given number of players
+	// and should return a UserError if the game cannot be played with that many players
+	Setup(players int) (state []byte, err error)
+
+	// Turn returns the positions of the players that may move in the given state
+	Turn(state []byte) (positions []int, err error)
+
+	// Validate checks that the move made by the player in the given position is allowed
+	// and should return a UserError explaining why if it is not
+	Validate(state []byte, position int, move []byte) error
+
+	// Apply applies a valid move to the state and returns the new state
+	// Apply must not change the given state, and must always return the same
+	// new state for the same state and move so the game can be replayed
+	Apply(state []byte, position int, move []byte) (newState []byte, err error)
+
+	// Over reports if the game is over in the given state,
+	// and the positions of the winners (none for a draw)
+	Over(state []byte) (over bool, winners []int, err error)
+}
+
+// Passer can be implemented by Rules for games where a player can pass their turn.
+// It is used to skip the turn of a player that ran out of time
+type Passer interface {
+	// PassMove returns the move that passes the turn for the player in the given position
+	PassMove(state []byte, position int) (move []byte, err error)
+}
+
+// RandomMover can be implemented by Rules that can pick a move for a player.
+// It is used to move for a player that ran out of time
+type RandomMover interface {
+	// RandomMove returns a random valid move for the player in the given position
+	RandomMove(state []byte, position int) (move []byte, err error)
+}
+
+// RegisterRules registers the rules for the given game type
+// This is usually called in the init() of the package holding the rules
+func RegisterRules(gameType string, r Rules) {
+	rulesLock.Lock()
+	defer rulesLock.Unlock()
+
+	if rules == nil {
+		rules = make(map[string]Rules, 0)
+	}
+
+	rules[gameType] = r
+}
+
+// GetRules returns the rules registered for the given game type
+func GetRules(gameType string) (r Rules, ok bool) {
+	rulesLock.RLock()
+	defer rulesLock.RUnlock()
+
+	r, ok = rules[gameType]
+
+	return
+}
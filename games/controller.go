@@ -0,0 +1,653 @@
+package games
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/benjamw/golibs/db"
+	"github.com/benjamw/golibs/hooks"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+)
+
+// CreateGame creates a new open game with the given player in the first seat
+// and the chat room for the game
+func CreateGame(ctx context.Context, playerID, gameType, name string, minPlayers, maxPlayers int64) (g model.Game, seats model.SeatList, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	if gameType == "" {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "A game type is required")
+		return
+	}
+
+	if minPlayers < 1 || maxPlayers < minPlayers {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Invalid player count: min %d, max %d", minPlayers, maxPlayers)
+		return
+	}
+
+	if name == "" {
+		name = gameType
+	}
+
+	// the game, its room and the first seat are saved together, so a failure does not leave a part behind
+	myerr = store.RunInTransaction(ctx, func(ctx context.Context) (err error) {
+		newGame := model.Game{
+			Type:       gameType,
+			Name:       name,
+			Status:     model.GameOpen,
+			CreatorKey: playerKey,
+			MinPlayers: minPlayers,
+			MaxPlayers: maxPlayers,
+		}
+		if err = store.Save(ctx, &newGame); err != nil {
+			return
+		}
+
+		room := model.Room{
+			ID:   newGame.ID,
+			Name: newGame.Name,
+			Type: model.RoomGame,
+		}
+		if err = store.Save(ctx, &room); err != nil {
+			return
+		}
+
+		seat := model.Seat{
+			GameKey:   newGame.GetKey(),
+			PlayerKey: playerKey,
+			Position:  0,
+		}
+		if err = store.Save(ctx, &seat); err != nil {
+			return
+		}
+
+		g = newGame
+		seats = model.SeatList{seat}
+
+		return
+	})
+	if myerr != nil {
+		return
+	}
+
+	hooks.Do("GameCreate", ctx, g, seats)
+
+	return
+}
+
+// DeleteGame deletes the game with its seats, moves, and chat room
+// It undoes a game that could not be set up, such as a match that fell through, so no hooks are run
+func DeleteGame(ctx context.Context, g model.Game) (myerr error) {
+	var seats model.SeatList
+	if myerr = seats.ByGame(ctx, g.GetKey()); myerr != nil {
+		return
+	}
+
+	for k := range seats {
+		if myerr = store.Delete(ctx, &seats[k]); myerr != nil {
+			return
+		}
+	}
+
+	var moves model.MoveList
+	if myerr = moves.ByGame(ctx, g.GetKey()); myerr != nil {
+		return
+	}
+
+	for k := range moves {
+		if myerr = store.Delete(ctx, &moves[k]); myerr != nil {
+			return
+		}
+	}
+
+	var room model.Room
+	if myerr = room.ByID(ctx, g.ID); myerr == nil {
+		var chats model.ChatList
+		if myerr = chats.ByRoom(ctx, room.GetKey()); myerr != nil {
+			return
+		}
+
+		for k := range chats {
+			if myerr = store.Delete(ctx, &chats[k]); myerr != nil {
+				return
+			}
+		}
+
+		if myerr = store.Delete(ctx, &room); myerr != nil {
+			return
+		}
+	} else if _, ok := myerr.(*db.UnfoundObjectError); !ok {
+		return
+	}
+
+	myerr = store.Delete(ctx, &g)
+
+	return
+}
+
+// GetGame loads the game with the given ID and its seats
+func GetGame(ctx context.Context, gameID string) (g model.Game, seats model.SeatList, myerr error) {
+	gID, myerr := strconv.ParseInt(gameID, 10, 64)
+	if myerr != nil {
+		return
+	}
+
+	if myerr = g.ByID(ctx, gID); myerr != nil {
+		return
+	}
+
+	myerr = seats.ByGame(ctx, g.GetKey())
+
+	return
+}
+
+// ListGames lists the games with the given status (open games if empty),
+// optionally limited to the given game type
+func ListGames(ctx context.Context, status, gameType string) (gl model.GameList, myerr error) {
+	if status == "" {
+		status = model.GameOpen
+	}
+
+	myerr = gl.ByStatus(ctx, status, gameType)
+
+	return
+}
+
+// ListPlayerGames lists the games the given player has a seat in,
+// optionally limited to the given status
+func ListPlayerGames(ctx context.Context, playerID, status string) (gl model.GameList, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	var seats model.SeatList
+	if myerr = seats.ByPlayer(ctx, playerKey); myerr != nil {
+		return
+	}
+
+	keys := make([]*datastore.Key, len(seats))
+	for k := range seats {
+		keys[k] = seats[k].GameKey
+	}
+
+	var all model.GameList
+	if myerr = all.ByKeys(ctx, keys); myerr != nil {
+		return
+	}
+
+	gl = make(model.GameList, 0, len(all))
+	for _, v := range all {
+		if status == "" || v.Status == status {
+			gl = append(gl, v)
+		}
+	}
+
+	return
+}
+
+// JoinGame gives the player the next open seat in the game
+func JoinGame(ctx context.Context, gameID, playerID string) (g model.Game, seats model.SeatList, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	// the seats are read and taken in a transaction, so two players cannot take the same seat
+	myerr = store.RunInTransaction(ctx, func(ctx context.Context) (err error) {
+		g, seats, err = join(ctx, gameID, playerKey)
+		return
+	})
+	if myerr != nil {
+		return
+	}
+
+	seat, _ := seats.Find(playerKey)
+	hooks.Do("GameJoin", ctx, g, seats, *seat)
+
+	return
+}
+
+// join seats the player in the lowest open position of the game
+func join(ctx context.Context, gameID string, playerKey *datastore.Key) (g model.Game, seats model.SeatList, myerr error) {
+	if g, seats, myerr = GetGame(ctx, gameID); myerr != nil {
+		return
+	}
+
+	if g.Status != model.GameOpen {
+		myerr = game.NewUserError(nil, http.StatusConflict, "The game is not open")
+		return
+	}
+
+	if _, found := seats.Find(playerKey); found {
+		myerr = game.NewUserError(nil, http.StatusConflict, "You have already joined the game")
+		return
+	}
+
+	if int64(len(seats)) >= g.MaxPlayers {
+		myerr = game.NewUserError(nil, http.StatusConflict, "The game is full")
+		return
+	}
+
+	// take the lowest position that is not in use
+	position := int64(0)
+	for _, v := range seats {
+		if v.Position != position {
+			break
+		}
+
+		position++
+	}
+
+	seat := model.Seat{
+		GameKey:   g.GetKey(),
+		PlayerKey: playerKey,
+		Position:  position,
+	}
+	if myerr = store.Save(ctx, &seat); myerr != nil {
+		return
+	}
+
+	// queries in a transaction do not see its own changes, so the seat is added by position
+	seats = append(seats, model.Seat{})
+	copy(seats[position+1:], seats[position:])
+	seats[position] = seat
+
+	return
+}
+
+// LeaveGame removes the player from a game that has not started yet
+// If the creator leaves, the next player becomes the creator,
+// and if the last player leaves, the game is abandoned
+func LeaveGame(ctx context.Context, gameID, playerID string) (g model.Game, seats model.SeatList, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	// the seats are read and changed in a transaction, so the game cannot start while the player leaves
+	var ev events
+	myerr = store.RunInTransaction(ctx, func(ctx context.Context) (err error) {
+		ev = nil
+		g, seats, err = leave(ctx, gameID, playerKey, &ev)
+		return
+	})
+	if myerr != nil {
+		return
+	}
+
+	ev.do(ctx)
+
+	return
+}
+
+// leave removes the player's seat from the game, queueing the hooks to run in ev
+func leave(ctx context.Context, gameID string, playerKey *datastore.Key, ev *events) (g model.Game, seats model.SeatList, myerr error) {
+	if g, seats, myerr = GetGame(ctx, gameID); myerr != nil {
+		return
+	}
+
+	if g.Status != model.GameOpen {
+		myerr = game.NewUserError(nil, http.StatusConflict, "Only open games can be left, forfeit the game instead")
+		return
+	}
+
+	seat, found := seats.Find(playerKey)
+	if !found {
+		myerr = game.NewUserError(nil, http.StatusConflict, "You have not joined the game")
+		return
+	}
+
+	if myerr = store.Delete(ctx, seat); myerr != nil {
+		return
+	}
+
+	// queries in a transaction do not see its own changes, so the seat is taken out of the list
+	left := *seat
+	rest := make(model.SeatList, 0, len(seats)-1)
+	for _, v := range seats {
+		if !v.PlayerKey.Equal(playerKey) {
+			rest = append(rest, v)
+		}
+	}
+	seats = rest
+
+	if len(seats) == 0 {
+		g.Status = model.GameAbandoned
+		g.Finished = game.Now(ctx)
+	} else if g.CreatorKey.Equal(playerKey) {
+		g.CreatorKey = seats[0].PlayerKey
+	}
+
+	if myerr = store.Save(ctx, &g); myerr != nil {
+		return
+	}
+
+	ev.add("GameLeave", g, seats, left)
+
+	if g.Status == model.GameAbandoned {
+		ev.add("GameFinish", g, seats)
+	}
+
+	return
+}
+
+// StartGame starts the game once enough players have joined
+// Only the creator of the game can start it
+func StartGame(ctx context.Context, gameID, playerID string) (g model.Game, seats model.SeatList, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	// the game is read and changed in a transaction, so no player can join or leave while it starts
+	var ev events
+	myerr = store.RunInTransaction(ctx, func(ctx context.Context) (err error) {
+		ev = nil
+		g, seats, err = start(ctx, gameID, playerKey, &ev)
+		return
+	})
+	if myerr != nil {
+		return
+	}
+
+	ev.do(ctx)
+
+	return
+}
+
+// start sets up the game's rules and starts it, queueing the hooks to run in ev
+func start(ctx context.Context, gameID string, playerKey *datastore.Key, ev *events) (g model.Game, seats model.SeatList, myerr error) {
+	if g, seats, myerr = GetGame(ctx, gameID); myerr != nil {
+		return
+	}
+
+	if !g.CreatorKey.Equal(playerKey) {
+		myerr = game.NewUserError(nil, http.StatusForbidden, "Only the creator can start the game")
+		return
+	}
+
+	if g.Status != model.GameOpen {
+		myerr = game.NewUserError(nil, http.StatusConflict, "The game is not open")
+		return
+	}
+
+	if int64(len(seats)) < g.MinPlayers {
+		myerr = game.NewUserError(nil, http.StatusConflict, "The game needs at least %d players to start", g.MinPlayers)
+		return
+	}
+
+	// games without registered rules are played outside of the move endpoint
+	if rules, ok := game.GetRules(g.Type); ok {
+		var state []byte
+		if state, myerr = rules.Setup(len(seats)); myerr != nil {
+			return
+		}
+
+		g.Setup = string(state)
+		g.State = g.Setup
+	}
+
+	g.Status = model.GameInProgress
+	g.Started = game.Now(ctx)
+	g.ResetDeadline(g.Started)
+	if myerr = store.Save(ctx, &g); myerr != nil {
+		return
+	}
+
+	ev.add("GameStart", g, seats)
+
+	return
+}
+
+// ForfeitGame forfeits the game for the player
+// If only one player is left playing, they win the game
+func ForfeitGame(ctx context.Context, gameID, playerID string) (g model.Game, seats model.SeatList, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	var ev events
+	myerr = store.RunInTransaction(ctx, func(ctx context.Context) (err error) {
+		ev = nil
+		g, seats, err = forfeitGame(ctx, gameID, playerKey, &ev)
+		return
+	})
+	if myerr != nil {
+		return
+	}
+
+	ev.do(ctx)
+
+	return
+}
+
+// forfeitGame forfeits the game for the player, queueing the hooks to run in ev
+func forfeitGame(ctx context.Context, gameID string, playerKey *datastore.Key, ev *events) (g model.Game, seats model.SeatList, myerr error) {
+	if g, seats, myerr = GetGame(ctx, gameID); myerr != nil {
+		return
+	}
+
+	if g.Status != model.GameInProgress {
+		myerr = game.NewUserError(nil, http.StatusConflict, "The game is not in progress")
+		return
+	}
+
+	seat, found := seats.Find(playerKey)
+	if !found || seat.Result != model.SeatPlaying {
+		myerr = game.NewUserError(nil, http.StatusConflict, "You are not playing the game")
+		return
+	}
+
+	myerr = forfeit(ctx, &g, seats, seat, ev)
+
+	return
+}
+
+// MakeMove validates the move with the rules for the game type, stores it,
+// and updates the game state, finishing the game if the move ended it
+func MakeMove(ctx context.Context, gameID, playerID, data string) (g model.Game, seats model.SeatList, move model.Move, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	// the game is read and changed in a transaction, so two moves cannot be made from the same state
+	var ev events
+	myerr = store.RunInTransaction(ctx, func(ctx context.Context) (err error) {
+		ev = nil
+		g, seats, move, err = makeMove(ctx, gameID, playerKey, data, &ev)
+		return
+	})
+	if myerr != nil {
+		return
+	}
+
+	ev.do(ctx)
+
+	return
+}
+
+// makeMove makes the player's move in the game, queueing the hooks to run in ev
+func makeMove(ctx context.Context, gameID string, playerKey *datastore.Key, data string, ev *events) (g model.Game, seats model.SeatList, move model.Move, myerr error) {
+	if g, seats, myerr = GetGame(ctx, gameID); myerr != nil {
+		return
+	}
+
+	if g.Status != model.GameInProgress {
+		myerr = game.NewUserError(nil, http.StatusConflict, "The game is not in progress")
+		return
+	}
+
+	rules, ok := game.GetRules(g.Type)
+	if !ok {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Moves cannot be made in %s games", g.Type)
+		return
+	}
+
+	seat, found := seats.Find(playerKey)
+	if !found || seat.Result != model.SeatPlaying {
+		myerr = game.NewUserError(nil, http.StatusConflict, "You are not playing the game")
+		return
+	}
+
+	turn, myerr := rules.Turn([]byte(g.State))
+	if myerr != nil {
+		return
+	}
+
+	if !hasPosition(turn, int(seat.Position)) {
+		myerr = game.NewUserError(nil, http.StatusConflict, "It is not your turn")
+		return
+	}
+
+	move, myerr = play(ctx, rules, &g, seats, seat, data, false, ev)
+
+	return
+}
+
+// play validates the move for the player in the seat, stores it, and updates the game state,
+// finishing the game if the move ended it
+// The hooks for the changes are queued in ev, to be run once they are committed
+func play(ctx context.Context, rules game.Rules, g *model.Game, seats model.SeatList, seat *model.Seat, data string, timedOut bool, ev *events) (move model.Move, myerr error) {
+	state := []byte(g.State)
+	position := int(seat.Position)
+
+	if myerr = rules.Validate(state, position, []byte(data)); myerr != nil {
+		if _, ok := myerr.(game.Error); !ok {
+			myerr = game.NewUserError(myerr, http.StatusBadRequest, "Invalid move: %v", myerr)
+		}
+
+		return
+	}
+
+	newState, myerr := rules.Apply(state, position, []byte(data))
+	if myerr != nil {
+		return
+	}
+
+	m := model.Move{
+		GameKey:   g.GetKey(),
+		PlayerKey: seat.PlayerKey,
+		Position:  seat.Position,
+		Number:    g.MoveCount + 1,
+		Data:      data,
+		State:     string(newState),
+		TimedOut:  timedOut,
+	}
+	if myerr = store.Save(ctx, &m); myerr != nil {
+		return
+	}
+
+	// making a move turns down any undo request
+	g.ClearUndo()
+	g.MoveCount = m.Number
+	g.State = m.State
+	g.ResetDeadline(game.Now(ctx))
+	if myerr = store.Save(ctx, g); myerr != nil {
+		return
+	}
+
+	move = m
+
+	ev.add("GameMove", *g, seats, move)
+
+	over, winners, myerr := rules.Over(newState)
+	if myerr != nil || !over {
+		return
+	}
+
+	positions := make([]int64, len(winners))
+	for k := range winners {
+		positions[k] = int64(winners[k])
+	}
+
+	myerr = finish(ctx, g, seats, model.GameFinished, positions, ev)
+
+	return
+}
+
+// forfeit forfeits the game for the player in the seat,
+// finishing the game if there is at most one player left
+// The hooks for the changes are queued in ev, to be run once they are committed
+func forfeit(ctx context.Context, g *model.Game, seats model.SeatList, seat *model.Seat, ev *events) (myerr error) {
+	seat.Result = model.SeatForfeit
+	if myerr = store.Save(ctx, seat); myerr != nil {
+		return
+	}
+
+	ev.add("GameForfeit", *g, seats)
+
+	playing := seats.Playing()
+	switch len(playing) {
+	case 0:
+		myerr = finish(ctx, g, seats, model.GameAbandoned, nil, ev)
+	case 1:
+		myerr = finish(ctx, g, seats, model.GameFinished, []int64{playing[0].Position}, ev)
+	}
+
+	return
+}
+
+func hasPosition(positions []int, position int) bool {
+	for _, v := range positions {
+		if v == position {
+			return true
+		}
+	}
+
+	return false
+}
+
+// finish ends the game with the given status, marking the seats in the winning positions as won
+// and everybody else still playing as lost, or everybody still playing as a draw if there are no winners
+// The GameFinish hook is queued in ev, to be run once the changes are committed
+func finish(ctx context.Context, g *model.Game, seats model.SeatList, status string, winners []int64, ev *events) (myerr error) {
+	for k := range seats {
+		if seats[k].Result != model.SeatPlaying {
+			continue
+		}
+
+		switch {
+		case len(winners) == 0:
+			seats[k].Result = model.SeatDraw
+		case hasWinner(winners, seats[k].Position):
+			seats[k].Result = model.SeatWon
+		default:
+			seats[k].Result = model.SeatLost
+		}
+
+		if myerr = store.Save(ctx, &seats[k]); myerr != nil {
+			return
+		}
+	}
+
+	g.Status = status
+	g.Finished = game.Now(ctx)
+	g.ResetDeadline(g.Finished)
+	if myerr = store.Save(ctx, g); myerr != nil {
+		return
+	}
+
+	ev.add("GameFinish", *g, seats)
+
+	return
+}
+
+func hasWinner(winners []int64, position int64) bool {
+	for _, v := range winners {
+		if v == position {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,500 @@
+package games
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/benjamw/gogame/game"
+	gttp "github.com/benjamw/gogame/http"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/session"
+)
+
+func init() {
+	gttp.R.Path("/game").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleCreate})
+
+	gttp.R.Path("/game").
+		Methods("GET").
+		Handler(&gttp.PlayerJSONHandler{handleList})
+
+	gttp.R.Path("/game/{id:[0-9]+}").
+		Methods("GET").
+		Handler(&gttp.PlayerJSONHandler{handleRead})
+
+	gttp.R.Path("/game/{id:[0-9]+}/join").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleJoin})
+
+	gttp.R.Path("/game/{id:[0-9]+}/leave").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleLeave})
+
+	gttp.R.Path("/game/{id:[0-9]+}/start").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleStart})
+
+	gttp.R.Path("/game/{id:[0-9]+}/timer").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleTimer})
+
+	gttp.R.Path("/game/{id:[0-9]+}/forfeit").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleForfeit})
+
+	gttp.R.Path("/game/{id:[0-9]+}/move").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleMove})
+
+	gttp.R.Path("/game/{id:[0-9]+}/moves").
+		Methods("GET").
+		Handler(&gttp.PlayerJSONHandler{handleMoves})
+
+	gttp.R.Path("/game/{id:[0-9]+}/moves/{number:[0-9]+}").
+		Methods("GET").
+		Handler(&gttp.PlayerJSONHandler{handleStateAt})
+
+	gttp.R.Path("/game/{id:[0-9]+}/undo").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleUndo})
+
+	gttp.R.Path("/game/{id:[0-9]+}/undo/accept").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleUndoAccept})
+
+	gttp.R.Path("/game/{id:[0-9]+}/undo/decline").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleUndoDecline})
+
+	// run by cron on App Engine, see app/cron.yaml
+	gttp.R.Path("/tasks/sweep").
+		Methods("GET").
+		Handler(&gttp.JSONHandler{handleSweep})
+}
+
+type SeatReply struct {
+	PlayerID string    `json:"player_id"`
+	Position int64     `json:"position"`
+	Result   string    `json:"result"`
+	Joined   time.Time `json:"joined"`
+}
+
+func (r *SeatReply) Set(m model.Seat) {
+	r.PlayerID = m.PlayerKey.Encode()
+	r.Position = m.Position
+	r.Result = m.Result
+	r.Joined = m.Joined
+}
+
+type Reply struct {
+	gttp.Response
+	GameID     string      `json:"game_id"`
+	ID         int64       `json:"id"`
+	Type       string      `json:"type"`
+	Name       string      `json:"name"`
+	Status     string      `json:"status"`
+	CreatorID  string      `json:"creator_id"`
+	MinPlayers int64       `json:"min_players"`
+	MaxPlayers int64       `json:"max_players"`
+	Seats      []SeatReply `json:"seats,omitempty"`
+	State      string      `json:"state,omitempty"`
+	MoveCount  int64       `json:"move_count"`
+	UndoNumber int64       `json:"undo_number,omitempty"` // the move a player has asked to take back
+	UndoID     string      `json:"undo_id,omitempty"`     // the player asking to take back the move
+	Turn       []int       `json:"turn,omitempty"`        // the seat positions that can move next
+	TimerMode  string      `json:"timer_mode,omitempty"`
+	TurnLimit  int64       `json:"turn_limit,omitempty"` // in days for correspondence games or seconds for real-time games
+	Timeout    string      `json:"timeout,omitempty"`
+	Deadline   time.Time   `json:"deadline"` // when the current turn runs out of time, zero if it can't
+	Created    time.Time   `json:"created"`
+	Started    time.Time   `json:"started"`
+	Finished   time.Time   `json:"finished"`
+}
+
+func (r *Reply) Set(m model.Game) {
+	r.GameID = m.GetKey().Encode()
+	r.ID = m.ID
+	r.Type = m.Type
+	r.Name = m.Name
+	r.Status = m.Status
+	r.CreatorID = m.CreatorKey.Encode()
+	r.MinPlayers = m.MinPlayers
+	r.MaxPlayers = m.MaxPlayers
+	r.State = m.State
+	r.MoveCount = m.MoveCount
+	r.UndoNumber = m.UndoNumber
+	if m.UndoKey != nil {
+		r.UndoID = m.UndoKey.Encode()
+	}
+	r.TimerMode = m.TimerMode
+	r.TurnLimit = m.TurnLimit
+	r.Timeout = m.Timeout
+	r.Deadline = m.Deadline
+	r.Created = m.Created
+	r.Started = m.Started
+	r.Finished = m.Finished
+}
+
+// SetTurn sets whose turn it is from the rules for the game type
+func (r *Reply) SetTurn(m model.Game) {
+	if m.Status != model.GameInProgress {
+		return
+	}
+
+	if rules, ok := game.GetRules(m.Type); ok {
+		r.Turn, _ = rules.Turn([]byte(m.State))
+	}
+}
+
+func (r *Reply) SetSeats(l model.SeatList) {
+	r.Seats = make([]SeatReply, len(l))
+
+	for k, v := range l {
+		r.Seats[k].Set(v)
+	}
+}
+
+type MoveReply struct {
+	Number   int64     `json:"number"`
+	PlayerID string    `json:"player_id"`
+	Position int64     `json:"position"`
+	Data     string    `json:"data"`
+	State    string    `json:"state,omitempty"`
+	Undone   bool      `json:"undone"`
+	TimedOut bool      `json:"timed_out"`
+	Created  time.Time `json:"created"`
+}
+
+func (r *MoveReply) Set(m model.Move) {
+	r.Number = m.Number
+	r.PlayerID = m.PlayerKey.Encode()
+	r.Position = m.Position
+	r.Data = m.Data
+	r.State = m.State
+	r.Undone = m.Undone
+	r.TimedOut = m.TimedOut
+	r.Created = m.Created
+}
+
+type MadeMoveReply struct {
+	Reply
+	Move MoveReply `json:"move"`
+}
+
+type MovesReply struct {
+	Reply
+	Moves []MoveReply `json:"moves"`
+}
+
+func (r *MovesReply) SetMoves(l model.MoveList) {
+	r.Moves = make([]MoveReply, len(l))
+
+	for k, v := range l {
+		r.Moves[k].Set(v)
+	}
+}
+
+type StateReply struct {
+	gttp.Response
+	GameID string `json:"game_id"`
+	Number int64  `json:"number"`
+	State  string `json:"state"`
+}
+
+type SweepReply struct {
+	gttp.Response
+	Games int `json:"games"` // the number of timed out games that were handled
+}
+
+type ListReply struct {
+	gttp.Response
+	Games []Reply `json:"games"`
+}
+
+func (r *ListReply) Set(l model.GameList) {
+	r.Games = make([]Reply, len(l))
+
+	for k, v := range l {
+		r.Games[k].Set(v)
+	}
+}
+
+func gameReply(g model.Game, seats model.SeatList) Reply {
+	reply := Reply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(g)
+	reply.SetSeats(seats)
+	reply.SetTurn(g)
+
+	return reply
+}
+
+// formInt reads an integer form value, returning def if it was not given
+func formInt(r *http.Request, key string, def int64) (int64, error) {
+	value := r.FormValue(key)
+	if value == "" {
+		return def, nil
+	}
+
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func handleCreate(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	gameType := r.FormValue("type")
+	if gameType == "" {
+		errReply = &gttp.MissingRequiredError{FormElement: "type"}
+		return
+	}
+
+	minPlayers, errReply := formInt(r, "min_players", 2)
+	if errReply != nil {
+		return
+	}
+
+	maxPlayers, errReply := formInt(r, "max_players", minPlayers)
+	if errReply != nil {
+		return
+	}
+
+	g, seats, errReply := CreateGame(ctx, s.PlayerID, gameType, r.FormValue("name"), minPlayers, maxPlayers)
+	if errReply != nil {
+		return
+	}
+
+	if mode := r.FormValue("timer_mode"); mode != "" {
+		var limit int64
+		if limit, errReply = formInt(r, "turn_limit", 0); errReply != nil {
+			return
+		}
+
+		gameID := strconv.FormatInt(g.ID, 10)
+		if g, seats, errReply = SetTimer(ctx, gameID, s.PlayerID, mode, limit, r.FormValue("timeout")); errReply != nil {
+			return
+		}
+	}
+
+	replyRaw = gameReply(g, seats)
+
+	return
+}
+
+func handleList(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	status := r.FormValue("status")
+
+	var gl model.GameList
+	if r.FormValue("mine") != "" {
+		gl, errReply = ListPlayerGames(ctx, s.PlayerID, status)
+	} else {
+		gl, errReply = ListGames(ctx, status, r.FormValue("type"))
+	}
+	if errReply != nil {
+		return
+	}
+
+	reply := ListReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(gl)
+
+	replyRaw = reply
+
+	return
+}
+
+func handleRead(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	g, seats, errReply := GetGame(ctx, gttp.GetURLValue(r, "id"))
+	if errReply != nil {
+		return
+	}
+
+	replyRaw = gameReply(g, seats)
+
+	return
+}
+
+func handleJoin(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	g, seats, errReply := JoinGame(ctx, gttp.GetURLValue(r, "id"), s.PlayerID)
+	if errReply != nil {
+		return
+	}
+
+	replyRaw = gameReply(g, seats)
+
+	return
+}
+
+func handleLeave(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	g, seats, errReply := LeaveGame(ctx, gttp.GetURLValue(r, "id"), s.PlayerID)
+	if errReply != nil {
+		return
+	}
+
+	replyRaw = gameReply(g, seats)
+
+	return
+}
+
+func handleStart(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	g, seats, errReply := StartGame(ctx, gttp.GetURLValue(r, "id"), s.PlayerID)
+	if errReply != nil {
+		return
+	}
+
+	replyRaw = gameReply(g, seats)
+
+	return
+}
+
+func handleTimer(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	limit, errReply := formInt(r, "turn_limit", 0)
+	if errReply != nil {
+		return
+	}
+
+	g, seats, errReply := SetTimer(ctx, gttp.GetURLValue(r, "id"), s.PlayerID, r.FormValue("timer_mode"), limit, r.FormValue("timeout"))
+	if errReply != nil {
+		return
+	}
+
+	replyRaw = gameReply(g, seats)
+
+	return
+}
+
+func handleForfeit(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	g, seats, errReply := ForfeitGame(ctx, gttp.GetURLValue(r, "id"), s.PlayerID)
+	if errReply != nil {
+		return
+	}
+
+	replyRaw = gameReply(g, seats)
+
+	return
+}
+
+func handleMove(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	data := r.FormValue("move")
+	if data == "" {
+		errReply = &gttp.MissingRequiredError{FormElement: "move"}
+		return
+	}
+
+	g, seats, move, errReply := MakeMove(ctx, gttp.GetURLValue(r, "id"), s.PlayerID, data)
+	if errReply != nil {
+		return
+	}
+
+	reply := MadeMoveReply{
+		Reply: gameReply(g, seats),
+	}
+	reply.Move.Set(move)
+
+	replyRaw = reply
+
+	return
+}
+
+func handleMoves(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	g, moves, errReply := GetMoves(ctx, gttp.GetURLValue(r, "id"))
+	if errReply != nil {
+		return
+	}
+
+	reply := MovesReply{
+		Reply: gameReply(g, nil),
+	}
+	reply.SetMoves(moves)
+
+	replyRaw = reply
+
+	return
+}
+
+func handleStateAt(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	number, errReply := strconv.ParseInt(gttp.GetURLValue(r, "number"), 10, 64)
+	if errReply != nil {
+		return
+	}
+
+	g, state, errReply := GetStateAt(ctx, gttp.GetURLValue(r, "id"), number)
+	if errReply != nil {
+		return
+	}
+
+	reply := StateReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+		GameID: g.GetKey().Encode(),
+		Number: number,
+		State:  state,
+	}
+
+	replyRaw = reply
+
+	return
+}
+
+func handleUndo(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	g, seats, errReply := RequestUndo(ctx, gttp.GetURLValue(r, "id"), s.PlayerID)
+	if errReply != nil {
+		return
+	}
+
+	replyRaw = gameReply(g, seats)
+
+	return
+}
+
+func handleUndoAccept(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	g, seats, errReply := AnswerUndo(ctx, gttp.GetURLValue(r, "id"), s.PlayerID, true)
+	if errReply != nil {
+		return
+	}
+
+	replyRaw = gameReply(g, seats)
+
+	return
+}
+
+func handleUndoDecline(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	g, seats, errReply := AnswerUndo(ctx, gttp.GetURLValue(r, "id"), s.PlayerID, false)
+	if errReply != nil {
+		return
+	}
+
+	replyRaw = gameReply(g, seats)
+
+	return
+}
+
+func handleSweep(ctx context.Context, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	// App Engine strips these headers from outside requests,
+	// and the standalone server sweeps on its own
+	if !game.AppEngine || (r.Header.Get("X-Appengine-Cron") == "" && r.Header.Get("X-AppEngine-QueueName") == "") {
+		errReply = game.NewUserError(nil, http.StatusForbidden, "The sweep can only be run by cron or the task queue")
+		return
+	}
+
+	num, errReply := Sweep(ctx)
+	if errReply != nil {
+		return
+	}
+
+	replyRaw = SweepReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+		Games: num,
+	}
+
+	return
+}
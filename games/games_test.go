@@ -0,0 +1,664 @@
+package games
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"github.com/benjamw/golibs/random"
+	"github.com/benjamw/golibs/test"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/games/tictactoe"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store/storetest"
+)
+
+// MODEL TESTS
+
+func TestGameEntityType(t *testing.T) {
+	var m model.Game
+	if "Game" != m.EntityType() {
+		t.Fatalf("Game.EntityType() returned '%s', wanted 'Game'", m.EntityType())
+	}
+}
+
+func TestGamePreSave(t *testing.T) {
+	ctx := storetest.NewContext()
+	var err error
+	var g model.Game
+
+	// test with no type
+	err = g.PreSave(ctx)
+	if e, ok := err.(*db.MissingRequiredError); !ok || e.Property != "Type" {
+		t.Fatalf("Game.PreSave threw the wrong error for a missing Type. Error: %v", err)
+	}
+
+	// test with no creator
+	g.Type = "test"
+	err = g.PreSave(ctx)
+	if e, ok := err.(*db.MissingRequiredError); !ok || e.Property != "CreatorKey" {
+		t.Fatalf("Game.PreSave threw the wrong error for a missing CreatorKey. Error: %v", err)
+	}
+
+	player := storetest.SavePlayer(ctx, t)
+
+	// test proper
+	g.CreatorKey = player.GetKey()
+	if err = g.PreSave(ctx); err != nil {
+		t.Fatalf("Game.PreSave threw an error: %v", err)
+	}
+	if g.GetKey() == nil {
+		t.Fatal("Game.PreSave did not create a datastore key.")
+	}
+	if g.Status != model.GameOpen {
+		t.Fatalf("Game.PreSave did not default the status. Wanted: %s; Got: %s", model.GameOpen, g.Status)
+	}
+}
+
+func TestSeatPreSave(t *testing.T) {
+	ctx := storetest.NewContext()
+	var err error
+	var s model.Seat
+
+	// test with no game
+	if _, ok := s.PreSave(ctx).(*db.MissingParentKeyError); !ok {
+		t.Fatal("Seat.PreSave did not throw an error for a missing Parent Game Key.")
+	}
+
+	g, _ := createGame(ctx, t, 2, 2)
+
+	// test with no player
+	s.GameKey = g.GetKey()
+	err = s.PreSave(ctx)
+	if e, ok := err.(*db.MissingRequiredError); !ok || e.Property != "PlayerKey" {
+		t.Fatalf("Seat.PreSave threw the wrong error for a missing PlayerKey. Error: %v", err)
+	}
+}
+
+// CONTROLLER TESTS
+
+func TestCreateGame(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	player := storetest.SavePlayer(ctx, t)
+
+	if _, _, err := CreateGame(ctx, player.GetKey().Encode(), "test", "", 3, 2); err == nil {
+		t.Fatal("CreateGame did not throw an error for an invalid player count.")
+	}
+
+	g, seats, err := CreateGame(ctx, player.GetKey().Encode(), "test", "Test Game", 2, 4)
+	if err != nil {
+		t.Fatalf("CreateGame threw an error: %v", err)
+	}
+
+	if g.ID == 0 || g.Status != model.GameOpen || g.Created.IsZero() {
+		t.Fatalf("CreateGame did not set up the game. Got: %+v", g)
+	}
+
+	if len(seats) != 1 || !seats[0].PlayerKey.Equal(player.GetKey()) {
+		t.Fatalf("CreateGame did not seat the creator. Got: %+v", seats)
+	}
+
+	var room model.Room
+	if err = room.ByID(ctx, g.ID); err != nil {
+		t.Fatalf("CreateGame did not create the game room. Error: %v", err)
+	}
+	if room.Name != g.Name {
+		t.Fatalf("CreateGame created the room with the wrong name. Wanted: %s; Got: %s", g.Name, room.Name)
+	}
+
+	var open model.GameList
+	if open, err = ListGames(ctx, "", "test"); err != nil {
+		t.Fatalf("ListGames threw an error: %v", err)
+	}
+	if !containsGame(open, g) {
+		t.Fatal("ListGames did not list the new game as open.")
+	}
+
+	var mine model.GameList
+	if mine, err = ListPlayerGames(ctx, player.GetKey().Encode(), model.GameOpen); err != nil {
+		t.Fatalf("ListPlayerGames threw an error: %v", err)
+	}
+	if !containsGame(mine, g) {
+		t.Fatal("ListPlayerGames did not list the new game.")
+	}
+}
+
+func TestJoinLeaveGame(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	g, creator := createGame(ctx, t, 2, 2)
+	gameID := strconv.FormatInt(g.ID, 10)
+	second := storetest.SavePlayer(ctx, t)
+	third := storetest.SavePlayer(ctx, t)
+
+	_, seats, err := JoinGame(ctx, gameID, second.GetKey().Encode())
+	if err != nil {
+		t.Fatalf("JoinGame threw an error: %v", err)
+	}
+	if len(seats) != 2 || seats[1].Position != 1 {
+		t.Fatalf("JoinGame did not seat the player in the next position. Got: %+v", seats)
+	}
+
+	if _, _, err = JoinGame(ctx, gameID, second.GetKey().Encode()); err == nil {
+		t.Fatal("JoinGame did not throw an error when joining twice.")
+	}
+
+	if _, _, err = JoinGame(ctx, gameID, third.GetKey().Encode()); err == nil {
+		t.Fatal("JoinGame did not throw an error when the game is full.")
+	}
+
+	// the creator leaving hands the game to the next player
+	g, seats, err = LeaveGame(ctx, gameID, creator.GetKey().Encode())
+	if err != nil {
+		t.Fatalf("LeaveGame threw an error: %v", err)
+	}
+	if len(seats) != 1 || !g.CreatorKey.Equal(second.GetKey()) {
+		t.Fatalf("LeaveGame did not pass the game to the next player. Got: %+v", g)
+	}
+
+	// the open seat is reused
+	if _, seats, err = JoinGame(ctx, gameID, third.GetKey().Encode()); err != nil {
+		t.Fatalf("JoinGame threw an error: %v", err)
+	}
+	if seats[0].Position != 0 || !seats[0].PlayerKey.Equal(third.GetKey()) {
+		t.Fatalf("JoinGame did not reuse the open seat. Got: %+v", seats)
+	}
+
+	if _, _, err = LeaveGame(ctx, gameID, third.GetKey().Encode()); err != nil {
+		t.Fatalf("LeaveGame threw an error: %v", err)
+	}
+
+	// the last player leaving abandons the game
+	if g, _, err = LeaveGame(ctx, gameID, second.GetKey().Encode()); err != nil {
+		t.Fatalf("LeaveGame threw an error: %v", err)
+	}
+	if g.Status != model.GameAbandoned || g.Finished.IsZero() {
+		t.Fatalf("LeaveGame did not abandon the empty game. Got: %+v", g)
+	}
+}
+
+func TestJoinGameRace(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	g, _ := createGame(ctx, t, 2, 2)
+	gameID := strconv.FormatInt(g.ID, 10)
+
+	players := make([]model.Player, 5)
+	for k := range players {
+		players[k] = storetest.SavePlayer(ctx, t)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(players))
+	for _, v := range players {
+		wg.Add(1)
+		go func(playerID string) {
+			defer wg.Done()
+			_, _, err := JoinGame(ctx, gameID, playerID)
+			errs <- err
+		}(v.GetKey().Encode())
+	}
+	wg.Wait()
+	close(errs)
+
+	joined := 0
+	for err := range errs {
+		if err == nil {
+			joined++
+		}
+	}
+
+	_, seats, err := GetGame(ctx, gameID)
+	if err != nil {
+		t.Fatalf("GetGame threw an error: %v", err)
+	}
+	if joined != 1 || len(seats) != 2 {
+		t.Fatalf("JoinGame let too many players into the game. Joined: %d; Seats: %d", joined, len(seats))
+	}
+}
+
+func TestStartForfeitGame(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	g, creator := createGame(ctx, t, 2, 3)
+	gameID := strconv.FormatInt(g.ID, 10)
+	second := storetest.SavePlayer(ctx, t)
+	third := storetest.SavePlayer(ctx, t)
+
+	if _, _, err := StartGame(ctx, gameID, creator.GetKey().Encode()); err == nil {
+		t.Fatal("StartGame did not throw an error without enough players.")
+	}
+
+	for _, p := range []model.Player{second, third} {
+		if _, _, err := JoinGame(ctx, gameID, p.GetKey().Encode()); err != nil {
+			t.Fatalf("JoinGame threw an error: %v", err)
+		}
+	}
+
+	_, _, err := StartGame(ctx, gameID, second.GetKey().Encode())
+	if e, ok := err.(game.Error); !ok || e.Code() != 403 {
+		t.Fatalf("StartGame threw the wrong error when started by somebody other than the creator. Error: %v", err)
+	}
+
+	if g, _, err = StartGame(ctx, gameID, creator.GetKey().Encode()); err != nil {
+		t.Fatalf("StartGame threw an error: %v", err)
+	}
+	if g.Status != model.GameInProgress || g.Started.IsZero() {
+		t.Fatalf("StartGame did not start the game. Got: %+v", g)
+	}
+
+	if _, _, err = LeaveGame(ctx, gameID, third.GetKey().Encode()); err == nil {
+		t.Fatal("LeaveGame did not throw an error for a started game.")
+	}
+
+	if g, _, err = ForfeitGame(ctx, gameID, creator.GetKey().Encode()); err != nil {
+		t.Fatalf("ForfeitGame threw an error: %v", err)
+	}
+	if g.Status != model.GameInProgress {
+		t.Fatalf("ForfeitGame ended the game with two players left. Got: %s", g.Status)
+	}
+
+	if _, _, err = ForfeitGame(ctx, gameID, creator.GetKey().Encode()); err == nil {
+		t.Fatal("ForfeitGame did not throw an error when forfeiting twice.")
+	}
+
+	var seats model.SeatList
+	if g, seats, err = ForfeitGame(ctx, gameID, second.GetKey().Encode()); err != nil {
+		t.Fatalf("ForfeitGame threw an error: %v", err)
+	}
+	if g.Status != model.GameFinished || g.Finished.IsZero() {
+		t.Fatalf("ForfeitGame did not finish the game. Got: %+v", g)
+	}
+
+	want := []string{model.SeatForfeit, model.SeatForfeit, model.SeatWon}
+	for k := range seats {
+		if seats[k].Result != want[k] {
+			t.Fatalf("ForfeitGame set the wrong result for seat %d. Wanted: %s; Got: %s", k, want[k], seats[k].Result)
+		}
+	}
+}
+
+func TestMakeMove(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	g, seats := createStartedGame(ctx, t, tictactoe.GameType)
+	gameID := strconv.FormatInt(g.ID, 10)
+	x := seats[0].PlayerKey.Encode()
+	o := seats[1].PlayerKey.Encode()
+
+	if g.State == "" {
+		t.Fatal("StartGame did not set up the game state.")
+	}
+
+	_, _, _, err := MakeMove(ctx, gameID, o, `{"square":0}`)
+	if e, ok := err.(game.Error); !ok || e.Code() != 409 {
+		t.Fatalf("MakeMove threw the wrong error for a move out of turn. Error: %v", err)
+	}
+
+	_, _, _, err = MakeMove(ctx, gameID, x, `{"square":10}`)
+	if e, ok := err.(game.Error); !ok || e.Code() != 400 {
+		t.Fatalf("MakeMove threw the wrong error for an invalid move. Error: %v", err)
+	}
+
+	var move model.Move
+	if g, _, move, err = MakeMove(ctx, gameID, x, `{"square":0}`); err != nil {
+		t.Fatalf("MakeMove threw an error: %v", err)
+	}
+	if move.Number != 1 || g.MoveCount != 1 || g.State != move.State {
+		t.Fatalf("MakeMove did not store the move and state. Got: %+v; %+v", g, move)
+	}
+
+	// x wins across the top row
+	moves := []struct {
+		player string
+		square int
+	}{{o, 3}, {x, 1}, {o, 4}, {x, 2}}
+	for _, v := range moves {
+		if g, seats, _, err = MakeMove(ctx, gameID, v.player, `{"square":`+strconv.Itoa(v.square)+`}`); err != nil {
+			t.Fatalf("MakeMove threw an error for square %d: %v", v.square, err)
+		}
+	}
+
+	if g.Status != model.GameFinished || g.MoveCount != 5 {
+		t.Fatalf("MakeMove did not finish the game. Got: %+v", g)
+	}
+	if seats[0].Result != model.SeatWon || seats[1].Result != model.SeatLost {
+		t.Fatalf("MakeMove set the wrong results. Got: %s, %s", seats[0].Result, seats[1].Result)
+	}
+
+	var moveList model.MoveList
+	if err = moveList.ByGame(ctx, g.GetKey()); err != nil {
+		t.Fatalf("MoveList.ByGame threw an error: %v", err)
+	}
+	if len(moveList) != 5 || moveList[4].Number != 5 || moveList[4].State != g.State {
+		t.Fatalf("MakeMove did not persist the moves in order. Got: %d moves", len(moveList))
+	}
+
+	if _, _, _, err = MakeMove(ctx, gameID, o, `{"square":5}`); err == nil {
+		t.Fatal("MakeMove did not throw an error for a finished game.")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	g, seats := createStartedGame(ctx, t, tictactoe.GameType)
+	gameID := strconv.FormatInt(g.ID, 10)
+
+	squares := []int{4, 0, 8}
+	for k, square := range squares {
+		playMove(ctx, t, gameID, seats[k%2], square)
+	}
+
+	g, moves, err := GetMoves(ctx, gameID)
+	if err != nil {
+		t.Fatalf("GetMoves threw an error: %v", err)
+	}
+	if len(moves) != len(squares) {
+		t.Fatalf("GetMoves returned the wrong number of moves. Wanted: %d; Got: %d", len(squares), len(moves))
+	}
+
+	// every stored state can be rebuilt
+	for _, v := range moves {
+		_, state, err := GetStateAt(ctx, gameID, v.Number)
+		if err != nil {
+			t.Fatalf("GetStateAt threw an error for move %d: %v", v.Number, err)
+		}
+		if state != v.State {
+			t.Fatalf("GetStateAt did not rebuild the state for move %d. Wanted: %s; Got: %s", v.Number, v.State, state)
+		}
+	}
+
+	_, state, err := GetStateAt(ctx, gameID, 0)
+	if err != nil {
+		t.Fatalf("GetStateAt threw an error for the starting state: %v", err)
+	}
+	if state != g.Setup {
+		t.Fatalf("GetStateAt did not return the starting state. Wanted: %s; Got: %s", g.Setup, state)
+	}
+
+	if _, _, err = GetStateAt(ctx, gameID, 4); err == nil {
+		t.Fatal("GetStateAt did not throw an error for a move that was not made.")
+	}
+}
+
+func TestUndo(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	g, seats := createStartedGame(ctx, t, tictactoe.GameType)
+	gameID := strconv.FormatInt(g.ID, 10)
+	x := seats[0].PlayerKey.Encode()
+	o := seats[1].PlayerKey.Encode()
+
+	playMove(ctx, t, gameID, seats[0], 4)
+	before := playMove(ctx, t, gameID, seats[1], 0)
+	playMove(ctx, t, gameID, seats[0], 8)
+
+	if _, _, err := RequestUndo(ctx, gameID, o); err == nil {
+		t.Fatal("RequestUndo did not throw an error when asking to undo the opponent's move.")
+	}
+
+	g, _, err := RequestUndo(ctx, gameID, x)
+	if err != nil {
+		t.Fatalf("RequestUndo threw an error: %v", err)
+	}
+	if g.UndoNumber != 3 {
+		t.Fatalf("RequestUndo did not store the request. Got: %d", g.UndoNumber)
+	}
+
+	if _, _, err = AnswerUndo(ctx, gameID, x, true); err == nil {
+		t.Fatal("AnswerUndo let the player accept their own undo request.")
+	}
+
+	// declining clears the request
+	if g, _, err = AnswerUndo(ctx, gameID, o, false); err != nil {
+		t.Fatalf("AnswerUndo threw an error when declining: %v", err)
+	}
+	if g.UndoNumber != 0 {
+		t.Fatal("AnswerUndo did not clear the declined request.")
+	}
+
+	if _, _, err = RequestUndo(ctx, gameID, x); err != nil {
+		t.Fatalf("RequestUndo threw an error: %v", err)
+	}
+
+	if g, _, err = AnswerUndo(ctx, gameID, o, true); err != nil {
+		t.Fatalf("AnswerUndo threw an error when accepting: %v", err)
+	}
+	if g.State != before.State || g.UndoNumber != 0 {
+		t.Fatalf("AnswerUndo did not take back the move. Wanted: %s; Got: %s", before.State, g.State)
+	}
+
+	// it is x's turn again, and the log keeps the undone move
+	next := playMove(ctx, t, gameID, seats[0], 2)
+	if next.Number != 4 {
+		t.Fatalf("MakeMove reused an undone move number. Got: %d", next.Number)
+	}
+
+	_, moves, err := GetMoves(ctx, gameID)
+	if err != nil {
+		t.Fatalf("GetMoves threw an error: %v", err)
+	}
+	if len(moves) != 4 || !moves[2].Undone {
+		t.Fatalf("GetMoves did not return the undone move in the log. Got: %+v", moves)
+	}
+
+	_, state, err := GetStateAt(ctx, gameID, 4)
+	if err != nil {
+		t.Fatalf("GetStateAt threw an error: %v", err)
+	}
+	if state != next.State {
+		t.Fatalf("GetStateAt did not skip the undone move. Wanted: %s; Got: %s", next.State, state)
+	}
+}
+
+func TestSetTimer(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	creator := storetest.SavePlayer(ctx, t)
+	other := storetest.SavePlayer(ctx, t)
+
+	g, _, err := CreateGame(ctx, creator.GetKey().Encode(), tictactoe.GameType, "", 2, 2)
+	if err != nil {
+		t.Fatalf("CreateGame threw an error: %v", err)
+	}
+	gameID := strconv.FormatInt(g.ID, 10)
+
+	if _, _, err = SetTimer(ctx, gameID, other.GetKey().Encode(), model.TimerRealtime, 30, ""); err == nil {
+		t.Fatal("SetTimer let a player that is not the creator set the timer.")
+	}
+
+	tests := []struct {
+		name    string
+		mode    string
+		limit   int64
+		timeout string
+	}{
+		{"unknown mode", "hourglass", 30, ""},
+		{"zero limit", model.TimerRealtime, 0, ""},
+		{"unknown timeout", model.TimerRealtime, 30, "resign"},
+	}
+
+	for _, v := range tests {
+		if _, _, err = SetTimer(ctx, gameID, creator.GetKey().Encode(), v.mode, v.limit, v.timeout); err == nil {
+			t.Fatalf("SetTimer did not throw an error for a %s.", v.name)
+		}
+	}
+
+	g, _, err = SetTimer(ctx, gameID, creator.GetKey().Encode(), model.TimerCorrespondence, 3, "")
+	if err != nil {
+		t.Fatalf("SetTimer threw an error: %v", err)
+	}
+	if g.Timeout != model.TimeoutForfeit || g.TurnDuration() != 72*time.Hour {
+		t.Fatalf("SetTimer did not set the timer with the default timeout. Got: %s %v", g.Timeout, g.TurnDuration())
+	}
+
+	// games without rules can not be timed
+	g, _ = createGame(ctx, t, 2, 2)
+	if _, _, err = SetTimer(ctx, strconv.FormatInt(g.ID, 10), g.CreatorKey.Encode(), model.TimerRealtime, 30, ""); err == nil {
+		t.Fatal("SetTimer did not throw an error for a game without rules.")
+	}
+}
+
+func TestSweep(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	ctx := game.SetNow(storetest.NewContext(), start)
+
+	randomGame, seats := createTimedGame(ctx, t, model.TimerRealtime, 30, model.TimeoutRandom)
+	skipGame, _ := createTimedGame(ctx, t, model.TimerRealtime, 60, model.TimeoutSkip)
+	correspondence, _ := createTimedGame(ctx, t, model.TimerCorrespondence, 1, model.TimeoutForfeit)
+
+	if !randomGame.Deadline.Equal(start.Add(30 * time.Second)) {
+		t.Fatalf("StartGame did not set the deadline. Got: %v", randomGame.Deadline)
+	}
+
+	// nothing has run out of time yet
+	num, err := Sweep(game.SetNow(ctx, start.Add(10*time.Second)))
+	if err != nil {
+		t.Fatalf("Sweep threw an error: %v", err)
+	}
+	if num != 0 {
+		t.Fatalf("Sweep timed out games early. Got: %d", num)
+	}
+
+	// moving resets the clock
+	playMove(game.SetNow(ctx, start.Add(20*time.Second)), t, strconv.FormatInt(randomGame.ID, 10), seats[0], 4)
+
+	if num, err = Sweep(game.SetNow(ctx, start.Add(40*time.Second))); err != nil || num != 0 {
+		t.Fatalf("Sweep did not honor the reset deadline. Got: %d; Error: %v", num, err)
+	}
+
+	later := game.SetNow(ctx, start.Add(90*time.Second))
+	if num, err = Sweep(later); err != nil || num != 2 {
+		t.Fatalf("Sweep did not time out the realtime games. Got: %d; Error: %v", num, err)
+	}
+
+	// the random policy made a move for o
+	g, moves, err := GetMoves(later, strconv.FormatInt(randomGame.ID, 10))
+	if err != nil {
+		t.Fatalf("GetMoves threw an error: %v", err)
+	}
+	if len(moves) != 2 || !moves[1].TimedOut || moves[1].Position != 1 {
+		t.Fatalf("Sweep did not make a random move. Got: %+v", moves)
+	}
+	if !g.Deadline.Equal(start.Add(120 * time.Second)) {
+		t.Fatalf("Sweep did not reset the deadline after the random move. Got: %v", g.Deadline)
+	}
+
+	// tic-tac-toe does not allow passing, so the skip policy falls back to forfeiting
+	g, gSeats, err := GetGame(later, strconv.FormatInt(skipGame.ID, 10))
+	if err != nil {
+		t.Fatalf("GetGame threw an error: %v", err)
+	}
+	if g.Status != model.GameFinished || gSeats[0].Result != model.SeatForfeit || gSeats[1].Result != model.SeatWon {
+		t.Fatalf("Sweep did not forfeit the game. Got: %s %+v", g.Status, gSeats)
+	}
+	if !g.Deadline.IsZero() {
+		t.Fatalf("Sweep did not clear the deadline of the finished game. Got: %v", g.Deadline)
+	}
+
+	// correspondence games have days to move
+	if g, _, _ = GetGame(later, strconv.FormatInt(correspondence.ID, 10)); g.Status != model.GameInProgress {
+		t.Fatalf("Sweep timed out a correspondence game early. Got: %s", g.Status)
+	}
+
+	if num, err = Sweep(game.SetNow(ctx, start.Add(25*time.Hour))); err != nil || num != 2 {
+		t.Fatalf("Sweep did not time out the correspondence game. Got: %d; Error: %v", num, err)
+	}
+	if g, _, _ = GetGame(ctx, strconv.FormatInt(correspondence.ID, 10)); g.Status != model.GameFinished {
+		t.Fatalf("Sweep did not forfeit the correspondence game. Got: %s", g.Status)
+	}
+}
+
+// HELPER FUNCTIONS
+
+func createGame(ctx context.Context, t *testing.T, minPlayers, maxPlayers int64) (model.Game, model.Player) {
+	file, line, funct := test.GetCaller()
+
+	player := storetest.SavePlayer(ctx, t)
+
+	g, _, err := CreateGame(ctx, player.GetKey().Encode(), "test", random.Stringn(10), minPlayers, maxPlayers)
+	if err != nil {
+		t.Fatalf("Could not create the test Game. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+	}
+
+	return g, player
+}
+
+func createStartedGame(ctx context.Context, t *testing.T, gameType string) (model.Game, model.SeatList) {
+	file, line, funct := test.GetCaller()
+
+	creator := storetest.SavePlayer(ctx, t)
+	opponent := storetest.SavePlayer(ctx, t)
+
+	g, _, err := CreateGame(ctx, creator.GetKey().Encode(), gameType, "", 2, 2)
+	if err != nil {
+		t.Fatalf("Could not create the test Game. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+	}
+
+	gameID := strconv.FormatInt(g.ID, 10)
+	if _, _, err = JoinGame(ctx, gameID, opponent.GetKey().Encode()); err != nil {
+		t.Fatalf("Could not join the test Game. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+	}
+
+	g, seats, err := StartGame(ctx, gameID, creator.GetKey().Encode())
+	if err != nil {
+		t.Fatalf("Could not start the test Game. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+	}
+
+	return g, seats
+}
+
+func createTimedGame(ctx context.Context, t *testing.T, mode string, limit int64, timeout string) (model.Game, model.SeatList) {
+	file, line, funct := test.GetCaller()
+
+	creator := storetest.SavePlayer(ctx, t)
+	opponent := storetest.SavePlayer(ctx, t)
+
+	g, _, err := CreateGame(ctx, creator.GetKey().Encode(), tictactoe.GameType, "", 2, 2)
+	if err != nil {
+		t.Fatalf("Could not create the test Game. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+	}
+
+	gameID := strconv.FormatInt(g.ID, 10)
+	if _, _, err = SetTimer(ctx, gameID, creator.GetKey().Encode(), mode, limit, timeout); err != nil {
+		t.Fatalf("Could not set the test Game timer. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+	}
+
+	if _, _, err = JoinGame(ctx, gameID, opponent.GetKey().Encode()); err != nil {
+		t.Fatalf("Could not join the test Game. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+	}
+
+	g, seats, err := StartGame(ctx, gameID, creator.GetKey().Encode())
+	if err != nil {
+		t.Fatalf("Could not start the test Game. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+	}
+
+	return g, seats
+}
+
+func playMove(ctx context.Context, t *testing.T, gameID string, seat model.Seat, square int) model.Move {
+	file, line, funct := test.GetCaller()
+
+	_, _, move, err := MakeMove(ctx, gameID, seat.PlayerKey.Encode(), `{"square":`+strconv.Itoa(square)+`}`)
+	if err != nil {
+		t.Fatalf("Could not make the test Move. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+	}
+
+	return move
+}
+
+func containsGame(l model.GameList, g model.Game) bool {
+	for _, v := range l {
+		if v.GetKey().Equal(g.GetKey()) {
+			return true
+		}
+	}
+
+	return false
+}
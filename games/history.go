@@ -0,0 +1,180 @@
+package games
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/benjamw/golibs/hooks"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+)
+
+// GetMoves loads the game with the given ID and its move log
+func GetMoves(ctx context.Context, gameID string) (g model.Game, moves model.MoveList, myerr error) {
+	if g, _, myerr = GetGame(ctx, gameID); myerr != nil {
+		return
+	}
+
+	myerr = moves.ByGame(ctx, g.GetKey())
+
+	return
+}
+
+// GetStateAt rebuilds the game state after the given move number
+// by replaying the moves through the rules. Move 0 is the starting state
+func GetStateAt(ctx context.Context, gameID string, number int64) (g model.Game, state string, myerr error) {
+	var moves model.MoveList
+	if g, moves, myerr = GetMoves(ctx, gameID); myerr != nil {
+		return
+	}
+
+	if number < 0 || g.MoveCount < number {
+		myerr = game.NewUserError(nil, http.StatusNotFound, "Move %d does not exist, the game has %d moves", number, g.MoveCount)
+		return
+	}
+
+	state, myerr = Replay(g, moves.Upto(number))
+
+	return
+}
+
+// Replay applies the moves that have not been undone to the starting state of the game
+// and returns the resulting state
+func Replay(g model.Game, moves model.MoveList) (state string, myerr error) {
+	rules, ok := game.GetRules(g.Type)
+	if !ok {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "%s games cannot be replayed", g.Type)
+		return
+	}
+
+	s := []byte(g.Setup)
+	for _, v := range moves {
+		if v.Undone {
+			continue
+		}
+
+		if s, myerr = rules.Apply(s, int(v.Position), []byte(v.Data)); myerr != nil {
+			return
+		}
+	}
+
+	state = string(s)
+
+	return
+}
+
+// RequestUndo asks the other players to let the player take back their last move
+func RequestUndo(ctx context.Context, gameID, playerID string) (g model.Game, seats model.SeatList, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	if g, seats, myerr = GetGame(ctx, gameID); myerr != nil {
+		return
+	}
+
+	if g.Status != model.GameInProgress {
+		myerr = game.NewUserError(nil, http.StatusConflict, "The game is not in progress")
+		return
+	}
+
+	if g.UndoNumber != 0 {
+		myerr = game.NewUserError(nil, http.StatusConflict, "An undo has already been requested")
+		return
+	}
+
+	var moves model.MoveList
+	if myerr = moves.ByGame(ctx, g.GetKey()); myerr != nil {
+		return
+	}
+
+	last, found := moves.LastPlayed()
+	if !found || !last.PlayerKey.Equal(playerKey) {
+		myerr = game.NewUserError(nil, http.StatusConflict, "Only the last move can be taken back, by the player that made it")
+		return
+	}
+
+	g.UndoNumber = last.Number
+	g.UndoKey = playerKey
+	if myerr = store.Save(ctx, &g); myerr != nil {
+		return
+	}
+
+	hooks.Do("GameUndoRequest", ctx, g, seats)
+
+	return
+}
+
+// AnswerUndo accepts or declines the undo request in the game
+// Any other player still in the game can answer the request,
+// and the player that asked can withdraw it by declining
+func AnswerUndo(ctx context.Context, gameID, playerID string, accept bool) (g model.Game, seats model.SeatList, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	if g, seats, myerr = GetGame(ctx, gameID); myerr != nil {
+		return
+	}
+
+	if g.Status != model.GameInProgress || g.UndoNumber == 0 {
+		myerr = game.NewUserError(nil, http.StatusConflict, "There is no undo request to answer")
+		return
+	}
+
+	seat, found := seats.Find(playerKey)
+	if !found || seat.Result != model.SeatPlaying {
+		myerr = game.NewUserError(nil, http.StatusConflict, "You are not playing the game")
+		return
+	}
+
+	if accept && g.UndoKey.Equal(playerKey) {
+		myerr = game.NewUserError(nil, http.StatusConflict, "Your opponent has to accept the undo")
+		return
+	}
+
+	if !accept {
+		g.ClearUndo()
+		myerr = store.Save(ctx, &g)
+
+		return
+	}
+
+	var moves model.MoveList
+	if myerr = moves.ByGame(ctx, g.GetKey()); myerr != nil {
+		return
+	}
+
+	last, found := moves.LastPlayed()
+	if !found || last.Number != g.UndoNumber {
+		myerr = game.NewUserError(nil, http.StatusConflict, "The move has already been taken back")
+		return
+	}
+
+	last.Undone = true
+	if myerr = store.Save(ctx, last); myerr != nil {
+		return
+	}
+
+	// the game goes back to the state of the move before it
+	g.State = g.Setup
+	if prev, found := moves.LastPlayed(); found {
+		g.State = prev.State
+	}
+
+	// the player gets a fresh clock to make the move again
+	g.ClearUndo()
+	g.ResetDeadline(game.Now(ctx))
+	if myerr = store.Save(ctx, &g); myerr != nil {
+		return
+	}
+
+	hooks.Do("GameUndo", ctx, g, seats)
+
+	return
+}
@@ -0,0 +1,160 @@
+package games
+
+import (
+	"context"
+
+	"github.com/benjamw/golibs/hooks"
+
+	"github.com/benjamw/gogame/model"
+)
+
+func init() {
+	hooks.Register("GameCreate", &GameListener{})
+	hooks.Register("GameJoin", &SeatListener{})
+	hooks.Register("GameLeave", &SeatListener{})
+	hooks.Register("GameStart", &GameListener{})
+	hooks.Register("GameForfeit", &GameListener{})
+	hooks.Register("GameFinish", &GameListener{})
+	hooks.Register("GameMove", &MoveListener{})
+	hooks.Register("GameUndoRequest", &GameListener{})
+	hooks.Register("GameUndo", &GameListener{})
+	hooks.Register("GameTimeout", &GameListener{})
+
+	// now that the hooks are registered, add the listeners (in listeners.go)
+	listen()
+}
+
+// GameListener is a hook that runs after a game changes
+// (created, started, forfeited, finished, or a move taken back),
+// and before the timeout policy is applied to a game that ran out of time
+type GameListener struct {
+	// H is the function that gets processed by the Doer
+	// Parameters:
+	//	The Game model data after the change
+	//	The seats in the game, in position order
+	H func(context.Context, model.Game, model.SeatList) (bool, error)
+}
+
+// Do satisfies the hook.Doer interface
+func (h *GameListener) Do(ctx context.Context, p ...interface{}) (bool, error) {
+	if 2 < len(p) {
+		panic("too many parameters passed to game doer")
+	}
+
+	var ok bool
+
+	var g model.Game
+	if g, ok = p[0].(model.Game); !ok {
+		panic("second parameter of game doer is of invalid type")
+	}
+
+	var seats model.SeatList
+	if seats, ok = p[1].(model.SeatList); !ok {
+		panic("third parameter of game doer is of invalid type")
+	}
+
+	return h.H(ctx, g, seats)
+}
+
+// SeatListener is a hook that runs after a player joins or leaves a game
+type SeatListener struct {
+	// H is the function that gets processed by the Doer
+	// Parameters:
+	//	The Game model data after the change
+	//	The seats in the game, in position order
+	//	The Seat model data of the player who joined or left
+	H func(context.Context, model.Game, model.SeatList, model.Seat) (bool, error)
+}
+
+// Do satisfies the hook.Doer interface
+func (h *SeatListener) Do(ctx context.Context, p ...interface{}) (bool, error) {
+	if 3 < len(p) {
+		panic("too many parameters passed to seat doer")
+	}
+
+	var ok bool
+
+	var g model.Game
+	if g, ok = p[0].(model.Game); !ok {
+		panic("second parameter of seat doer is of invalid type")
+	}
+
+	var seats model.SeatList
+	if seats, ok = p[1].(model.SeatList); !ok {
+		panic("third parameter of seat doer is of invalid type")
+	}
+
+	var seat model.Seat
+	if seat, ok = p[2].(model.Seat); !ok {
+		panic("fourth parameter of seat doer is of invalid type")
+	}
+
+	return h.H(ctx, g, seats, seat)
+}
+
+// MoveListener is a hook that runs after a move is made in a game
+type MoveListener struct {
+	// H is the function that gets processed by the Doer
+	// Parameters:
+	//	The Game model data after the move
+	//	The seats in the game, in position order
+	//	The Move model data
+	H func(context.Context, model.Game, model.SeatList, model.Move) (bool, error)
+}
+
+// Do satisfies the hook.Doer interface
+func (h *MoveListener) Do(ctx context.Context, p ...interface{}) (bool, error) {
+	if 3 < len(p) {
+		panic("too many parameters passed to move doer")
+	}
+
+	var ok bool
+
+	var g model.Game
+	if g, ok = p[0].(model.Game); !ok {
+		panic("second parameter of move doer is of invalid type")
+	}
+
+	var seats model.SeatList
+	if seats, ok = p[1].(model.SeatList); !ok {
+		panic("third parameter of move doer is of invalid type")
+	}
+
+	var move model.Move
+	if move, ok = p[2].(model.Move); !ok {
+		panic("fourth parameter of move doer is of invalid type")
+	}
+
+	return h.H(ctx, g, seats, move)
+}
+
+// events holds the hooks to run once the changes to a game are saved,
+// so the listeners only hear about changes that were committed
+type events []event
+
+type event struct {
+	name   string
+	params []interface{}
+}
+
+// add queues the hook with the given name and parameters
+func (e *events) add(name string, params ...interface{}) {
+	// the seats may change after the hook is queued, so it gets them as they are now
+	for k, v := range params {
+		if seats, ok := v.(model.SeatList); ok {
+			params[k] = append(model.SeatList(nil), seats...)
+		}
+	}
+
+	*e = append(*e, event{
+		name:   name,
+		params: params,
+	})
+}
+
+// do runs the queued hooks, in the order they were added
+func (e events) do(ctx context.Context) {
+	for _, v := range e {
+		hooks.Do(v.name, ctx, v.params...)
+	}
+}
@@ -0,0 +1,20 @@
+package games
+
+import (
+	"context"
+
+	"github.com/benjamw/golibs/hooks"
+
+	"github.com/benjamw/gogame/model"
+)
+
+func listen() {
+	hooks.Listen("GameFinish", &GameListener{listenFinish}, 1000)
+}
+
+func listenFinish(ctx context.Context, g model.Game, seats model.SeatList) (bool, error) {
+
+	// do something
+
+	return true, nil
+}
@@ -0,0 +1,171 @@
+// Package tictactoe is a reference game.Rules implementation
+// showing how a game plugs into the core move handling
+package tictactoe
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+
+	"github.com/benjamw/gogame/game"
+)
+
+// GameType is the game type the rules are registered under
+const GameType = "tictactoe"
+
+func init() {
+	game.RegisterRules(GameType, Rules{})
+}
+
+// the three in a row lines that win the game
+var lines = [][3]int{
+	{0, 1, 2}, {3, 4, 5}, {6, 7, 8}, // rows
+	{0, 3, 6}, {1, 4, 7}, {2, 5, 8}, // columns
+	{0, 4, 8}, {2, 4, 6}, // diagonals
+}
+
+// State is the serialized game state
+// Board holds the marks for the nine squares, left to right and top to bottom:
+// 0 for an empty square, or 1 + the seat position of the player that marked it
+type State struct {
+	Board [9]int `json:"board"`
+	Turn  int    `json:"turn"` // the seat position of the player to move next
+}
+
+// Move is a serialized move
+type Move struct {
+	Square int `json:"square"`
+}
+
+// Rules are the tic-tac-toe rules
+type Rules struct{}
+
+// Setup satisfies the game.Rules interface
+func (Rules) Setup(players int) (state []byte, err error) {
+	if players != 2 {
+		return nil, game.NewUserError(nil, http.StatusBadRequest, "Tic-tac-toe needs 2 players, not %d", players)
+	}
+
+	return json.Marshal(State{})
+}
+
+// Turn satisfies the game.Rules interface
+func (Rules) Turn(state []byte) (positions []int, err error) {
+	s, err := decodeState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	if over, _ := s.over(); over {
+		return []int{}, nil
+	}
+
+	return []int{s.Turn}, nil
+}
+
+// Validate satisfies the game.Rules interface
+func (Rules) Validate(state []byte, position int, move []byte) error {
+	s, err := decodeState(state)
+	if err != nil {
+		return err
+	}
+
+	if over, _ := s.over(); over {
+		return game.NewUserError(nil, http.StatusConflict, "The game is over")
+	}
+
+	if position != s.Turn {
+		return game.NewUserError(nil, http.StatusConflict, "It is not your turn")
+	}
+
+	var m Move
+	if err = json.Unmarshal(move, &m); err != nil {
+		return game.NewUserError(err, http.StatusBadRequest, "The move could not be read: %v", err)
+	}
+
+	if m.Square < 0 || len(s.Board) <= m.Square {
+		return game.NewUserError(nil, http.StatusBadRequest, "Square %d is not on the board", m.Square)
+	}
+
+	if s.Board[m.Square] != 0 {
+		return game.NewUserError(nil, http.StatusBadRequest, "Square %d has already been taken", m.Square)
+	}
+
+	return nil
+}
+
+// Apply satisfies the game.Rules interface
+func (Rules) Apply(state []byte, position int, move []byte) (newState []byte, err error) {
+	s, err := decodeState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Move
+	if err = json.Unmarshal(move, &m); err != nil {
+		return nil, err
+	}
+
+	s.Board[m.Square] = position + 1
+	s.Turn = 1 - position
+
+	return json.Marshal(s)
+}
+
+// Over satisfies the game.Rules interface
+func (Rules) Over(state []byte) (over bool, winners []int, err error) {
+	s, err := decodeState(state)
+	if err != nil {
+		return false, nil, err
+	}
+
+	over, winners = s.over()
+
+	return over, winners, nil
+}
+
+// RandomMove satisfies the game.RandomMover interface
+// Tic-tac-toe does not allow passing, so it does not satisfy the game.Passer interface
+func (Rules) RandomMove(state []byte, position int) (move []byte, err error) {
+	s, err := decodeState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	empty := make([]int, 0, len(s.Board))
+	for k, mark := range s.Board {
+		if mark == 0 {
+			empty = append(empty, k)
+		}
+	}
+
+	if len(empty) == 0 {
+		return nil, game.NewUserError(nil, http.StatusConflict, "There are no squares left")
+	}
+
+	return json.Marshal(Move{Square: empty[rand.Intn(len(empty))]})
+}
+
+func decodeState(state []byte) (s State, err error) {
+	err = json.Unmarshal(state, &s)
+
+	return
+}
+
+// over reports if there are three in a row, or if the board is full
+func (s State) over() (over bool, winners []int) {
+	for _, l := range lines {
+		mark := s.Board[l[0]]
+		if mark != 0 && mark == s.Board[l[1]] && mark == s.Board[l[2]] {
+			return true, []int{mark - 1}
+		}
+	}
+
+	for _, mark := range s.Board {
+		if mark == 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,160 @@
+package tictactoe
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/benjamw/gogame/game"
+)
+
+func TestRegistered(t *testing.T) {
+	if _, ok := game.GetRules(GameType); !ok {
+		t.Fatal("The tic-tac-toe rules were not registered.")
+	}
+}
+
+func TestSetup(t *testing.T) {
+	var r Rules
+
+	if _, err := r.Setup(3); err == nil {
+		t.Fatal("Rules.Setup did not throw an error for 3 players.")
+	}
+
+	state, err := r.Setup(2)
+	if err != nil {
+		t.Fatalf("Rules.Setup threw an error: %v", err)
+	}
+
+	turn, err := r.Turn(state)
+	if err != nil {
+		t.Fatalf("Rules.Turn threw an error: %v", err)
+	}
+	if len(turn) != 1 || turn[0] != 0 {
+		t.Fatalf("Rules.Turn did not give the first move to position 0. Got: %v", turn)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var r Rules
+
+	state := play(t, 4)
+
+	tests := []struct {
+		name     string
+		position int
+		move     string
+	}{
+		{"out of turn", 0, `{"square":0}`},
+		{"taken square", 1, `{"square":4}`},
+		{"off the board", 1, `{"square":9}`},
+		{"bad move", 1, `square 0`},
+	}
+
+	for _, v := range tests {
+		err := r.Validate(state, v.position, []byte(v.move))
+		if _, ok := err.(game.Error); !ok {
+			t.Fatalf("Rules.Validate did not throw a game.Error for a move %s. Error: %v", v.name, err)
+		}
+	}
+
+	if err := r.Validate(state, 1, []byte(`{"square":0}`)); err != nil {
+		t.Fatalf("Rules.Validate threw an error for a valid move: %v", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	var r Rules
+
+	state := play(t, 4)
+
+	next, err := r.Apply(state, 1, []byte(`{"square":0}`))
+	if err != nil {
+		t.Fatalf("Rules.Apply threw an error: %v", err)
+	}
+
+	var s State
+	if err = json.Unmarshal(next, &s); err != nil {
+		t.Fatalf("Rules.Apply returned an invalid state: %v", err)
+	}
+
+	if s.Board[0] != 2 || s.Board[4] != 1 || s.Turn != 0 {
+		t.Fatalf("Rules.Apply did not apply the move. Got: %+v", s)
+	}
+
+	// the original state is untouched
+	if string(state) == string(next) {
+		t.Fatal("Rules.Apply did not return a new state.")
+	}
+}
+
+func TestOver(t *testing.T) {
+	var r Rules
+
+	tests := []struct {
+		name    string
+		squares []int
+		over    bool
+		winners []int
+	}{
+		{"in progress", []int{4, 0}, false, nil},
+		{"first player wins", []int{0, 3, 1, 4, 2}, true, []int{0}},
+		{"second player wins", []int{0, 2, 1, 4, 8, 6}, true, []int{1}},
+		{"draw", []int{0, 1, 2, 4, 3, 5, 7, 6, 8}, true, []int{}},
+	}
+
+	for _, v := range tests {
+		over, winners, err := r.Over(play(t, v.squares...))
+		if err != nil {
+			t.Fatalf("Rules.Over threw an error for %s: %v", v.name, err)
+		}
+
+		if over != v.over || len(winners) != len(v.winners) || (len(winners) == 1 && winners[0] != v.winners[0]) {
+			t.Fatalf("Rules.Over returned the wrong result for %s. Wanted: %v %v; Got: %v %v", v.name, v.over, v.winners, over, winners)
+		}
+	}
+}
+
+// play makes the moves on the given squares, alternating players, and returns the state
+func play(t *testing.T, squares ...int) []byte {
+	var r Rules
+
+	state, err := r.Setup(2)
+	if err != nil {
+		t.Fatalf("Rules.Setup threw an error: %v", err)
+	}
+
+	for k, square := range squares {
+		move, _ := json.Marshal(Move{Square: square})
+
+		if err = r.Validate(state, k%2, move); err != nil {
+			t.Fatalf("Rules.Validate threw an error for square %d: %v", square, err)
+		}
+
+		if state, err = r.Apply(state, k%2, move); err != nil {
+			t.Fatalf("Rules.Apply threw an error for square %d: %v", square, err)
+		}
+	}
+
+	return state
+}
+
+func TestRandomMove(t *testing.T) {
+	var r Rules
+
+	state := play(t, 0, 1, 2, 4, 3, 5, 7)
+
+	for i := 0; i < 10; i++ {
+		move, err := r.RandomMove(state, 1)
+		if err != nil {
+			t.Fatalf("Rules.RandomMove threw an error: %v", err)
+		}
+
+		if err = r.Validate(state, 1, move); err != nil {
+			t.Fatalf("Rules.RandomMove returned an invalid move %s: %v", move, err)
+		}
+	}
+
+	if _, err := r.RandomMove(play(t, 0, 1, 2, 4, 3, 5, 7, 6, 8), 0); err == nil {
+		t.Fatal("Rules.RandomMove did not throw an error for a full board.")
+	}
+}
@@ -0,0 +1,223 @@
+package games
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/benjamw/golibs/hooks"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/config"
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+)
+
+// sweepBatch is the most timed out games handled by a single Sweep
+const sweepBatch = 100
+
+// SetTimer sets the turn timer for a game that has not started yet
+// mode is one of the model.Timer* constants, limit is the time allowed for each turn
+// in days for correspondence games or seconds for real-time games,
+// and timeout is one of the model.Timeout* constants (the configured default if empty)
+// Only the creator of the game can set the timer
+func SetTimer(ctx context.Context, gameID, playerID, mode string, limit int64, timeout string) (g model.Game, seats model.SeatList, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	if g, seats, myerr = GetGame(ctx, gameID); myerr != nil {
+		return
+	}
+
+	if !g.CreatorKey.Equal(playerKey) {
+		myerr = game.NewUserError(nil, http.StatusForbidden, "Only the creator can set the turn timer")
+		return
+	}
+
+	if g.Status != model.GameOpen {
+		myerr = game.NewUserError(nil, http.StatusConflict, "The turn timer can only be set before the game starts")
+		return
+	}
+
+	switch mode {
+	case model.TimerNone:
+		limit = 0
+		timeout = ""
+	case model.TimerCorrespondence, model.TimerRealtime:
+		if _, ok := game.GetRules(g.Type); !ok {
+			myerr = game.NewUserError(nil, http.StatusBadRequest, "%s games cannot have a turn timer", g.Type)
+			return
+		}
+
+		if limit < 1 {
+			myerr = game.NewUserError(nil, http.StatusBadRequest, "The turn limit must be at least 1, got %d", limit)
+			return
+		}
+
+		if timeout == "" {
+			timeout = config.FromContext(ctx).TurnTimeout
+		}
+
+		switch timeout {
+		case model.TimeoutSkip, model.TimeoutForfeit, model.TimeoutRandom:
+		default:
+			myerr = game.NewUserError(nil, http.StatusBadRequest, "Unknown timeout policy: %s", timeout)
+			return
+		}
+	default:
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Unknown timer mode: %s", mode)
+		return
+	}
+
+	g.TimerMode = mode
+	g.TurnLimit = limit
+	g.Timeout = timeout
+	myerr = store.Save(ctx, &g)
+
+	return
+}
+
+// Sweep applies the timeout policy to the games whose current turn has run out of time
+// by game.Now, and returns the number of games that were handled
+// It is run by the sweep task on App Engine, and on a ticker by the standalone server
+func Sweep(ctx context.Context) (num int, myerr error) {
+	var gl model.GameList
+	if myerr = gl.TimedOut(ctx, game.Now(ctx), sweepBatch); myerr != nil {
+		return
+	}
+
+	for k := range gl {
+		// one broken game should not hold up the rest of the sweep
+		if err := timeOut(ctx, gl[k]); err != nil {
+			game.Errorf(ctx, "Could not time out game %d: %v", gl[k].ID, err)
+			continue
+		}
+
+		num++
+	}
+
+	return
+}
+
+// timeOut applies the timeout policy of the game to each player whose turn it is
+func timeOut(ctx context.Context, g model.Game) (myerr error) {
+	var seats model.SeatList
+	if myerr = seats.ByGame(ctx, g.GetKey()); myerr != nil {
+		return
+	}
+
+	rules, ok := game.GetRules(g.Type)
+	if !ok {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "%s games cannot be timed out", g.Type)
+		return
+	}
+
+	hooks.Do("GameTimeout", ctx, g, seats)
+
+	// the game is read again and changed in a transaction, so a move made since the sweep found it is kept
+	var ev events
+	myerr = store.RunInTransaction(ctx, func(ctx context.Context) (err error) {
+		ev = nil
+		return applyTimeout(ctx, rules, g.GetKey(), &ev)
+	})
+	if myerr != nil {
+		return
+	}
+
+	ev.do(ctx)
+
+	return
+}
+
+// applyTimeout applies the timeout policy to the game with the given key if its turn is still out of time,
+// queueing the hooks to run in ev
+func applyTimeout(ctx context.Context, rules game.Rules, gameKey *datastore.Key, ev *events) (myerr error) {
+	var g model.Game
+	if myerr = store.Load(ctx, gameKey, &g); myerr != nil {
+		return
+	}
+
+	if g.Status != model.GameInProgress || g.Deadline.IsZero() || game.Now(ctx).Before(g.Deadline) {
+		return
+	}
+
+	var seats model.SeatList
+	if myerr = seats.ByGame(ctx, gameKey); myerr != nil {
+		return
+	}
+
+	turn, myerr := rules.Turn([]byte(g.State))
+	if myerr != nil {
+		return
+	}
+
+	moved := false
+	for _, position := range turn {
+		if g.IsOver() {
+			break
+		}
+
+		seat, found := seats.AtPosition(int64(position))
+		if !found || seat.Result != model.SeatPlaying {
+			continue
+		}
+
+		// an earlier move in this sweep may have ended the turn for this player
+		if moved {
+			var current []int
+			if current, myerr = rules.Turn([]byte(g.State)); myerr != nil {
+				return
+			}
+
+			if !hasPosition(current, position) {
+				continue
+			}
+		}
+
+		var move []byte
+		if move, myerr = timeoutMove(rules, g, position); myerr != nil {
+			return
+		}
+
+		if move == nil {
+			if myerr = forfeit(ctx, &g, seats, seat, ev); myerr != nil {
+				return
+			}
+
+			continue
+		}
+
+		if _, myerr = play(ctx, rules, &g, seats, seat, string(move), true, ev); myerr != nil {
+			return
+		}
+
+		moved = true
+	}
+
+	// start a new clock if nothing else did, so the game is not swept again right away
+	if !g.IsOver() && !game.Now(ctx).Before(g.Deadline) {
+		g.ResetDeadline(game.Now(ctx))
+		myerr = store.Save(ctx, &g)
+	}
+
+	return
+}
+
+// timeoutMove returns the move to make for the player in the given position under the timeout policy of the game,
+// or nil if the player should forfeit
+func timeoutMove(rules game.Rules, g model.Game, position int) (move []byte, myerr error) {
+	switch g.Timeout {
+	case model.TimeoutSkip:
+		if p, ok := rules.(game.Passer); ok {
+			move, myerr = p.PassMove([]byte(g.State), position)
+		}
+	case model.TimeoutRandom:
+		if r, ok := rules.(game.RandomMover); ok {
+			move, myerr = r.RandomMove([]byte(g.State), position)
+		}
+	}
+
+	return
+}
@@ -5,10 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-
-	"google.golang.org/appengine/log"
+	"strconv"
+	"time"
 
 	"github.com/benjamw/gogame/config"
+	"github.com/benjamw/gogame/game"
 	"github.com/benjamw/gogame/session"
 )
 
@@ -69,7 +70,7 @@ type PlayerBlankHandler struct {
 func (h PlayerBlankHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx, s, err := prepSession(r, PlayerCookieName)
 	if _, ok := err.(*session.InvalidSessionError); ok {
-		http.Redirect(w, r, config.FrontLogin, http.StatusFound)
+		http.Redirect(w, r, config.FromContext(ctx).FrontLogin, http.StatusFound)
 		return
 	}
 	if err != nil {
@@ -92,7 +93,7 @@ type PlayerHTMLHandler struct {
 func (h PlayerHTMLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx, s, err := prepSession(r, PlayerCookieName)
 	if _, ok := err.(*session.InvalidSessionError); ok {
-		http.Redirect(w, r, config.FrontLogin, http.StatusFound)
+		http.Redirect(w, r, config.FromContext(ctx).FrontLogin, http.StatusFound)
 		return
 	}
 	if err != nil {
@@ -136,7 +137,7 @@ type Response struct {
 func ReplyJSON(ctx context.Context, w http.ResponseWriter, data interface{}) {
 	replyBytes, err := json.Marshal(data)
 	if err != nil {
-		log.Errorf(ctx, "JSON marshalling failed: %v", err)
+		game.Errorf(ctx, "JSON marshalling failed: %v", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
@@ -152,6 +153,11 @@ func ReplyErr(ctx context.Context, w http.ResponseWriter, err error) {
 		w.Header().Set("Location", e.URL)
 	}
 
+	if e, ok := err.(*game.TooManyRequestsError); ok {
+		// whole seconds, rounded up so the retry is not too early
+		w.Header().Set("Retry-After", strconv.FormatInt(int64((e.RetryAfter+time.Second-1)/time.Second), 10))
+	}
+
 	errCode, errMessage := processError(ctx, err)
 	http.Error(w, errMessage, errCode)
 	return
@@ -205,7 +211,7 @@ func prepSession(r *http.Request, cookieName string) (ctx context.Context, s ses
 	}
 
 	var found bool
-	found, err = s.FromCookie(r, PlayerCookieName)
+	found, err = s.FromCookie(ctx, r, PlayerCookieName)
 	if !found || !s.IsPlayer {
 		err = &session.InvalidSessionError{}
 	}
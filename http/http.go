@@ -9,18 +9,60 @@ import (
 
 	"github.com/benjamw/golibs/random"
 	"google.golang.org/appengine"
-	"google.golang.org/appengine/log"
 
 	"github.com/benjamw/gogame/config"
 	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/pubsub"
+	"github.com/benjamw/gogame/ratelimit"
+	"github.com/benjamw/gogame/store"
 )
 
 func buildContext(r *http.Request) context.Context {
-	ctx := appengine.NewContext(r)
+	var ctx context.Context
+	if game.AppEngine {
+		ctx = appengine.NewContext(r)
+
+		// carry over anything the router middleware attached to the request
+		ctx = config.NewContext(ctx, config.FromContext(r.Context()))
+		ctx = store.NewContext(ctx, store.FromContext(r.Context()))
+		ctx = pubsub.NewContext(ctx, pubsub.FromContext(r.Context()))
+		ctx = ratelimit.NewContext(ctx, ratelimit.FromContext(r.Context()))
+	} else {
+		ctx = r.Context()
+	}
 	ctx = game.SetNow(ctx)
 	return ctx
 }
 
+// WithConfig attaches the given config to every request served by the handler
+// so a router can run with settings other than the process wide config
+func WithConfig(h http.Handler, c *config.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(config.NewContext(r.Context(), c)))
+	})
+}
+
+// WithStore attaches the given store to every request served by the handler
+func WithStore(h http.Handler, s store.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(store.NewContext(r.Context(), s)))
+	})
+}
+
+// WithBroker attaches the given pub/sub Broker to every request served by the handler
+func WithBroker(h http.Handler, b pubsub.Broker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(pubsub.NewContext(r.Context(), b)))
+	})
+}
+
+// WithLimiter attaches the given rate Limiter to every request served by the handler
+func WithLimiter(h http.Handler, l ratelimit.Limiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(ratelimit.NewContext(r.Context(), l)))
+	})
+}
+
 func updateConfig(r *http.Request) {
 	if config.RootURL == "" {
 		config.RootURL = r.Host
@@ -49,7 +91,7 @@ func processError(ctx context.Context, err error) (httpCode int, errMessage stri
 	errID := random.Int31()
 	errMessage = fmt.Sprintf("%v (%d)", err, errID)
 
-	log.Errorf(ctx, "error (%d): %v", errID, err)
+	game.Errorf(ctx, "error (%d): %v", errID, err)
 
 	if e, ok := err.(game.Error); ok {
 		httpCode = e.Code()
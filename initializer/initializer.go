@@ -4,7 +4,11 @@ import (
 	// run init() on the endpoints
 	_ "github.com/benjamw/gogame/chat"
 	_ "github.com/benjamw/gogame/forgot"
+	_ "github.com/benjamw/gogame/games"
+	_ "github.com/benjamw/gogame/games/tictactoe"
+	_ "github.com/benjamw/gogame/matchmaking"
 	_ "github.com/benjamw/gogame/player"
+	_ "github.com/benjamw/gogame/ratings"
 	_ "github.com/benjamw/gogame/test"
 )
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"strings"
 	"sync"
 
@@ -23,12 +24,12 @@ var (
 
 // FromTemplate reads the template from settings and sends the email
 func FromTemplate(ctx context.Context, template string, to []string, params map[string]interface{}, mg mailgun.Mailgun) error {
-	tpls, err := parseTemplates(template, params)
+	tpls, err := parseTemplates(ctx, template, params)
 	if err != nil {
 		return err
 	}
 
-	return Send(ctx, config.FromEmail, to, tpls["subject.hbs"], tpls["text.hbs"], tpls["html.hbs"], mg)
+	return Send(ctx, config.FromContext(ctx).FromEmail, to, tpls["subject.hbs"], tpls["text.hbs"], tpls["html.hbs"], mg)
 }
 
 // Send an email
@@ -52,7 +53,7 @@ func Send(ctx context.Context, from string, to []string, subj string, plain stri
 	return
 }
 
-func parseTemplates(template string, params map[string]interface{}) (tpls map[string]string, myerr error) {
+func parseTemplates(ctx context.Context, template string, params map[string]interface{}) (tpls map[string]string, myerr error) {
 	tplPath := config.Root + "/emails/" + template + "/"
 
 	if params == nil {
@@ -61,7 +62,7 @@ func parseTemplates(template string, params map[string]interface{}) (tpls map[st
 
 	// add some defaults to the param list
 	params["ROOT"] = config.RootURL
-	params["SiteName"] = config.SiteName
+	params["SiteName"] = config.FromContext(ctx).SiteName
 
 	t := make(map[string]string, 0)
 	var result string
@@ -155,12 +156,16 @@ func putTemplate(template string, file string, tpl *raymond.Template) {
 }
 
 func initMailgun(ctx context.Context) mailgun.Mailgun {
-	httpc := urlfetch.Client(ctx)
+	httpc := http.DefaultClient
+	if game.AppEngine {
+		httpc = urlfetch.Client(ctx)
+	}
 
+	c := config.FromContext(ctx)
 	mg := mailgun.NewMailgun(
-		config.MailGunDomain,
-		config.MailGunAPIKey,
-		config.MailGunPubKey,
+		c.MailGunDomain,
+		c.MailGunAPIKey,
+		c.MailGunPubKey,
 	)
 	mg.SetClient(httpc)
 
@@ -14,7 +14,7 @@ import (
 )
 
 var (
-	email = config.TestToEmail
+	email = config.Get().TestToEmail
 )
 
 func TestMain(m *testing.M) {
@@ -30,7 +30,7 @@ func TestMain(m *testing.M) {
 
 func TestParseTemplate(t *testing.T) {
 	params := make(map[string]interface{}, 0)
-	split, err := parseTemplates("welcome", params)
+	split, err := parseTemplates(test.GetCtx(), "welcome", params)
 	if err != nil {
 		t.Fatalf("mail.parseTemplates threw an error: %v", err)
 	}
@@ -0,0 +1,327 @@
+// Package matchmaking queues players for a game type and seats them
+// in a new game once enough compatible players are waiting
+package matchmaking
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"github.com/benjamw/golibs/hooks"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/games"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+)
+
+func init() {
+	hooks.Register("QueueMatch", &games.GameListener{})
+}
+
+// Options are the constraints a player puts on their match
+type Options struct {
+	MinRating  int64 // the lowest opponent rating accepted, 0 for no limit
+	MaxRating  int64 // the highest opponent rating accepted, 0 for no limit
+	MinPlayers int64 // the smallest game accepted, 2 if not set
+	MaxPlayers int64 // the largest game accepted, MinPlayers if not set
+}
+
+// JoinQueue puts the player in the queue for the game type, replacing any ticket they already hold,
+// and creates and starts a game if enough compatible players are waiting
+func JoinQueue(ctx context.Context, playerID, gameType string, opts Options) (ticket model.Ticket, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	if gameType == "" {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "A game type is required")
+		return
+	}
+
+	if opts.MinPlayers == 0 {
+		opts.MinPlayers = 2
+	}
+
+	if opts.MaxPlayers == 0 {
+		opts.MaxPlayers = opts.MinPlayers
+	}
+
+	if opts.MinPlayers < 2 || opts.MaxPlayers < opts.MinPlayers {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Invalid player count: min %d, max %d", opts.MinPlayers, opts.MaxPlayers)
+		return
+	}
+
+	if opts.MinRating < 0 || opts.MaxRating < 0 || (opts.MaxRating != 0 && opts.MaxRating < opts.MinRating) {
+		myerr = game.NewUserError(nil, http.StatusBadRequest, "Invalid rating range: min %d, max %d", opts.MinRating, opts.MaxRating)
+		return
+	}
+
+	rating, myerr := playerRating(ctx, playerKey, gameType)
+	if myerr != nil {
+		return
+	}
+
+	ticket = model.Ticket{
+		PlayerKey:  playerKey,
+		GameType:   gameType,
+		Status:     model.TicketWaiting,
+		Rating:     rating,
+		MinRating:  opts.MinRating,
+		MaxRating:  opts.MaxRating,
+		MinPlayers: opts.MinPlayers,
+		MaxPlayers: opts.MaxPlayers,
+		Created:    game.Now(ctx),
+	}
+	if myerr = store.Save(ctx, &ticket); myerr != nil {
+		return
+	}
+
+	myerr = match(ctx, &ticket)
+
+	return
+}
+
+// LeaveQueue takes the player out of the queue
+func LeaveQueue(ctx context.Context, playerID string) (myerr error) {
+	ticket, myerr := PollQueue(ctx, playerID)
+	if myerr != nil {
+		return
+	}
+
+	if ticket.Status != model.TicketWaiting {
+		myerr = game.NewUserError(nil, http.StatusConflict, "You have already been matched")
+		return
+	}
+
+	myerr = store.Delete(ctx, &ticket)
+
+	return
+}
+
+// PollQueue returns the player's ticket, which holds the game once they are matched
+func PollQueue(ctx context.Context, playerID string) (ticket model.Ticket, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	if myerr = ticket.ByPlayer(ctx, playerKey); myerr != nil {
+		if _, ok := myerr.(*db.UnfoundObjectError); ok {
+			myerr = game.NewUserError(myerr, http.StatusNotFound, "You are not in the queue")
+		}
+
+		return
+	}
+
+	return
+}
+
+// match looks for the oldest waiting tickets that are compatible with the given ticket and each other,
+// and seats them all in a new game if there are enough of them
+func match(ctx context.Context, ticket *model.Ticket) (myerr error) {
+	var waiting model.TicketList
+	if myerr = waiting.Waiting(ctx, ticket.GameType); myerr != nil {
+		return
+	}
+
+	group := []*model.Ticket{ticket}
+	minPlayers, maxPlayers := ticket.MinPlayers, ticket.MaxPlayers
+	for k := range waiting {
+		if int64(len(group)) == maxPlayers {
+			break
+		}
+
+		other := &waiting[k]
+		if other.PlayerKey.Equal(ticket.PlayerKey) {
+			continue
+		}
+
+		if other.MaxPlayers < minPlayers || maxPlayers < other.MinPlayers {
+			continue
+		}
+
+		if !compatible(group, other) {
+			continue
+		}
+
+		group = append(group, other)
+		if minPlayers < other.MinPlayers {
+			minPlayers = other.MinPlayers
+		}
+		if other.MaxPlayers < maxPlayers {
+			maxPlayers = other.MaxPlayers
+		}
+	}
+
+	if int64(len(group)) < minPlayers {
+		return
+	}
+
+	// the player that has waited the longest creates the game
+	group = append(group[1:], group[0])
+
+	myerr = createMatch(ctx, group)
+
+	return
+}
+
+// compatible returns true if the ticket and every ticket in the group accept each other's ratings
+func compatible(group []*model.Ticket, ticket *model.Ticket) bool {
+	for _, v := range group {
+		if !v.Accepts(ticket.Rating) || !ticket.Accepts(v.Rating) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// errClaimed is returned when a ticket in a match was taken by another match first
+var errClaimed = errors.New("matchmaking: a ticket has already been matched")
+
+// createMatch creates and starts a game for the players holding the tickets,
+// and marks the tickets as matched
+// If another match takes one of the tickets first, the game is deleted and the tickets are left waiting
+func createMatch(ctx context.Context, group []*model.Ticket) (myerr error) {
+	players := int64(len(group))
+	creatorID := group[0].PlayerKey.Encode()
+
+	g, seats, myerr := games.CreateGame(ctx, creatorID, group[0].GameType, "", players, players)
+	if myerr != nil {
+		return
+	}
+
+	if myerr = claim(ctx, group, g.GetKey()); myerr == nil {
+		if g, seats, myerr = seatMatch(ctx, g, group[1:], creatorID); myerr == nil {
+			hooks.Do("QueueMatch", ctx, g, seats)
+			return
+		}
+
+		// put the players back in the queue, to be matched again
+		if err := release(ctx, group, g.GetKey()); err != nil {
+			game.Errorf(ctx, "Could not put the tickets for game %d back in the queue: %v", g.ID, err)
+		}
+	}
+
+	// a match that fell through does not leave its game behind
+	if err := games.DeleteGame(ctx, g); err != nil {
+		game.Errorf(ctx, "Could not delete game %d: %v", g.ID, err)
+	}
+
+	// the tickets are still waiting, and will be matched by a later player
+	if myerr == errClaimed {
+		myerr = nil
+	}
+
+	return
+}
+
+// claim marks the tickets as matched into the game, in a transaction so a ticket cannot be matched twice
+// errClaimed is returned if any of the tickets is no longer waiting
+func claim(ctx context.Context, group []*model.Ticket, gameKey *datastore.Key) (myerr error) {
+	claimed := make([]model.Ticket, len(group))
+	myerr = store.RunInTransaction(ctx, func(ctx context.Context) (err error) {
+		for k, v := range group {
+			if err = store.Load(ctx, v.GetKey(), &claimed[k]); err != nil {
+				if _, ok := err.(*db.UnfoundObjectError); ok {
+					err = errClaimed
+				}
+
+				return
+			}
+
+			if claimed[k].Status != model.TicketWaiting || claimed[k].GameType != v.GameType {
+				return errClaimed
+			}
+		}
+
+		now := game.Now(ctx)
+		for k := range claimed {
+			claimed[k].Status = model.TicketMatched
+			claimed[k].GameKey = gameKey
+			claimed[k].Matched = now
+			if err = store.Save(ctx, &claimed[k]); err != nil {
+				return
+			}
+		}
+
+		return
+	})
+	if myerr != nil {
+		return
+	}
+
+	for k, v := range group {
+		*v = claimed[k]
+	}
+
+	return
+}
+
+// release puts the tickets matched into the game back in the queue
+func release(ctx context.Context, group []*model.Ticket, gameKey *datastore.Key) (myerr error) {
+	released := make([]model.Ticket, len(group))
+	myerr = store.RunInTransaction(ctx, func(ctx context.Context) (err error) {
+		for k, v := range group {
+			if err = store.Load(ctx, v.GetKey(), &released[k]); err != nil {
+				return
+			}
+
+			// the player may have left the queue or joined it again since
+			if released[k].Status != model.TicketMatched || !released[k].GameKey.Equal(gameKey) {
+				continue
+			}
+
+			released[k].Status = model.TicketWaiting
+			released[k].GameKey = nil
+			released[k].Matched = time.Time{}
+			if err = store.Save(ctx, &released[k]); err != nil {
+				return
+			}
+		}
+
+		return
+	})
+	if myerr != nil {
+		return
+	}
+
+	for k, v := range group {
+		*v = released[k]
+	}
+
+	return
+}
+
+// seatMatch seats the players holding the tickets in the creator's game, and starts it
+func seatMatch(ctx context.Context, g model.Game, group []*model.Ticket, creatorID string) (started model.Game, seats model.SeatList, myerr error) {
+	gameID := strconv.FormatInt(g.ID, 10)
+	for _, v := range group {
+		if _, _, myerr = games.JoinGame(ctx, gameID, v.PlayerKey.Encode()); myerr != nil {
+			return
+		}
+	}
+
+	started, seats, myerr = games.StartGame(ctx, gameID, creatorID)
+
+	return
+}
+
+// playerRating returns the player's rating for the game type, rounded for the queue
+func playerRating(ctx context.Context, playerKey *datastore.Key, gameType string) (rating int64, myerr error) {
+	var r model.Rating
+	if myerr = r.ByPlayer(ctx, playerKey, gameType); myerr != nil {
+		return
+	}
+
+	rating = int64(math.Round(r.Rating))
+
+	return
+}
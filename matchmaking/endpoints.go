@@ -0,0 +1,128 @@
+package matchmaking
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	gttp "github.com/benjamw/gogame/http"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/session"
+)
+
+func init() {
+	gttp.R.Path("/queue").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleJoin})
+
+	gttp.R.Path("/queue").
+		Methods("GET").
+		Handler(&gttp.PlayerJSONHandler{handlePoll})
+
+	gttp.R.Path("/queue/leave").
+		Methods("POST").
+		Handler(&gttp.PlayerJSONHandler{handleLeave})
+}
+
+type TicketReply struct {
+	gttp.Response
+	GameType   string    `json:"game_type"`
+	Status     string    `json:"status"`
+	Rating     int64     `json:"rating"`
+	MinRating  int64     `json:"min_rating,omitempty"`
+	MaxRating  int64     `json:"max_rating,omitempty"`
+	MinPlayers int64     `json:"min_players"`
+	MaxPlayers int64     `json:"max_players"`
+	GameID     int64     `json:"game_id,omitempty"` // the game the player was matched into
+	Created    time.Time `json:"created"`
+	Matched    time.Time `json:"matched"`
+}
+
+func (r *TicketReply) Set(m model.Ticket) {
+	r.GameType = m.GameType
+	r.Status = m.Status
+	r.Rating = m.Rating
+	r.MinRating = m.MinRating
+	r.MaxRating = m.MaxRating
+	r.MinPlayers = m.MinPlayers
+	r.MaxPlayers = m.MaxPlayers
+	if m.GameKey != nil {
+		r.GameID = m.GameKey.IntID()
+	}
+	r.Created = m.Created
+	r.Matched = m.Matched
+}
+
+func ticketReply(m model.Ticket) TicketReply {
+	reply := TicketReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(m)
+
+	return reply
+}
+
+// formInt reads an integer form value, returning 0 if it was not given
+func formInt(r *http.Request, key string) (int64, error) {
+	value := r.FormValue(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func handleJoin(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	gameType := r.FormValue("game_type")
+	if gameType == "" {
+		errReply = &gttp.MissingRequiredError{FormElement: "game_type"}
+		return
+	}
+
+	var opts Options
+	for key, value := range map[string]*int64{
+		"min_rating":  &opts.MinRating,
+		"max_rating":  &opts.MaxRating,
+		"min_players": &opts.MinPlayers,
+		"max_players": &opts.MaxPlayers,
+	} {
+		if *value, errReply = formInt(r, key); errReply != nil {
+			return
+		}
+	}
+
+	ticket, errReply := JoinQueue(ctx, s.PlayerID, gameType, opts)
+	if errReply != nil {
+		return
+	}
+
+	replyRaw = ticketReply(ticket)
+
+	return
+}
+
+func handlePoll(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	ticket, errReply := PollQueue(ctx, s.PlayerID)
+	if errReply != nil {
+		return
+	}
+
+	replyRaw = ticketReply(ticket)
+
+	return
+}
+
+func handleLeave(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	if errReply = LeaveQueue(ctx, s.PlayerID); errReply != nil {
+		return
+	}
+
+	replyRaw = gttp.Response{
+		Success: true,
+	}
+
+	return
+}
@@ -0,0 +1,237 @@
+package matchmaking
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/benjamw/golibs/db"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/games/tictactoe"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store/storetest"
+)
+
+// MODEL TESTS
+
+func TestTicketPreSave(t *testing.T) {
+	ctx := storetest.NewContext()
+	var m model.Ticket
+
+	// test with no player
+	if _, ok := m.PreSave(ctx).(*db.MissingParentKeyError); !ok {
+		t.Fatal("Ticket.PreSave did not throw an error for a missing Parent Player Key.")
+	}
+
+	// test with no game type
+	player := storetest.SavePlayer(ctx, t)
+	m.PlayerKey = player.GetKey()
+	err := m.PreSave(ctx)
+	if e, ok := err.(*db.MissingRequiredError); !ok || e.Property != "GameType" {
+		t.Fatalf("Ticket.PreSave threw the wrong error for a missing GameType. Error: %v", err)
+	}
+
+	// test proper
+	m.GameType = tictactoe.GameType
+	if err = m.PreSave(ctx); err != nil {
+		t.Fatalf("Ticket.PreSave threw an error: %v", err)
+	}
+	if m.Status != model.TicketWaiting || m.Created.IsZero() {
+		t.Fatalf("Ticket.PreSave did not set the defaults. Got: %+v", m)
+	}
+}
+
+func TestTicketAccepts(t *testing.T) {
+	m := model.Ticket{
+		MinRating: 1400,
+		MaxRating: 1600,
+	}
+
+	tests := []struct {
+		rating  int64
+		accepts bool
+	}{
+		{1399, false},
+		{1400, true},
+		{1600, true},
+		{1601, false},
+	}
+
+	for _, v := range tests {
+		if m.Accepts(v.rating) != v.accepts {
+			t.Fatalf("Ticket.Accepts returned the wrong result for %d. Wanted: %v", v.rating, v.accepts)
+		}
+	}
+
+	if m = (model.Ticket{}); !m.Accepts(3000) {
+		t.Fatal("Ticket.Accepts rejected a rating without limits.")
+	}
+}
+
+// CONTROLLER TESTS
+
+func TestJoinQueue(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	first := storetest.SavePlayer(ctx, t)
+	second := storetest.SavePlayer(ctx, t)
+	picky := storetest.SavePlayer(ctx, t)
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"single player game", Options{MinPlayers: 1}},
+		{"bad player range", Options{MinPlayers: 3, MaxPlayers: 2}},
+		{"bad rating range", Options{MinRating: 1600, MaxRating: 1400}},
+	}
+
+	for _, v := range tests {
+		if _, err := JoinQueue(ctx, first.GetKey().Encode(), tictactoe.GameType, v.opts); err == nil {
+			t.Fatalf("JoinQueue did not throw an error for a %s.", v.name)
+		}
+	}
+
+	ticket, err := JoinQueue(ctx, first.GetKey().Encode(), tictactoe.GameType, Options{})
+	if err != nil {
+		t.Fatalf("JoinQueue threw an error: %v", err)
+	}
+	if ticket.Status != model.TicketWaiting || ticket.Rating != model.DefaultRating {
+		t.Fatalf("JoinQueue matched a player by themselves. Got: %+v", ticket)
+	}
+
+	// the picky player will not accept the first player's rating
+	if ticket, err = JoinQueue(ctx, picky.GetKey().Encode(), tictactoe.GameType, Options{MinRating: 2000}); err != nil {
+		t.Fatalf("JoinQueue threw an error: %v", err)
+	}
+	if ticket.Status != model.TicketWaiting {
+		t.Fatalf("JoinQueue matched players outside of the rating range. Got: %+v", ticket)
+	}
+
+	if ticket, err = JoinQueue(ctx, second.GetKey().Encode(), tictactoe.GameType, Options{}); err != nil {
+		t.Fatalf("JoinQueue threw an error: %v", err)
+	}
+	if ticket.Status != model.TicketMatched || ticket.GameKey == nil {
+		t.Fatalf("JoinQueue did not match the players. Got: %+v", ticket)
+	}
+
+	// the first player finds the game by polling
+	polled, err := PollQueue(ctx, first.GetKey().Encode())
+	if err != nil {
+		t.Fatalf("PollQueue threw an error: %v", err)
+	}
+	if polled.Status != model.TicketMatched || !polled.GameKey.Equal(ticket.GameKey) {
+		t.Fatalf("PollQueue did not return the match. Got: %+v", polled)
+	}
+
+	var g model.Game
+	if err = g.ByID(ctx, ticket.GameKey.IntID()); err != nil {
+		t.Fatalf("JoinQueue did not create the game. Error: %v", err)
+	}
+	if g.Status != model.GameInProgress || !g.CreatorKey.Equal(first.GetKey()) {
+		t.Fatalf("JoinQueue did not start the game for the longest waiting player. Got: %+v", g)
+	}
+
+	var seats model.SeatList
+	if err = seats.ByGame(ctx, g.GetKey()); err != nil {
+		t.Fatalf("SeatList.ByGame threw an error: %v", err)
+	}
+	if len(seats) != 2 {
+		t.Fatalf("JoinQueue did not seat both players. Got: %+v", seats)
+	}
+	if _, found := seats.Find(picky.GetKey()); found {
+		t.Fatal("JoinQueue seated the picky player.")
+	}
+}
+
+func TestLeaveQueue(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	player := storetest.SavePlayer(ctx, t)
+
+	if err := LeaveQueue(ctx, player.GetKey().Encode()); err == nil {
+		t.Fatal("LeaveQueue did not throw an error for a player that is not in the queue.")
+	}
+
+	if _, err := JoinQueue(ctx, player.GetKey().Encode(), tictactoe.GameType, Options{}); err != nil {
+		t.Fatalf("JoinQueue threw an error: %v", err)
+	}
+
+	if err := LeaveQueue(ctx, player.GetKey().Encode()); err != nil {
+		t.Fatalf("LeaveQueue threw an error: %v", err)
+	}
+
+	_, err := PollQueue(ctx, player.GetKey().Encode())
+	if e, ok := err.(game.Error); !ok || e.Code() != http.StatusNotFound {
+		t.Fatalf("PollQueue did not throw a 404 after leaving the queue. Error: %v", err)
+	}
+
+	// nobody is waiting to be matched with
+	other := storetest.SavePlayer(ctx, t)
+	ticket, err := JoinQueue(ctx, other.GetKey().Encode(), tictactoe.GameType, Options{})
+	if err != nil {
+		t.Fatalf("JoinQueue threw an error: %v", err)
+	}
+	if ticket.Status != model.TicketWaiting {
+		t.Fatalf("JoinQueue matched a player that left the queue. Got: %+v", ticket)
+	}
+}
+
+func TestQueueRace(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	players := make([]model.Player, 6)
+	for k := range players {
+		players[k] = storetest.SavePlayer(ctx, t)
+	}
+
+	var wg sync.WaitGroup
+	for _, v := range players {
+		wg.Add(1)
+		go func(playerID string) {
+			defer wg.Done()
+			if _, err := JoinQueue(ctx, playerID, tictactoe.GameType, Options{}); err != nil {
+				t.Errorf("JoinQueue threw an error: %v", err)
+			}
+		}(v.GetKey().Encode())
+	}
+	wg.Wait()
+
+	matched := make(map[int64]int)
+	for _, v := range players {
+		ticket, err := PollQueue(ctx, v.GetKey().Encode())
+		if err != nil {
+			t.Fatalf("PollQueue threw an error: %v", err)
+		}
+
+		if ticket.Status == model.TicketMatched {
+			matched[ticket.GameKey.IntID()]++
+		}
+	}
+
+	for id, num := range matched {
+		var g model.Game
+		if err := g.ByID(ctx, id); err != nil {
+			t.Fatalf("Game.ByID threw an error: %v", err)
+		}
+
+		var seats model.SeatList
+		if err := seats.ByGame(ctx, g.GetKey()); err != nil {
+			t.Fatalf("SeatList.ByGame threw an error: %v", err)
+		}
+
+		if num != 2 || len(seats) != 2 {
+			t.Fatalf("JoinQueue matched the wrong players into game %d. Tickets: %d; Seats: %d", id, num, len(seats))
+		}
+	}
+
+	// a match that fell through does not leave its game behind
+	var open model.GameList
+	if err := open.ByStatus(ctx, model.GameOpen, tictactoe.GameType); err != nil {
+		t.Fatalf("GameList.ByStatus threw an error: %v", err)
+	}
+	if len(open) != 0 {
+		t.Fatalf("JoinQueue left games behind. Got: %+v", open)
+	}
+}
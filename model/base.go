@@ -42,7 +42,7 @@ func (m *Base) SetIsNew(isNew bool) {
 }
 
 // PreSave sets some basic info before continuing on to Save
-// PreSave is called in db.Save, and if an error is returned,
+// PreSave is called in store.Save, and if an error is returned,
 // will halt saving the struct
 func (m *Base) PreSave(ctx context.Context) error {
 	return nil
@@ -73,7 +73,7 @@ func (m *Base) Transform(ctx context.Context, pl datastore.PropertyList) error {
 
 // PreDelete performs any tasks need before the struct is
 // deleted from the datastore.
-// PreDelete gets called in db.Delete, and if an error is returned,
+// PreDelete gets called in store.Delete, and if an error is returned,
 // will halt deletion of the struct
 func (m *Base) PreDelete(ctx context.Context) error {
 	return nil
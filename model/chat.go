@@ -2,20 +2,49 @@ package model
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/benjamw/golibs/db"
 	"google.golang.org/appengine/datastore"
 
 	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/store"
 )
 
+// The types of chat
+const (
+	ChatMessage = "message" // a message posted by a player
+	ChatSystem  = "system"  // an event posted by the game, without a player
+)
+
+// Chat is a message posted to a room
+// An edited chat keeps its earlier messages as ChatEdits, and a deleted chat is kept with Deleted set
+// System chats are posted by the game, and hold the Event with its JSON encoded Data so clients can
+// render or localize it, with Message as the plain text to show when they can't
 type Chat struct {
 	Base
-	RoomKey   *datastore.Key
-	PlayerKey *datastore.Key
-	Message   string
-	Created   time.Time
+	RoomKey    *datastore.Key
+	PlayerKey  *datastore.Key // nil for system chats
+	Type       string         // ChatMessage if empty
+	Event      string         // the kind of system event, such as "game_over"
+	Data       string         `datastore:",noindex"` // the JSON encoded details of the system event
+	Message    string
+	Created    time.Time
+	Edited     time.Time      // when the message was last edited, zero if never
+	Deleted    time.Time      // when the chat was deleted, zero if not
+	DeleterKey *datastore.Key // the player who deleted the chat, the author or an admin
+
+	// Muted is set on chats from a player the reader has muted
+	Muted bool `datastore:"-" json:"-"`
+
+	// Reactions holds the number of reactions with each emoji, once loaded with ChatList.LoadReactions
+	Reactions map[string]int `datastore:"-" json:"-"`
+
+	// indexed is the message as it is in the search index, so saves that don't change it skip the index
+	indexed string `datastore:"-"`
 }
 
 const chatEntityType = "Chat"
@@ -36,18 +65,27 @@ func (m *Chat) PreSave(ctx context.Context) error {
 		m.SetKey(datastore.NewIncompleteKey(ctx, m.EntityType(), m.RoomKey))
 	}
 
-	if m.PlayerKey == nil {
-		return &db.MissingRequiredError{"PlayerKey"}
-	}
+	if m.IsSystem() {
+		if m.Event == "" {
+			return &db.MissingRequiredError{"Event"}
+		}
+	} else {
+		if m.PlayerKey == nil {
+			return &db.MissingRequiredError{"PlayerKey"}
+		}
 
-	if m.Message == "" {
-		return &db.MissingRequiredError{"Message"}
+		if m.Message == "" {
+			return &db.MissingRequiredError{"Message"}
+		}
 	}
 
 	if m.Created.IsZero() {
 		m.Created = game.Now(ctx)
 	}
 
+	// the datastore keeps microseconds, so cursors match the stored time
+	m.Created = m.Created.Truncate(time.Microsecond)
+
 	return nil
 }
 
@@ -59,31 +97,293 @@ func (m *Chat) PostLoad(ctx context.Context) error {
 
 	m.RoomKey = m.key.Parent()
 
+	if !m.IsDeleted() {
+		m.indexed = m.Message
+	}
+
 	return nil
 }
 
+// PostSave updates the chat's entries in the search index when its message changes
+// A deleted chat is dropped from the index
+func (m *Chat) PostSave(ctx context.Context) (myerr error) {
+	if m.IsDeleted() {
+		if myerr = m.unindex(ctx); myerr != nil {
+			return
+		}
+
+		m.indexed = ""
+		return
+	}
+
+	if m.Message == m.indexed {
+		return
+	}
+
+	terms := Terms(m.Message)
+	if len(terms) > maxChatTerms {
+		terms = terms[:maxChatTerms]
+	}
+
+	// a new chat has nothing in the index yet, and an edited one keeps the terms it still has
+	var old ChatTermList
+	if !m.IsNew() || m.indexed != "" {
+		if myerr = old.ByChat(ctx, m.GetKey()); myerr != nil {
+			return
+		}
+	}
+
+	keep := make(map[string]bool, len(terms))
+	for _, v := range terms {
+		keep[v] = true
+	}
+
+	had := make(map[string]bool, len(old))
+	var stale []db.Model
+	for k := range old {
+		had[old[k].Term] = true
+		if !keep[old[k].Term] {
+			stale = append(stale, &old[k])
+		}
+	}
+
+	if len(stale) > 0 {
+		if myerr = store.DeleteMulti(ctx, stale); myerr != nil {
+			return
+		}
+	}
+
+	var added []db.Model
+	for _, v := range terms {
+		if had[v] {
+			continue
+		}
+
+		added = append(added, &ChatTerm{
+			ChatKey:   m.GetKey(),
+			Term:      v,
+			PlayerKey: m.PlayerKey,
+			Created:   m.Created,
+		})
+	}
+
+	if len(added) > 0 {
+		if myerr = store.SaveMulti(ctx, added); myerr != nil {
+			return
+		}
+	}
+
+	m.indexed = m.Message
+
+	return
+}
+
+// PreDelete deletes the chat's edit history, reactions and search index entries along with it
+func (m *Chat) PreDelete(ctx context.Context) (myerr error) {
+	if myerr = m.unindex(ctx); myerr != nil {
+		return
+	}
+
+	var edits ChatEditList
+	if myerr = edits.ByChat(ctx, m.GetKey()); myerr != nil {
+		return
+	}
+
+	ms := make([]db.Model, 0, len(edits))
+	for k := range edits {
+		ms = append(ms, &edits[k])
+	}
+
+	var reactions ReactionList
+	if myerr = reactions.ByChat(ctx, m.GetKey()); myerr != nil {
+		return
+	}
+
+	for k := range reactions {
+		ms = append(ms, &reactions[k])
+	}
+
+	myerr = store.DeleteMulti(ctx, ms)
+
+	return
+}
+
+// unindex deletes the chat's entries in the search index
+func (m *Chat) unindex(ctx context.Context) (myerr error) {
+	var terms ChatTermList
+	if myerr = terms.ByChat(ctx, m.GetKey()); myerr != nil {
+		return
+	}
+
+	ms := make([]db.Model, 0, len(terms))
+	for k := range terms {
+		ms = append(ms, &terms[k])
+	}
+
+	myerr = store.DeleteMulti(ctx, ms)
+
+	return
+}
+
+// ChatType returns the type of the chat
+func (m *Chat) ChatType() string {
+	if m.Type == "" {
+		return ChatMessage
+	}
+
+	return m.Type
+}
+
+// IsSystem returns true if the chat was posted by the game instead of a player
+func (m *Chat) IsSystem() bool {
+	return m.Type == ChatSystem
+}
+
+// AuthorID returns the encoded key of the player who posted the chat, or an empty string for system chats
+func (m *Chat) AuthorID() string {
+	if m.PlayerKey == nil {
+		return ""
+	}
+
+	return m.PlayerKey.Encode()
+}
+
+// IsDeleted returns true if the chat has been deleted
+func (m *Chat) IsDeleted() bool {
+	return !m.Deleted.IsZero()
+}
+
+// Cursor returns the position of the chat in its room, used to read on from the chat
+// The cursor is opaque to clients; it holds the time and key of the chat
+func (m *Chat) Cursor() string {
+	return strconv.FormatInt(m.Created.UnixNano()/1e3, 10) + "." + m.key.Encode()
+}
+
+// ParseChatCursor returns the time and key of the chat the cursor points to
+func ParseChatCursor(cursor string) (created time.Time, key *datastore.Key, myerr error) {
+	parts := strings.SplitN(cursor, ".", 2)
+	if len(parts) != 2 {
+		myerr = errors.New("invalid chat cursor")
+		return
+	}
+
+	us, myerr := strconv.ParseInt(parts[0], 10, 64)
+	if myerr != nil {
+		return
+	}
+
+	if key, myerr = datastore.DecodeKey(parts[1]); myerr != nil {
+		return
+	}
+
+	created = time.Unix(0, us*1e3)
+
+	return
+}
+
 // ChatList is a slice of related Chats
 type ChatList []Chat
 
-// ByRoomID loads all the chats for the room with the given ID
+// ByRoomID loads all the chats for the lobby (ID 0) or the room of the game with the given ID
 func (l *ChatList) ByRoomID(ctx context.Context, id int64) (myerr error) {
-	key := makeRoomKey(ctx, id)
+	var room Room
+	if myerr = room.ByID(ctx, id); myerr != nil {
+		return
+	}
 
-	var chats []Chat
-	var keys []*datastore.Key
-	keys, myerr = datastore.NewQuery(chatEntityType).
-		Ancestor(key).
-		Order("-Created"). // DESC
-		GetAll(ctx, &chats)
-	if myerr != nil {
+	return l.ByRoom(ctx, room.GetKey())
+}
+
+// ByRoom loads all the chats for the room with the given key, newest first
+func (l *ChatList) ByRoom(ctx context.Context, roomKey *datastore.Key) (myerr error) {
+	query := store.NewQuery(chatEntityType).
+		Ancestor(roomKey).
+		Order("-Created") // DESC
+
+	*l, myerr = loadChats(ctx, query)
+
+	return
+}
+
+// ByRoomIDAfter loads all the chats for the room with the given ID that came in after the given time
+func (l *ChatList) ByRoomIDAfter(ctx context.Context, id int64, after time.Time) (myerr error) {
+	var room Room
+	if myerr = room.ByID(ctx, id); myerr != nil {
 		return
 	}
 
-	for k := range keys {
-		chats[k].SetKey(keys[k])
-		if myerr = chats[k].PostLoad(ctx); myerr != nil {
+	query := store.NewQuery(chatEntityType).
+		Ancestor(room.GetKey()).
+		Filter("Created >=", after).
+		Order("-Created") // DESC
+
+	*l, myerr = loadChats(ctx, query)
+
+	return
+}
+
+// ByRoomAndPlayer loads the chats the player posted in the room, newest first
+// The chats can be limited to those posted from (inclusive) and to (exclusive) the given times (if not zero)
+func (l *ChatList) ByRoomAndPlayer(ctx context.Context, roomKey, playerKey *datastore.Key, from, to time.Time) (myerr error) {
+	query := store.NewQuery(chatEntityType).
+		Ancestor(roomKey).
+		Filter("PlayerKey =", playerKey)
+
+	if !from.IsZero() {
+		query = query.Filter("Created >=", from)
+	}
+
+	if !to.IsZero() {
+		query = query.Filter("Created <", to)
+	}
+
+	*l, myerr = loadChats(ctx, query.Order("-Created")) // DESC
+
+	return
+}
+
+// ByRoomAndPlayerPage loads at most limit of the chats the player posted in the room, newest first,
+// limited to those posted from (inclusive) and to (exclusive) the given times (if not zero),
+// and to the chats older than before (if set)
+func (l *ChatList) ByRoomAndPlayerPage(ctx context.Context, roomKey, playerKey *datastore.Key, from, to time.Time, before ChatPosition, limit int) (myerr error) {
+	query := store.NewQuery(chatEntityType).
+		Ancestor(roomKey).
+		Filter("PlayerKey =", playerKey)
+
+	if !from.IsZero() {
+		query = query.Filter("Created >=", from)
+	}
+
+	// the chats posted at the same time as the position come first, read on from its key
+	var chats ChatList
+	if before.Key != nil {
+		chats, myerr = loadChats(ctx, query.
+			Filter("Created =", before.Created).
+			Filter(store.KeyField+" <", before.Key).
+			Order("-"+store.KeyField). // DESC
+			Limit(limit))
+		if myerr != nil {
+			return
+		}
+	}
+
+	if len(chats) < limit {
+		rest := query
+		if !to.IsZero() {
+			rest = rest.Filter("Created <", to)
+		}
+
+		if !before.Created.IsZero() {
+			rest = rest.Filter("Created <", before.Created)
+		}
+
+		var past ChatList
+		past, myerr = loadChats(ctx, rest.Order("-Created").Order("-"+store.KeyField).Limit(limit-len(chats))) // DESC
+		if myerr != nil {
 			return
 		}
+
+		chats = append(chats, past...)
 	}
 
 	*l = chats
@@ -91,18 +391,112 @@ func (l *ChatList) ByRoomID(ctx context.Context, id int64) (myerr error) {
 	return
 }
 
-// ByRoomIDAfter loads all the chats for the room with the given ID that came in after the given time
-func (l *ChatList) ByRoomIDAfter(ctx context.Context, id int64, after time.Time) (myerr error) {
-	key := makeRoomKey(ctx, id)
+// ChatPosition is a place in a room to read on from: the time a chat was posted, and the chat's key
+// Chats posted at the same time are read in key order, so paging never skips or repeats them
+// Without a key, the chats posted at the time itself are not read
+type ChatPosition struct {
+	Created time.Time
+	Key     *datastore.Key
+}
+
+// ByRoomPage loads a page of at most limit chats for the room with the given key, newest first
+// If before is set, the page holds the newest chats older than before,
+// else if after is set, the page holds the oldest chats newer than after,
+// else the page holds the newest chats in the room
+// more is true if there are more chats past the page in the direction being read
+func (l *ChatList) ByRoomPage(ctx context.Context, roomKey *datastore.Key, before, after ChatPosition, limit int) (more bool, myerr error) {
+	query := store.NewQuery(chatEntityType).
+		Ancestor(roomKey)
+
+	pos, desc := before, true
+	if before.Created.IsZero() && !after.Created.IsZero() {
+		pos, desc = after, false
+	}
 
-	var chats []Chat
+	timeOp, keyOp, timeOrder, keyOrder := "<", "<", "-Created", "-"+store.KeyField // DESC
+	if !desc {
+		timeOp, keyOp, timeOrder, keyOrder = ">", ">", "Created", store.KeyField
+	}
+
+	// the chats posted at the same time as the position come first, read on from its key
+	var chats ChatList
+	if pos.Key != nil {
+		chats, myerr = loadChats(ctx, query.
+			Filter("Created =", pos.Created).
+			Filter(store.KeyField+" "+keyOp, pos.Key).
+			Order(keyOrder).
+			Limit(limit+1))
+		if myerr != nil {
+			return
+		}
+	}
+
+	if len(chats) <= limit {
+		rest := query
+		if !pos.Created.IsZero() {
+			rest = rest.Filter("Created "+timeOp, pos.Created)
+		}
+
+		var past ChatList
+		past, myerr = loadChats(ctx, rest.Order(timeOrder).Order(keyOrder).Limit(limit+1-len(chats)))
+		if myerr != nil {
+			return
+		}
+
+		chats = append(chats, past...)
+	}
+
+	if len(chats) > limit {
+		more = true
+		chats = chats[:limit]
+	}
+
+	if !desc {
+		for i, j := 0, len(chats)-1; i < j; i, j = i+1, j-1 {
+			chats[i], chats[j] = chats[j], chats[i]
+		}
+	}
+
+	*l = chats
+
+	return
+}
+
+// ByKeys loads the chats with the given keys, in the same order
+func (l *ChatList) ByKeys(ctx context.Context, keys []*datastore.Key) (myerr error) {
+	chats := make(ChatList, len(keys))
+	ms := make([]db.Model, len(keys))
+	for k := range chats {
+		ms[k] = &chats[k]
+	}
+
+	if myerr = store.LoadMulti(ctx, keys, ms); myerr != nil {
+		return
+	}
+
+	*l = chats
+
+	return
+}
+
+// LoadReactions loads the reaction counts of each chat in the list
+func (l ChatList) LoadReactions(ctx context.Context) (myerr error) {
+	for k := range l {
+		var reactions ReactionList
+		if myerr = reactions.ByChat(ctx, l[k].GetKey()); myerr != nil {
+			return
+		}
+
+		l[k].Reactions = reactions.Counts()
+	}
+
+	return
+}
+
+// loadChats runs the query and loads the chats it finds
+func loadChats(ctx context.Context, query *store.Query) (chats ChatList, myerr error) {
 	var keys []*datastore.Key
-	keys, myerr = datastore.NewQuery(chatEntityType).
-		Ancestor(key).
-		Filter("Created >=", after).
-		Order("-Created"). // DESC
-		GetAll(ctx, &chats)
-	if myerr != nil {
+	if keys, myerr = query.GetAll(ctx, &chats); myerr != nil {
 		return
 	}
 
@@ -113,7 +507,5 @@ func (l *ChatList) ByRoomIDAfter(ctx context.Context, id int64, after time.Time)
 		}
 	}
 
-	*l = chats
-
 	return
 }
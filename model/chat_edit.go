@@ -0,0 +1,83 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/store"
+)
+
+// ChatEdit is an earlier version of an edited chat, kept as the chat's edit history
+type ChatEdit struct {
+	Base
+	ChatKey *datastore.Key `datastore:"-" json:"-"`
+	Message string         `json:"message"` // the message before the edit
+	Edited  time.Time      `json:"edited"`  // when the message was replaced
+}
+
+const chatEditEntityType = "ChatEdit"
+
+// EntityType returns the entity type
+func (m *ChatEdit) EntityType() string {
+	return chatEditEntityType
+}
+
+// PreSave sets some basic info before continuing on to Save
+func (m *ChatEdit) PreSave(ctx context.Context) error {
+	if m.GetKey() == nil {
+		if m.ChatKey == nil {
+			return &db.MissingParentKeyError{}
+		}
+
+		m.SetIsNew(true)
+		m.SetKey(datastore.NewIncompleteKey(ctx, m.EntityType(), m.ChatKey))
+	}
+
+	if m.Edited.IsZero() {
+		m.Edited = game.Now(ctx)
+	}
+
+	return nil
+}
+
+// PostLoad populates the parent key from the loaded record's key
+func (m *ChatEdit) PostLoad(ctx context.Context) error {
+	if err := m.Base.PostLoad(ctx); err != nil {
+		return err
+	}
+
+	m.ChatKey = m.key.Parent()
+
+	return nil
+}
+
+// ChatEditList is a slice of related ChatEdits
+type ChatEditList []ChatEdit
+
+// ByChat loads the edit history of the chat, oldest first
+func (l *ChatEditList) ByChat(ctx context.Context, chatKey *datastore.Key) (myerr error) {
+	var edits []ChatEdit
+	var keys []*datastore.Key
+	keys, myerr = store.NewQuery(chatEditEntityType).
+		Ancestor(chatKey).
+		Order("Edited").
+		GetAll(ctx, &edits)
+	if myerr != nil {
+		return
+	}
+
+	for k := range keys {
+		edits[k].SetKey(keys[k])
+		if myerr = edits[k].PostLoad(ctx); myerr != nil {
+			return
+		}
+	}
+
+	*l = edits
+
+	return
+}
@@ -0,0 +1,125 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/store"
+)
+
+// ChatSeen marks the newest chat a player has seen in a room
+// A player has one marker per room, so the key is named by the room ID and has the player as the parent
+type ChatSeen struct {
+	Base
+	PlayerKey           *datastore.Key `datastore:"-" json:"-"`
+	RoomKey             *datastore.Key `json:"-"`
+	LastMessageSeenDate time.Time      `json:"last_message_seen_date"` // the time of the newest chat seen
+	DateSeen            time.Time      `json:"date_seen"`              // when the player last read the room
+}
+
+const chatSeenEntityType = "ChatSeen"
+
+// EntityType returns the entity type
+func (m *ChatSeen) EntityType() string {
+	return chatSeenEntityType
+}
+
+// PreSave sets some basic info before continuing on to Save
+func (m *ChatSeen) PreSave(ctx context.Context) error {
+	if m.GetKey() == nil {
+		if m.PlayerKey == nil {
+			return &db.MissingParentKeyError{}
+		}
+
+		if m.RoomKey == nil {
+			return &db.MissingRequiredError{"RoomKey"}
+		}
+
+		m.SetIsNew(true)
+		m.SetKey(makeChatSeenKey(ctx, m.PlayerKey, m.RoomKey))
+	}
+
+	if m.DateSeen.IsZero() {
+		m.DateSeen = game.Now(ctx)
+	}
+
+	return nil
+}
+
+// PostLoad populates the parent key from the loaded record's key
+func (m *ChatSeen) PostLoad(ctx context.Context) error {
+	if err := m.Base.PostLoad(ctx); err != nil {
+		return err
+	}
+
+	m.PlayerKey = m.key.Parent()
+
+	return nil
+}
+
+// ByRoom loads the player's marker for the room
+// If the player has not read the room, the marker is left unsaved with a zero LastMessageSeenDate
+func (m *ChatSeen) ByRoom(ctx context.Context, playerKey, roomKey *datastore.Key) (myerr error) {
+	seen := ChatSeen{}
+	if myerr = store.Load(ctx, makeChatSeenKey(ctx, playerKey, roomKey), &seen); myerr != nil {
+		if _, ok := myerr.(*db.UnfoundObjectError); !ok {
+			return
+		}
+
+		myerr = nil
+		seen = ChatSeen{
+			PlayerKey: playerKey,
+			RoomKey:   roomKey,
+		}
+	}
+
+	*m = seen
+
+	return
+}
+
+// makeChatSeenKey names the marker for the whole room key, as rooms under different games or players share IDs
+func makeChatSeenKey(ctx context.Context, playerKey, roomKey *datastore.Key) *datastore.Key {
+	return datastore.NewKey(ctx, chatSeenEntityType, roomKey.Encode(), 0, playerKey)
+}
+
+// ChatSeenList is a slice of related ChatSeens
+type ChatSeenList []ChatSeen
+
+// ByPlayer loads all the player's markers, one for each room the player has read
+func (l *ChatSeenList) ByPlayer(ctx context.Context, playerKey *datastore.Key) (myerr error) {
+	query := store.NewQuery(chatSeenEntityType).
+		Ancestor(playerKey)
+
+	var seen ChatSeenList
+	var keys []*datastore.Key
+	if keys, myerr = query.GetAll(ctx, &seen); myerr != nil {
+		return
+	}
+
+	for k := range keys {
+		seen[k].SetKey(keys[k])
+		if myerr = seen[k].PostLoad(ctx); myerr != nil {
+			return
+		}
+	}
+
+	*l = seen
+
+	return
+}
+
+// Find returns the marker for the room with the given key
+func (l ChatSeenList) Find(roomKey *datastore.Key) (*ChatSeen, bool) {
+	for k := range l {
+		if l[k].RoomKey.Equal(roomKey) {
+			return &l[k], true
+		}
+	}
+
+	return nil, false
+}
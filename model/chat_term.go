@@ -0,0 +1,224 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/store"
+)
+
+// The limits on the terms indexed for a chat
+const (
+	minTermLength = 2  // shorter words are not indexed
+	maxTermLength = 32 // longer words are cut to this many runes
+	maxChatTerms  = 64 // the most distinct terms indexed per chat
+)
+
+// ChatTerm is an entry in the search index of the chats: a term found in a chat
+// A chat has one entry per distinct term, so the key is named by the term and has the chat as the parent
+// The author and time are copied from the chat so searches can filter on them
+type ChatTerm struct {
+	Base
+	ChatKey   *datastore.Key `datastore:"-" json:"-"`
+	Term      string         `json:"term"`
+	PlayerKey *datastore.Key `json:"-"`
+	Created   time.Time      `json:"created"`
+}
+
+const chatTermEntityType = "ChatTerm"
+
+// EntityType returns the entity type
+func (m *ChatTerm) EntityType() string {
+	return chatTermEntityType
+}
+
+// PreSave sets some basic info before continuing on to Save
+func (m *ChatTerm) PreSave(ctx context.Context) error {
+	if m.GetKey() == nil {
+		if m.ChatKey == nil {
+			return &db.MissingParentKeyError{}
+		}
+
+		if m.Term == "" {
+			return &db.MissingRequiredError{"Term"}
+		}
+
+		m.SetIsNew(true)
+		m.SetKey(makeChatTermKey(ctx, m.ChatKey, m.Term))
+	}
+
+	return nil
+}
+
+// PostLoad populates the parent key from the loaded record's key
+func (m *ChatTerm) PostLoad(ctx context.Context) error {
+	if err := m.Base.PostLoad(ctx); err != nil {
+		return err
+	}
+
+	m.ChatKey = m.key.Parent()
+
+	return nil
+}
+
+// ChatTermList is a slice of related ChatTerms
+type ChatTermList []ChatTerm
+
+// ByChat loads the index entries of the chat
+func (l *ChatTermList) ByChat(ctx context.Context, chatKey *datastore.Key) (myerr error) {
+	return l.load(ctx, store.NewQuery(chatTermEntityType).
+		Ancestor(chatKey),
+	)
+}
+
+// Search loads at most limit (if not 0) index entries for the term in the room, newest first
+// The entries can be limited to one author (if playerKey is not nil), to the chats posted
+// from (inclusive) and to (exclusive) the given times (if not zero), and to the chats older than before (if set)
+func (l *ChatTermList) Search(ctx context.Context, roomKey *datastore.Key, term string, playerKey *datastore.Key, from, to time.Time, before ChatPosition, limit int) (myerr error) {
+	query := store.NewQuery(chatTermEntityType).
+		Ancestor(roomKey).
+		Filter("Term =", term)
+
+	if playerKey != nil {
+		query = query.Filter("PlayerKey =", playerKey)
+	}
+
+	if !from.IsZero() {
+		query = query.Filter("Created >=", from)
+	}
+
+	// the entries of the chats posted at the same time as the position come first, read on from its key
+	var entries ChatTermList
+	if before.Key != nil {
+		if myerr = entries.load(ctx, query.
+			Filter("Created =", before.Created).
+			Filter(store.KeyField+" <", makeChatTermKey(ctx, before.Key, term)).
+			Order("-"+store.KeyField). // DESC
+			Limit(limit)); myerr != nil {
+			return
+		}
+	}
+
+	if limit == 0 || len(entries) < limit {
+		rest := query
+		if !to.IsZero() {
+			rest = rest.Filter("Created <", to)
+		}
+
+		if !before.Created.IsZero() {
+			rest = rest.Filter("Created <", before.Created)
+		}
+
+		if limit > 0 {
+			rest = rest.Limit(limit - len(entries))
+		}
+
+		var past ChatTermList
+		if myerr = past.load(ctx, rest.Order("-Created").Order("-"+store.KeyField)); myerr != nil { // DESC
+			return
+		}
+
+		entries = append(entries, past...)
+	}
+
+	*l = entries
+
+	return
+}
+
+// load runs the query and loads the entries it finds
+func (l *ChatTermList) load(ctx context.Context, query *store.Query) (myerr error) {
+	var terms []ChatTerm
+	var keys []*datastore.Key
+	if keys, myerr = query.GetAll(ctx, &terms); myerr != nil {
+		return
+	}
+
+	for k := range keys {
+		terms[k].SetKey(keys[k])
+		if myerr = terms[k].PostLoad(ctx); myerr != nil {
+			return
+		}
+	}
+
+	*l = terms
+
+	return
+}
+
+// makeChatTermKey names the index entry by its term, under the chat
+func makeChatTermKey(ctx context.Context, chatKey *datastore.Key, term string) *datastore.Key {
+	return datastore.NewKey(ctx, chatTermEntityType, term, 0, chatKey)
+}
+
+// TermSpan is a search term found in a text, and where it was found
+type TermSpan struct {
+	Term  string
+	Start int // the byte offset of the word in the text
+	End   int // the byte offset just past the word
+}
+
+// TermSpans splits the text into words and returns the search term of each word long enough to index
+// Terms are lowercased words of letters and digits, cut to maxTermLength runes
+func TermSpans(text string) (spans []TermSpan) {
+	start := -1
+	for i, r := range text + " " {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+
+			continue
+		}
+
+		if start < 0 {
+			continue
+		}
+
+		if term := normalizeTerm(text[start:i]); term != "" {
+			spans = append(spans, TermSpan{
+				Term:  term,
+				Start: start,
+				End:   i,
+			})
+		}
+		start = -1
+	}
+
+	return
+}
+
+// Terms returns the distinct search terms in the text, in the order they are found
+func Terms(text string) (terms []string) {
+	found := make(map[string]bool)
+	for _, v := range TermSpans(text) {
+		if found[v.Term] {
+			continue
+		}
+		found[v.Term] = true
+
+		terms = append(terms, v.Term)
+	}
+
+	return
+}
+
+// normalizeTerm returns the search term for the word, or an empty string if the word is too short
+func normalizeTerm(word string) string {
+	if utf8.RuneCountInString(word) < minTermLength {
+		return ""
+	}
+
+	word = strings.ToLower(word)
+	if runes := []rune(word); len(runes) > maxTermLength {
+		word = string(runes[:maxTermLength])
+	}
+
+	return word
+}
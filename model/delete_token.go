@@ -8,6 +8,7 @@ import (
 	"google.golang.org/appengine/datastore"
 
 	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/store"
 	"github.com/benjamw/golibs/db"
 	"github.com/benjamw/golibs/random"
 )
@@ -70,7 +71,7 @@ func (m *DeleteToken) ByValue(ctx context.Context, token string) (myerr error) {
 
 	var tokens []DeleteToken
 	var keys []*datastore.Key
-	keys, myerr = datastore.NewQuery(m.EntityType()).
+	keys, myerr = store.NewQuery(m.EntityType()).
 		Filter("Value =", token).
 		GetAll(ctx, &tokens)
 	if myerr != nil {
@@ -116,7 +117,7 @@ func (m *DeleteToken) ByValue(ctx context.Context, token string) (myerr error) {
 func (m *DeleteToken) ClearExisting(ctx context.Context, playerKey *datastore.Key) (num int, myerr error) {
 	var tokens []DeleteToken
 	var keys []*datastore.Key
-	keys, myerr = datastore.NewQuery(m.EntityType()).
+	keys, myerr = store.NewQuery(m.EntityType()).
 		Ancestor(playerKey).
 		GetAll(ctx, &tokens)
 	if myerr != nil {
@@ -130,7 +131,7 @@ func (m *DeleteToken) ClearExisting(ctx context.Context, playerKey *datastore.Ke
 			return
 		}
 
-		if myerr = db.Delete(ctx, &tokens[k]); myerr != nil {
+		if myerr = store.Delete(ctx, &tokens[k]); myerr != nil {
 			return
 		}
 
@@ -144,7 +145,7 @@ func (m *DeleteToken) ClearExisting(ctx context.Context, playerKey *datastore.Ke
 func (m *DeleteToken) ClearExpired(ctx context.Context) (num int, myerr error) {
 	var tokens []DeleteToken
 	var keys []*datastore.Key
-	keys, myerr = datastore.NewQuery(m.EntityType()).
+	keys, myerr = store.NewQuery(m.EntityType()).
 		Filter("Expires <", game.Now(ctx)).
 		GetAll(ctx, &tokens)
 	if myerr != nil {
@@ -158,7 +159,7 @@ func (m *DeleteToken) ClearExpired(ctx context.Context) (num int, myerr error) {
 			return
 		}
 
-		if myerr = db.Delete(ctx, &tokens[k]); myerr != nil {
+		if myerr = store.Delete(ctx, &tokens[k]); myerr != nil {
 			return
 		}
 
@@ -10,6 +10,7 @@ import (
 	"google.golang.org/appengine/datastore"
 
 	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/store"
 )
 
 // ForgotToken is an individual forgot password token for a player
@@ -69,7 +70,7 @@ func (m *ForgotToken) ByValue(ctx context.Context, token string) (myerr error) {
 
 	var tokens []ForgotToken
 	var keys []*datastore.Key
-	keys, myerr = datastore.NewQuery(m.EntityType()).
+	keys, myerr = store.NewQuery(m.EntityType()).
 		Filter("Value =", token).
 		GetAll(ctx, &tokens)
 	if myerr != nil {
@@ -130,7 +131,7 @@ func (m *ForgotToken) ByEmail(ctx context.Context, email string) (myerr error) {
 
 	var tokens []ForgotToken
 	var keys []*datastore.Key
-	keys, myerr = datastore.NewQuery(m.EntityType()).
+	keys, myerr = store.NewQuery(m.EntityType()).
 		Ancestor(player.GetKey()).
 		GetAll(ctx, &tokens)
 	if myerr != nil {
@@ -175,7 +176,7 @@ func (m *ForgotToken) ByEmail(ctx context.Context, email string) (myerr error) {
 func (m *ForgotToken) ClearExisting(ctx context.Context, playerKey *datastore.Key) (num int, myerr error) {
 	var tokens []ForgotToken
 	var keys []*datastore.Key
-	keys, myerr = datastore.NewQuery(m.EntityType()).
+	keys, myerr = store.NewQuery(m.EntityType()).
 		Ancestor(playerKey).
 		GetAll(ctx, &tokens)
 	if myerr != nil {
@@ -189,7 +190,7 @@ func (m *ForgotToken) ClearExisting(ctx context.Context, playerKey *datastore.Ke
 			return
 		}
 
-		if myerr = db.Delete(ctx, &tokens[k]); myerr != nil {
+		if myerr = store.Delete(ctx, &tokens[k]); myerr != nil {
 			return
 		}
 
@@ -203,7 +204,7 @@ func (m *ForgotToken) ClearExisting(ctx context.Context, playerKey *datastore.Ke
 func (m *ForgotToken) ClearExpired(ctx context.Context) (num int, myerr error) {
 	var tokens []ForgotToken
 	var keys []*datastore.Key
-	keys, myerr = datastore.NewQuery(m.EntityType()).
+	keys, myerr = store.NewQuery(m.EntityType()).
 		Filter("Expires <", game.Now(ctx)).
 		GetAll(ctx, &tokens)
 	if myerr != nil {
@@ -217,7 +218,7 @@ func (m *ForgotToken) ClearExpired(ctx context.Context) (num int, myerr error) {
 			return
 		}
 
-		if myerr = db.Delete(ctx, &tokens[k]); myerr != nil {
+		if myerr = store.Delete(ctx, &tokens[k]); myerr != nil {
 			return
 		}
 
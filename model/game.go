@@ -0,0 +1,241 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/store"
+)
+
+// The statuses a Game can be in
+const (
+	GameOpen       = "open"        // waiting for players to join
+	GameInProgress = "in_progress" // started and being played
+	GameFinished   = "finished"    // played to the end, or won by forfeit
+	GameAbandoned  = "abandoned"   // ended before anyone could win
+)
+
+// The kinds of turn timer a Game can have
+const (
+	TimerNone           = ""               // turns can take as long as they like
+	TimerCorrespondence = "correspondence" // TurnLimit is in days
+	TimerRealtime       = "realtime"       // TurnLimit is in seconds
+)
+
+// The policies for a player running out of time on their turn
+const (
+	TimeoutSkip    = "skip"    // the player passes, or forfeits if the rules do not allow passing
+	TimeoutForfeit = "forfeit" // the player forfeits the game
+	TimeoutRandom  = "random"  // a random move is made, or the player forfeits if the rules cannot pick one
+)
+
+// Game is a single game being played between players
+// The players are held in the Seats for the game
+type Game struct {
+	Base
+	ID         int64          `json:"id"`
+	Type       string         `json:"type"` // the kind of game being played (e.g.- "tictactoe")
+	Name       string         `json:"name"`
+	Status     string         `json:"status"`
+	CreatorKey *datastore.Key `json:"-"`
+	MinPlayers int64          `json:"min_players"`
+	MaxPlayers int64          `json:"max_players"`
+	Setup      string         `datastore:",noindex" json:"-"`     // the starting state, used to replay the moves
+	State      string         `datastore:",noindex" json:"state"` // serialized by the game.Rules for the game type
+	MoveCount  int64          `json:"move_count"`                 // the number of moves in the move log, including undone moves
+	UndoNumber int64          `json:"undo_number"`                // the move a player has asked to take back, if any
+	UndoKey    *datastore.Key `json:"-"`                          // the player asking to take back the move
+	TimerMode  string         `json:"timer_mode"`                 // one of the Timer* constants
+	TurnLimit  int64          `json:"turn_limit"`                 // the time allowed for each turn, in the units of the TimerMode
+	Timeout    string         `json:"timeout"`                    // one of the Timeout* constants
+	Deadline   time.Time      `json:"deadline"`                   // when the current turn runs out of time, zero if it can't
+	Created    time.Time      `json:"created"`
+	Started    time.Time      `json:"started"`
+	Finished   time.Time      `json:"finished"`
+}
+
+const gameEntityType = "Game"
+
+// EntityType returns the entity type
+func (m *Game) EntityType() string {
+	return gameEntityType
+}
+
+// PreSave sets some basic info before continuing on to Save
+func (m *Game) PreSave(ctx context.Context) error {
+	if m.GetKey() == nil {
+		m.SetIsNew(true)
+		m.SetKey(makeGameKey(ctx, m.ID))
+	}
+
+	if m.Type == "" {
+		return &db.MissingRequiredError{"Type"}
+	}
+
+	if m.CreatorKey == nil {
+		return &db.MissingRequiredError{"CreatorKey"}
+	}
+
+	if m.Status == "" {
+		m.Status = GameOpen
+	}
+
+	if m.Created.IsZero() {
+		m.Created = game.Now(ctx)
+	}
+
+	return nil
+}
+
+// PostSave sets the allocated ID after the struct is saved to the db
+func (m *Game) PostSave(ctx context.Context) error {
+	m.ID = m.key.IntID()
+
+	return nil
+}
+
+// PostLoad sets some data after the struct is loaded from the db
+func (m *Game) PostLoad(ctx context.Context) error {
+	if err := m.Base.PostLoad(ctx); err != nil {
+		return err
+	}
+
+	m.ID = m.key.IntID()
+
+	return nil
+}
+
+// ClearUndo clears any pending undo request
+func (m *Game) ClearUndo() {
+	m.UndoNumber = 0
+	m.UndoKey = nil
+}
+
+// TurnDuration returns the time allowed for each turn, or 0 if turns are not timed
+func (m *Game) TurnDuration() time.Duration {
+	switch m.TimerMode {
+	case TimerCorrespondence:
+		return time.Duration(m.TurnLimit) * 24 * time.Hour
+	case TimerRealtime:
+		return time.Duration(m.TurnLimit) * time.Second
+	}
+
+	return 0
+}
+
+// ResetDeadline starts the clock on a new turn at the given time
+// The deadline is cleared if the game is not in progress or turns are not timed
+func (m *Game) ResetDeadline(now time.Time) {
+	m.Deadline = time.Time{}
+
+	if d := m.TurnDuration(); d != 0 && m.Status == GameInProgress {
+		m.Deadline = now.Add(d)
+	}
+}
+
+// IsOver returns true if the game can no longer be played
+func (m *Game) IsOver() bool {
+	return m.Status == GameFinished || m.Status == GameAbandoned
+}
+
+// ByID loads the game with the given ID
+func (m *Game) ByID(ctx context.Context, id int64) (myerr error) {
+	key := makeGameKey(ctx, id)
+	g := Game{}
+	myerr = store.Load(ctx, key, &g)
+	if myerr != nil {
+		return
+	}
+
+	*m = g
+
+	return
+}
+
+func makeGameKey(ctx context.Context, id int64) *datastore.Key {
+	return datastore.NewKey(ctx, gameEntityType, "", id, nil)
+}
+
+// GameList is a slice of related Games
+type GameList []Game
+
+// ByStatus loads the games with the given status, newest first
+// If gameType is not empty, only games of that type are loaded
+func (l *GameList) ByStatus(ctx context.Context, status, gameType string) (myerr error) {
+	q := store.NewQuery(gameEntityType).
+		Filter("Status =", status)
+
+	if gameType != "" {
+		q = q.Filter("Type =", gameType)
+	}
+
+	q = q.Order("-Created") // DESC
+
+	var games []Game
+	var keys []*datastore.Key
+	keys, myerr = q.GetAll(ctx, &games)
+	if myerr != nil {
+		return
+	}
+
+	for k := range keys {
+		games[k].SetKey(keys[k])
+		if myerr = games[k].PostLoad(ctx); myerr != nil {
+			return
+		}
+	}
+
+	*l = games
+
+	return
+}
+
+// TimedOut loads the games in progress whose current turn ran out of time at or before the given time,
+// oldest deadline first, up to limit games (all of them if limit is 0)
+func (l *GameList) TimedOut(ctx context.Context, now time.Time, limit int) (myerr error) {
+	q := store.NewQuery(gameEntityType).
+		Filter("Status =", GameInProgress).
+		Filter("Deadline >", time.Time{}).
+		Filter("Deadline <=", now).
+		Order("Deadline")
+
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+
+	var games []Game
+	var keys []*datastore.Key
+	keys, myerr = q.GetAll(ctx, &games)
+	if myerr != nil {
+		return
+	}
+
+	for k := range keys {
+		games[k].SetKey(keys[k])
+		if myerr = games[k].PostLoad(ctx); myerr != nil {
+			return
+		}
+	}
+
+	*l = games
+
+	return
+}
+
+// ByKeys loads the games with the given keys, in the same order
+func (l *GameList) ByKeys(ctx context.Context, keys []*datastore.Key) (myerr error) {
+	games := make([]Game, len(keys))
+	for k := range keys {
+		if myerr = store.Load(ctx, keys[k], &games[k]); myerr != nil {
+			return
+		}
+	}
+
+	*l = games
+
+	return
+}
@@ -0,0 +1,127 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/store"
+)
+
+// Member is a player's membership in a private group or direct message room
+// A player can only be a member once, so the key is named by the player and has the room as the parent
+type Member struct {
+	Base
+	RoomKey   *datastore.Key `datastore:"-" json:"-"`
+	PlayerKey *datastore.Key `json:"-"`
+	Joined    time.Time      `json:"joined"`
+}
+
+const memberEntityType = "Member"
+
+// EntityType returns the entity type
+func (m *Member) EntityType() string {
+	return memberEntityType
+}
+
+// PreSave sets some basic info before continuing on to Save
+func (m *Member) PreSave(ctx context.Context) error {
+	if m.GetKey() == nil {
+		if m.RoomKey == nil {
+			return &db.MissingParentKeyError{}
+		}
+
+		if m.PlayerKey == nil {
+			return &db.MissingRequiredError{"PlayerKey"}
+		}
+
+		m.SetIsNew(true)
+		m.SetKey(makeMemberKey(ctx, m.RoomKey, m.PlayerKey))
+	}
+
+	if m.Joined.IsZero() {
+		m.Joined = game.Now(ctx)
+	}
+
+	return nil
+}
+
+// PostLoad populates the parent key from the loaded record's key
+func (m *Member) PostLoad(ctx context.Context) error {
+	if err := m.Base.PostLoad(ctx); err != nil {
+		return err
+	}
+
+	m.RoomKey = m.key.Parent()
+
+	return nil
+}
+
+// ByRoom loads the player's membership in the room
+func (m *Member) ByRoom(ctx context.Context, roomKey, playerKey *datastore.Key) (myerr error) {
+	member := Member{}
+	if myerr = store.Load(ctx, makeMemberKey(ctx, roomKey, playerKey), &member); myerr != nil {
+		return
+	}
+
+	*m = member
+
+	return
+}
+
+func makeMemberKey(ctx context.Context, roomKey, playerKey *datastore.Key) *datastore.Key {
+	return datastore.NewKey(ctx, memberEntityType, playerKey.Encode(), 0, roomKey)
+}
+
+// MemberList is a slice of related Members
+type MemberList []Member
+
+// ByRoom loads the members of the room, oldest first
+func (l *MemberList) ByRoom(ctx context.Context, roomKey *datastore.Key) (myerr error) {
+	return l.load(ctx, store.NewQuery(memberEntityType).
+		Ancestor(roomKey).
+		Order("Joined"),
+	)
+}
+
+// ByPlayer loads the player's memberships, newest first
+func (l *MemberList) ByPlayer(ctx context.Context, playerKey *datastore.Key) (myerr error) {
+	return l.load(ctx, store.NewQuery(memberEntityType).
+		Filter("PlayerKey =", playerKey).
+		Order("-Joined"), // DESC
+	)
+}
+
+// Find returns the membership of the given player
+func (l MemberList) Find(playerKey *datastore.Key) (*Member, bool) {
+	for k := range l {
+		if l[k].PlayerKey.Equal(playerKey) {
+			return &l[k], true
+		}
+	}
+
+	return nil, false
+}
+
+// load runs the query and loads the members it finds
+func (l *MemberList) load(ctx context.Context, query *store.Query) (myerr error) {
+	var members []Member
+	var keys []*datastore.Key
+	if keys, myerr = query.GetAll(ctx, &members); myerr != nil {
+		return
+	}
+
+	for k := range keys {
+		members[k].SetKey(keys[k])
+		if myerr = members[k].PostLoad(ctx); myerr != nil {
+			return
+		}
+	}
+
+	*l = members
+
+	return
+}
@@ -0,0 +1,124 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/store"
+)
+
+// Move is a single move made in a game
+// The moves for a game are numbered from 1, and the number is used as the key ID
+// so each move can only be stored once.
+// The moves are an append-only log; taking back a move marks it as Undone instead of deleting it
+type Move struct {
+	Base
+	GameKey   *datastore.Key `datastore:"-" json:"-"`
+	PlayerKey *datastore.Key `json:"-"`
+	Position  int64          `json:"position"` // the seat position of the player that moved
+	Number    int64          `json:"number"`
+	Data      string         `datastore:",noindex" json:"data"`  // the move, serialized by the game.Rules
+	State     string         `datastore:",noindex" json:"state"` // the game state after the move
+	Undone    bool           `json:"undone"`                     // the move was taken back, and is skipped when replaying
+	TimedOut  bool           `json:"timed_out"`                  // the move was made for the player when they ran out of time
+	Created   time.Time      `json:"created"`
+}
+
+const moveEntityType = "Move"
+
+// EntityType returns the entity type
+func (m *Move) EntityType() string {
+	return moveEntityType
+}
+
+// PreSave sets some basic info before continuing on to Save
+func (m *Move) PreSave(ctx context.Context) error {
+	if m.GetKey() == nil {
+		if m.GameKey == nil {
+			return &db.MissingParentKeyError{}
+		}
+
+		if m.Number < 1 {
+			return &db.MissingRequiredError{"Number"}
+		}
+
+		m.SetIsNew(true)
+		m.SetKey(datastore.NewKey(ctx, m.EntityType(), "", m.Number, m.GameKey))
+	}
+
+	if m.PlayerKey == nil {
+		return &db.MissingRequiredError{"PlayerKey"}
+	}
+
+	if m.Created.IsZero() {
+		m.Created = game.Now(ctx)
+	}
+
+	return nil
+}
+
+// PostLoad populates the parent key from the loaded record's key
+func (m *Move) PostLoad(ctx context.Context) error {
+	if err := m.Base.PostLoad(ctx); err != nil {
+		return err
+	}
+
+	m.GameKey = m.key.Parent()
+	m.Number = m.key.IntID()
+
+	return nil
+}
+
+// MoveList is a slice of related Moves
+type MoveList []Move
+
+// ByGame loads the moves for the given game, in the order they were made
+func (l *MoveList) ByGame(ctx context.Context, gameKey *datastore.Key) (myerr error) {
+	var moves []Move
+	var keys []*datastore.Key
+	keys, myerr = store.NewQuery(moveEntityType).
+		Ancestor(gameKey).
+		Order("Number").
+		GetAll(ctx, &moves)
+	if myerr != nil {
+		return
+	}
+
+	for k := range keys {
+		moves[k].SetKey(keys[k])
+		if myerr = moves[k].PostLoad(ctx); myerr != nil {
+			return
+		}
+	}
+
+	*l = moves
+
+	return
+}
+
+// Upto returns the moves up to and including the given move number
+func (l MoveList) Upto(number int64) MoveList {
+	moves := make(MoveList, 0, len(l))
+	for _, v := range l {
+		if v.Number <= number {
+			moves = append(moves, v)
+		}
+	}
+
+	return moves
+}
+
+// LastPlayed returns the last move that has not been undone
+func (l MoveList) LastPlayed() (move *Move, found bool) {
+	for k := len(l) - 1; k >= 0; k-- {
+		if !l[k].Undone {
+			return &l[k], true
+		}
+	}
+
+	return nil, false
+}
@@ -2,16 +2,31 @@ package model
 
 import (
 	"context"
+	"time"
 
 	"github.com/benjamw/golibs/db"
 	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/store"
+)
+
+// Mute scopes, from the most specific to the least
+const (
+	MuteRoom   = "room"
+	MuteGame   = "game"
+	MuteGlobal = "global"
 )
 
 // Mute is a muted player entry
+// A mute applies to a single room, to the room of a game, or to the whole site
+// An exempt entry unmutes the player in its scope while a broader mute applies
 type Mute struct {
 	Base
 	PlayerKey *datastore.Key `datastore:"-" json:"-"`
 	MutedKey  *datastore.Key `json:"-"`
+	ScopeKey  *datastore.Key `json:"-"` // the room or game the mute applies to, nil for the whole site
+	Expires   time.Time      // zero if the mute doesn't expire
+	Exempt    bool
 }
 
 // MuteList is a list of mutes
@@ -52,11 +67,28 @@ func (m *Mute) PostLoad(ctx context.Context) error {
 	return nil
 }
 
+// Scope returns the scope of the mute
+func (m *Mute) Scope() string {
+	switch {
+	case m.ScopeKey == nil:
+		return MuteGlobal
+	case m.ScopeKey.Kind() == gameEntityType:
+		return MuteGame
+	default:
+		return MuteRoom
+	}
+}
+
+// Active returns true if the mute has not expired by the given time
+func (m *Mute) Active(now time.Time) bool {
+	return m.Expires.IsZero() || now.Before(m.Expires)
+}
+
 // ByPlayer loads the mutes with the given parent player key
 func (l *MuteList) ByPlayer(ctx context.Context, playerKey *datastore.Key) (num int, myerr error) {
 	var mutes []Mute
 	var keys []*datastore.Key
-	keys, myerr = datastore.NewQuery(new(Mute).EntityType()).
+	keys, myerr = store.NewQuery(new(Mute).EntityType()).
 		Ancestor(playerKey).
 		GetAll(ctx, &mutes)
 	if myerr != nil {
@@ -77,3 +109,41 @@ func (l *MuteList) ByPlayer(ctx context.Context, playerKey *datastore.Key) (num
 
 	return
 }
+
+// Find returns the mute of the muted player with the given scope key
+func (l MuteList) Find(mutedKey, scopeKey *datastore.Key) (*Mute, bool) {
+	for k := range l {
+		if l[k].MutedKey.Equal(mutedKey) && sameKey(l[k].ScopeKey, scopeKey) {
+			return &l[k], true
+		}
+	}
+
+	return nil, false
+}
+
+// Applies returns the most specific active mute of the muted player for a chat in the room,
+// checking the room itself, then the game the room belongs to, then the whole site
+func (l MuteList) Applies(ctx context.Context, mutedKey *datastore.Key, room Room, now time.Time) (*Mute, bool) {
+	scopes := []*datastore.Key{room.GetKey()}
+	if gameKey := room.GameKey(ctx); gameKey != nil {
+		scopes = append(scopes, gameKey)
+	}
+	scopes = append(scopes, nil)
+
+	for _, scope := range scopes {
+		if m, ok := l.Find(mutedKey, scope); ok && m.Active(now) {
+			return m, true
+		}
+	}
+
+	return nil, false
+}
+
+// sameKey returns true if both keys are nil or they are equal
+func sameKey(a, b *datastore.Key) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return a.Equal(b)
+}
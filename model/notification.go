@@ -0,0 +1,141 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/store"
+)
+
+// The kinds of notification
+const (
+	NotificationMention = "mention" // the player was mentioned in a chat
+)
+
+// The ways a player can be told about a notification, besides the list of notifications
+const (
+	NotifyPush  = "push"  // push it to the player's open streams (the default)
+	NotifyEmail = "email" // send the player an email
+	NotifyAll   = "all"   // push it and send an email
+	NotifyNone  = "none"  // only add it to the list
+)
+
+// ValidNotify returns true if the way of notifying a player is known
+func ValidNotify(notify string) bool {
+	switch notify {
+	case NotifyPush, NotifyEmail, NotifyAll, NotifyNone:
+		return true
+	}
+
+	return false
+}
+
+// Notification is something a player is told about, such as being mentioned in a chat
+// It has the notified player as the parent, and stays unread until the player marks it read
+// A player is told about a chat once, so the key is named by the chat
+type Notification struct {
+	Base
+	PlayerKey *datastore.Key `datastore:"-" json:"-"`
+	Kind      string         `json:"kind"`
+	FromKey   *datastore.Key `json:"-"` // the player who caused the notification
+	RoomKey   *datastore.Key `json:"-"`
+	ChatKey   *datastore.Key `json:"-"`
+	Message   string         `datastore:",noindex" json:"message"`
+	Created   time.Time      `json:"created"`
+	Unread    bool           `json:"unread"`
+	Read      time.Time      `json:"read"`
+}
+
+const notificationEntityType = "Notification"
+
+// EntityType returns the entity type
+func (m *Notification) EntityType() string {
+	return notificationEntityType
+}
+
+// PreSave sets some basic info before continuing on to Save
+func (m *Notification) PreSave(ctx context.Context) error {
+	if m.GetKey() == nil {
+		if m.PlayerKey == nil {
+			return &db.MissingParentKeyError{}
+		}
+
+		if m.Kind == "" {
+			return &db.MissingRequiredError{"Kind"}
+		}
+
+		if m.ChatKey == nil {
+			return &db.MissingRequiredError{"ChatKey"}
+		}
+
+		m.SetIsNew(true)
+		m.SetKey(makeNotificationKey(ctx, m.PlayerKey, m.ChatKey))
+		m.Unread = true
+	}
+
+	if m.Created.IsZero() {
+		m.Created = game.Now(ctx)
+	}
+
+	return nil
+}
+
+// PostLoad populates the parent key from the loaded record's key
+func (m *Notification) PostLoad(ctx context.Context) error {
+	if err := m.Base.PostLoad(ctx); err != nil {
+		return err
+	}
+
+	m.PlayerKey = m.key.Parent()
+
+	return nil
+}
+
+// ByChat loads the player's notification about the chat
+func (m *Notification) ByChat(ctx context.Context, playerKey, chatKey *datastore.Key) (myerr error) {
+	note := Notification{}
+	if myerr = store.Load(ctx, makeNotificationKey(ctx, playerKey, chatKey), &note); myerr != nil {
+		return
+	}
+
+	*m = note
+
+	return
+}
+
+func makeNotificationKey(ctx context.Context, playerKey, chatKey *datastore.Key) *datastore.Key {
+	return datastore.NewKey(ctx, notificationEntityType, chatKey.Encode(), 0, playerKey)
+}
+
+// NotificationList is a slice of related Notifications
+type NotificationList []Notification
+
+// Unread loads up to limit of the player's unread notifications, newest first
+func (l *NotificationList) Unread(ctx context.Context, playerKey *datastore.Key, limit int) (myerr error) {
+	var notes []Notification
+	var keys []*datastore.Key
+	keys, myerr = store.NewQuery(notificationEntityType).
+		Ancestor(playerKey).
+		Filter("Unread =", true).
+		Order("-Created"). // DESC
+		Limit(limit).
+		GetAll(ctx, &notes)
+	if myerr != nil {
+		return
+	}
+
+	for k := range keys {
+		notes[k].SetKey(keys[k])
+		if myerr = notes[k].PostLoad(ctx); myerr != nil {
+			return
+		}
+	}
+
+	*l = notes
+
+	return
+}
@@ -8,6 +8,7 @@ import (
 	"google.golang.org/appengine/datastore"
 
 	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/store"
 )
 
 // Player is a user entity
@@ -18,6 +19,7 @@ type Player struct {
 	PasswordHash string        `datastore:",noindex" json:"-"`
 	Timezone     time.Location `json:"-"`
 	IsAdmin      bool          `json:"is_admin"`
+	Notify       string        `json:"notify"` // how the player is told about notifications, NotifyPush if empty
 	Created      time.Time     `json:"-"`
 	Approved     time.Time     `json:"-"`
 }
@@ -46,7 +48,7 @@ func (m *Player) PreSave(ctx context.Context) error {
 func (m *Player) ByEmail(ctx context.Context, email string) (myerr error) {
 	var people []Player
 	var keys []*datastore.Key
-	keys, myerr = datastore.NewQuery(m.EntityType()).
+	keys, myerr = store.NewQuery(m.EntityType()).
 		Filter("Email =", email).
 		GetAll(ctx, &people)
 	if myerr != nil {
@@ -80,3 +82,65 @@ func (m *Player) ByEmail(ctx context.Context, email string) (myerr error) {
 
 	return nil
 }
+
+// ByUsername loads the player with the given username
+func (m *Player) ByUsername(ctx context.Context, username string) (myerr error) {
+	var people []Player
+	var keys []*datastore.Key
+	keys, myerr = store.NewQuery(m.EntityType()).
+		Filter("Username =", username).
+		Limit(1).
+		GetAll(ctx, &people)
+	if myerr != nil {
+		return
+	}
+
+	if len(people) == 0 {
+		myerr = &db.UnfoundObjectError{
+			EntityType: m.EntityType(),
+			Key:        "username",
+			Value:      username,
+		}
+		return
+	}
+
+	people[0].SetKey(keys[0])
+	if myerr = people[0].PostLoad(ctx); myerr != nil {
+		return
+	}
+
+	*m = people[0]
+
+	return
+}
+
+// NotifyBy returns whether notifications are pushed to the player's streams and emailed to the player
+func (m *Player) NotifyBy() (push, email bool) {
+	switch m.Notify {
+	case "", NotifyPush:
+		return true, false
+	case NotifyEmail:
+		return false, true
+	case NotifyAll:
+		return true, true
+	}
+
+	return false, false
+}
+
+// PlayerList is a slice of related Players
+type PlayerList []Player
+
+// ByKeys loads the players with the given keys, in the same order
+func (l *PlayerList) ByKeys(ctx context.Context, keys []*datastore.Key) (myerr error) {
+	players := make([]Player, len(keys))
+	for k := range keys {
+		if myerr = store.Load(ctx, keys[k], &players[k]); myerr != nil {
+			return
+		}
+	}
+
+	*l = players
+
+	return
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/store"
+)
+
+// RateBucket is the stored state of a rate limit token bucket
+// The key is named by the limiter key (e.g.- "chat/player/...")
+type RateBucket struct {
+	Base
+	Name    string    `datastore:"-" json:"-"`
+	Tokens  float64   `json:"tokens"`
+	Updated time.Time `json:"updated"`
+}
+
+const rateBucketEntityType = "RateBucket"
+
+// EntityType returns the entity type
+func (m *RateBucket) EntityType() string {
+	return rateBucketEntityType
+}
+
+// PreSave sets some basic info before continuing on to Save
+func (m *RateBucket) PreSave(ctx context.Context) error {
+	if m.GetKey() == nil {
+		if m.Name == "" {
+			return &db.MissingRequiredError{"Name"}
+		}
+
+		m.SetIsNew(true)
+		m.SetKey(makeRateBucketKey(ctx, m.Name))
+	}
+
+	return nil
+}
+
+// PostLoad sets some data after the struct is loaded from the db
+func (m *RateBucket) PostLoad(ctx context.Context) error {
+	if err := m.Base.PostLoad(ctx); err != nil {
+		return err
+	}
+
+	m.Name = m.key.StringID()
+
+	return nil
+}
+
+// ByName loads the bucket with the given name
+// If the bucket does not exist, it is left unsaved with a zero Updated time
+func (m *RateBucket) ByName(ctx context.Context, name string) (myerr error) {
+	bucket := RateBucket{}
+	if myerr = store.Load(ctx, makeRateBucketKey(ctx, name), &bucket); myerr != nil {
+		if _, ok := myerr.(*db.UnfoundObjectError); !ok {
+			return
+		}
+
+		myerr = nil
+		bucket = RateBucket{
+			Name: name,
+		}
+	}
+
+	*m = bucket
+
+	return
+}
+
+func makeRateBucketKey(ctx context.Context, name string) *datastore.Key {
+	return datastore.NewKey(ctx, rateBucketEntityType, name, 0, nil)
+}
@@ -0,0 +1,234 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/store"
+)
+
+// The rating given to players that have not played a game type yet
+const (
+	DefaultRating    = 1500.0
+	DefaultDeviation = 350.0
+)
+
+// Rating is a player's skill rating for one game type
+// A player has one rating per game type, so the key is named by the game type
+// and has the player as the parent
+type Rating struct {
+	Base
+	PlayerKey *datastore.Key `datastore:"-" json:"-"`
+	GameType  string         `json:"game_type"`
+	Rating    float64        `json:"rating"`
+	Deviation float64        `json:"deviation"` // the Glicko rating deviation, lower is more certain
+	Games     int64          `json:"games"`
+	Wins      int64          `json:"wins"`
+	Losses    int64          `json:"losses"`
+	Draws     int64          `json:"draws"`
+	Updated   time.Time      `json:"updated"`
+}
+
+const ratingEntityType = "Rating"
+
+// EntityType returns the entity type
+func (m *Rating) EntityType() string {
+	return ratingEntityType
+}
+
+// PreSave sets some basic info before continuing on to Save
+func (m *Rating) PreSave(ctx context.Context) error {
+	if m.GetKey() == nil {
+		if m.PlayerKey == nil {
+			return &db.MissingParentKeyError{}
+		}
+
+		if m.GameType == "" {
+			return &db.MissingRequiredError{"GameType"}
+		}
+
+		m.SetIsNew(true)
+		m.SetKey(makeRatingKey(ctx, m.PlayerKey, m.GameType))
+	}
+
+	m.Updated = game.Now(ctx)
+
+	return nil
+}
+
+// PostLoad populates the parent key from the loaded record's key
+func (m *Rating) PostLoad(ctx context.Context) error {
+	if err := m.Base.PostLoad(ctx); err != nil {
+		return err
+	}
+
+	m.PlayerKey = m.key.Parent()
+
+	return nil
+}
+
+// ByPlayer loads the player's rating for the game type
+// Players that have not played the game type yet get the default rating
+func (m *Rating) ByPlayer(ctx context.Context, playerKey *datastore.Key, gameType string) (myerr error) {
+	r := Rating{}
+	if myerr = store.Load(ctx, makeRatingKey(ctx, playerKey, gameType), &r); myerr != nil {
+		if _, ok := myerr.(*db.UnfoundObjectError); !ok {
+			return
+		}
+
+		myerr = nil
+		r = Rating{
+			PlayerKey: playerKey,
+			GameType:  gameType,
+			Rating:    DefaultRating,
+			Deviation: DefaultDeviation,
+		}
+	}
+
+	*m = r
+
+	return
+}
+
+func makeRatingKey(ctx context.Context, playerKey *datastore.Key, gameType string) *datastore.Key {
+	return datastore.NewKey(ctx, ratingEntityType, gameType, 0, playerKey)
+}
+
+// RatingList is a slice of related Ratings
+type RatingList []Rating
+
+// Leaderboard loads the ratings for the game type, highest first,
+// skipping the first offset ratings and loading up to limit ratings
+func (l *RatingList) Leaderboard(ctx context.Context, gameType string, limit, offset int) (myerr error) {
+	var ratings []Rating
+	var keys []*datastore.Key
+	keys, myerr = store.NewQuery(ratingEntityType).
+		Filter("GameType =", gameType).
+		Order("-Rating"). // DESC
+		Offset(offset).
+		Limit(limit).
+		GetAll(ctx, &ratings)
+	if myerr != nil {
+		return
+	}
+
+	for k := range keys {
+		ratings[k].SetKey(keys[k])
+		if myerr = ratings[k].PostLoad(ctx); myerr != nil {
+			return
+		}
+	}
+
+	*l = ratings
+
+	return
+}
+
+// RatingChange is a change to a player's rating from a finished game
+// A player's rating changes once per game, so the key is named by the game and has the player as the parent
+type RatingChange struct {
+	Base
+	PlayerKey *datastore.Key `datastore:"-" json:"-"`
+	GameType  string         `json:"game_type"`
+	GameKey   *datastore.Key `json:"-"`
+	Result    string         `json:"result"` // the seat result for the player
+	Before    float64        `json:"before"`
+	After     float64        `json:"after"`
+	Deviation float64        `json:"deviation"` // the deviation after the change
+	Created   time.Time      `json:"created"`
+}
+
+const ratingChangeEntityType = "RatingChange"
+
+// EntityType returns the entity type
+func (m *RatingChange) EntityType() string {
+	return ratingChangeEntityType
+}
+
+// PreSave sets some basic info before continuing on to Save
+func (m *RatingChange) PreSave(ctx context.Context) error {
+	if m.GetKey() == nil {
+		if m.PlayerKey == nil {
+			return &db.MissingParentKeyError{}
+		}
+
+		if m.GameKey == nil {
+			return &db.MissingRequiredError{"GameKey"}
+		}
+
+		m.SetIsNew(true)
+		m.SetKey(makeRatingChangeKey(ctx, m.PlayerKey, m.GameKey))
+	}
+
+	if m.GameType == "" {
+		return &db.MissingRequiredError{"GameType"}
+	}
+
+	if m.Created.IsZero() {
+		m.Created = game.Now(ctx)
+	}
+
+	return nil
+}
+
+// PostLoad populates the parent key from the loaded record's key
+func (m *RatingChange) PostLoad(ctx context.Context) error {
+	if err := m.Base.PostLoad(ctx); err != nil {
+		return err
+	}
+
+	m.PlayerKey = m.key.Parent()
+
+	return nil
+}
+
+// ByGame loads the change to the player's rating from the game
+func (m *RatingChange) ByGame(ctx context.Context, playerKey, gameKey *datastore.Key) (myerr error) {
+	change := RatingChange{}
+	if myerr = store.Load(ctx, makeRatingChangeKey(ctx, playerKey, gameKey), &change); myerr != nil {
+		return
+	}
+
+	*m = change
+
+	return
+}
+
+func makeRatingChangeKey(ctx context.Context, playerKey, gameKey *datastore.Key) *datastore.Key {
+	return datastore.NewKey(ctx, ratingChangeEntityType, gameKey.Encode(), 0, playerKey)
+}
+
+// RatingChangeList is a slice of related RatingChanges
+type RatingChangeList []RatingChange
+
+// ByPlayer loads the changes to the player's rating for the game type, newest first,
+// skipping the first offset changes and loading up to limit changes
+func (l *RatingChangeList) ByPlayer(ctx context.Context, playerKey *datastore.Key, gameType string, limit, offset int) (myerr error) {
+	var changes []RatingChange
+	var keys []*datastore.Key
+	keys, myerr = store.NewQuery(ratingChangeEntityType).
+		Ancestor(playerKey).
+		Filter("GameType =", gameType).
+		Order("-Created"). // DESC
+		Offset(offset).
+		Limit(limit).
+		GetAll(ctx, &changes)
+	if myerr != nil {
+		return
+	}
+
+	for k := range keys {
+		changes[k].SetKey(keys[k])
+		if myerr = changes[k].PostLoad(ctx); myerr != nil {
+			return
+		}
+	}
+
+	*l = changes
+
+	return
+}
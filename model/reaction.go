@@ -0,0 +1,120 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/store"
+)
+
+// Reaction is a player's emoji reaction to a chat
+// A player can only react with each emoji once, so the key is named by the emoji and player
+// and has the chat as the parent
+type Reaction struct {
+	Base
+	ChatKey   *datastore.Key `datastore:"-" json:"-"`
+	PlayerKey *datastore.Key `json:"-"`
+	Emoji     string         `json:"emoji"`
+	Created   time.Time      `json:"created"`
+}
+
+const reactionEntityType = "Reaction"
+
+// EntityType returns the entity type
+func (m *Reaction) EntityType() string {
+	return reactionEntityType
+}
+
+// PreSave sets some basic info before continuing on to Save
+func (m *Reaction) PreSave(ctx context.Context) error {
+	if m.GetKey() == nil {
+		if m.ChatKey == nil {
+			return &db.MissingParentKeyError{}
+		}
+
+		if m.PlayerKey == nil {
+			return &db.MissingRequiredError{"PlayerKey"}
+		}
+
+		if m.Emoji == "" {
+			return &db.MissingRequiredError{"Emoji"}
+		}
+
+		m.SetIsNew(true)
+		m.SetKey(makeReactionKey(ctx, m.ChatKey, m.PlayerKey, m.Emoji))
+	}
+
+	if m.Created.IsZero() {
+		m.Created = game.Now(ctx)
+	}
+
+	return nil
+}
+
+// PostLoad populates the parent key from the loaded record's key
+func (m *Reaction) PostLoad(ctx context.Context) error {
+	if err := m.Base.PostLoad(ctx); err != nil {
+		return err
+	}
+
+	m.ChatKey = m.key.Parent()
+
+	return nil
+}
+
+// ByChat loads the player's reaction to the chat with the given emoji
+func (m *Reaction) ByChat(ctx context.Context, chatKey, playerKey *datastore.Key, emoji string) (myerr error) {
+	reaction := Reaction{}
+	if myerr = store.Load(ctx, makeReactionKey(ctx, chatKey, playerKey, emoji), &reaction); myerr != nil {
+		return
+	}
+
+	*m = reaction
+
+	return
+}
+
+func makeReactionKey(ctx context.Context, chatKey, playerKey *datastore.Key, emoji string) *datastore.Key {
+	return datastore.NewKey(ctx, reactionEntityType, emoji+" "+playerKey.Encode(), 0, chatKey)
+}
+
+// ReactionList is a slice of related Reactions
+type ReactionList []Reaction
+
+// ByChat loads the reactions to the chat, oldest first
+func (l *ReactionList) ByChat(ctx context.Context, chatKey *datastore.Key) (myerr error) {
+	var reactions []Reaction
+	var keys []*datastore.Key
+	keys, myerr = store.NewQuery(reactionEntityType).
+		Ancestor(chatKey).
+		Order("Created").
+		GetAll(ctx, &reactions)
+	if myerr != nil {
+		return
+	}
+
+	for k := range keys {
+		reactions[k].SetKey(keys[k])
+		if myerr = reactions[k].PostLoad(ctx); myerr != nil {
+			return
+		}
+	}
+
+	*l = reactions
+
+	return
+}
+
+// Counts returns the number of reactions with each emoji
+func (l ReactionList) Counts() map[string]int {
+	counts := make(map[string]int)
+	for _, v := range l {
+		counts[v.Emoji]++
+	}
+
+	return counts
+}
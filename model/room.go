@@ -2,16 +2,39 @@ package model
 
 import (
 	"context"
+	"sort"
+	"time"
 
 	"github.com/benjamw/golibs/db"
 	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/store"
+)
+
+// The types of Room
+const (
+	RoomLobby  = "lobby"  // the public lobby, open to every player
+	RoomGame   = "game"   // a game's room, open to the players seated in the game
+	RoomGroup  = "group"  // a private group, open to its members
+	RoomDirect = "direct" // a direct message between two players, open to both of them
 )
 
 // Room is a chat room
+// The lobby is room 0, and every game has a room with the same ID as the game, kept under the game's key
+// Private groups get a new ID and direct messages a key named for their two players,
+// and both list their players as Members
+// A room may have a retention policy, keeping only its newest chats or the chats younger than an age
 type Room struct {
 	Base
-	ID   int64  `json:"id"`
-	Name string `json:"name"`
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	KeepLast int64  `json:"keep_last"` // the number of newest chats kept, 0 for no limit
+	MaxAge   int64  `json:"max_age"`   // the age in seconds after which chats expire, 0 for no limit
+
+	// KeptFrom is when the oldest of the KeepLast newest chats was posted, as of the last purge
+	KeptFrom time.Time `json:"-"`
 }
 
 const roomEntityType = "Room"
@@ -23,14 +46,50 @@ func (m *Room) EntityType() string {
 
 // PreSave sets some basic info before continuing on to Save
 func (m *Room) PreSave(ctx context.Context) error {
+	m.Type = m.RoomType()
+
 	if m.GetKey() == nil {
 		m.SetIsNew(true)
-		m.SetKey(makeRoomKey(ctx, m.ID))
+		if m.Private() {
+			m.SetKey(datastore.NewIncompleteKey(ctx, m.EntityType(), nil))
+		} else {
+			m.SetKey(makeRoomKey(ctx, m.ID))
+		}
 	}
 
 	return nil
 }
 
+// PostSave sets the allocated ID after the struct is saved to the db
+func (m *Room) PostSave(ctx context.Context) error {
+	m.ID = m.key.IntID()
+
+	return nil
+}
+
+// RoomType returns the type of the room
+// Rooms saved before rooms had types are the lobby or game rooms
+func (m *Room) RoomType() string {
+	switch {
+	case m.Type != "":
+		return m.Type
+	case m.ID == 0:
+		return RoomLobby
+	default:
+		return RoomGame
+	}
+}
+
+// Private returns true if the room is only open to its members
+func (m *Room) Private() bool {
+	switch m.RoomType() {
+	case RoomGroup, RoomDirect:
+		return true
+	}
+
+	return false
+}
+
 // PostLoad sets some data after the struct is loaded from the db
 func (m *Room) PostLoad(ctx context.Context) error {
 	if err := m.Base.PostLoad(ctx); err != nil {
@@ -42,25 +101,185 @@ func (m *Room) PostLoad(ctx context.Context) error {
 	return nil
 }
 
-// ByID loads the room with the given ID
+// GameKey returns the key of the game the room belongs to, or nil if it is not a game's room
+func (m *Room) GameKey(ctx context.Context) *datastore.Key {
+	if m.RoomType() != RoomGame {
+		return nil
+	}
+
+	return makeGameKey(ctx, m.ID)
+}
+
+// ByID loads the lobby (ID 0) or the room of the game with the given ID
+// Game rooms saved before they were kept under their game are found at their old key
+// Private rooms are loaded by key
 func (m *Room) ByID(ctx context.Context, id int64) (myerr error) {
-	key := makeRoomKey(ctx, id)
 	room := Room{}
-	_, myerr = db.Load(ctx, key, &room)
+	myerr = store.Load(ctx, makeRoomKey(ctx, id), &room)
+	if _, ok := myerr.(*db.UnfoundObjectError); ok && id != 0 {
+		myerr = store.Load(ctx, makeLegacyRoomKey(ctx, id), &room)
+	}
 	if myerr != nil {
 		return
 	}
 
-	room.SetKey(key)
-	if myerr = room.PostLoad(ctx); myerr != nil {
+	*m = room
+
+	return
+}
+
+// lobbyKeyName is the key name of the lobby room
+// an ID of 0 would give an incomplete key, so the lobby uses a named key
+const lobbyKeyName = "lobby"
+
+// Cutoff returns the time of the oldest chat the room keeps under its retention policy
+// Older chats have expired; the time is zero if the room keeps every chat
+// Chats past KeepLast only expire once the purge moves KeptFrom up
+func (m *Room) Cutoff(ctx context.Context) (cutoff time.Time) {
+	if m.MaxAge > 0 {
+		cutoff = game.Now(ctx).Add(-time.Duration(m.MaxAge) * time.Second)
+	}
+
+	if m.KeepLast > 0 && m.KeptFrom.After(cutoff) {
+		cutoff = m.KeptFrom
+	}
+
+	return
+}
+
+// UpdateKeptFrom finds when the oldest of the KeepLast newest chats was posted,
+// and saves it on the room if it moved
+func (m *Room) UpdateKeptFrom(ctx context.Context) (myerr error) {
+	var keptFrom time.Time
+	if m.KeepLast > 0 {
+		var chats ChatList
+		chats, myerr = loadChats(ctx, store.NewQuery(chatEntityType).
+			Ancestor(m.GetKey()).
+			Order("-Created"). // DESC
+			Offset(int(m.KeepLast-1)).
+			Limit(1))
+		if myerr != nil {
+			return
+		}
+
+		if len(chats) != 0 {
+			keptFrom = chats[0].Created
+		}
+	}
+
+	if keptFrom.Equal(m.KeptFrom) {
 		return
 	}
 
-	*m = room
+	m.KeptFrom = keptFrom
+	myerr = store.Save(ctx, m)
 
 	return
 }
 
+// ClearExpired moves KeptFrom up to the room's newest chats,
+// and deletes up to limit of the room's expired chats, oldest first
+func (m *Room) ClearExpired(ctx context.Context, limit int) (num int, myerr error) {
+	if myerr = m.UpdateKeptFrom(ctx); myerr != nil {
+		return
+	}
+
+	cutoff := m.Cutoff(ctx)
+	if cutoff.IsZero() {
+		return
+	}
+
+	chats, myerr := loadChats(ctx, store.NewQuery(chatEntityType).
+		Ancestor(m.GetKey()).
+		Filter("Created <", cutoff).
+		Order("Created").
+		Limit(limit))
+	if myerr != nil {
+		return
+	}
+
+	num = 0
+	for k := range chats {
+		if myerr = store.Delete(ctx, &chats[k]); myerr != nil {
+			return
+		}
+
+		num++
+	}
+
+	return
+}
+
+// makeRoomKey returns the key of the lobby or of the room of the game with the given ID
+// Game rooms are kept under their game, so their IDs never clash with the IDs of private groups
 func makeRoomKey(ctx context.Context, id int64) *datastore.Key {
+	if id == 0 {
+		return datastore.NewKey(ctx, roomEntityType, lobbyKeyName, 0, nil)
+	}
+
+	return datastore.NewKey(ctx, roomEntityType, "", id, makeGameKey(ctx, id))
+}
+
+// makeLegacyRoomKey returns the key game rooms had before they were kept under their game
+func makeLegacyRoomKey(ctx context.Context, id int64) *datastore.Key {
 	return datastore.NewKey(ctx, roomEntityType, "", id, nil)
 }
+
+// DirectRoomKey returns the key of the direct message room between the two players,
+// which is the same whichever order they are given in
+func DirectRoomKey(ctx context.Context, a, b *datastore.Key) *datastore.Key {
+	ids := []string{a.Encode(), b.Encode()}
+	sort.Strings(ids)
+
+	return datastore.NewKey(ctx, roomEntityType, directKeyPrefix+ids[0]+"."+ids[1], 0, nil)
+}
+
+// directKeyPrefix starts the key names of direct message rooms
+const directKeyPrefix = "direct."
+
+// RoomList is a slice of related Rooms
+type RoomList []Room
+
+// WithRetention loads the rooms that have a retention policy
+func (l *RoomList) WithRetention(ctx context.Context) (myerr error) {
+	rooms := make(RoomList, 0)
+	for _, field := range []string{"KeepLast >", "MaxAge >"} {
+		var found []Room
+		var keys []*datastore.Key
+		keys, myerr = store.NewQuery(roomEntityType).
+			Filter(field, int64(0)).
+			GetAll(ctx, &found)
+		if myerr != nil {
+			return
+		}
+
+		for k := range keys {
+			// a room with both limits is found twice
+			if rooms.find(keys[k]) {
+				continue
+			}
+
+			found[k].SetKey(keys[k])
+			if myerr = found[k].PostLoad(ctx); myerr != nil {
+				return
+			}
+
+			rooms = append(rooms, found[k])
+		}
+	}
+
+	*l = rooms
+
+	return
+}
+
+// find returns true if the room with the given key is in the list
+func (l RoomList) find(key *datastore.Key) bool {
+	for k := range l {
+		if l[k].GetKey().Equal(key) {
+			return true
+		}
+	}
+
+	return false
+}
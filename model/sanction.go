@@ -0,0 +1,132 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/store"
+)
+
+// The kinds of Sanction an admin can put on a player
+const (
+	SanctionSilence = "silence" // the player can't post chats
+	SanctionBan     = "ban"     // the player can't post or read chats
+)
+
+// Sanction is a moderation action an admin took against a player's chat,
+// in a single room or site-wide
+// Sanctions are never deleted, so they also serve as the audit log
+type Sanction struct {
+	Base
+	PlayerKey *datastore.Key `datastore:"-" json:"-"`
+	Kind      string         `json:"kind"`
+	RoomKey   *datastore.Key `json:"-"` // the room the sanction applies to, nil for the whole site
+	AdminKey  *datastore.Key `json:"-"` // the admin who set the sanction
+	Reason    string         `json:"reason"`
+	Created   time.Time      `json:"created"`
+	Expires   time.Time      `json:"expires"` // zero if the sanction doesn't expire
+	Lifted    time.Time      `json:"lifted"`  // set when an admin lifts the sanction early
+	LifterKey *datastore.Key `json:"-"`       // the admin who lifted the sanction
+}
+
+const sanctionEntityType = "Sanction"
+
+// EntityType returns the entity type
+func (m *Sanction) EntityType() string {
+	return sanctionEntityType
+}
+
+// PreSave sets some basic info before continuing on to Save
+func (m *Sanction) PreSave(ctx context.Context) error {
+	if m.GetKey() == nil {
+		if m.PlayerKey == nil {
+			return &db.MissingParentKeyError{}
+		}
+
+		m.SetIsNew(true)
+		m.SetKey(datastore.NewIncompleteKey(ctx, m.EntityType(), m.PlayerKey))
+	}
+
+	if m.Kind == "" {
+		return &db.MissingRequiredError{"Kind"}
+	}
+
+	if m.AdminKey == nil {
+		return &db.MissingRequiredError{"AdminKey"}
+	}
+
+	if m.Reason == "" {
+		return &db.MissingRequiredError{"Reason"}
+	}
+
+	if m.Created.IsZero() {
+		m.Created = game.Now(ctx)
+	}
+
+	return nil
+}
+
+// PostLoad populates the parent key from the loaded record's key
+func (m *Sanction) PostLoad(ctx context.Context) error {
+	if err := m.Base.PostLoad(ctx); err != nil {
+		return err
+	}
+
+	m.PlayerKey = m.key.Parent()
+
+	return nil
+}
+
+// Active returns true if the sanction has not expired or been lifted by the given time
+func (m *Sanction) Active(now time.Time) bool {
+	return m.Lifted.IsZero() && (m.Expires.IsZero() || now.Before(m.Expires))
+}
+
+// Covers returns true if the sanction applies to the room
+func (m *Sanction) Covers(roomKey *datastore.Key) bool {
+	return m.RoomKey == nil || m.RoomKey.Equal(roomKey)
+}
+
+// SanctionList is a slice of related Sanctions
+type SanctionList []Sanction
+
+// ByPlayer loads the sanctions put on the given player, newest first
+func (l *SanctionList) ByPlayer(ctx context.Context, playerKey *datastore.Key) (myerr error) {
+	return l.load(ctx, store.NewQuery(sanctionEntityType).
+		Ancestor(playerKey).
+		Order("-Created"), // DESC
+	)
+}
+
+// Page loads a page of all the sanctions, newest first
+func (l *SanctionList) Page(ctx context.Context, limit, offset int) (myerr error) {
+	return l.load(ctx, store.NewQuery(sanctionEntityType).
+		Order("-Created"). // DESC
+		Limit(limit).
+		Offset(offset),
+	)
+}
+
+// load runs the query and loads the sanctions it finds
+func (l *SanctionList) load(ctx context.Context, query *store.Query) (myerr error) {
+	var sanctions []Sanction
+	var keys []*datastore.Key
+	if keys, myerr = query.GetAll(ctx, &sanctions); myerr != nil {
+		return
+	}
+
+	for k := range keys {
+		sanctions[k].SetKey(keys[k])
+		if myerr = sanctions[k].PostLoad(ctx); myerr != nil {
+			return
+		}
+	}
+
+	*l = sanctions
+
+	return
+}
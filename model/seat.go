@@ -0,0 +1,156 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/store"
+)
+
+// The results a Seat can have once the game is over
+const (
+	SeatPlaying = ""        // the game is not over for this seat
+	SeatWon     = "won"     // the player won the game
+	SeatLost    = "lost"    // the player lost the game
+	SeatDraw    = "draw"    // the game ended in a draw
+	SeatForfeit = "forfeit" // the player forfeited the game
+)
+
+// Seat is a player's place in a game
+type Seat struct {
+	Base
+	GameKey   *datastore.Key `datastore:"-" json:"-"`
+	PlayerKey *datastore.Key `json:"-"`
+	Position  int64          `json:"position"` // the order of the player in the game, starting at 0
+	Result    string         `json:"result"`
+	Joined    time.Time      `json:"joined"`
+}
+
+const seatEntityType = "Seat"
+
+// EntityType returns the entity type
+func (m *Seat) EntityType() string {
+	return seatEntityType
+}
+
+// PreSave sets some basic info before continuing on to Save
+func (m *Seat) PreSave(ctx context.Context) error {
+	if m.GetKey() == nil {
+		if m.GameKey == nil {
+			return &db.MissingParentKeyError{}
+		}
+
+		m.SetIsNew(true)
+		m.SetKey(datastore.NewIncompleteKey(ctx, m.EntityType(), m.GameKey))
+	}
+
+	if m.PlayerKey == nil {
+		return &db.MissingRequiredError{"PlayerKey"}
+	}
+
+	if m.Joined.IsZero() {
+		m.Joined = game.Now(ctx)
+	}
+
+	return nil
+}
+
+// PostLoad populates the parent key from the loaded record's key
+func (m *Seat) PostLoad(ctx context.Context) error {
+	if err := m.Base.PostLoad(ctx); err != nil {
+		return err
+	}
+
+	m.GameKey = m.key.Parent()
+
+	return nil
+}
+
+// SeatList is a slice of related Seats
+type SeatList []Seat
+
+// ByGame loads the seats for the given game, in position order
+func (l *SeatList) ByGame(ctx context.Context, gameKey *datastore.Key) (myerr error) {
+	var seats []Seat
+	var keys []*datastore.Key
+	keys, myerr = store.NewQuery(seatEntityType).
+		Ancestor(gameKey).
+		Order("Position").
+		GetAll(ctx, &seats)
+	if myerr != nil {
+		return
+	}
+
+	for k := range keys {
+		seats[k].SetKey(keys[k])
+		if myerr = seats[k].PostLoad(ctx); myerr != nil {
+			return
+		}
+	}
+
+	*l = seats
+
+	return
+}
+
+// ByPlayer loads all the seats the given player holds, newest first
+func (l *SeatList) ByPlayer(ctx context.Context, playerKey *datastore.Key) (myerr error) {
+	var seats []Seat
+	var keys []*datastore.Key
+	keys, myerr = store.NewQuery(seatEntityType).
+		Filter("PlayerKey =", playerKey).
+		Order("-Joined"). // DESC
+		GetAll(ctx, &seats)
+	if myerr != nil {
+		return
+	}
+
+	for k := range keys {
+		seats[k].SetKey(keys[k])
+		if myerr = seats[k].PostLoad(ctx); myerr != nil {
+			return
+		}
+	}
+
+	*l = seats
+
+	return
+}
+
+// Find returns the seat held by the given player
+func (l SeatList) Find(playerKey *datastore.Key) (seat *Seat, found bool) {
+	for k := range l {
+		if l[k].PlayerKey.Equal(playerKey) {
+			return &l[k], true
+		}
+	}
+
+	return nil, false
+}
+
+// AtPosition returns the seat in the given position
+func (l SeatList) AtPosition(position int64) (seat *Seat, found bool) {
+	for k := range l {
+		if l[k].Position == position {
+			return &l[k], true
+		}
+	}
+
+	return nil, false
+}
+
+// Playing returns the seats that have not forfeited or otherwise finished the game
+func (l SeatList) Playing() SeatList {
+	playing := make(SeatList, 0, len(l))
+	for _, v := range l {
+		if v.Result == SeatPlaying {
+			playing = append(playing, v)
+		}
+	}
+
+	return playing
+}
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/store"
+)
+
+// The statuses a Ticket can be in
+const (
+	TicketWaiting = "waiting" // in the queue, waiting for a match
+	TicketMatched = "matched" // matched, and seated in the game
+)
+
+// Ticket is a player's place in the matchmaking queue for a game type
+// A player can only hold one ticket, so the key is named and has the player as the parent
+type Ticket struct {
+	Base
+	PlayerKey  *datastore.Key `datastore:"-" json:"-"`
+	GameType   string         `json:"game_type"`
+	Status     string         `json:"status"`
+	Rating     int64          `json:"rating"`      // the player's rating for the game type when they joined the queue
+	MinRating  int64          `json:"min_rating"`  // the lowest opponent rating accepted, 0 for no limit
+	MaxRating  int64          `json:"max_rating"`  // the highest opponent rating accepted, 0 for no limit
+	MinPlayers int64          `json:"min_players"` // the smallest game accepted
+	MaxPlayers int64          `json:"max_players"` // the largest game accepted
+	GameKey    *datastore.Key `json:"-"`           // the game the player was matched into
+	Created    time.Time      `json:"created"`
+	Matched    time.Time      `json:"matched"`
+}
+
+const ticketEntityType = "Ticket"
+
+// EntityType returns the entity type
+func (m *Ticket) EntityType() string {
+	return ticketEntityType
+}
+
+// PreSave sets some basic info before continuing on to Save
+func (m *Ticket) PreSave(ctx context.Context) error {
+	if m.GetKey() == nil {
+		if m.PlayerKey == nil {
+			return &db.MissingParentKeyError{}
+		}
+
+		m.SetIsNew(true)
+		m.SetKey(makeTicketKey(ctx, m.PlayerKey))
+	}
+
+	if m.GameType == "" {
+		return &db.MissingRequiredError{"GameType"}
+	}
+
+	if m.Status == "" {
+		m.Status = TicketWaiting
+	}
+
+	if m.Created.IsZero() {
+		m.Created = game.Now(ctx)
+	}
+
+	return nil
+}
+
+// PostLoad populates the parent key from the loaded record's key
+func (m *Ticket) PostLoad(ctx context.Context) error {
+	if err := m.Base.PostLoad(ctx); err != nil {
+		return err
+	}
+
+	m.PlayerKey = m.key.Parent()
+
+	return nil
+}
+
+// ByPlayer loads the ticket held by the given player
+func (m *Ticket) ByPlayer(ctx context.Context, playerKey *datastore.Key) (myerr error) {
+	t := Ticket{}
+	if myerr = store.Load(ctx, makeTicketKey(ctx, playerKey), &t); myerr != nil {
+		return
+	}
+
+	*m = t
+
+	return
+}
+
+// Accepts returns true if the ticket accepts an opponent with the given rating
+func (m *Ticket) Accepts(rating int64) bool {
+	if m.MinRating != 0 && rating < m.MinRating {
+		return false
+	}
+
+	if m.MaxRating != 0 && m.MaxRating < rating {
+		return false
+	}
+
+	return true
+}
+
+func makeTicketKey(ctx context.Context, playerKey *datastore.Key) *datastore.Key {
+	return datastore.NewKey(ctx, ticketEntityType, "queue", 0, playerKey)
+}
+
+// TicketList is a slice of related Tickets
+type TicketList []Ticket
+
+// Waiting loads the tickets waiting in the queue for the given game type, oldest first
+func (l *TicketList) Waiting(ctx context.Context, gameType string) (myerr error) {
+	var tickets []Ticket
+	var keys []*datastore.Key
+	keys, myerr = store.NewQuery(ticketEntityType).
+		Filter("GameType =", gameType).
+		Filter("Status =", TicketWaiting).
+		Order("Created").
+		GetAll(ctx, &tickets)
+	if myerr != nil {
+		return
+	}
+
+	for k := range keys {
+		tickets[k].SetKey(keys[k])
+		if myerr = tickets[k].PostLoad(ctx); myerr != nil {
+			return
+		}
+	}
+
+	*l = tickets
+
+	return
+}
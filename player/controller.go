@@ -12,6 +12,7 @@ import (
 	gttp "github.com/benjamw/gogame/http"
 	"github.com/benjamw/gogame/model"
 	"github.com/benjamw/gogame/session"
+	"github.com/benjamw/gogame/store"
 	"github.com/benjamw/golibs/random"
 )
 
@@ -48,7 +49,7 @@ func Register(ctx context.Context, username, email, pass string) (p model.Player
 	p.Email = email
 	p.PasswordHash = password.Encode(pass)
 
-	if myerr = db.Save(ctx, &p); myerr != nil {
+	if myerr = store.Save(ctx, &p); myerr != nil {
 		p = model.Player{}
 
 		return
@@ -113,7 +114,7 @@ func Update(ctx context.Context, oldEmail, oldPass, newEmail, newPass string) (p
 		p.PasswordHash = password.Encode(newPass)
 	}
 
-	if myerr = db.Save(ctx, &p); myerr != nil {
+	if myerr = store.Save(ctx, &p); myerr != nil {
 		p = model.Player{}
 
 		return
@@ -127,7 +128,7 @@ func Update(ctx context.Context, oldEmail, oldPass, newEmail, newPass string) (p
 // GetDeleteToken creates a token for use when deleting an account
 func GetDeleteToken(ctx context.Context, plyrID, pass string) (token string, myerr error) {
 	var old model.Player
-	if _, myerr = db.LoadS(ctx, plyrID, &old); myerr != nil {
+	if myerr = store.LoadS(ctx, plyrID, &old); myerr != nil {
 		return
 	}
 	pk := old.GetKey()
@@ -142,7 +143,7 @@ func GetDeleteToken(ctx context.Context, plyrID, pass string) (token string, mye
 		Value:     random.Stringnt(64, random.ALPHANUMERIC),
 	}
 	dt.ClearExisting(ctx, dt.PlayerKey)
-	if myerr = db.Save(ctx, &dt); myerr != nil {
+	if myerr = store.Save(ctx, &dt); myerr != nil {
 		return
 	}
 
@@ -154,7 +155,7 @@ func GetDeleteToken(ctx context.Context, plyrID, pass string) (token string, mye
 // Delete the user with the given token
 func Delete(ctx context.Context, plyrID, token string) (myerr error) {
 	var old model.Player
-	if _, myerr = db.LoadS(ctx, plyrID, &old); myerr != nil {
+	if myerr = store.LoadS(ctx, plyrID, &old); myerr != nil {
 		return
 	}
 
@@ -170,7 +171,7 @@ func Delete(ctx context.Context, plyrID, token string) (myerr error) {
 	dt.ClearExisting(ctx, dt.PlayerKey)
 
 	p := old
-	if myerr = db.Delete(ctx, &p); myerr != nil {
+	if myerr = store.Delete(ctx, &p); myerr != nil {
 		return
 	}
 
@@ -179,8 +180,8 @@ func Delete(ctx context.Context, plyrID, token string) (myerr error) {
 	return
 }
 
-func setCookie(w http.ResponseWriter, s session.Data) {
-	s.ToCookie(w, gttp.PlayerCookieName)
+func setCookie(ctx context.Context, w http.ResponseWriter, s session.Data) {
+	s.ToCookie(ctx, w, gttp.PlayerCookieName)
 }
 
 func killCookie(w http.ResponseWriter, s session.Data) {
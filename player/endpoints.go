@@ -5,7 +5,6 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/benjamw/golibs/db"
 	"google.golang.org/appengine/datastore"
 
 	"strings"
@@ -14,6 +13,7 @@ import (
 	gttp "github.com/benjamw/gogame/http"
 	"github.com/benjamw/gogame/model"
 	"github.com/benjamw/gogame/session"
+	"github.com/benjamw/gogame/store"
 )
 
 func init() {
@@ -114,12 +114,12 @@ func handleLogin(ctx context.Context, w http.ResponseWriter, r *http.Request) (r
 		return
 	}
 
-	c, errReply := sess.Serialize()
+	c, errReply := sess.Serialize(ctx)
 	if errReply != nil {
 		return
 	}
 
-	setCookie(w, sess)
+	setCookie(ctx, w, sess)
 
 	reply := Reply{}
 	reply.Success = true
@@ -149,7 +149,7 @@ func handleUpdate(ctx context.Context, s session.Data, w http.ResponseWriter, r
 	}
 
 	var old model.Player
-	_, errReply = db.Load(ctx, plyrKey, &old)
+	errReply = store.Load(ctx, plyrKey, &old)
 	if errReply != nil {
 		return
 	}
@@ -0,0 +1,80 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// bufferSize is the number of messages a subscriber can fall behind
+// before the Memory broker starts dropping messages for it
+const bufferSize = 64
+
+// Memory is a Broker that delivers messages within the process
+type Memory struct {
+	mu     sync.RWMutex
+	nextID int64
+	topics map[string]map[int64]chan []byte
+}
+
+// NewMemory creates an in-process Broker
+func NewMemory() *Memory {
+	return &Memory{
+		topics: make(map[string]map[int64]chan []byte),
+	}
+}
+
+// Publish satisfies the Broker interface
+// Subscribers that are too far behind miss the message instead of blocking the publisher
+func (b *Memory) Publish(ctx context.Context, topic string, data []byte) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, ch := range b.topics[topic] {
+		select {
+		case ch <- data:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Subscribe satisfies the Broker interface
+func (b *Memory) Subscribe(ctx context.Context, topic string) (messages <-chan []byte, cancel func(), err error) {
+	ch := make(chan []byte, bufferSize)
+
+	b.mu.Lock()
+	b.nextID++
+	id := b.nextID
+	if b.topics[topic] == nil {
+		b.topics[topic] = make(map[int64]chan []byte)
+	}
+	b.topics[topic][id] = ch
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	var once sync.Once
+	cancel = func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.topics[topic], id)
+			if len(b.topics[topic]) == 0 {
+				delete(b.topics, topic)
+			}
+			b.mu.Unlock()
+
+			close(done)
+			close(ch)
+		})
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-done:
+		}
+	}()
+
+	return ch, cancel, nil
+}
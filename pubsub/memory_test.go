@@ -0,0 +1,95 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryPublish(t *testing.T) {
+	b := NewMemory()
+	ctx := context.Background()
+
+	first, cancelFirst, err := b.Subscribe(ctx, "room/1")
+	if err != nil {
+		t.Fatalf("Memory.Subscribe threw an error: %v", err)
+	}
+	defer cancelFirst()
+
+	second, cancelSecond, err := b.Subscribe(ctx, "room/1")
+	if err != nil {
+		t.Fatalf("Memory.Subscribe threw an error: %v", err)
+	}
+
+	other, cancelOther, err := b.Subscribe(ctx, "room/2")
+	if err != nil {
+		t.Fatalf("Memory.Subscribe threw an error: %v", err)
+	}
+	defer cancelOther()
+
+	if err = b.Publish(ctx, "room/1", []byte("hello")); err != nil {
+		t.Fatalf("Memory.Publish threw an error: %v", err)
+	}
+
+	for _, ch := range []<-chan []byte{first, second} {
+		if got := receive(t, ch); string(got) != "hello" {
+			t.Fatalf("The subscriber did not get the message. Got: %q", got)
+		}
+	}
+
+	select {
+	case got := <-other:
+		t.Fatalf("A subscriber to another topic got the message. Got: %q", got)
+	default:
+	}
+
+	// cancelled subscriptions are closed and no longer receive messages
+	cancelSecond()
+	if _, ok := <-second; ok {
+		t.Fatal("Memory.Subscribe did not close the cancelled channel.")
+	}
+
+	if err = b.Publish(ctx, "room/1", []byte("again")); err != nil {
+		t.Fatalf("Memory.Publish threw an error: %v", err)
+	}
+	if got := receive(t, first); string(got) != "again" {
+		t.Fatalf("The subscriber did not get the second message. Got: %q", got)
+	}
+}
+
+func TestMemorySlowSubscriber(t *testing.T) {
+	b := NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ch, _, err := b.Subscribe(ctx, "room/1")
+	if err != nil {
+		t.Fatalf("Memory.Subscribe threw an error: %v", err)
+	}
+
+	// publishing never blocks, even when nobody is reading
+	for i := 0; i < bufferSize*2; i++ {
+		if err = b.Publish(ctx, "room/1", []byte("spam")); err != nil {
+			t.Fatalf("Memory.Publish threw an error: %v", err)
+		}
+	}
+
+	if len(ch) != bufferSize {
+		t.Fatalf("The subscriber did not get a full buffer. Wanted: %d; Got: %d", bufferSize, len(ch))
+	}
+
+	// ending the context ends the subscription
+	cancel()
+	for range ch {
+	}
+}
+
+func receive(t *testing.T, ch <-chan []byte) []byte {
+	select {
+	case data := <-ch:
+		return data
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for a message.")
+	}
+
+	return nil
+}
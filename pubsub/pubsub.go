@@ -0,0 +1,49 @@
+// Package pubsub passes messages between the parts of the site that change data
+// and the clients streaming those changes, through a pluggable Broker
+package pubsub
+
+import (
+	"context"
+)
+
+var brokerContextKey = "holds the Broker used for the request"
+
+// Default is the Broker used when none has been attached to the context
+// The in-process broker only reaches subscribers in the same process;
+// sites running several instances should set a Broker backed by a shared message service
+var Default Broker = NewMemory()
+
+// Broker delivers the messages published to a topic to every subscriber of that topic
+type Broker interface {
+	// Publish sends the data to the current subscribers of the topic
+	// It must not block on slow subscribers
+	Publish(ctx context.Context, topic string, data []byte) error
+
+	// Subscribe returns a channel receiving the data published to the topic
+	// until ctx is done or the returned cancel func is called, which closes the channel
+	Subscribe(ctx context.Context, topic string) (messages <-chan []byte, cancel func(), err error)
+}
+
+// NewContext returns a copy of ctx that uses the given Broker
+func NewContext(ctx context.Context, b Broker) context.Context {
+	return context.WithValue(ctx, &brokerContextKey, b)
+}
+
+// FromContext returns the Broker that is stored in context, or the Default if not found
+func FromContext(ctx context.Context) Broker {
+	if b, ok := ctx.Value(&brokerContextKey).(Broker); ok && b != nil {
+		return b
+	}
+
+	return Default
+}
+
+// Publish sends the data to the subscribers of the topic using the context Broker
+func Publish(ctx context.Context, topic string, data []byte) error {
+	return FromContext(ctx).Publish(ctx, topic, data)
+}
+
+// Subscribe subscribes to the topic using the context Broker
+func Subscribe(ctx context.Context, topic string) (<-chan []byte, func(), error) {
+	return FromContext(ctx).Subscribe(ctx, topic)
+}
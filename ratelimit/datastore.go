@@ -0,0 +1,39 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+)
+
+// Datastore is a Limiter that keeps the buckets as RateBuckets in the context store,
+// so every instance of the site shares them
+// The bucket is read and written in a transaction, so requests racing
+// for the last token cannot both get it
+type Datastore struct{}
+
+// Take satisfies the Limiter interface
+func (l Datastore) Take(ctx context.Context, key string, rate Rate, now time.Time) (ok bool, retryAfter time.Duration, myerr error) {
+	myerr = store.RunInTransaction(ctx, func(ctx context.Context) (err error) {
+		var rb model.RateBucket
+		if err = rb.ByName(ctx, key); err != nil {
+			return
+		}
+
+		b := Bucket{
+			Tokens:  rb.Tokens,
+			Updated: rb.Updated,
+		}
+		ok, retryAfter = b.Take(rate, now)
+
+		rb.Tokens = b.Tokens
+		rb.Updated = b.Updated
+		err = store.Save(ctx, &rb)
+
+		return
+	})
+
+	return
+}
@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/appengine/memcache"
+)
+
+// casRetries is the most times the Memcache limiter retries a bucket another request changed
+const casRetries = 5
+
+// Memcache is a Limiter that keeps the buckets in App Engine memcache, shared by every instance
+// The buckets are updated with compare-and-swap, but can be evicted, which refills them
+type Memcache struct{}
+
+// Take satisfies the Limiter interface
+func (l Memcache) Take(ctx context.Context, key string, rate Rate, now time.Time) (ok bool, retryAfter time.Duration, myerr error) {
+	for i := 0; i < casRetries; i++ {
+		var b Bucket
+		item, err := memcache.JSON.Get(ctx, key, &b)
+		if err != nil && err != memcache.ErrCacheMiss {
+			myerr = err
+			return
+		}
+
+		ok, retryAfter = b.Take(rate, now)
+
+		// a bucket left alone long enough is full again, the same as a missing one
+		expiration := time.Duration(rate.Burst) * rate.Every
+		if item == nil {
+			err = memcache.JSON.Add(ctx, &memcache.Item{
+				Key:        key,
+				Object:     b,
+				Expiration: expiration,
+			})
+		} else {
+			item.Object = b
+			item.Expiration = expiration
+			err = memcache.JSON.CompareAndSwap(ctx, item)
+		}
+
+		switch err {
+		case nil:
+			return
+		case memcache.ErrCASConflict, memcache.ErrNotStored:
+			continue
+		default:
+			myerr = err
+			return
+		}
+	}
+
+	myerr = errors.New("ratelimit: too many conflicting updates to the bucket " + key)
+
+	return
+}
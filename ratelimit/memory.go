@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pruneSize is the number of buckets the Memory limiter holds before it drops the full ones
+const pruneSize = 10000
+
+// Memory is a Limiter that keeps the buckets in the process
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+type memoryBucket struct {
+	Bucket
+	rate Rate
+}
+
+// NewMemory creates an in-process Limiter
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: make(map[string]*memoryBucket),
+	}
+}
+
+// Take satisfies the Limiter interface
+func (l *Memory) Take(ctx context.Context, key string, rate Rate, now time.Time) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, found := l.buckets[key]
+	if !found {
+		if len(l.buckets) >= pruneSize {
+			l.prune(now)
+		}
+
+		b = &memoryBucket{}
+		l.buckets[key] = b
+	}
+	b.rate = rate
+
+	ok, retryAfter := b.Take(rate, now)
+
+	return ok, retryAfter, nil
+}
+
+// prune drops the buckets that have refilled, as they are the same as new buckets
+func (l *Memory) prune(now time.Time) {
+	for k, b := range l.buckets {
+		if b.Full(b.rate, now) {
+			delete(l.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package ratelimit limits how often something can be done with token buckets,
+// kept by a pluggable Limiter
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+var limiterContextKey = "holds the Limiter used for the request"
+
+// Default is the Limiter used when none has been attached to the context
+// The in-process limiter only counts the requests made to the same process;
+// sites running several instances should set a Datastore or Memcache limiter
+var Default Limiter = NewMemory()
+
+// Rate is the size and refill rate of a token bucket
+// A bucket holds up to Burst tokens, and gains a token every Every
+type Rate struct {
+	Burst int
+	Every time.Duration
+}
+
+// PerMinute returns the Rate allowing burst requests at once, and perMinute requests a minute after that
+// The rate is off (see Off) if either value is not positive
+func PerMinute(burst, perMinute int) Rate {
+	if burst <= 0 || perMinute <= 0 {
+		return Rate{}
+	}
+
+	return Rate{
+		Burst: burst,
+		Every: time.Minute / time.Duration(perMinute),
+	}
+}
+
+// Off returns true if the rate does not limit anything
+func (r Rate) Off() bool {
+	return r.Burst <= 0 || r.Every <= 0
+}
+
+// Limiter keeps the token buckets, by key
+type Limiter interface {
+	// Take takes a token from the bucket with the given key at the given time,
+	// and returns false and how long until the next token if the bucket is empty
+	Take(ctx context.Context, key string, rate Rate, now time.Time) (ok bool, retryAfter time.Duration, err error)
+}
+
+// NewContext returns a copy of ctx that uses the given Limiter
+func NewContext(ctx context.Context, l Limiter) context.Context {
+	return context.WithValue(ctx, &limiterContextKey, l)
+}
+
+// FromContext returns the Limiter that is stored in context, or the Default if not found
+func FromContext(ctx context.Context) Limiter {
+	if l, ok := ctx.Value(&limiterContextKey).(Limiter); ok && l != nil {
+		return l
+	}
+
+	return Default
+}
+
+// Take takes a token from the bucket with the given key using the context Limiter
+// A rate that is Off always has a token
+func Take(ctx context.Context, key string, rate Rate, now time.Time) (bool, time.Duration, error) {
+	if rate.Off() {
+		return true, 0, nil
+	}
+
+	return FromContext(ctx).Take(ctx, key, rate, now)
+}
+
+// Bucket is the state of a token bucket, for Limiters to store
+type Bucket struct {
+	Tokens  float64   `json:"tokens"`
+	Updated time.Time `json:"updated"` // when the tokens were last counted, zero for a new (full) bucket
+}
+
+// Take refills the bucket up to the given time, and takes a token if there is one
+// If not, it returns false and how long until the next token
+func (b *Bucket) Take(rate Rate, now time.Time) (ok bool, retryAfter time.Duration) {
+	if b.Updated.IsZero() {
+		b.Tokens = float64(rate.Burst)
+	} else if elapsed := now.Sub(b.Updated); elapsed > 0 {
+		b.Tokens += float64(elapsed) / float64(rate.Every)
+	}
+
+	if b.Tokens > float64(rate.Burst) {
+		b.Tokens = float64(rate.Burst)
+	}
+
+	// a clock that went back does not move the bucket back
+	if now.After(b.Updated) {
+		b.Updated = now
+	}
+
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.Tokens) * float64(rate.Every))
+}
+
+// Full returns true if the bucket will have refilled by the given time, so it no longer needs to be kept
+func (b *Bucket) Full(rate Rate, now time.Time) bool {
+	return now.Sub(b.Updated) >= time.Duration((float64(rate.Burst)-b.Tokens)*float64(rate.Every))
+}
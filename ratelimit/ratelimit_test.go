@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benjamw/gogame/store"
+)
+
+func TestBucket(t *testing.T) {
+	rate := Rate{Burst: 2, Every: 10 * time.Second}
+	now := time.Now()
+
+	var b Bucket
+	for i := 0; i < 2; i++ {
+		if ok, _ := b.Take(rate, now); !ok {
+			t.Fatalf("Bucket.Take did not give token %d of the burst.", i+1)
+		}
+	}
+
+	ok, retryAfter := b.Take(rate, now.Add(4*time.Second))
+	if ok || retryAfter != 6*time.Second {
+		t.Fatalf("Bucket.Take did not limit an empty bucket. Got: %v, %v", ok, retryAfter)
+	}
+
+	if ok, _ = b.Take(rate, now.Add(10*time.Second)); !ok {
+		t.Fatal("Bucket.Take did not refill the bucket.")
+	}
+
+	if b.Full(rate, now.Add(20*time.Second)) || !b.Full(rate, now.Add(30*time.Second)) {
+		t.Fatal("Bucket.Full returned the wrong value.")
+	}
+
+	// an hour later the bucket only holds the burst
+	later := now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if ok, _ = b.Take(rate, later); !ok {
+			t.Fatalf("Bucket.Take did not give token %d of the refilled burst.", i+1)
+		}
+	}
+	if ok, _ = b.Take(rate, later); ok {
+		t.Fatal("Bucket.Take refilled the bucket past the burst.")
+	}
+}
+
+func TestLimiters(t *testing.T) {
+	limiters := map[string]Limiter{
+		"Memory":    NewMemory(),
+		"Datastore": Datastore{},
+	}
+
+	rate := PerMinute(1, 6)
+	now := time.Now()
+
+	for name, l := range limiters {
+		ctx := NewContext(store.NewContext(context.Background(), store.NewMemory()), l)
+
+		if ok, _, err := Take(ctx, "a", rate, now); err != nil || !ok {
+			t.Fatalf("%s.Take did not give the first token. Got: %v, %v", name, ok, err)
+		}
+
+		ok, retryAfter, err := Take(ctx, "a", rate, now.Add(time.Second))
+		if err != nil || ok || retryAfter != 9*time.Second {
+			t.Fatalf("%s.Take did not limit the bucket. Got: %v, %v, %v", name, ok, retryAfter, err)
+		}
+
+		if ok, _, err = Take(ctx, "b", rate, now); err != nil || !ok {
+			t.Fatalf("%s.Take shared the bucket between keys. Got: %v, %v", name, ok, err)
+		}
+
+		if ok, _, err = Take(ctx, "a", rate, now.Add(10*time.Second)); err != nil || !ok {
+			t.Fatalf("%s.Take did not refill the bucket. Got: %v, %v", name, ok, err)
+		}
+
+		if ok, _, err = Take(ctx, "a", Rate{}, now); err != nil || !ok {
+			t.Fatalf("Take limited a rate that is off. Got: %v, %v", ok, err)
+		}
+	}
+}
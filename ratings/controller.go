@@ -0,0 +1,180 @@
+// Package ratings keeps a rating per game type for each player,
+// updated through the "RatingUpdate" hook when a game finishes
+package ratings
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/benjamw/golibs/db"
+	"github.com/benjamw/golibs/hooks"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/benjamw/gogame/game"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store"
+)
+
+// MaxLimit is the most ratings or changes returned in one page
+const MaxLimit = 100
+
+// rate updates the ratings of the players in a finished game
+// It listens to the "GameFinish" hook, and runs the "RatingUpdate" hook to change the ratings
+func rate(ctx context.Context, g model.Game, seats model.SeatList) (bool, error) {
+	// abandoned games have no winners to rate
+	if g.Status != model.GameFinished || len(seats) < 2 {
+		return true, nil
+	}
+
+	// the changes are keyed by the game, so a game whose finish is run again is not rated twice
+	if rated, err := isRated(ctx, g, seats); err != nil || rated {
+		return err == nil, err
+	}
+
+	u := &Update{
+		Game:    g,
+		Seats:   seats,
+		Ratings: make(model.RatingList, len(seats)),
+	}
+	for k := range seats {
+		if err := u.Ratings[k].ByPlayer(ctx, seats[k].PlayerKey, g.Type); err != nil {
+			return false, err
+		}
+	}
+
+	before := make([]float64, len(u.Ratings))
+	for k := range u.Ratings {
+		before[k] = u.Ratings[k].Rating
+	}
+
+	if _, err := hooks.Do("RatingUpdate", ctx, u); err != nil {
+		return false, err
+	}
+
+	if u.Skip || !u.Rated {
+		return true, nil
+	}
+
+	for k := range u.Ratings {
+		r := &u.Ratings[k]
+		r.Games++
+		switch seats[k].Result {
+		case model.SeatWon:
+			r.Wins++
+		case model.SeatDraw:
+			r.Draws++
+		default:
+			r.Losses++
+		}
+
+		change := model.RatingChange{
+			PlayerKey: r.PlayerKey,
+			GameType:  g.Type,
+			GameKey:   g.GetKey(),
+			Result:    seats[k].Result,
+			Before:    before[k],
+			After:     r.Rating,
+			Deviation: r.Deviation,
+		}
+
+		// each player's rating is saved with its change in a transaction of its own,
+		// as a transaction can only span a few entity groups
+		err := store.RunInTransaction(ctx, func(ctx context.Context) error {
+			var done model.RatingChange
+			if err := done.ByGame(ctx, r.PlayerKey, g.GetKey()); err == nil {
+				return nil
+			} else if _, ok := err.(*db.UnfoundObjectError); !ok {
+				return err
+			}
+
+			if err := store.Save(ctx, r); err != nil {
+				return err
+			}
+
+			return store.Save(ctx, &change)
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// isRated returns true if the ratings of every player in the game were already changed by it
+func isRated(ctx context.Context, g model.Game, seats model.SeatList) (bool, error) {
+	for _, v := range seats {
+		var change model.RatingChange
+		if err := change.ByGame(ctx, v.PlayerKey, g.GetKey()); err != nil {
+			if _, ok := err.(*db.UnfoundObjectError); ok {
+				return false, nil
+			}
+
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// GetRating returns the player's rating for the game type
+func GetRating(ctx context.Context, playerID, gameType string) (rating model.Rating, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	myerr = rating.ByPlayer(ctx, playerKey, gameType)
+
+	return
+}
+
+// GetHistory returns a page of the changes to the player's rating for the game type, newest first
+func GetHistory(ctx context.Context, playerID, gameType string, limit, offset int) (changes model.RatingChangeList, myerr error) {
+	var playerKey *datastore.Key
+	if playerKey, myerr = datastore.DecodeKey(playerID); myerr != nil {
+		return
+	}
+
+	if limit, offset, myerr = checkPage(limit, offset); myerr != nil {
+		return
+	}
+
+	myerr = changes.ByPlayer(ctx, playerKey, gameType, limit, offset)
+
+	return
+}
+
+// Leaderboard returns a page of the ratings for the game type, highest first,
+// and the players holding them
+func Leaderboard(ctx context.Context, gameType string, limit, offset int) (ratings model.RatingList, players model.PlayerList, myerr error) {
+	if limit, offset, myerr = checkPage(limit, offset); myerr != nil {
+		return
+	}
+
+	if myerr = ratings.Leaderboard(ctx, gameType, limit, offset); myerr != nil {
+		return
+	}
+
+	keys := make([]*datastore.Key, len(ratings))
+	for k := range ratings {
+		keys[k] = ratings[k].PlayerKey
+	}
+
+	myerr = players.ByKeys(ctx, keys)
+
+	return
+}
+
+// checkPage checks the page values, defaulting the limit to MaxLimit
+func checkPage(limit, offset int) (int, int, error) {
+	if limit < 0 || MaxLimit < limit || offset < 0 {
+		return 0, 0, game.NewUserError(nil, http.StatusBadRequest, "Invalid page: limit %d (at most %d), offset %d", limit, MaxLimit, offset)
+	}
+
+	if limit == 0 {
+		limit = MaxLimit
+	}
+
+	return limit, offset, nil
+}
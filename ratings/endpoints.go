@@ -0,0 +1,206 @@
+package ratings
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	gttp "github.com/benjamw/gogame/http"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/session"
+)
+
+func init() {
+	gttp.R.Path("/leaderboard/{gameType:[a-zA-Z0-9_-]+}").
+		Methods("GET").
+		Handler(&gttp.PlayerJSONHandler{handleLeaderboard})
+
+	gttp.R.Path("/rating/{gameType:[a-zA-Z0-9_-]+}").
+		Methods("GET").
+		Handler(&gttp.PlayerJSONHandler{handleRating})
+
+	gttp.R.Path("/rating/{gameType:[a-zA-Z0-9_-]+}/history").
+		Methods("GET").
+		Handler(&gttp.PlayerJSONHandler{handleHistory})
+}
+
+type RatingReply struct {
+	Rank      int       `json:"rank,omitempty"` // the place on the leaderboard, starting at 1
+	PlayerID  string    `json:"player_id"`
+	Username  string    `json:"username,omitempty"`
+	GameType  string    `json:"game_type"`
+	Rating    float64   `json:"rating"`
+	Deviation float64   `json:"deviation"`
+	Games     int64     `json:"games"`
+	Wins      int64     `json:"wins"`
+	Losses    int64     `json:"losses"`
+	Draws     int64     `json:"draws"`
+	Updated   time.Time `json:"updated"`
+}
+
+func (r *RatingReply) Set(m model.Rating) {
+	r.PlayerID = m.PlayerKey.Encode()
+	r.GameType = m.GameType
+	r.Rating = m.Rating
+	r.Deviation = m.Deviation
+	r.Games = m.Games
+	r.Wins = m.Wins
+	r.Losses = m.Losses
+	r.Draws = m.Draws
+	r.Updated = m.Updated
+}
+
+type SingleRatingReply struct {
+	gttp.Response
+	RatingReply
+}
+
+type LeaderboardReply struct {
+	gttp.Response
+	GameType string        `json:"game_type"`
+	Offset   int           `json:"offset"`
+	Ratings  []RatingReply `json:"ratings"`
+}
+
+func (r *LeaderboardReply) Set(l model.RatingList, players model.PlayerList) {
+	r.Ratings = make([]RatingReply, len(l))
+
+	for k, v := range l {
+		r.Ratings[k].Set(v)
+		r.Ratings[k].Rank = r.Offset + k + 1
+		r.Ratings[k].Username = players[k].Username
+	}
+}
+
+type ChangeReply struct {
+	GameID    int64     `json:"game_id"`
+	Result    string    `json:"result"`
+	Before    float64   `json:"before"`
+	After     float64   `json:"after"`
+	Deviation float64   `json:"deviation"`
+	Created   time.Time `json:"created"`
+}
+
+func (r *ChangeReply) Set(m model.RatingChange) {
+	if m.GameKey != nil {
+		r.GameID = m.GameKey.IntID()
+	}
+	r.Result = m.Result
+	r.Before = m.Before
+	r.After = m.After
+	r.Deviation = m.Deviation
+	r.Created = m.Created
+}
+
+type HistoryReply struct {
+	gttp.Response
+	PlayerID string        `json:"player_id"`
+	GameType string        `json:"game_type"`
+	Offset   int           `json:"offset"`
+	Changes  []ChangeReply `json:"changes"`
+}
+
+func (r *HistoryReply) Set(l model.RatingChangeList) {
+	r.Changes = make([]ChangeReply, len(l))
+
+	for k, v := range l {
+		r.Changes[k].Set(v)
+	}
+}
+
+// formPage reads the limit and offset form values
+func formPage(r *http.Request) (limit, offset int, myerr error) {
+	if value := r.FormValue("limit"); value != "" {
+		if limit, myerr = strconv.Atoi(value); myerr != nil {
+			return
+		}
+	}
+
+	if value := r.FormValue("offset"); value != "" {
+		offset, myerr = strconv.Atoi(value)
+	}
+
+	return
+}
+
+// formPlayerID reads the player_id form value, defaulting to the logged in player
+func formPlayerID(r *http.Request, s session.Data) string {
+	if playerID := r.FormValue("player_id"); playerID != "" {
+		return playerID
+	}
+
+	return s.PlayerID
+}
+
+func handleLeaderboard(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	limit, offset, errReply := formPage(r)
+	if errReply != nil {
+		return
+	}
+
+	gameType := gttp.GetURLValue(r, "gameType")
+	ratings, players, errReply := Leaderboard(ctx, gameType, limit, offset)
+	if errReply != nil {
+		return
+	}
+
+	reply := LeaderboardReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+		GameType: gameType,
+		Offset:   offset,
+	}
+	reply.Set(ratings, players)
+
+	replyRaw = reply
+
+	return
+}
+
+func handleRating(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	rating, errReply := GetRating(ctx, formPlayerID(r, s), gttp.GetURLValue(r, "gameType"))
+	if errReply != nil {
+		return
+	}
+
+	reply := SingleRatingReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+	}
+	reply.Set(rating)
+
+	replyRaw = reply
+
+	return
+}
+
+func handleHistory(ctx context.Context, s session.Data, w http.ResponseWriter, r *http.Request) (replyRaw interface{}, errReply error) {
+	limit, offset, errReply := formPage(r)
+	if errReply != nil {
+		return
+	}
+
+	playerID := formPlayerID(r, s)
+	gameType := gttp.GetURLValue(r, "gameType")
+	changes, errReply := GetHistory(ctx, playerID, gameType, limit, offset)
+	if errReply != nil {
+		return
+	}
+
+	reply := HistoryReply{
+		Response: gttp.Response{
+			Success: true,
+		},
+		PlayerID: playerID,
+		GameType: gameType,
+		Offset:   offset,
+	}
+	reply.Set(changes)
+
+	replyRaw = reply
+
+	return
+}
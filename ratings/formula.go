@@ -0,0 +1,93 @@
+package ratings
+
+import (
+	"context"
+	"math"
+)
+
+// EloK is the most an Elo rating can change in one game
+const EloK = 32.0
+
+// MinDeviation keeps Glicko ratings from becoming so certain they stop moving
+const MinDeviation = 30.0
+
+// glickoQ is the Glicko scaling constant, ln(10) / 400
+var glickoQ = math.Ln10 / 400
+
+// Elo updates the ratings with the Elo formula
+// In games with more than two players, each player is rated against every other player
+// and the change is divided between the opponents
+func Elo(ctx context.Context, u *Update) (bool, error) {
+	n := len(u.Ratings)
+	if n < 2 {
+		return true, nil
+	}
+
+	k := EloK / float64(n-1)
+
+	changes := make([]float64, n)
+	for i := range u.Ratings {
+		for j := range u.Ratings {
+			if i == j {
+				continue
+			}
+
+			expected := 1 / (1 + math.Pow(10, (u.Ratings[j].Rating-u.Ratings[i].Rating)/400))
+			changes[i] += k * (u.Score(i, j) - expected)
+		}
+	}
+
+	for i := range u.Ratings {
+		u.Ratings[i].Rating += changes[i]
+	}
+
+	u.Rated = true
+
+	return true, nil
+}
+
+// Glicko updates the ratings and deviations with the Glicko formula,
+// treating the game as a rating period against each of the other players
+func Glicko(ctx context.Context, u *Update) (bool, error) {
+	n := len(u.Ratings)
+	if n < 2 {
+		return true, nil
+	}
+
+	ratings := make([]float64, n)
+	deviations := make([]float64, n)
+	for i := range u.Ratings {
+		var sum, variance float64
+		for j := range u.Ratings {
+			if i == j {
+				continue
+			}
+
+			g := glickoG(u.Ratings[j].Deviation)
+			expected := 1 / (1 + math.Pow(10, -g*(u.Ratings[i].Rating-u.Ratings[j].Rating)/400))
+
+			sum += g * (u.Score(i, j) - expected)
+			variance += g * g * expected * (1 - expected)
+		}
+
+		dSquared := 1 / (glickoQ * glickoQ * variance)
+		precision := 1/(u.Ratings[i].Deviation*u.Ratings[i].Deviation) + 1/dSquared
+
+		ratings[i] = u.Ratings[i].Rating + glickoQ/precision*sum
+		deviations[i] = math.Max(math.Sqrt(1/precision), MinDeviation)
+	}
+
+	for i := range u.Ratings {
+		u.Ratings[i].Rating = ratings[i]
+		u.Ratings[i].Deviation = deviations[i]
+	}
+
+	u.Rated = true
+
+	return true, nil
+}
+
+// glickoG reduces the impact of a game against an opponent with an uncertain rating
+func glickoG(deviation float64) float64 {
+	return 1 / math.Sqrt(1+3*glickoQ*glickoQ*deviation*deviation/(math.Pi*math.Pi))
+}
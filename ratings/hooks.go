@@ -0,0 +1,77 @@
+package ratings
+
+import (
+	"context"
+
+	"github.com/benjamw/golibs/hooks"
+
+	"github.com/benjamw/gogame/model"
+)
+
+func init() {
+	hooks.Register("RatingUpdate", &UpdateListener{})
+
+	// now that the hooks are registered, add the listeners (in listeners.go)
+	listen()
+}
+
+// Update holds the ratings of the players in a finished game while they are being updated
+type Update struct {
+	Game    model.Game
+	Seats   model.SeatList
+	Ratings model.RatingList // the ratings of the players, in seat order, changed in place by the formula
+	Skip    bool             // set by a listener to leave the ratings unchanged
+	Rated   bool             // set by the formula that changed the ratings
+}
+
+// Score returns the score of the player in seat i against the player in seat j:
+// 1 for a win, 0.5 for a draw, and 0 for a loss
+func (u *Update) Score(i, j int) float64 {
+	a, b := rank(u.Seats[i].Result), rank(u.Seats[j].Result)
+
+	switch {
+	case a > b:
+		return 1
+	case a == b:
+		return 0.5
+	}
+
+	return 0
+}
+
+func rank(result string) int {
+	switch result {
+	case model.SeatWon:
+		return 2
+	case model.SeatDraw:
+		return 1
+	}
+
+	return 0
+}
+
+// UpdateListener is a hook that runs when the ratings of the players in a finished game are updated
+// Listeners with a lower priority than the default formula can change the ratings with their own formula
+// and set Rated, or opt the game out of ratings by setting Skip
+type UpdateListener struct {
+	// H is the function that gets processed by the Doer
+	// Parameters:
+	//	The ratings being updated
+	H func(context.Context, *Update) (bool, error)
+}
+
+// Do satisfies the hook.Doer interface
+func (h *UpdateListener) Do(ctx context.Context, p ...interface{}) (bool, error) {
+	if 1 < len(p) {
+		panic("too many parameters passed to rating update doer")
+	}
+
+	var ok bool
+
+	var u *Update
+	if u, ok = p[0].(*Update); !ok {
+		panic("second parameter of rating update doer is of invalid type")
+	}
+
+	return h.H(ctx, u)
+}
@@ -0,0 +1,32 @@
+package ratings
+
+import (
+	"context"
+
+	"github.com/benjamw/golibs/hooks"
+
+	"github.com/benjamw/gogame/config"
+	"github.com/benjamw/gogame/games"
+)
+
+// DefaultPriority is the priority of the default rating formula
+// Listen to "RatingUpdate" with a lower priority to replace the formula or opt out for a game type
+const DefaultPriority = 1000
+
+func listen() {
+	hooks.Listen("GameFinish", &games.GameListener{rate}, 500)
+	hooks.Listen("RatingUpdate", &UpdateListener{listenDefault}, DefaultPriority)
+}
+
+// listenDefault applies the configured rating formula if no earlier listener rated the game
+func listenDefault(ctx context.Context, u *Update) (bool, error) {
+	if u.Skip || u.Rated {
+		return true, nil
+	}
+
+	if config.FromContext(ctx).RatingSystem == "elo" {
+		return Elo(ctx, u)
+	}
+
+	return Glicko(ctx, u)
+}
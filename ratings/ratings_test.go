@@ -0,0 +1,191 @@
+package ratings
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/benjamw/golibs/hooks"
+	"github.com/benjamw/golibs/test"
+
+	"github.com/benjamw/gogame/games"
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/store/storetest"
+)
+
+// FORMULA TESTS
+
+func TestElo(t *testing.T) {
+	u := &Update{
+		Seats: model.SeatList{
+			{Result: model.SeatWon},
+			{Result: model.SeatLost},
+		},
+		Ratings: model.RatingList{
+			{Rating: 1500},
+			{Rating: 1500},
+		},
+	}
+
+	if _, err := Elo(context.Background(), u); err != nil {
+		t.Fatalf("Elo threw an error: %v", err)
+	}
+
+	if !u.Rated || u.Ratings[0].Rating != 1516 || u.Ratings[1].Rating != 1484 {
+		t.Fatalf("Elo did not update the ratings. Got: %v, %v", u.Ratings[0].Rating, u.Ratings[1].Rating)
+	}
+}
+
+func TestGlicko(t *testing.T) {
+	// the example from Glickman's paper: the player beats the first opponent and loses to the others
+	u := &Update{
+		Seats: model.SeatList{
+			{Result: model.SeatDraw},
+			{Result: model.SeatLost},
+			{Result: model.SeatWon},
+			{Result: model.SeatWon},
+		},
+		Ratings: model.RatingList{
+			{Rating: 1500, Deviation: 200},
+			{Rating: 1400, Deviation: 30},
+			{Rating: 1550, Deviation: 100},
+			{Rating: 1700, Deviation: 300},
+		},
+	}
+
+	if _, err := Glicko(context.Background(), u); err != nil {
+		t.Fatalf("Glicko threw an error: %v", err)
+	}
+
+	if !u.Rated || math.Abs(u.Ratings[0].Rating-1464) > 1 || math.Abs(u.Ratings[0].Deviation-151.4) > 1 {
+		t.Fatalf("Glicko did not update the rating. Wanted: 1464 (151.4); Got: %v (%v)", u.Ratings[0].Rating, u.Ratings[0].Deviation)
+	}
+}
+
+// CONTROLLER TESTS
+
+func TestRate(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	g, seats := createFinishedGame(ctx, t, "rated")
+
+	winner, err := GetRating(ctx, seats[1].PlayerKey.Encode(), g.Type)
+	if err != nil {
+		t.Fatalf("GetRating threw an error: %v", err)
+	}
+	if winner.Rating <= model.DefaultRating || winner.Games != 1 || winner.Wins != 1 {
+		t.Fatalf("The winner's rating was not raised. Got: %+v", winner)
+	}
+
+	loser, err := GetRating(ctx, seats[0].PlayerKey.Encode(), g.Type)
+	if err != nil {
+		t.Fatalf("GetRating threw an error: %v", err)
+	}
+	if loser.Rating >= model.DefaultRating || loser.Losses != 1 {
+		t.Fatalf("The loser's rating was not lowered. Got: %+v", loser)
+	}
+
+	changes, err := GetHistory(ctx, seats[1].PlayerKey.Encode(), g.Type, 0, 0)
+	if err != nil {
+		t.Fatalf("GetHistory threw an error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Before != model.DefaultRating || changes[0].After != winner.Rating || !changes[0].GameKey.Equal(g.GetKey()) {
+		t.Fatalf("GetHistory did not return the change. Got: %+v", changes)
+	}
+
+	// a game whose finish is run again is not rated twice
+	if _, err = rate(ctx, g, seats); err != nil {
+		t.Fatalf("rate threw an error: %v", err)
+	}
+	if again, err := GetRating(ctx, seats[1].PlayerKey.Encode(), g.Type); err != nil || again.Rating != winner.Rating || again.Games != 1 {
+		t.Fatalf("rate rated the game twice. Wanted: %v; Got: %+v; Error: %v", winner.Rating, again, err)
+	}
+
+	ratings, players, err := Leaderboard(ctx, g.Type, 0, 0)
+	if err != nil {
+		t.Fatalf("Leaderboard threw an error: %v", err)
+	}
+	if len(ratings) != 2 || !ratings[0].PlayerKey.Equal(seats[1].PlayerKey) || !players[0].GetKey().Equal(seats[1].PlayerKey) {
+		t.Fatalf("Leaderboard did not rank the winner first. Got: %+v", ratings)
+	}
+
+	if ratings, _, err = Leaderboard(ctx, g.Type, 1, 1); err != nil || len(ratings) != 1 || !ratings[0].PlayerKey.Equal(seats[0].PlayerKey) {
+		t.Fatalf("Leaderboard did not return the second page. Got: %+v; Error: %v", ratings, err)
+	}
+
+	if _, _, err = Leaderboard(ctx, g.Type, MaxLimit+1, 0); err == nil {
+		t.Fatal("Leaderboard did not throw an error for a limit that is too large.")
+	}
+}
+
+func TestRateOptOut(t *testing.T) {
+	ctx := storetest.NewContext()
+
+	hooks.Listen("RatingUpdate", &UpdateListener{func(ctx context.Context, u *Update) (bool, error) {
+		switch u.Game.Type {
+		case "unrated":
+			u.Skip = true
+		case "fixed":
+			for k := range u.Ratings {
+				u.Ratings[k].Rating += 100
+			}
+			u.Rated = true
+		}
+
+		return true, nil
+	}}, DefaultPriority-1)
+
+	g, seats := createFinishedGame(ctx, t, "unrated")
+
+	var ratings model.RatingList
+	if err := ratings.Leaderboard(ctx, g.Type, 0, 0); err != nil {
+		t.Fatalf("RatingList.Leaderboard threw an error: %v", err)
+	}
+	if len(ratings) != 0 {
+		t.Fatalf("The game that opted out was rated. Got: %+v", ratings)
+	}
+
+	g, seats = createFinishedGame(ctx, t, "fixed")
+
+	for _, v := range seats {
+		r, err := GetRating(ctx, v.PlayerKey.Encode(), g.Type)
+		if err != nil {
+			t.Fatalf("GetRating threw an error: %v", err)
+		}
+		if r.Rating != model.DefaultRating+100 {
+			t.Fatalf("The game's own formula was not used. Got: %v", r.Rating)
+		}
+	}
+}
+
+// HELPER FUNCTIONS
+
+// createFinishedGame creates a two player game of the given type that was won by the second player
+func createFinishedGame(ctx context.Context, t *testing.T, gameType string) (model.Game, model.SeatList) {
+	file, line, funct := test.GetCaller()
+
+	creator := storetest.SavePlayer(ctx, t)
+	opponent := storetest.SavePlayer(ctx, t)
+
+	g, _, err := games.CreateGame(ctx, creator.GetKey().Encode(), gameType, "", 2, 2)
+	if err != nil {
+		t.Fatalf("Could not create the test Game. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+	}
+
+	gameID := strconv.FormatInt(g.ID, 10)
+	if _, _, err = games.JoinGame(ctx, gameID, opponent.GetKey().Encode()); err != nil {
+		t.Fatalf("Could not join the test Game. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+	}
+
+	if _, _, err = games.StartGame(ctx, gameID, creator.GetKey().Encode()); err != nil {
+		t.Fatalf("Could not start the test Game. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+	}
+
+	g, seats, err := games.ForfeitGame(ctx, gameID, creator.GetKey().Encode())
+	if err != nil {
+		t.Fatalf("Could not finish the test Game. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+	}
+
+	return g, seats
+}
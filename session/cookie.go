@@ -2,6 +2,7 @@ package session
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/binary"
 	"errors"
@@ -84,8 +85,8 @@ type Data struct {
 	PlayerID    string
 }
 
-// Serialize the session data
-func (s *Data) Serialize() (string, error) {
+// Serialize the session data using the cookie keys from the config in the context
+func (s *Data) Serialize(ctx context.Context) (string, error) {
 	var msg bytes.Buffer
 
 	msg.WriteByte(version)
@@ -101,12 +102,16 @@ func (s *Data) Serialize() (string, error) {
 		msg.WriteString(s.PlayerID)
 	}
 
-	return SignAndEncode(msg, config.CookieSignatureKey, config.CookieCryptKey)
+	c := config.FromContext(ctx)
+
+	return SignAndEncode(msg, c.CookieSignatureKey, c.CookieCryptKey)
 }
 
-// Deserialize an encoded string to the session
-func (s *Data) Deserialize(rawString string) error {
-	signedBytes, err := DecodeAndCheckSig(rawString, config.CookieSignatureKey, config.CookieCryptKey)
+// Deserialize an encoded string to the session using the cookie keys from the config in the context
+func (s *Data) Deserialize(ctx context.Context, rawString string) error {
+	c := config.FromContext(ctx)
+
+	signedBytes, err := DecodeAndCheckSig(rawString, c.CookieSignatureKey, c.CookieCryptKey)
 	if err != nil {
 		return err
 	}
@@ -139,8 +144,8 @@ func (s *Data) Deserialize(rawString string) error {
 }
 
 // ToCookie store the session as an encoded cookie with the given name
-func (s *Data) ToCookie(w http.ResponseWriter, name string) error {
-	data, err := s.Serialize()
+func (s *Data) ToCookie(ctx context.Context, w http.ResponseWriter, name string) error {
+	data, err := s.Serialize(ctx)
 	if err != nil {
 		return err
 	}
@@ -160,7 +165,7 @@ func (s *Data) KillCookie(w http.ResponseWriter, name string) error {
 }
 
 // FromCookie pull the session from a cookie with the given name and decode
-func (s *Data) FromCookie(r *http.Request, name string) (found bool, err error) {
+func (s *Data) FromCookie(ctx context.Context, r *http.Request, name string) (found bool, err error) {
 	var c *http.Cookie
 	c, err = r.Cookie(name)
 	if err != nil {
@@ -169,7 +174,7 @@ func (s *Data) FromCookie(r *http.Request, name string) (found bool, err error)
 		return
 	}
 
-	err = s.Deserialize(c.Value)
+	err = s.Deserialize(ctx, c.Value)
 	if err != nil {
 		found = false
 		return
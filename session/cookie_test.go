@@ -2,9 +2,12 @@ package session
 
 import (
 	"bytes"
+	"context"
 	"testing"
 
 	"github.com/benjamw/golibs/random"
+
+	"github.com/benjamw/gogame/config"
 )
 
 var (
@@ -33,12 +36,17 @@ func TestEncodeDecode(t *testing.T) {
 }
 
 func TestPlayerCookie(t *testing.T) {
+	ctx := config.NewContext(context.Background(), &config.Config{
+		CookieCryptKey:     cryptKey,
+		CookieSignatureKey: sigKey,
+	})
+
 	in := Data{
 		IsPlayer: true,
 		PlayerID: random.String(),
 	}
 
-	encoded, err := in.Serialize()
+	encoded, err := in.Serialize(ctx)
 	if err != nil {
 		t.Errorf("Serialize returned an error: %v", err)
 	}
@@ -49,7 +57,7 @@ func TestPlayerCookie(t *testing.T) {
 
 	var out Data
 
-	err = out.Deserialize(encoded)
+	err = out.Deserialize(ctx, encoded)
 	if err != nil {
 		t.Errorf("Deserialize returned an error: %v", err)
 	}
@@ -68,7 +76,7 @@ func TestPlayerCookie(t *testing.T) {
 	in2 := in
 	in2.PlayerID = random.Stringn(1025)
 
-	encoded2, err := in2.Serialize()
+	encoded2, err := in2.Serialize(ctx)
 	if err != nil {
 		t.Errorf("The second Serialize returned an error: %v", err)
 	}
@@ -79,7 +87,7 @@ func TestPlayerCookie(t *testing.T) {
 
 	var out2 Data
 
-	err = out2.Deserialize(encoded2)
+	err = out2.Deserialize(ctx, encoded2)
 	if err != nil {
 		t.Errorf("The second Deserialize returned an error: %v", err)
 	}
@@ -1,12 +1,13 @@
 package session
 
 import (
+	"context"
 	"net/http"
 )
 
 type Cookier interface {
-	Serialize() (string, error)
-	Deserialize(string) error
-	ToCookie(http.ResponseWriter, string) error
-	FromCookie(*http.Request, string) (bool, error)
+	Serialize(context.Context) (string, error)
+	Deserialize(context.Context, string) error
+	ToCookie(context.Context, http.ResponseWriter, string) error
+	FromCookie(context.Context, *http.Request, string) (bool, error)
 }
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"context"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+)
+
+// AppEngine is a Store backed by the App Engine datastore
+type AppEngine struct {
+}
+
+// Load satisfies the Store interface
+func (s *AppEngine) Load(ctx context.Context, key *datastore.Key, m db.Model) (myerr error) {
+	if _, myerr = db.Load(ctx, key, m); myerr != nil {
+		if myerr == datastore.ErrNoSuchEntity {
+			myerr = &db.UnfoundObjectError{
+				EntityType: key.Kind(),
+				Key:        "key",
+				Value:      key.Encode(),
+				Err:        myerr,
+			}
+		}
+
+		return
+	}
+
+	m.SetKey(key)
+	myerr = m.PostLoad(ctx)
+
+	return
+}
+
+// Save satisfies the Store interface
+func (s *AppEngine) Save(ctx context.Context, m db.Model) error {
+	return db.Save(ctx, m)
+}
+
+// Delete satisfies the Store interface
+func (s *AppEngine) Delete(ctx context.Context, m db.Model) error {
+	return db.Delete(ctx, m)
+}
+
+// maxBatch is the most entities the datastore puts or deletes in one call
+const maxBatch = 500
+
+// LoadMulti satisfies the Store interface
+func (s *AppEngine) LoadMulti(ctx context.Context, keys []*datastore.Key, ms []db.Model) (myerr error) {
+	for i := 0; i < len(ms); i += maxBatch {
+		j := i + maxBatch
+		if j > len(ms) {
+			j = len(ms)
+		}
+
+		if myerr = datastore.GetMulti(ctx, keys[i:j], ms[i:j]); myerr != nil {
+			if errs, ok := myerr.(appengine.MultiError); ok {
+				for k, err := range errs {
+					if err == datastore.ErrNoSuchEntity {
+						myerr = &db.UnfoundObjectError{
+							EntityType: keys[i+k].Kind(),
+							Key:        "key",
+							Value:      keys[i+k].Encode(),
+							Err:        err,
+						}
+						break
+					}
+				}
+			}
+
+			return
+		}
+	}
+
+	for k, m := range ms {
+		m.SetKey(keys[k])
+		if myerr = m.PostLoad(ctx); myerr != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// SaveMulti satisfies the Store interface
+func (s *AppEngine) SaveMulti(ctx context.Context, ms []db.Model) (myerr error) {
+	keys := make([]*datastore.Key, len(ms))
+	for k, m := range ms {
+		if myerr = m.PreSave(ctx); myerr != nil {
+			return
+		}
+
+		if keys[k] = m.GetKey(); keys[k] == nil {
+			myerr = &db.MissingKeyError{}
+			return
+		}
+	}
+
+	for i := 0; i < len(ms); i += maxBatch {
+		j := i + maxBatch
+		if j > len(ms) {
+			j = len(ms)
+		}
+
+		var done []*datastore.Key
+		if done, myerr = datastore.PutMulti(ctx, keys[i:j], ms[i:j]); myerr != nil {
+			return
+		}
+		copy(keys[i:j], done)
+	}
+
+	for k, m := range ms {
+		m.SetKey(keys[k])
+		if myerr = m.PostSave(ctx); myerr != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// DeleteMulti satisfies the Store interface
+func (s *AppEngine) DeleteMulti(ctx context.Context, ms []db.Model) (myerr error) {
+	keys := make([]*datastore.Key, len(ms))
+	for k, m := range ms {
+		if myerr = m.PreDelete(ctx); myerr != nil {
+			return
+		}
+
+		if keys[k] = m.GetKey(); keys[k] == nil {
+			myerr = &db.MissingKeyError{}
+			return
+		}
+	}
+
+	for i := 0; i < len(keys); i += maxBatch {
+		j := i + maxBatch
+		if j > len(keys) {
+			j = len(keys)
+		}
+
+		if myerr = datastore.DeleteMulti(ctx, keys[i:j]); myerr != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// GetAll satisfies the Store interface
+func (s *AppEngine) GetAll(ctx context.Context, q *Query, dst interface{}) ([]*datastore.Key, error) {
+	return s.query(q).GetAll(ctx, dst)
+}
+
+// query converts the Query into a datastore.Query
+func (s *AppEngine) query(q *Query) *datastore.Query {
+	dq := datastore.NewQuery(q.kind)
+
+	if q.ancestor != nil {
+		dq = dq.Ancestor(q.ancestor)
+	}
+
+	for _, f := range q.filters {
+		dq = dq.Filter(f.field+" "+f.op, f.value)
+	}
+
+	for _, o := range q.orders {
+		if o.desc {
+			dq = dq.Order("-" + o.field)
+		} else {
+			dq = dq.Order(o.field)
+		}
+	}
+
+	if q.limit > 0 {
+		dq = dq.Limit(q.limit)
+	}
+
+	if q.offset > 0 {
+		dq = dq.Offset(q.offset)
+	}
+
+	return dq
+}
+
+// aeTx marks a context that is in a datastore transaction
+type aeTx struct {
+}
+
+// RunInTransaction satisfies the Store interface
+// The transaction is cross-group, so it can change up to 25 entity groups,
+// and the queries in it must be ancestor queries
+func (s *AppEngine) RunInTransaction(ctx context.Context, f func(ctx context.Context) error) error {
+	if _, ok := txFrom(ctx).(aeTx); ok {
+		return f(ctx)
+	}
+
+	return datastore.RunInTransaction(ctx, func(tc context.Context) error {
+		return f(withTx(tc, aeTx{}))
+	}, &datastore.TransactionOptions{XG: true})
+}
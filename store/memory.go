@@ -0,0 +1,563 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+)
+
+// Memory is a Store that keeps everything in process memory.
+// It is meant for unit tests and small standalone servers
+type Memory struct {
+	mu       sync.RWMutex
+	txMu     sync.Mutex // runs one transaction at a time
+	nextID   int64
+	entities map[string]memEntity
+}
+
+// memTx is a transaction of a Memory store, which keeps the entities
+// it changed as they were before, to put them back on a rollback
+type memTx struct {
+	store *Memory
+	undo  map[string]*memEntity // nil if the entity did not exist
+}
+
+type memEntity struct {
+	key   *datastore.Key
+	props []datastore.Property
+}
+
+// NewMemory creates an empty in-memory Store
+func NewMemory() *Memory {
+	setAppID()
+
+	return &Memory{
+		entities: make(map[string]memEntity),
+	}
+}
+
+// Load satisfies the Store interface
+func (s *Memory) Load(ctx context.Context, key *datastore.Key, m db.Model) error {
+	if key == nil {
+		return &db.MissingKeyError{}
+	}
+
+	s.mu.RLock()
+	e, ok := s.entities[key.String()]
+	s.mu.RUnlock()
+
+	if !ok {
+		return &db.UnfoundObjectError{
+			EntityType: key.Kind(),
+			Key:        "key",
+			Value:      key.String(),
+			Err:        datastore.ErrNoSuchEntity,
+		}
+	}
+
+	if err := loadProps(m, e.props); err != nil {
+		return err
+	}
+
+	m.SetKey(e.key)
+
+	return m.PostLoad(ctx)
+}
+
+// Save satisfies the Store interface
+func (s *Memory) Save(ctx context.Context, m db.Model) error {
+	if err := m.PreSave(ctx); err != nil {
+		return err
+	}
+
+	key := m.GetKey()
+	if key == nil {
+		return &db.MissingKeyError{}
+	}
+
+	props, err := datastore.SaveStruct(m)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if key.Incomplete() {
+		s.nextID++
+		key = datastore.NewKey(ctx, key.Kind(), "", s.nextID, key.Parent())
+	} else if key.StringID() == "" && s.nextID < key.IntID() {
+		// don't hand out IDs that were set manually
+		s.nextID = key.IntID()
+	}
+	s.record(ctx, key.String())
+	s.entities[key.String()] = memEntity{
+		key:   key,
+		props: copyProps(props),
+	}
+	s.mu.Unlock()
+
+	m.SetKey(key)
+
+	return m.PostSave(ctx)
+}
+
+// Delete satisfies the Store interface
+func (s *Memory) Delete(ctx context.Context, m db.Model) error {
+	if err := m.PreDelete(ctx); err != nil {
+		return err
+	}
+
+	key := m.GetKey()
+	if key == nil {
+		return &db.MissingKeyError{}
+	}
+
+	s.mu.Lock()
+	s.record(ctx, key.String())
+	delete(s.entities, key.String())
+	s.mu.Unlock()
+
+	return nil
+}
+
+// LoadMulti satisfies the Store interface
+// Nothing is gained by batching in memory, so the entities are loaded one at a time
+func (s *Memory) LoadMulti(ctx context.Context, keys []*datastore.Key, ms []db.Model) error {
+	for k, m := range ms {
+		if err := s.Load(ctx, keys[k], m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SaveMulti satisfies the Store interface
+// Nothing is gained by batching in memory, so the entities are saved one at a time
+func (s *Memory) SaveMulti(ctx context.Context, ms []db.Model) error {
+	for _, m := range ms {
+		if err := s.Save(ctx, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteMulti satisfies the Store interface
+func (s *Memory) DeleteMulti(ctx context.Context, ms []db.Model) error {
+	for _, m := range ms {
+		if err := s.Delete(ctx, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAll satisfies the Store interface
+func (s *Memory) GetAll(ctx context.Context, q *Query, dst interface{}) ([]*datastore.Key, error) {
+	dv := reflect.ValueOf(dst)
+	if dv.Kind() != reflect.Ptr || dv.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("store: invalid GetAll destination %T, wanted a pointer to a slice", dst)
+	}
+	sv := dv.Elem()
+
+	found := s.run(q)
+
+	keys := make([]*datastore.Key, 0, len(found))
+	for _, e := range found {
+		elem, ptr := newElem(sv.Type().Elem())
+		if err := loadProps(ptr.Interface(), e.props); err != nil {
+			return nil, err
+		}
+
+		sv.Set(reflect.Append(sv, elem))
+		keys = append(keys, e.key)
+	}
+
+	return keys, nil
+}
+
+// RunInTransaction satisfies the Store interface
+// Transactions are run one at a time, but are not isolated from changes made outside of a transaction
+func (s *Memory) RunInTransaction(ctx context.Context, f func(ctx context.Context) error) error {
+	if tx, ok := txFrom(ctx).(*memTx); ok && tx.store == s {
+		return f(ctx)
+	}
+
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	tx := &memTx{
+		store: s,
+		undo:  make(map[string]*memEntity),
+	}
+
+	err := f(withTx(ctx, tx))
+	if err == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	for k, e := range tx.undo {
+		if e == nil {
+			delete(s.entities, k)
+			continue
+		}
+
+		s.entities[k] = *e
+	}
+	s.mu.Unlock()
+
+	return err
+}
+
+// record keeps the entity with the given key as it is, before it is changed in a transaction
+// s.mu must be locked
+func (s *Memory) record(ctx context.Context, key string) {
+	tx, ok := txFrom(ctx).(*memTx)
+	if !ok || tx.store != s {
+		return
+	}
+
+	if _, ok = tx.undo[key]; ok {
+		return
+	}
+
+	if e, ok := s.entities[key]; ok {
+		tx.undo[key] = &e
+		return
+	}
+
+	tx.undo[key] = nil
+}
+
+// run returns the entities matching the query in query order
+func (s *Memory) run(q *Query) []memEntity {
+	s.mu.RLock()
+	found := make([]memEntity, 0)
+	for _, e := range s.entities {
+		if e.key.Kind() != q.kind {
+			continue
+		}
+
+		if q.ancestor != nil && !hasAncestor(e.key, q.ancestor) {
+			continue
+		}
+
+		if !matchFilters(e, q.filters) {
+			continue
+		}
+
+		if !hasOrderProps(e, q.orders) {
+			continue
+		}
+
+		found = append(found, e)
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(found, func(i, j int) bool {
+		for _, o := range q.orders {
+			a, _ := found[i].value(o.field)
+			b, _ := found[j].value(o.field)
+			c, _ := compareValues(a, b)
+			if c == 0 {
+				continue
+			}
+
+			if o.desc {
+				return c > 0
+			}
+
+			return c < 0
+		}
+
+		return compareKeys(found[i].key, found[j].key) < 0
+	})
+
+	if q.offset > 0 {
+		if q.offset >= len(found) {
+			return found[:0]
+		}
+		found = found[q.offset:]
+	}
+
+	if q.limit > 0 && q.limit < len(found) {
+		found = found[:q.limit]
+	}
+
+	return found
+}
+
+// newElem creates a new value for a slice of the given element type,
+// and a pointer to the underlying struct for loading into
+func newElem(t reflect.Type) (elem reflect.Value, ptr reflect.Value) {
+	if t.Kind() == reflect.Ptr {
+		ptr = reflect.New(t.Elem())
+		return ptr, ptr
+	}
+
+	ptr = reflect.New(t)
+	return ptr.Elem(), ptr
+}
+
+func loadProps(dst interface{}, props []datastore.Property) error {
+	err := datastore.LoadStruct(dst, copyProps(props))
+	if _, ok := err.(*datastore.ErrFieldMismatch); ok {
+		// same as the datastore, missing fields are not fatal
+		err = nil
+	}
+
+	return err
+}
+
+func copyProps(props []datastore.Property) []datastore.Property {
+	c := make([]datastore.Property, len(props))
+	copy(c, props)
+
+	for k := range c {
+		if b, ok := c[k].Value.([]byte); ok {
+			c[k].Value = append([]byte(nil), b...)
+		}
+	}
+
+	return c
+}
+
+func hasAncestor(key, ancestor *datastore.Key) bool {
+	for k := key; k != nil; k = k.Parent() {
+		if k.Equal(ancestor) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasOrderProps(e memEntity, orders []order) bool {
+	for _, o := range orders {
+		if _, ok := e.value(o.field); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// value returns the value of the named property of the entity, or its key for KeyField
+func (e memEntity) value(name string) (interface{}, bool) {
+	if name == KeyField {
+		return e.key, true
+	}
+
+	return propValue(e.props, name)
+}
+
+func propValue(props []datastore.Property, name string) (interface{}, bool) {
+	for _, p := range props {
+		if p.Name == name {
+			return p.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// matchFilters returns true if all the filters match at least one value
+// of the filtered property, the same as multi-valued datastore properties
+func matchFilters(e memEntity, filters []filter) bool {
+	for _, f := range filters {
+		if f.field == KeyField {
+			if c, ok := compareValues(e.key, f.value); !ok || !matchOp(c, f.op) {
+				return false
+			}
+
+			continue
+		}
+
+		matched := false
+		for _, p := range e.props {
+			if p.Name != f.field {
+				continue
+			}
+
+			c, ok := compareValues(p.Value, normalize(f.value))
+			if ok && matchOp(c, f.op) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchOp(c int, op string) bool {
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case "=":
+		return c == 0
+	case ">=":
+		return c >= 0
+	case ">":
+		return c > 0
+	}
+
+	return false
+}
+
+// normalize converts filter values into the types used by datastore properties
+func normalize(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	}
+
+	return v
+}
+
+// compareValues compares two property values of the same type.
+// ok is false if the values can not be compared
+func compareValues(a, b interface{}) (c int, ok bool) {
+	a, b = normalize(a), normalize(b)
+
+	switch x := a.(type) {
+	case nil:
+		if b == nil {
+			return 0, true
+		}
+		return -1, true
+	case int64:
+		if y, ok := b.(int64); ok {
+			return compareInts(x, y), true
+		}
+	case float64:
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, true
+			case !x:
+				return -1, true
+			}
+			return 1, true
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			switch {
+			case x.Before(y):
+				return -1, true
+			case x.After(y):
+				return 1, true
+			}
+			return 0, true
+		}
+	case *datastore.Key:
+		if y, ok := b.(*datastore.Key); ok {
+			return compareKeys(x, y), true
+		}
+	}
+
+	if b == nil {
+		return 1, true
+	}
+
+	return 0, false
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+// compareKeys orders keys by path, the same way the datastore does
+func compareKeys(a, b *datastore.Key) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		}
+		return 1
+	}
+
+	pa, pb := keyPath(a), keyPath(b)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if c := strings.Compare(pa[i].Kind(), pb[i].Kind()); c != 0 {
+			return c
+		}
+
+		// integer IDs sort before string IDs
+		sa, sb := pa[i].StringID(), pb[i].StringID()
+		switch {
+		case sa == "" && sb == "":
+			if c := compareInts(pa[i].IntID(), pb[i].IntID()); c != 0 {
+				return c
+			}
+		case sa == "":
+			return -1
+		case sb == "":
+			return 1
+		default:
+			if c := strings.Compare(sa, sb); c != 0 {
+				return c
+			}
+		}
+	}
+
+	return compareInts(int64(len(pa)), int64(len(pb)))
+}
+
+// keyPath returns the key and its ancestors, root first
+func keyPath(key *datastore.Key) []*datastore.Key {
+	path := make([]*datastore.Key, 0)
+	for k := key; k != nil; k = k.Parent() {
+		path = append([]*datastore.Key{k}, path...)
+	}
+
+	return path
+}
@@ -0,0 +1,324 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+)
+
+// thing is a bare bones db.Model used to test the stores
+type thing struct {
+	key       *datastore.Key `datastore:"-"`
+	ParentKey *datastore.Key `datastore:"-"`
+	Name      string
+	Score     int64
+	Created   time.Time
+	preSaved  bool `datastore:"-"`
+	postSaved bool `datastore:"-"`
+}
+
+func (m *thing) EntityType() string                                             { return "Thing" }
+func (m *thing) GetKey() *datastore.Key                                         { return m.key }
+func (m *thing) SetKey(key *datastore.Key) error                                { m.key = key; return nil }
+func (m *thing) IsNew() bool                                                    { return m.key == nil }
+func (m *thing) SetIsNew(isNew bool)                                            {}
+func (m *thing) PostSave(ctx context.Context) error                             { m.postSaved = true; return nil }
+func (m *thing) Transform(ctx context.Context, pl datastore.PropertyList) error { return nil }
+func (m *thing) PreDelete(ctx context.Context) error                            { return nil }
+func (m *thing) Collect(num int) []db.Model                                     { return nil }
+
+func (m *thing) PreSave(ctx context.Context) error {
+	m.preSaved = true
+	if m.key == nil {
+		m.key = datastore.NewIncompleteKey(ctx, m.EntityType(), m.ParentKey)
+	}
+
+	return nil
+}
+
+func (m *thing) PostLoad(ctx context.Context) error {
+	if m.key == nil {
+		return &db.MissingKeyError{}
+	}
+
+	m.ParentKey = m.key.Parent()
+
+	return nil
+}
+
+func createThing(ctx context.Context, t *testing.T, parent *datastore.Key, name string, score int64) thing {
+	th := thing{
+		ParentKey: parent,
+		Name:      name,
+		Score:     score,
+		Created:   time.Now(),
+	}
+	if err := Save(ctx, &th); err != nil {
+		t.Fatalf("Could not save the test thing. Error: %v", err)
+	}
+
+	return th
+}
+
+func TestMemorySaveLoad(t *testing.T) {
+	ctx := NewContext(context.Background(), NewMemory())
+
+	th := createThing(ctx, t, nil, "one", 1)
+	if !th.preSaved || !th.postSaved {
+		t.Fatal("Memory.Save did not run the PreSave and PostSave hooks.")
+	}
+
+	key := th.GetKey()
+	if key == nil || key.Incomplete() {
+		t.Fatalf("Memory.Save did not complete the key. Got: %v", key)
+	}
+
+	var got thing
+	if err := Load(ctx, key, &got); err != nil {
+		t.Fatalf("Memory.Load threw an error: %v", err)
+	}
+	if got.Name != "one" || got.Score != 1 {
+		t.Fatalf("Memory.Load returned the wrong data. Got: %+v", got)
+	}
+	if !got.GetKey().Equal(key) {
+		t.Fatalf("Memory.Load did not set the key. Wanted: %v; Got: %v", key, got.GetKey())
+	}
+
+	var enc thing
+	if err := LoadS(ctx, key.Encode(), &enc); err != nil {
+		t.Fatalf("LoadS threw an error: %v", err)
+	}
+
+	if err := Delete(ctx, &got); err != nil {
+		t.Fatalf("Memory.Delete threw an error: %v", err)
+	}
+
+	err := Load(ctx, key, &got)
+	if _, ok := err.(*db.UnfoundObjectError); !ok {
+		t.Fatalf("Memory.Load threw the wrong error for a deleted entity. Error: %v", err)
+	}
+}
+
+func TestMemoryLoadInt(t *testing.T) {
+	ctx := NewContext(context.Background(), NewMemory())
+
+	th := thing{
+		Name: "manual",
+	}
+	th.SetKey(datastore.NewKey(ctx, th.EntityType(), "", 42, nil))
+	if err := Save(ctx, &th); err != nil {
+		t.Fatalf("Memory.Save threw an error: %v", err)
+	}
+
+	var got thing
+	if err := LoadInt(ctx, 42, &got); err != nil {
+		t.Fatalf("LoadInt threw an error: %v", err)
+	}
+	if got.Name != "manual" {
+		t.Fatalf("LoadInt returned the wrong entity. Got: %+v", got)
+	}
+
+	// the next allocated ID should not clobber the manual one
+	next := createThing(ctx, t, nil, "next", 0)
+	if next.GetKey().IntID() <= 42 {
+		t.Fatalf("Memory.Save allocated an ID that was already used. Got: %d", next.GetKey().IntID())
+	}
+}
+
+func TestMemoryQuery(t *testing.T) {
+	ctx := NewContext(context.Background(), NewMemory())
+
+	parent := createThing(ctx, t, nil, "parent", 0)
+	other := createThing(ctx, t, nil, "other", 0)
+
+	for i := int64(1); i <= 5; i++ {
+		createThing(ctx, t, parent.GetKey(), "child", i)
+	}
+	createThing(ctx, t, other.GetKey(), "child", 10)
+
+	var things []thing
+	keys, err := NewQuery("Thing").
+		Ancestor(parent.GetKey()).
+		Filter("Name =", "child").
+		Filter("Score >=", 2).
+		Order("-Score").
+		GetAll(ctx, &things)
+	if err != nil {
+		t.Fatalf("Memory.GetAll threw an error: %v", err)
+	}
+
+	if len(things) != 4 || len(keys) != 4 {
+		t.Fatalf("Memory.GetAll returned the wrong number of results. Wanted: 4; Got: %d", len(things))
+	}
+
+	for k := range things {
+		if want := int64(5 - k); things[k].Score != want {
+			t.Fatalf("Memory.GetAll returned the wrong order. Wanted: %d; Got: %d", want, things[k].Score)
+		}
+
+		if !keys[k].Parent().Equal(parent.GetKey()) {
+			t.Fatalf("Memory.GetAll returned an entity outside of the ancestor. Got: %v", keys[k])
+		}
+	}
+
+	var limited []*thing
+	_, err = NewQuery("Thing").
+		Filter("Name =", "child").
+		Order("Score").
+		Offset(1).
+		Limit(2).
+		GetAll(ctx, &limited)
+	if err != nil {
+		t.Fatalf("Memory.GetAll threw an error: %v", err)
+	}
+
+	if len(limited) != 2 || limited[0].Score != 2 || limited[1].Score != 3 {
+		t.Fatalf("Memory.GetAll did not apply the offset and limit. Got: %d results", len(limited))
+	}
+}
+
+func TestMemoryTransaction(t *testing.T) {
+	checkTransaction(NewContext(context.Background(), NewMemory()), t, "Memory")
+}
+
+// checkTransaction fails the test if the context store does not commit and roll back transactions
+func checkTransaction(ctx context.Context, t *testing.T, name string) {
+	th := createThing(ctx, t, nil, "before", 1)
+
+	fail := errors.New("roll back")
+	var added thing
+	err := RunInTransaction(ctx, func(ctx context.Context) error {
+		th.Name = "during"
+		if err := Save(ctx, &th); err != nil {
+			return err
+		}
+
+		added = createThing(ctx, t, nil, "added", 2)
+
+		// a nested transaction is part of the outer one
+		return RunInTransaction(ctx, func(ctx context.Context) error {
+			return fail
+		})
+	})
+	if err != fail {
+		t.Fatalf("%s.RunInTransaction did not return the error. Got: %v", name, err)
+	}
+
+	var got thing
+	if err = Load(ctx, th.GetKey(), &got); err != nil || got.Name != "before" {
+		t.Fatalf("%s.RunInTransaction did not roll back a change. Got: %+v, %v", name, got, err)
+	}
+	if err = Load(ctx, added.GetKey(), &got); err == nil {
+		t.Fatalf("%s.RunInTransaction did not roll back a new entity.", name)
+	}
+
+	err = RunInTransaction(ctx, func(ctx context.Context) error {
+		th.Name = "after"
+		return Save(ctx, &th)
+	})
+	if err != nil {
+		t.Fatalf("%s.RunInTransaction threw an error: %v", name, err)
+	}
+	if err = Load(ctx, th.GetKey(), &got); err != nil || got.Name != "after" {
+		t.Fatalf("%s.RunInTransaction did not commit the change. Got: %+v, %v", name, got, err)
+	}
+}
+
+func TestMemoryKeyQuery(t *testing.T) {
+	checkKeyQuery(NewContext(context.Background(), NewMemory()), t, "Memory")
+}
+
+// checkKeyQuery fails the test if the context store does not filter and order on keys the same way
+func checkKeyQuery(ctx context.Context, t *testing.T, name string) {
+	for i := 0; i < 5; i++ {
+		createThing(ctx, t, nil, "tied", 1)
+	}
+
+	var things []thing
+	keys, err := NewQuery("Thing").
+		Filter("Score =", 1).
+		Order("-"+KeyField).
+		GetAll(ctx, &things)
+	if err != nil || len(keys) != 5 {
+		t.Fatalf("%s.GetAll did not order on the keys. Got: %d, %v", name, len(keys), err)
+	}
+
+	// reading on past the second key finds the rest in the same order
+	var rest []thing
+	restKeys, err := NewQuery("Thing").
+		Filter("Score =", 1).
+		Filter(KeyField+" <", keys[1]).
+		Order("-"+KeyField).
+		GetAll(ctx, &rest)
+	if err != nil {
+		t.Fatalf("%s.GetAll threw an error: %v", name, err)
+	}
+	if len(restKeys) != 3 {
+		t.Fatalf("%s.GetAll did not filter on the keys. Wanted: 3; Got: %d", name, len(restKeys))
+	}
+	for k := range restKeys {
+		if !restKeys[k].Equal(keys[k+2]) {
+			t.Fatalf("%s.GetAll filtered on the keys out of order. Wanted: %v; Got: %v", name, keys[k+2], restKeys[k])
+		}
+	}
+}
+
+func TestMemoryMulti(t *testing.T) {
+	checkMulti(NewContext(context.Background(), NewMemory()), t, "Memory")
+}
+
+// checkMulti fails the test if the context store does not load, save and delete entities together
+func checkMulti(ctx context.Context, t *testing.T, name string) {
+	kept := createThing(ctx, t, nil, "kept", 1)
+	kept.Score = 2
+
+	added := []thing{{Name: "one", Score: 1}, {Name: "two", Score: 1}}
+	ms := []db.Model{&kept, &added[0], &added[1]}
+	if err := SaveMulti(ctx, ms); err != nil {
+		t.Fatalf("%s.SaveMulti threw an error: %v", name, err)
+	}
+
+	for _, v := range ms {
+		th := v.(*thing)
+		if th.GetKey() == nil || th.GetKey().Incomplete() || !th.preSaved || !th.postSaved {
+			t.Fatalf("%s.SaveMulti did not save %s with its hooks. Got: %+v", name, th.Name, th)
+		}
+
+		var got thing
+		if err := Load(ctx, th.GetKey(), &got); err != nil || got.Name != th.Name || got.Score != th.Score {
+			t.Fatalf("%s.SaveMulti did not store %s. Got: %+v, %v", name, th.Name, got, err)
+		}
+	}
+
+	keys := []*datastore.Key{added[1].GetKey(), kept.GetKey(), added[0].GetKey()}
+	loaded := make([]thing, len(keys))
+	if err := LoadMulti(ctx, keys, []db.Model{&loaded[0], &loaded[1], &loaded[2]}); err != nil {
+		t.Fatalf("%s.LoadMulti threw an error: %v", name, err)
+	}
+	for k, v := range []thing{added[1], kept, added[0]} {
+		if !loaded[k].GetKey().Equal(v.GetKey()) || loaded[k].Name != v.Name || loaded[k].Score != v.Score {
+			t.Fatalf("%s.LoadMulti loaded the wrong entity for %s. Got: %+v", name, v.Name, loaded[k])
+		}
+	}
+
+	if err := DeleteMulti(ctx, []db.Model{&added[0], &added[1]}); err != nil {
+		t.Fatalf("%s.DeleteMulti threw an error: %v", name, err)
+	}
+
+	err := LoadMulti(ctx, keys, []db.Model{new(thing), new(thing), new(thing)})
+	if _, ok := err.(*db.UnfoundObjectError); !ok {
+		t.Fatalf("%s.LoadMulti did not throw an UnfoundObjectError for a deleted entity. Error: %v", name, err)
+	}
+
+	var things []thing
+	if _, err := NewQuery("Thing").GetAll(ctx, &things); err != nil {
+		t.Fatalf("%s.GetAll threw an error: %v", name, err)
+	}
+	if len(things) != 1 || things[0].Name != "kept" {
+		t.Fatalf("%s.DeleteMulti did not remove only the given entities. Got: %+v", name, things)
+	}
+}
@@ -0,0 +1,407 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Migration is a single versioned change to the SQL schema
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string // the statements to run, in order
+}
+
+// Migrations holds the schema changes for the SQL store.
+// Never edit a migration that has already been released, add a new one instead.
+// Games that add their own models should append their tables here
+// (with a version number above 1000) before calling SQL.Migrate
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create core tables",
+		Up: concat(
+			[]string{
+				`CREATE TABLE "key_sequence" ("next_id" BIGINT NOT NULL)`,
+				`INSERT INTO "key_sequence" ("next_id") VALUES (0)`,
+			},
+			entityTable("player",
+				`"username" TEXT`,
+				`"email" TEXT`,
+				`"password_hash" TEXT`,
+				`"is_admin" BOOLEAN`,
+				`"created" BIGINT`,
+				`"approved" BIGINT`,
+			),
+			index("player", "email"),
+			entityTable("room",
+				`"id" BIGINT`,
+				`"name" TEXT`,
+			),
+			entityTable("chat",
+				`"room_key" TEXT`,
+				`"player_key" TEXT`,
+				`"message" TEXT`,
+				`"created" BIGINT`,
+			),
+			index("chat", "created"),
+			entityTable("mute",
+				`"muted_key" TEXT`,
+			),
+			entityTable("forgot_token",
+				`"value" TEXT`,
+				`"expires" BIGINT`,
+			),
+			index("forgot_token", "value"),
+			index("forgot_token", "expires"),
+			entityTable("delete_token",
+				`"value" TEXT`,
+				`"expires" BIGINT`,
+			),
+			index("delete_token", "value"),
+			index("delete_token", "expires"),
+		),
+	},
+	{
+		Version: 2,
+		Name:    "create game tables",
+		Up: concat(
+			entityTable("game",
+				`"id" BIGINT`,
+				`"type" TEXT`,
+				`"name" TEXT`,
+				`"status" TEXT`,
+				`"creator_key" TEXT`,
+				`"min_players" BIGINT`,
+				`"max_players" BIGINT`,
+				`"created" BIGINT`,
+				`"started" BIGINT`,
+				`"finished" BIGINT`,
+			),
+			index("game", "status", "created"),
+			entityTable("seat",
+				`"player_key" TEXT`,
+				`"position" BIGINT`,
+				`"result" TEXT`,
+				`"joined" BIGINT`,
+			),
+			index("seat", "player_key"),
+		),
+	},
+	{
+		Version: 3,
+		Name:    "add game moves",
+		Up: concat(
+			[]string{
+				`ALTER TABLE "game" ADD COLUMN "state" TEXT`,
+				`ALTER TABLE "game" ADD COLUMN "move_count" BIGINT`,
+			},
+			entityTable("move",
+				`"player_key" TEXT`,
+				`"position" BIGINT`,
+				`"number" BIGINT`,
+				`"data" TEXT`,
+				`"state" TEXT`,
+				`"created" BIGINT`,
+			),
+		),
+	},
+	{
+		Version: 4,
+		Name:    "add game history and undo",
+		Up: []string{
+			`ALTER TABLE "game" ADD COLUMN "setup" TEXT`,
+			`ALTER TABLE "game" ADD COLUMN "undo_number" BIGINT`,
+			`ALTER TABLE "game" ADD COLUMN "undo_key" TEXT`,
+			`ALTER TABLE "move" ADD COLUMN "undone" BOOLEAN`,
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add turn timers",
+		Up: concat(
+			[]string{
+				`ALTER TABLE "game" ADD COLUMN "timer_mode" TEXT`,
+				`ALTER TABLE "game" ADD COLUMN "turn_limit" BIGINT`,
+				`ALTER TABLE "game" ADD COLUMN "timeout" TEXT`,
+				`ALTER TABLE "game" ADD COLUMN "deadline" BIGINT`,
+				`ALTER TABLE "move" ADD COLUMN "timed_out" BOOLEAN`,
+			},
+			index("game", "status", "deadline"),
+		),
+	},
+	{
+		Version: 6,
+		Name:    "create matchmaking queue",
+		Up: concat(
+			entityTable("ticket",
+				`"game_type" TEXT`,
+				`"status" TEXT`,
+				`"rating" BIGINT`,
+				`"min_rating" BIGINT`,
+				`"max_rating" BIGINT`,
+				`"min_players" BIGINT`,
+				`"max_players" BIGINT`,
+				`"game_key" TEXT`,
+				`"created" BIGINT`,
+				`"matched" BIGINT`,
+			),
+			index("ticket", "game_type", "status", "created"),
+		),
+	},
+	{
+		Version: 7,
+		Name:    "create ratings",
+		Up: concat(
+			entityTable("rating",
+				`"game_type" TEXT`,
+				`"rating" DOUBLE PRECISION`,
+				`"deviation" DOUBLE PRECISION`,
+				`"games" BIGINT`,
+				`"wins" BIGINT`,
+				`"losses" BIGINT`,
+				`"draws" BIGINT`,
+				`"updated" BIGINT`,
+			),
+			index("rating", "game_type", "rating"),
+			entityTable("rating_change",
+				`"game_type" TEXT`,
+				`"game_key" TEXT`,
+				`"result" TEXT`,
+				`"before" DOUBLE PRECISION`,
+				`"after" DOUBLE PRECISION`,
+				`"deviation" DOUBLE PRECISION`,
+				`"created" BIGINT`,
+			),
+			index("rating_change", "parent_key", "game_type", "created"),
+		),
+	},
+	{
+		Version: 8,
+		Name:    "add mute scopes",
+		Up: []string{
+			`ALTER TABLE "mute" ADD COLUMN "scope_key" TEXT`,
+			`ALTER TABLE "mute" ADD COLUMN "expires" BIGINT`,
+			`ALTER TABLE "mute" ADD COLUMN "exempt" BOOLEAN`,
+		},
+	},
+	{
+		Version: 9,
+		Name:    "create sanctions",
+		Up: concat(
+			entityTable("sanction",
+				`"kind" TEXT`,
+				`"room_key" TEXT`,
+				`"admin_key" TEXT`,
+				`"reason" TEXT`,
+				`"created" BIGINT`,
+				`"expires" BIGINT`,
+				`"lifted" BIGINT`,
+				`"lifter_key" TEXT`,
+			),
+			index("sanction", "created"),
+		),
+	},
+	{
+		Version: 10,
+		Name:    "create chat seen markers",
+		Up: entityTable("chat_seen",
+			`"room_key" TEXT`,
+			`"last_message_seen_date" BIGINT`,
+			`"date_seen" BIGINT`,
+		),
+	},
+	{
+		Version: 11,
+		Name:    "add room retention",
+		Up: []string{
+			`ALTER TABLE "room" ADD COLUMN "keep_last" BIGINT`,
+			`ALTER TABLE "room" ADD COLUMN "max_age" BIGINT`,
+			`ALTER TABLE "room" ADD COLUMN "kept_from" BIGINT`,
+		},
+	},
+	{
+		Version: 12,
+		Name:    "add room types and members",
+		Up: concat(
+			[]string{
+				`ALTER TABLE "room" ADD COLUMN "type" TEXT`,
+			},
+			entityTable("member",
+				`"player_key" TEXT`,
+				`"joined" BIGINT`,
+			),
+			index("member", "player_key", "joined"),
+		),
+	},
+	{
+		Version: 13,
+		Name:    "add chat edits, deletes and reactions",
+		Up: concat(
+			[]string{
+				`ALTER TABLE "chat" ADD COLUMN "edited" BIGINT`,
+				`ALTER TABLE "chat" ADD COLUMN "deleted" BIGINT`,
+				`ALTER TABLE "chat" ADD COLUMN "deleter_key" TEXT`,
+			},
+			entityTable("chat_edit",
+				`"message" TEXT`,
+				`"edited" BIGINT`,
+			),
+			entityTable("reaction",
+				`"player_key" TEXT`,
+				`"emoji" TEXT`,
+				`"created" BIGINT`,
+			),
+		),
+	},
+	{
+		Version: 14,
+		Name:    "create rate buckets",
+		Up: entityTable("rate_bucket",
+			`"tokens" DOUBLE PRECISION`,
+			`"updated" BIGINT`,
+		),
+	},
+	{
+		Version: 15,
+		Name:    "create chat search index",
+		Up: concat(
+			entityTable("chat_term",
+				`"term" TEXT`,
+				`"player_key" TEXT`,
+				`"created" BIGINT`,
+			),
+			index("chat_term", "term", "created"),
+		),
+	},
+	{
+		Version: 16,
+		Name:    "create notifications",
+		Up: concat(
+			[]string{
+				`ALTER TABLE "player" ADD COLUMN "notify" TEXT`,
+			},
+			entityTable("notification",
+				`"kind" TEXT`,
+				`"from_key" TEXT`,
+				`"room_key" TEXT`,
+				`"chat_key" TEXT`,
+				`"message" TEXT`,
+				`"created" BIGINT`,
+				`"unread" BOOLEAN`,
+				`"read" BIGINT`,
+			),
+		),
+	},
+	{
+		Version: 17,
+		Name:    "add system chats",
+		Up: []string{
+			`ALTER TABLE "chat" ADD COLUMN "type" TEXT`,
+			`ALTER TABLE "chat" ADD COLUMN "event" TEXT`,
+			`ALTER TABLE "chat" ADD COLUMN "data" TEXT`,
+		},
+	},
+}
+
+// entityTable returns the statements to create a table for an entity type
+// with the key columns used by the SQL store, and the given property columns
+func entityTable(table string, columns ...string) []string {
+	cols := append([]string{
+		`"entity_key" TEXT PRIMARY KEY`,
+		`"parent_key" TEXT`,
+		`"path" TEXT NOT NULL`,
+	}, columns...)
+
+	return []string{
+		fmt.Sprintf("CREATE TABLE %s (%s)", quote(table), strings.Join(cols, ", ")),
+		index(table, "parent_key")[0],
+		index(table, "path")[0],
+	}
+}
+
+// index returns the statement to create an index on the given table columns
+func index(table string, columns ...string) []string {
+	return []string{
+		fmt.Sprintf("CREATE INDEX %s ON %s (%s)", quote(table+"_"+strings.Join(columns, "_")), quote(table), quoteAll(columns)),
+	}
+}
+
+func concat(stmts ...[]string) []string {
+	all := make([]string, 0)
+	for _, s := range stmts {
+		all = append(all, s...)
+	}
+
+	return all
+}
+
+// Migrate brings the database schema up to date with the Migrations
+// and returns the number of migrations that were applied
+func (s *SQL) Migrate(ctx context.Context) (applied int, myerr error) {
+	_, myerr = s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS "schema_migrations" (`+
+		`"version" BIGINT PRIMARY KEY, "name" TEXT NOT NULL, "applied" BIGINT NOT NULL)`)
+	if myerr != nil {
+		return
+	}
+
+	var current int
+	row := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX("version"), 0) FROM "schema_migrations"`)
+	if myerr = row.Scan(&current); myerr != nil {
+		return
+	}
+
+	migrations := make([]Migration, len(Migrations))
+	copy(migrations, Migrations)
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		if myerr = s.migrate(ctx, m); myerr != nil {
+			myerr = fmt.Errorf("store: migration %d (%s) failed: %v", m.Version, m.Name, myerr)
+			return
+		}
+
+		applied++
+	}
+
+	return
+}
+
+// migrate applies a single migration in a transaction
+func (s *SQL) migrate(ctx context.Context, m Migration) (myerr error) {
+	tx, myerr := s.db.BeginTx(ctx, nil)
+	if myerr != nil {
+		return
+	}
+
+	defer func() {
+		if myerr != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, stmt := range m.Up {
+		if _, myerr = tx.ExecContext(ctx, stmt); myerr != nil {
+			return
+		}
+	}
+
+	_, myerr = tx.ExecContext(ctx, s.rebind(`INSERT INTO "schema_migrations" ("version", "name", "applied") VALUES (?, ?, ?)`),
+		m.Version, m.Name, time.Now().Unix())
+	if myerr != nil {
+		return
+	}
+
+	myerr = tx.Commit()
+
+	return
+}
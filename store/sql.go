@@ -0,0 +1,904 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/benjamw/golibs/db"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"google.golang.org/appengine/datastore"
+)
+
+// the SQL dialects supported by the SQL store
+const (
+	SQLite   = "sqlite"
+	Postgres = "postgres"
+)
+
+var (
+	keyType  = reflect.TypeOf(&datastore.Key{})
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// SQL is a Store backed by a relational database (SQLite or Postgres).
+// Every entity type is stored in its own table, created by the migrations
+// in migrations.go, with the following extra columns:
+//
+//	entity_key: the encoded datastore key (primary key)
+//	parent_key: the encoded parent key, if any
+//	path:       the full key path, used for ancestor queries
+//
+// Times are stored as microseconds since the Unix epoch (UTC)
+// and keys are stored in their encoded form.
+type SQL struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQL creates a SQL store on the given database connection.
+// The connection must already be open, and Migrate should be run
+// before the store is used
+func NewSQL(conn *sql.DB, dialect string) (*SQL, error) {
+	switch dialect {
+	case SQLite, Postgres:
+	default:
+		return nil, fmt.Errorf("store: unknown SQL dialect %q", dialect)
+	}
+
+	setAppID()
+
+	return &SQL{
+		db:      conn,
+		dialect: dialect,
+	}, nil
+}
+
+// DB returns the underlying database connection
+func (s *SQL) DB() *sql.DB {
+	return s.db
+}
+
+// execer runs statements on the database, or in a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// sqlTx is a transaction of a SQL store
+type sqlTx struct {
+	store *SQL
+	tx    *sql.Tx
+}
+
+// maxTxAttempts is the number of times a transaction is run before its conflict is returned
+const maxTxAttempts = 3
+
+// tx returns the transaction of the store that is stored in context, or nil if not in one
+func (s *SQL) tx(ctx context.Context) *sql.Tx {
+	if t, ok := txFrom(ctx).(*sqlTx); ok && t.store == s {
+		return t.tx
+	}
+
+	return nil
+}
+
+// conn returns the transaction the context is in, or the database if not in one
+func (s *SQL) conn(ctx context.Context) execer {
+	if tx := s.tx(ctx); tx != nil {
+		return tx
+	}
+
+	return s.db
+}
+
+// Load satisfies the Store interface
+func (s *SQL) Load(ctx context.Context, key *datastore.Key, m db.Model) error {
+	if key == nil {
+		return &db.MissingKeyError{}
+	}
+
+	table, err := tableName(key.Kind())
+	if err != nil {
+		return err
+	}
+
+	fields, err := propFields(reflect.TypeOf(m))
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE "entity_key" = ?`, selectColumns(fields), quote(table))
+	row := s.conn(ctx).QueryRowContext(ctx, s.rebind(query), key.Encode())
+
+	_, props, err := scanEntity(row, fields)
+	if err == sql.ErrNoRows {
+		return &db.UnfoundObjectError{
+			EntityType: key.Kind(),
+			Key:        "key",
+			Value:      key.Encode(),
+			Err:        datastore.ErrNoSuchEntity,
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = loadProps(m, props); err != nil {
+		return err
+	}
+
+	m.SetKey(key)
+
+	return m.PostLoad(ctx)
+}
+
+// LoadMulti satisfies the Store interface
+// The entities of each table are read with one statement
+func (s *SQL) LoadMulti(ctx context.Context, keys []*datastore.Key, ms []db.Model) error {
+	var tables []string
+	byTable := make(map[string][]int) // the indexes of the keys in each table
+	for k, key := range keys {
+		if key == nil {
+			return &db.MissingKeyError{}
+		}
+
+		table, err := tableName(key.Kind())
+		if err != nil {
+			return err
+		}
+
+		if _, ok := byTable[table]; !ok {
+			tables = append(tables, table)
+		}
+		byTable[table] = append(byTable[table], k)
+	}
+
+	found := make(map[string][]datastore.Property, len(keys))
+	for _, table := range tables {
+		fields, err := propFields(reflect.TypeOf(ms[byTable[table][0]]))
+		if err != nil {
+			return err
+		}
+
+		for rest := byTable[table]; len(rest) > 0; {
+			n := len(rest)
+			if n > maxParams {
+				n = maxParams
+			}
+
+			args := make([]interface{}, n)
+			for k, i := range rest[:n] {
+				args[k] = keys[i].Encode()
+			}
+
+			if err = s.selectRows(ctx, table, fields, args, found); err != nil {
+				return err
+			}
+
+			rest = rest[n:]
+		}
+	}
+
+	for k, key := range keys {
+		props, ok := found[key.Encode()]
+		if !ok {
+			return &db.UnfoundObjectError{
+				EntityType: key.Kind(),
+				Key:        "key",
+				Value:      key.Encode(),
+				Err:        datastore.ErrNoSuchEntity,
+			}
+		}
+
+		if err := loadProps(ms[k], props); err != nil {
+			return err
+		}
+
+		ms[k].SetKey(key)
+		if err := ms[k].PostLoad(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// selectRows reads the rows of the table with the given encoded keys into found, by encoded key
+func (s *SQL) selectRows(ctx context.Context, table string, fields []propField, keys []interface{}, found map[string][]datastore.Property) error {
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE "entity_key" IN (%s)`, selectColumns(fields), quote(table), placeholders(len(keys)))
+	rows, err := s.conn(ctx).QueryContext(ctx, s.rebind(query), keys...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		key, props, err := scanEntity(rows, fields)
+		if err != nil {
+			return err
+		}
+
+		found[key.Encode()] = props
+	}
+
+	return rows.Err()
+}
+
+// Save satisfies the Store interface
+func (s *SQL) Save(ctx context.Context, m db.Model) error {
+	return s.SaveMulti(ctx, []db.Model{m})
+}
+
+// SaveMulti satisfies the Store interface
+// The entities of each table are stored with one statement
+func (s *SQL) SaveMulti(ctx context.Context, ms []db.Model) (myerr error) {
+	for _, m := range ms {
+		if myerr = m.PreSave(ctx); myerr != nil {
+			return
+		}
+	}
+
+	keys := make([]*datastore.Key, len(ms))
+	var batch sqlRows
+	for k, m := range ms {
+		var table string
+		var cols []string
+		var vals []interface{}
+		if keys[k], table, cols, vals, myerr = s.row(ctx, m); myerr != nil {
+			return
+		}
+
+		// models of the same type have the same columns, so they go in together
+		if batch.table != table || strings.Join(batch.cols, ",") != strings.Join(cols, ",") || len(batch.vals)+len(vals) > maxParams {
+			if myerr = s.upsert(ctx, batch); myerr != nil {
+				return
+			}
+
+			batch = sqlRows{table: table, cols: cols}
+		}
+		batch.vals = append(batch.vals, vals...)
+		batch.n++
+	}
+
+	if myerr = s.upsert(ctx, batch); myerr != nil {
+		return
+	}
+
+	for k, m := range ms {
+		m.SetKey(keys[k])
+		if myerr = m.PostSave(ctx); myerr != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// maxParams is the most values bound to one statement, the lowest limit of the dialects
+const maxParams = 999
+
+// sqlRows are the rows to store in a table with one statement
+type sqlRows struct {
+	table string
+	cols  []string
+	vals  []interface{}
+	n     int
+}
+
+// row returns the completed key, table, columns and values to store the model
+func (s *SQL) row(ctx context.Context, m db.Model) (key *datastore.Key, table string, cols []string, vals []interface{}, myerr error) {
+	if key = m.GetKey(); key == nil {
+		myerr = &db.MissingKeyError{}
+		return
+	}
+
+	if table, myerr = tableName(key.Kind()); myerr != nil {
+		return
+	}
+
+	props, myerr := datastore.SaveStruct(m)
+	if myerr != nil {
+		return
+	}
+
+	if key.Incomplete() {
+		var id int64
+		if id, myerr = s.allocateID(ctx); myerr != nil {
+			return
+		}
+
+		key = datastore.NewKey(ctx, key.Kind(), "", id, key.Parent())
+	} else if key.StringID() == "" {
+		// don't hand out IDs that were set manually
+		if myerr = s.reserveID(ctx, key.IntID()); myerr != nil {
+			return
+		}
+	}
+
+	cols = []string{"entity_key", "parent_key", "path"}
+	vals = []interface{}{key.Encode(), encodeKey(key.Parent()), key.String()}
+	seen := make(map[string]bool, len(props))
+	for _, p := range props {
+		if seen[p.Name] || p.Multiple {
+			myerr = fmt.Errorf("store: multi-valued property %s.%s is not supported by the SQL store", key.Kind(), p.Name)
+			return
+		}
+		seen[p.Name] = true
+
+		cols = append(cols, columnName(p.Name))
+		vals = append(vals, toSQL(p.Value))
+	}
+
+	return
+}
+
+// upsert stores the rows, replacing the rows with the same keys
+func (s *SQL) upsert(ctx context.Context, rows sqlRows) error {
+	if rows.n == 0 {
+		return nil
+	}
+
+	values := make([]string, rows.n)
+	for k := range values {
+		values[k] = "(" + placeholders(len(rows.cols)) + ")"
+	}
+
+	updates := make([]string, 0, len(rows.cols))
+	for _, c := range rows.cols[1:] {
+		updates = append(updates, fmt.Sprintf("%s = excluded.%s", quote(c), quote(c)))
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES %s ON CONFLICT ("entity_key") DO UPDATE SET %s`,
+		quote(rows.table), quoteAll(rows.cols), strings.Join(values, ", "), strings.Join(updates, ", "))
+	_, err := s.conn(ctx).ExecContext(ctx, s.rebind(query), rows.vals...)
+
+	return err
+}
+
+// Delete satisfies the Store interface
+func (s *SQL) Delete(ctx context.Context, m db.Model) error {
+	return s.DeleteMulti(ctx, []db.Model{m})
+}
+
+// DeleteMulti satisfies the Store interface
+// The entities of each table are removed with one statement
+func (s *SQL) DeleteMulti(ctx context.Context, ms []db.Model) error {
+	for _, m := range ms {
+		if err := m.PreDelete(ctx); err != nil {
+			return err
+		}
+	}
+
+	var tables []string
+	keys := make(map[string][]interface{})
+	for _, m := range ms {
+		key := m.GetKey()
+		if key == nil {
+			return &db.MissingKeyError{}
+		}
+
+		table, err := tableName(key.Kind())
+		if err != nil {
+			return err
+		}
+
+		if _, ok := keys[table]; !ok {
+			tables = append(tables, table)
+		}
+		keys[table] = append(keys[table], key.Encode())
+	}
+
+	for _, table := range tables {
+		for rest := keys[table]; len(rest) > 0; {
+			n := len(rest)
+			if n > maxParams {
+				n = maxParams
+			}
+
+			query := fmt.Sprintf(`DELETE FROM %s WHERE "entity_key" IN (%s)`, quote(table), placeholders(n))
+			if _, err := s.conn(ctx).ExecContext(ctx, s.rebind(query), rest[:n]...); err != nil {
+				return err
+			}
+
+			rest = rest[n:]
+		}
+	}
+
+	return nil
+}
+
+// GetAll satisfies the Store interface
+func (s *SQL) GetAll(ctx context.Context, q *Query, dst interface{}) ([]*datastore.Key, error) {
+	dv := reflect.ValueOf(dst)
+	if dv.Kind() != reflect.Ptr || dv.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("store: invalid GetAll destination %T, wanted a pointer to a slice", dst)
+	}
+	sv := dv.Elem()
+
+	fields, err := propFields(sv.Type().Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	query, args, err := s.selectQuery(q, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]*datastore.Key, 0)
+	for rows.Next() {
+		key, props, err := scanEntity(rows, fields)
+		if err != nil {
+			return nil, err
+		}
+
+		elem, ptr := newElem(sv.Type().Elem())
+		if err = loadProps(ptr.Interface(), props); err != nil {
+			return nil, err
+		}
+
+		sv.Set(reflect.Append(sv, elem))
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RunInTransaction satisfies the Store interface
+// The transaction is serializable, and is run again if it conflicts with another
+func (s *SQL) RunInTransaction(ctx context.Context, f func(ctx context.Context) error) (myerr error) {
+	if s.tx(ctx) != nil {
+		return f(ctx)
+	}
+
+	for i := 0; i < maxTxAttempts; i++ {
+		if myerr = s.runTx(ctx, f); !isConflict(myerr) {
+			return
+		}
+	}
+
+	return
+}
+
+// runTx runs f in a new transaction, committing it if f returns nil
+func (s *SQL) runTx(ctx context.Context, f func(ctx context.Context) error) (myerr error) {
+	tx, myerr := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if myerr != nil {
+		return
+	}
+
+	if myerr = f(withTx(ctx, &sqlTx{store: s, tx: tx})); myerr != nil {
+		tx.Rollback()
+		return
+	}
+
+	myerr = tx.Commit()
+
+	return
+}
+
+// isConflict returns true if the error is the database refusing a transaction
+// because of a concurrent one, which can be run again
+func isConflict(err error) bool {
+	switch e := err.(type) {
+	case sqlite3.Error:
+		return e.Code == sqlite3.ErrBusy || e.Code == sqlite3.ErrLocked
+	case *pq.Error:
+		return e.Code == serializationFailure
+	}
+
+	return false
+}
+
+// serializationFailure is the Postgres error code for a transaction that conflicted with another
+const serializationFailure = "40001"
+
+// selectQuery converts the Query into a SELECT statement and its arguments
+func (s *SQL) selectQuery(q *Query, fields []propField) (query string, args []interface{}, myerr error) {
+	table, myerr := tableName(q.kind)
+	if myerr != nil {
+		return
+	}
+
+	where := make([]string, 0)
+	args = make([]interface{}, 0)
+
+	if q.ancestor != nil {
+		path := q.ancestor.String()
+		where = append(where, `("path" = ? OR substr("path", 1, ?) = ?)`)
+		args = append(args, path, len([]rune(path))+1, path+"/")
+	}
+
+	for _, f := range q.filters {
+		where = append(where, fmt.Sprintf("%s %s ?", quote(columnName(f.field)), f.op))
+		args = append(args, toSQL(normalize(f.value)))
+	}
+
+	query = fmt.Sprintf("SELECT %s FROM %s", selectColumns(fields), quote(table))
+	if len(where) != 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	orders := make([]string, 0, len(q.orders)+1)
+	for _, o := range q.orders {
+		dir := "ASC"
+		if o.desc {
+			dir = "DESC"
+		}
+		orders = append(orders, quote(columnName(o.field))+" "+dir)
+	}
+	orders = append(orders, `"entity_key" ASC`)
+	query += " ORDER BY " + strings.Join(orders, ", ")
+
+	if q.limit > 0 {
+		query += " LIMIT " + strconv.Itoa(q.limit)
+	} else if q.offset > 0 && s.dialect == SQLite {
+		// SQLite requires a LIMIT with an OFFSET
+		query += " LIMIT -1"
+	}
+
+	if q.offset > 0 {
+		query += " OFFSET " + strconv.Itoa(q.offset)
+	}
+
+	return
+}
+
+// allocateID returns a new unique ID for an incomplete key
+func (s *SQL) allocateID(ctx context.Context) (id int64, myerr error) {
+	if tx, ok := s.sequence(ctx).(*sql.Tx); ok {
+		return nextID(ctx, tx)
+	}
+
+	tx, myerr := s.db.BeginTx(ctx, nil)
+	if myerr != nil {
+		return
+	}
+
+	if id, myerr = nextID(ctx, tx); myerr != nil {
+		tx.Rollback()
+		return
+	}
+
+	myerr = tx.Commit()
+
+	return
+}
+
+// sequence returns where the key sequence is changed: SQLite has a single writer,
+// so in the transaction the context is in, and Postgres outside of it,
+// so that transactions saving entities do not all conflict over the sequence
+func (s *SQL) sequence(ctx context.Context) execer {
+	if s.dialect == SQLite {
+		return s.conn(ctx)
+	}
+
+	return s.db
+}
+
+// nextID takes the next ID from the key sequence
+func nextID(ctx context.Context, tx *sql.Tx) (id int64, myerr error) {
+	if _, myerr = tx.ExecContext(ctx, `UPDATE "key_sequence" SET "next_id" = "next_id" + 1`); myerr != nil {
+		return
+	}
+
+	myerr = tx.QueryRowContext(ctx, `SELECT "next_id" FROM "key_sequence"`).Scan(&id)
+
+	return
+}
+
+// reserveID makes sure the given manually set ID does not get allocated later
+func (s *SQL) reserveID(ctx context.Context, id int64) error {
+	_, err := s.sequence(ctx).ExecContext(ctx, s.rebind(`UPDATE "key_sequence" SET "next_id" = ? WHERE "next_id" < ?`), id, id)
+
+	return err
+}
+
+// rebind converts the ? placeholders into the dialect placeholders
+func (s *SQL) rebind(query string) string {
+	if s.dialect != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// propField is a single property of a model as stored in the datastore
+type propField struct {
+	name    string
+	typ     reflect.Type
+	noIndex bool
+}
+
+// propFields returns the datastore properties of the given struct type
+func propFields(t reflect.Type) ([]propField, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("store: invalid entity type %v", t)
+	}
+
+	fields := make([]propField, 0)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		name, opts := f.Name, ""
+		if tag := f.Tag.Get("datastore"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+
+			parts := strings.SplitN(tag, ",", 2)
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			if len(parts) == 2 {
+				opts = parts[1]
+			}
+		}
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			inner, err := propFields(f.Type)
+			if err != nil {
+				return nil, err
+			}
+
+			fields = append(fields, inner...)
+			continue
+		}
+
+		if f.PkgPath != "" || !unicode.IsUpper([]rune(f.Name)[0]) {
+			// unexported
+			continue
+		}
+
+		switch {
+		case f.Type == keyType, f.Type == timeType:
+		case f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.Uint8:
+		case f.Type.Kind() == reflect.Slice:
+			return nil, fmt.Errorf("store: multi-valued property %s is not supported by the SQL store", f.Name)
+		case f.Type.Kind() == reflect.Struct:
+			inner, err := propFields(f.Type)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, v := range inner {
+				v.name = name + "." + v.name
+				fields = append(fields, v)
+			}
+			continue
+		}
+
+		fields = append(fields, propField{
+			name:    name,
+			typ:     f.Type,
+			noIndex: strings.Contains(opts, "noindex"),
+		})
+	}
+
+	return fields, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanEntity reads a single row selected with selectColumns
+func scanEntity(row scanner, fields []propField) (key *datastore.Key, props []datastore.Property, myerr error) {
+	var encoded string
+	vals := make([]interface{}, len(fields))
+	ptrs := make([]interface{}, len(fields)+1)
+	ptrs[0] = &encoded
+	for k := range vals {
+		ptrs[k+1] = &vals[k]
+	}
+
+	if myerr = row.Scan(ptrs...); myerr != nil {
+		return
+	}
+
+	if key, myerr = datastore.DecodeKey(encoded); myerr != nil {
+		return
+	}
+
+	props = make([]datastore.Property, 0, len(fields))
+	for k, f := range fields {
+		var v interface{}
+		if v, myerr = fromSQL(vals[k], f.typ); myerr != nil {
+			return
+		}
+
+		props = append(props, datastore.Property{
+			Name:    f.name,
+			Value:   v,
+			NoIndex: f.noIndex,
+		})
+	}
+
+	return
+}
+
+// toSQL converts a datastore property value into a database value
+func toSQL(v interface{}) interface{} {
+	switch x := v.(type) {
+	case *datastore.Key:
+		return encodeKey(x)
+	case time.Time:
+		return x.Unix()*1e6 + int64(x.Nanosecond()/1e3)
+	}
+
+	return v
+}
+
+// fromSQL converts a database value into the datastore property value for the given field type
+func fromSQL(v interface{}, t reflect.Type) (interface{}, error) {
+	if b, ok := v.([]byte); ok && t.Kind() != reflect.Slice {
+		v = string(b)
+	}
+
+	switch {
+	case t == keyType:
+		s, _ := v.(string)
+		if s == "" {
+			return (*datastore.Key)(nil), nil
+		}
+		return datastore.DecodeKey(s)
+
+	case t == timeType:
+		us, err := toInt(v)
+		if err != nil {
+			return nil, err
+		}
+		return time.Unix(us/1e6, (us%1e6)*1e3), nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		s, _ := v.(string)
+		return s, nil
+
+	case reflect.Bool:
+		switch x := v.(type) {
+		case bool:
+			return x, nil
+		case nil:
+			return false, nil
+		}
+		n, err := toInt(v)
+		return n != 0, err
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return toInt(v)
+
+	case reflect.Float32, reflect.Float64:
+		switch x := v.(type) {
+		case float64:
+			return x, nil
+		case nil:
+			return float64(0), nil
+		}
+		n, err := toInt(v)
+		return float64(n), err
+
+	case reflect.Slice:
+		b, _ := v.([]byte)
+		return b, nil
+	}
+
+	return nil, fmt.Errorf("store: unsupported property type %v", t)
+}
+
+func toInt(v interface{}) (int64, error) {
+	switch x := v.(type) {
+	case int64:
+		return x, nil
+	case nil:
+		return 0, nil
+	case string:
+		return strconv.ParseInt(x, 10, 64)
+	}
+
+	return 0, fmt.Errorf("store: can not convert %T to an integer", v)
+}
+
+func encodeKey(key *datastore.Key) interface{} {
+	if key == nil {
+		return nil
+	}
+
+	return key.Encode()
+}
+
+func selectColumns(fields []propField) string {
+	cols := make([]string, 0, len(fields)+1)
+	cols = append(cols, "entity_key")
+	for _, f := range fields {
+		cols = append(cols, columnName(f.name))
+	}
+
+	return quoteAll(cols)
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func quote(ident string) string {
+	return `"` + ident + `"`
+}
+
+func quoteAll(idents []string) string {
+	q := make([]string, len(idents))
+	for k := range idents {
+		q[k] = quote(idents[k])
+	}
+
+	return strings.Join(q, ", ")
+}
+
+// tableName converts an entity type (e.g.- ForgotToken) into its table name (e.g.- forgot_token)
+func tableName(kind string) (string, error) {
+	if kind == "" {
+		return "", fmt.Errorf("store: missing entity type")
+	}
+
+	return columnName(kind), nil
+}
+
+// columnName converts a property name (e.g.- PasswordHash) into its column name (e.g.- password_hash)
+// KeyField is the entity_key column, so keys are filtered and ordered by their encoded form
+func columnName(name string) string {
+	if name == KeyField {
+		return "entity_key"
+	}
+
+	runes := []rune(name)
+
+	var b strings.Builder
+	for k, r := range runes {
+		if r == '.' {
+			b.WriteRune('_')
+			continue
+		}
+
+		if unicode.IsUpper(r) {
+			// start a new word unless this continues an acronym (e.g.- the ID in RoomID)
+			if 0 < k && runes[k-1] != '.' && (unicode.IsLower(runes[k-1]) || (k+1 < len(runes) && unicode.IsLower(runes[k+1]))) {
+				b.WriteRune('_')
+			}
+			r = unicode.ToLower(r)
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
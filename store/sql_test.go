@@ -0,0 +1,264 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benjamw/golibs/db"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"google.golang.org/appengine/datastore"
+)
+
+func createSQLStore(t *testing.T) (context.Context, *SQL) {
+	conn, err := sql.Open("sqlite3", ":memory:?_txlock=immediate")
+	if err != nil {
+		t.Fatalf("Could not open the test database. Error: %v", err)
+	}
+	// every connection to :memory: is a new database
+	conn.SetMaxOpenConns(1)
+
+	s, err := NewSQL(conn, SQLite)
+	if err != nil {
+		t.Fatalf("NewSQL threw an error: %v", err)
+	}
+
+	if _, err = s.Migrate(context.Background()); err != nil {
+		t.Fatalf("SQL.Migrate threw an error: %v", err)
+	}
+
+	for _, stmt := range entityTable("thing", `"name" TEXT`, `"score" BIGINT`, `"created" BIGINT`) {
+		if _, err = conn.Exec(stmt); err != nil {
+			t.Fatalf("Could not create the test table. Error: %v", err)
+		}
+	}
+
+	return NewContext(context.Background(), s), s
+}
+
+func TestSQLMigrate(t *testing.T) {
+	ctx, s := createSQLStore(t)
+
+	// running it again should not do anything
+	applied, err := s.Migrate(ctx)
+	if err != nil {
+		t.Fatalf("SQL.Migrate threw an error the second time: %v", err)
+	}
+	if applied != 0 {
+		t.Fatalf("SQL.Migrate re-applied migrations. Wanted: 0; Got: %d", applied)
+	}
+}
+
+func TestSQLSaveLoad(t *testing.T) {
+	ctx, _ := createSQLStore(t)
+
+	th := createThing(ctx, t, nil, "one", 1)
+	if !th.preSaved || !th.postSaved {
+		t.Fatal("SQL.Save did not run the PreSave and PostSave hooks.")
+	}
+
+	key := th.GetKey()
+	if key == nil || key.Incomplete() {
+		t.Fatalf("SQL.Save did not complete the key. Got: %v", key)
+	}
+
+	var got thing
+	if err := Load(ctx, key, &got); err != nil {
+		t.Fatalf("SQL.Load threw an error: %v", err)
+	}
+	if got.Name != "one" || got.Score != 1 {
+		t.Fatalf("SQL.Load returned the wrong data. Got: %+v", got)
+	}
+	if !got.Created.Equal(th.Created.Truncate(time.Microsecond)) {
+		t.Fatalf("SQL.Load returned the wrong time. Wanted: %v; Got: %v", th.Created, got.Created)
+	}
+
+	// update in place
+	got.Score = 2
+	if err := Save(ctx, &got); err != nil {
+		t.Fatalf("SQL.Save threw an error when updating: %v", err)
+	}
+	if !got.GetKey().Equal(key) {
+		t.Fatalf("SQL.Save changed the key when updating. Wanted: %v; Got: %v", key, got.GetKey())
+	}
+
+	var updated thing
+	if err := Load(ctx, key, &updated); err != nil {
+		t.Fatalf("SQL.Load threw an error: %v", err)
+	}
+	if updated.Score != 2 {
+		t.Fatalf("SQL.Save did not update the entity. Got: %+v", updated)
+	}
+
+	if err := Delete(ctx, &updated); err != nil {
+		t.Fatalf("SQL.Delete threw an error: %v", err)
+	}
+
+	err := Load(ctx, key, &got)
+	if _, ok := err.(*db.UnfoundObjectError); !ok {
+		t.Fatalf("SQL.Load threw the wrong error for a deleted entity. Error: %v", err)
+	}
+}
+
+func TestSQLTransaction(t *testing.T) {
+	ctx, _ := createSQLStore(t)
+
+	checkTransaction(ctx, t, "SQL")
+}
+
+func TestSQLKeyQuery(t *testing.T) {
+	ctx, _ := createSQLStore(t)
+
+	checkKeyQuery(ctx, t, "SQL")
+}
+
+func TestSQLMulti(t *testing.T) {
+	ctx, _ := createSQLStore(t)
+
+	checkMulti(ctx, t, "SQL")
+}
+
+func TestSQLZeroValues(t *testing.T) {
+	ctx, _ := createSQLStore(t)
+
+	th := thing{}
+	if err := Save(ctx, &th); err != nil {
+		t.Fatalf("SQL.Save threw an error: %v", err)
+	}
+
+	var got thing
+	if err := Load(ctx, th.GetKey(), &got); err != nil {
+		t.Fatalf("SQL.Load threw an error: %v", err)
+	}
+	if !got.Created.IsZero() {
+		t.Fatalf("SQL.Load did not return a zero time. Got: %v", got.Created)
+	}
+}
+
+func TestSQLQuery(t *testing.T) {
+	ctx, _ := createSQLStore(t)
+
+	parent := createThing(ctx, t, nil, "parent", 0)
+	other := createThing(ctx, t, nil, "other", 0)
+
+	for i := int64(1); i <= 5; i++ {
+		createThing(ctx, t, parent.GetKey(), "child", i)
+	}
+	createThing(ctx, t, other.GetKey(), "child", 10)
+
+	var things []thing
+	keys, err := NewQuery("Thing").
+		Ancestor(parent.GetKey()).
+		Filter("Name =", "child").
+		Filter("Score >=", 2).
+		Order("-Score").
+		GetAll(ctx, &things)
+	if err != nil {
+		t.Fatalf("SQL.GetAll threw an error: %v", err)
+	}
+
+	if len(things) != 4 || len(keys) != 4 {
+		t.Fatalf("SQL.GetAll returned the wrong number of results. Wanted: 4; Got: %d", len(things))
+	}
+
+	for k := range things {
+		if want := int64(5 - k); things[k].Score != want {
+			t.Fatalf("SQL.GetAll returned the wrong order. Wanted: %d; Got: %d", want, things[k].Score)
+		}
+
+		if !keys[k].Parent().Equal(parent.GetKey()) {
+			t.Fatalf("SQL.GetAll returned an entity outside of the ancestor. Got: %v", keys[k])
+		}
+	}
+
+	var limited []*thing
+	_, err = NewQuery("Thing").
+		Filter("Name =", "child").
+		Order("Score").
+		Offset(1).
+		Limit(2).
+		GetAll(ctx, &limited)
+	if err != nil {
+		t.Fatalf("SQL.GetAll threw an error: %v", err)
+	}
+
+	if len(limited) != 2 || limited[0].Score != 2 || limited[1].Score != 3 {
+		t.Fatalf("SQL.GetAll did not apply the offset and limit. Got: %d results", len(limited))
+	}
+
+	var recent []thing
+	_, err = NewQuery("Thing").
+		Filter("Created >", time.Now().Add(-time.Hour)).
+		GetAll(ctx, &recent)
+	if err != nil {
+		t.Fatalf("SQL.GetAll threw an error: %v", err)
+	}
+
+	if len(recent) != 8 {
+		t.Fatalf("SQL.GetAll did not filter on time. Wanted: 8; Got: %d", len(recent))
+	}
+}
+
+func TestSQLManualID(t *testing.T) {
+	ctx, _ := createSQLStore(t)
+
+	th := thing{
+		Name: "manual",
+	}
+	th.SetKey(datastore.NewKey(ctx, th.EntityType(), "", 42, nil))
+	if err := Save(ctx, &th); err != nil {
+		t.Fatalf("SQL.Save threw an error: %v", err)
+	}
+
+	var got thing
+	if err := LoadInt(ctx, 42, &got); err != nil {
+		t.Fatalf("LoadInt threw an error: %v", err)
+	}
+
+	next := createThing(ctx, t, nil, "next", 0)
+	if next.GetKey().IntID() <= 42 {
+		t.Fatalf("SQL.Save allocated an ID that was already used. Got: %d", next.GetKey().IntID())
+	}
+}
+
+func TestIsConflict(t *testing.T) {
+	tests := map[error]bool{
+		sqlite3.Error{Code: sqlite3.ErrBusy}:       true,
+		sqlite3.Error{Code: sqlite3.ErrLocked}:     true,
+		sqlite3.Error{Code: sqlite3.ErrConstraint}: false,
+		&pq.Error{Code: serializationFailure}:      true,
+		&pq.Error{Code: "23505"}:                   false,
+		errors.New("could not serialize access"):   false,
+	}
+
+	for err, want := range tests {
+		if got := isConflict(err); got != want {
+			t.Fatalf("isConflict(%#v) returned %v, wanted %v", err, got, want)
+		}
+	}
+
+	if isConflict(nil) {
+		t.Fatal("isConflict returned true for no error.")
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	tests := map[string]string{
+		"Player":        "player",
+		"ForgotToken":   "forgot_token",
+		"PasswordHash":  "password_hash",
+		"ID":            "id",
+		"RoomID":        "room_id",
+		"IsAdmin":       "is_admin",
+		"Timezone.Name": "timezone_name",
+	}
+
+	for in, want := range tests {
+		if got := columnName(in); got != want {
+			t.Fatalf("columnName(%q) returned %q, wanted %q", in, got, want)
+		}
+	}
+}
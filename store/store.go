@@ -0,0 +1,260 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/benjamw/golibs/db"
+	"google.golang.org/appengine/datastore"
+)
+
+var storeContextKey = "holds the Store used for the request"
+
+var txContextKey = "holds the transaction the request is running in"
+
+// Default is the Store used when none has been attached to the context
+var Default Store = &AppEngine{}
+
+// defaultAppID is the application ID given to keys when not running on App Engine
+const defaultAppID = "dev~gogame"
+
+// Store is the persistence backend for the models
+type Store interface {
+	// Load reads the entity with the given key into m
+	// and returns an *db.UnfoundObjectError if it does not exist
+	Load(ctx context.Context, key *datastore.Key, m db.Model) error
+
+	// Save runs the PreSave hook on m, stores it, sets the
+	// completed key on m, and runs the PostSave hook
+	Save(ctx context.Context, m db.Model) error
+
+	// Delete runs the PreDelete hook on m and removes it
+	Delete(ctx context.Context, m db.Model) error
+
+	// LoadMulti reads the entities with the given keys into the models at the same index of ms like Load,
+	// reading them together instead of making a trip to the backend for each one
+	LoadMulti(ctx context.Context, keys []*datastore.Key, ms []db.Model) error
+
+	// SaveMulti saves all of ms like Save, storing them together
+	// instead of making a trip to the backend for each one
+	SaveMulti(ctx context.Context, ms []db.Model) error
+
+	// DeleteMulti removes all of ms like Delete, removing them together
+	DeleteMulti(ctx context.Context, ms []db.Model) error
+
+	// GetAll runs the given query and appends the found entities to dst,
+	// which must be a pointer to a slice of structs.
+	// The keys are returned in the same order as the entities
+	GetAll(ctx context.Context, q *Query, dst interface{}) ([]*datastore.Key, error)
+
+	// RunInTransaction runs f in a transaction, passing it a context that makes
+	// every call to the Store with it part of the transaction.
+	// The changes are committed if f returns nil, and rolled back otherwise.
+	// f may be run more than once if the transaction conflicts with another,
+	// so it should not have side effects outside of the Store.
+	// Calling RunInTransaction with a context that is already in a transaction
+	// runs f in that transaction
+	RunInTransaction(ctx context.Context, f func(ctx context.Context) error) error
+}
+
+// NewContext returns a copy of ctx that uses the given Store
+func NewContext(ctx context.Context, s Store) context.Context {
+	return context.WithValue(ctx, &storeContextKey, s)
+}
+
+// FromContext returns the Store that is stored in context, or the Default if not found
+func FromContext(ctx context.Context) Store {
+	if s, ok := ctx.Value(&storeContextKey).(Store); ok && s != nil {
+		return s
+	}
+
+	return Default
+}
+
+// setAppID makes sure datastore keys can be created outside of App Engine
+// where the application ID would otherwise be read from the metadata server
+func setAppID() {
+	if os.Getenv("GAE_APPLICATION") == "" {
+		os.Setenv("GAE_APPLICATION", defaultAppID)
+	}
+}
+
+// Load reads the entity with the given key into m using the context Store
+func Load(ctx context.Context, key *datastore.Key, m db.Model) error {
+	return FromContext(ctx).Load(ctx, key, m)
+}
+
+// LoadS reads the entity with the given encoded key into m using the context Store
+func LoadS(ctx context.Context, encoded string, m db.Model) error {
+	key, err := datastore.DecodeKey(encoded)
+	if err != nil {
+		return err
+	}
+
+	return Load(ctx, key, m)
+}
+
+// LoadInt reads the root entity with the given integer ID into m using the context Store
+func LoadInt(ctx context.Context, id int64, m db.Model) error {
+	return Load(ctx, datastore.NewKey(ctx, m.EntityType(), "", id, nil), m)
+}
+
+// Save stores m using the context Store
+func Save(ctx context.Context, m db.Model) error {
+	return FromContext(ctx).Save(ctx, m)
+}
+
+// Delete removes m using the context Store
+func Delete(ctx context.Context, m db.Model) error {
+	return FromContext(ctx).Delete(ctx, m)
+}
+
+// LoadMulti reads the entities with the given keys into ms using the context Store
+func LoadMulti(ctx context.Context, keys []*datastore.Key, ms []db.Model) error {
+	return FromContext(ctx).LoadMulti(ctx, keys, ms)
+}
+
+// SaveMulti stores all of ms using the context Store
+func SaveMulti(ctx context.Context, ms []db.Model) error {
+	return FromContext(ctx).SaveMulti(ctx, ms)
+}
+
+// DeleteMulti removes all of ms using the context Store
+func DeleteMulti(ctx context.Context, ms []db.Model) error {
+	return FromContext(ctx).DeleteMulti(ctx, ms)
+}
+
+// RunInTransaction runs f in a transaction of the context Store
+func RunInTransaction(ctx context.Context, f func(ctx context.Context) error) error {
+	return FromContext(ctx).RunInTransaction(ctx, f)
+}
+
+// withTx returns a copy of ctx that holds the given transaction of a Store
+func withTx(ctx context.Context, tx interface{}) context.Context {
+	return context.WithValue(ctx, &txContextKey, tx)
+}
+
+// txFrom returns the transaction stored in context, if any
+func txFrom(ctx context.Context) interface{} {
+	return ctx.Value(&txContextKey)
+}
+
+// KeyField is the name used to filter and order a query on the keys of the entities, the same as in the datastore
+// Each Store orders keys its own way, but filters on them in the same order
+const KeyField = "__key__"
+
+// Query is a backend independent datastore style query
+type Query struct {
+	kind     string
+	ancestor *datastore.Key
+	filters  []filter
+	orders   []order
+	limit    int
+	offset   int
+}
+
+type filter struct {
+	field string
+	op    string
+	value interface{}
+}
+
+type order struct {
+	field string
+	desc  bool
+}
+
+// NewQuery creates a new Query for the given entity type
+func NewQuery(kind string) *Query {
+	return &Query{
+		kind: kind,
+	}
+}
+
+func (q *Query) clone() *Query {
+	x := *q
+	x.filters = append([]filter(nil), q.filters...)
+	x.orders = append([]order(nil), q.orders...)
+
+	return &x
+}
+
+// Ancestor returns a derivative query limited to descendants of the given key
+func (q *Query) Ancestor(key *datastore.Key) *Query {
+	q = q.clone()
+	q.ancestor = key
+
+	return q
+}
+
+// Filter returns a derivative query with a field-based filter.
+// The filterStr argument must be a field name followed by optional space,
+// followed by an operator, one of ">", "<", ">=", "<=", or "="
+// exactly the same as datastore.Query.Filter. KeyField filters on the keys
+func (q *Query) Filter(filterStr string, value interface{}) *Query {
+	q = q.clone()
+
+	filterStr = strings.TrimSpace(filterStr)
+	field := strings.TrimRight(filterStr, " ><=!")
+	op := strings.TrimSpace(filterStr[len(field):])
+	switch op {
+	case "<", "<=", "=", ">=", ">":
+	default:
+		panic(fmt.Sprintf("store: invalid operator %q in filter %q", op, filterStr))
+	}
+
+	q.filters = append(q.filters, filter{
+		field: strings.TrimSpace(field),
+		op:    op,
+		value: value,
+	})
+
+	return q
+}
+
+// Order returns a derivative query with a field-based sort order.
+// A field name prefixed with "-" sorts in descending order, and KeyField sorts on the keys
+func (q *Query) Order(fieldName string) *Query {
+	q = q.clone()
+
+	fieldName = strings.TrimSpace(fieldName)
+	o := order{
+		field: fieldName,
+	}
+	if strings.HasPrefix(fieldName, "-") {
+		o.field = strings.TrimSpace(fieldName[1:])
+		o.desc = true
+	}
+	q.orders = append(q.orders, o)
+
+	return q
+}
+
+// Limit returns a derivative query that returns at most limit results.
+// A value of zero (or less) means unlimited
+func (q *Query) Limit(limit int) *Query {
+	q = q.clone()
+	q.limit = limit
+
+	return q
+}
+
+// Offset returns a derivative query that skips the first offset results
+func (q *Query) Offset(offset int) *Query {
+	q = q.clone()
+	q.offset = offset
+
+	return q
+}
+
+// Kind returns the entity type the query runs against
+func (q *Query) Kind() string {
+	return q.kind
+}
+
+// GetAll runs the query with the context Store
+func (q *Query) GetAll(ctx context.Context, dst interface{}) ([]*datastore.Key, error) {
+	return FromContext(ctx).GetAll(ctx, q, dst)
+}
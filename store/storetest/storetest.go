@@ -0,0 +1,62 @@
+// Package storetest holds the fixtures shared by the package tests:
+// a context with a fresh in-memory Store, and the entities most tests need saved in it
+package storetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/benjamw/golibs/password"
+	"github.com/benjamw/golibs/random"
+	"github.com/benjamw/golibs/test"
+
+	"github.com/benjamw/gogame/model"
+	"github.com/benjamw/gogame/ratelimit"
+	"github.com/benjamw/gogame/store"
+)
+
+// NewContext returns a context with an empty in-memory store and rate limiter, so every test starts from scratch
+func NewContext() context.Context {
+	return ratelimit.NewContext(store.NewContext(context.Background(), store.NewMemory()), ratelimit.NewMemory())
+}
+
+// SavePlayer saves a player with a random username, email and password
+func SavePlayer(ctx context.Context, t *testing.T) model.Player {
+	file, line, funct := test.GetCaller()
+
+	thing := model.Player{
+		Username:     random.Stringn(10),
+		Email:        random.Email(),
+		PasswordHash: password.Encode(random.Stringn(10)),
+	}
+	if err := store.Save(ctx, &thing); err != nil {
+		t.Fatalf("Could not save the test Player. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+	}
+
+	return thing
+}
+
+// SaveRoom saves a private group with a random name, and the given players as its members
+func SaveRoom(ctx context.Context, t *testing.T, members ...model.Player) model.Room {
+	file, line, funct := test.GetCaller()
+
+	thing := model.Room{
+		Name: random.Stringn(10),
+		Type: model.RoomGroup,
+	}
+	if err := store.Save(ctx, &thing); err != nil {
+		t.Fatalf("Could not save the test Room. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+	}
+
+	for _, v := range members {
+		member := model.Member{
+			RoomKey:   thing.GetKey(),
+			PlayerKey: v.GetKey(),
+		}
+		if err := store.Save(ctx, &member); err != nil {
+			t.Fatalf("Could not save the test Member. Func: %s; File: %s; Line: %d; Error: %v", funct, file, line, err)
+		}
+	}
+
+	return thing
+}